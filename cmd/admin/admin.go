@@ -17,6 +17,7 @@ var (
 var (
 	userName = flag.String("user", "admin", "admin user name")
 	pwd      = flag.String("pwd", "admin", "admin user pwd")
+	mgrToken = flag.String("mgr-token", "", "token of the manager requests to the proxies, the mgrToken of the proxies.")
 )
 
 func main() {
@@ -25,6 +26,6 @@ func main() {
 	runtime.GOMAXPROCS(*cpus)
 
 	address := []string{*etcdAddr}
-	s := server.NewAdminServer(*addr, address, *etcdPrefix, *userName, *pwd)
+	s := server.NewAdminServer(*addr, address, *etcdPrefix, *userName, *pwd, *mgrToken)
 	s.Start()
 }
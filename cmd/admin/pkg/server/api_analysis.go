@@ -44,7 +44,7 @@ func (server *AdminServer) getAnalysis() echo.HandlerFunc {
 
 		registor, _ := server.store.(model.Register)
 
-		data, err := registor.GetAnalysisPoint(proxyAddr, serverAddr, secs)
+		data, err := registor.GetAnalysisPoint(proxyAddr, server.mgrToken, serverAddr, secs)
 		if err != nil {
 			errstr = err.Error()
 			code = CodeError
@@ -71,7 +71,7 @@ func (server *AdminServer) newAnalysis() echo.HandlerFunc {
 		} else {
 			registor, _ := server.store.(model.Register)
 
-			err := registor.AddAnalysisPoint(point.ProxyAddr, point.ServerAddr, point.Secs)
+			err := registor.AddAnalysisPoint(point.ProxyAddr, server.mgrToken, point.ServerAddr, point.Secs)
 			if nil != err {
 				errstr = err.Error()
 				code = CodeError
@@ -38,7 +38,7 @@ func (server *AdminServer) changeLogLevel() echo.HandlerFunc {
 
 		registor, _ := server.store.(model.Register)
 
-		err := registor.ChangeLogLevel(addr, level)
+		err := registor.ChangeLogLevel(addr, server.mgrToken, level)
 
 		if nil != err {
 			errstr = err.Error()
@@ -23,10 +23,12 @@ type AdminServer struct {
 	addr  string
 	e     *echo.Echo
 	store model.Store
+	// mgrToken the token of the manager requests to the proxies, the MgrToken of the proxies
+	mgrToken string
 }
 
 // NewAdminServer create a AdminServer
-func NewAdminServer(addr string, etcdAddrs []string, etcdPrefix string, user string, pwd string) *AdminServer {
+func NewAdminServer(addr string, etcdAddrs []string, etcdPrefix string, user string, pwd string, mgrToken string) *AdminServer {
 	st, _ := model.NewEtcdStore(etcdAddrs, etcdPrefix)
 
 	st.GC()
@@ -37,6 +39,8 @@ func NewAdminServer(addr string, etcdAddrs []string, etcdPrefix string, user str
 		e:     echo.New(),
 		addr:  addr,
 		store: st,
+
+		mgrToken: mgrToken,
 	}
 
 	server.initHTTPServer()
@@ -17,8 +17,10 @@ function ServerCreateController($scope, $routeParams, $http, $location, $route)
             "schema": "http",
             "addr": $scope.newServerAddr,
             "checkPath": $scope.newServerCheckPath,
+            "checkExpectCode": $scope.newServerCheckExpectCode,
             "checkTimeout": $scope.newServerCheckTimeout,
             "checkDuration": $scope.newServerCheckDuration,
+            "weight": $scope.newServerWeight,
             "maxQPS": $scope.newServerMaxQPS,
             "halfToOpen": $scope.newServerHalfToOpen,
             "halfTrafficRate": $scope.newHalfTrafficRate,
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"io/ioutil"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/CodisLabs/codis/pkg/utils/log"
 	"github.com/fagongzi/gateway/conf"
@@ -15,11 +20,18 @@ import (
 	"github.com/fagongzi/gateway/proxy"
 )
 
+const (
+	routeConfigCheckInterval   = 200 * time.Millisecond
+	defaultRouteConfigDebounce = 500 * time.Millisecond
+)
+
 var (
 	cpus       = flag.Int("cpus", 1, "use cpu nums")
 	logFile    = flag.String("log-file", "", "which file to record log, if not set stdout to use.")
 	logLevel   = flag.String("log-level", "info", "log level.")
 	configFile = flag.String("config", "", "config file")
+
+	shutdownTimeout = flag.Int("shutdown-timeout", 30, "seconds to wait for the in-flight requests when stop.")
 )
 
 func main() {
@@ -49,7 +61,9 @@ func main() {
 		}()
 	}
 
-	log.Infof("conf:<%+v>", cnf)
+	// the secrets are not marshaled
+	data, _ = json.Marshal(cnf)
+	log.Infof("conf:<%s>", data)
 
 	proxyInfo := &model.ProxyInfo{
 		Conf: cnf,
@@ -68,11 +82,55 @@ func main() {
 	rt := model.NewRouteTable(store)
 	rt.Load()
 
+	if "" != cnf.RouteConfigFile {
+		loadRouteConfig(cnf, rt)
+	}
+
 	server := proxy.NewProxy(cnf, rt)
 
 	for _, filter := range cnf.Filers {
 		server.RegistryFilter(filter)
 	}
 
+	stopped := make(chan struct{})
+	go func() {
+		sc := make(chan os.Signal, 1)
+		signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM)
+		sig := <-sc
+		log.Infof("exit: signal <%s>.", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*shutdownTimeout)*time.Second)
+		defer cancel()
+
+		if err := server.Stop(ctx); nil != err {
+			log.WarnErrorf(err, "stop proxy fail.")
+		}
+		close(stopped)
+	}()
+
 	server.Start()
+	<-stopped
+}
+
+func loadRouteConfig(cnf *conf.Conf, rt *model.RouteTable) {
+	cfg, err := model.LoadRouteConfig(cnf.RouteConfigFile)
+	if nil != err {
+		log.PanicErrorf(err, "read route config file <%s> failure.", cnf.RouteConfigFile)
+	}
+
+	err = rt.Reload(cfg)
+	if nil != err {
+		log.PanicErrorf(err, "load route config file <%s> failure.", cnf.RouteConfigFile)
+	}
+
+	if !cnf.WatchRouteConfig {
+		return
+	}
+
+	debounce := time.Duration(cnf.RouteConfigDebounce) * time.Millisecond
+	if debounce <= 0 {
+		debounce = defaultRouteConfigDebounce
+	}
+
+	go rt.WatchFile(cnf.RouteConfigFile, routeConfigCheckInterval, debounce, nil)
 }
@@ -1,19 +1,98 @@
 package conf
 
-// Conf config struct
+// Conf config struct, the secrets are tagged json:"-" so they are never marshaled, e.g. the conf registered
+// to etcd and returned by the admin api, they are read from the config file by UnmarshalJSON
 type Conf struct {
 	LogLevel string `json:"-"`
 
 	Addr    string `json:"addr"`
 	MgrAddr string `json:"mgrAddr"`
+	// MgrToken Token of the manager requests on MgrAddr, only the local clients are authorized if neither MgrToken nor MgrTLSClientCAFile is set.
+	MgrToken string `json:"-"`
+	// MgrAllowRemote Listen at all interfaces if the host of MgrAddr is empty, otherwise the manager listen at localhost.
+	MgrAllowRemote bool `json:"mgrAllowRemote,omitempty"`
+	// MgrTLSCertFile Certificate file of the manager, the manager serve plain net/rpc if not set.
+	MgrTLSCertFile string `json:"mgrTLSCertFile,omitempty"`
+	// MgrTLSKeyFile Private key file of MgrTLSCertFile.
+	MgrTLSKeyFile string `json:"mgrTLSKeyFile,omitempty"`
+	// MgrTLSClientCAFile CA bundle to verify the client certificates of the manager, the mutual tls is required if set.
+	MgrTLSClientCAFile string `json:"mgrTLSClientCAFile,omitempty"`
+
+	// TLSCertFile Certificate file to terminate the inbound tls of Addr, the proxy serve plain http if not set.
+	TLSCertFile string `json:"tlsCertFile,omitempty"`
+	// TLSKeyFile Private key file of TLSCertFile.
+	TLSKeyFile string `json:"tlsKeyFile,omitempty"`
+	// TLSCerts Additional certificates, selected by the SNI of client.
+	TLSCerts []TLSCert `json:"tlsCerts,omitempty"`
+	// TLSMinVersion Minimum tls version, 1.0, 1.1, 1.2 or 1.3, default is 1.2.
+	TLSMinVersion string `json:"tlsMinVersion,omitempty"`
+	// TLSCipherSuites Cipher suites of tls 1.2 and below, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, default is the go default.
+	TLSCipherSuites []string `json:"tlsCipherSuites,omitempty"`
+	// TLSClientCAFile CA bundle to verify the client certificates, the clients must present a valid certificate if set.
+	TLSClientCAFile string `json:"tlsClientCAFile,omitempty"`
+
+	// ServerReadTimeout Maximum duration for reading the full request of client (including body), unit is second, 0 is unlimited.
+	ServerReadTimeout int `json:"serverReadTimeout"`
+	// ServerWriteTimeout Maximum duration for writing the full response to client (including body), unit is second, 0 is unlimited.
+	ServerWriteTimeout int `json:"serverWriteTimeout"`
+	// ServerIdleTimeout Maximum duration to wait for the next request of the keep-alive connections, unit is second, 0 is unlimited.
+	// The fasthttp server limits the idle connections by the read timeout, so the larger one of ServerReadTimeout and
+	// ServerIdleTimeout is used.
+	ServerIdleTimeout int `json:"serverIdleTimeout"`
+	// ServerMaxKeepaliveDuration Keep-alive connections of client are closed after this duration, unit is second, 0 is unlimited.
+	ServerMaxKeepaliveDuration int `json:"serverMaxKeepaliveDuration"`
+	// ServerMaxRequestBodySize Maximum request body size accepted from client, the larger requests are rejected, 0 is unlimited.
+	ServerMaxRequestBodySize int `json:"serverMaxRequestBodySize"`
+	// ServerConcurrency Maximum number of concurrent client connections, default is fasthttp.DefaultConcurrency.
+	ServerConcurrency int `json:"serverConcurrency"`
+	// ServerConnRateLimit Maximum number of new client connections accepted per second, the excess connections are closed,
+	// 0 is unlimited. It is checked before the tls handshake.
+	ServerConnRateLimit int `json:"serverConnRateLimit"`
+	// ServerConnRateLimitBurst Maximum burst of new client connections, default is ServerConnRateLimit.
+	ServerConnRateLimitBurst int `json:"serverConnRateLimitBurst"`
 
 	EtcdAddrs  []string `json:"etcdAddrs"`
 	EtcdPrefix string   `json:"etcdPrefix"`
 
 	Filers []string `json:"filers"`
 
+	// MaintenanceContentType Default content type of the 503 responses of the gateway and the nodes in maintenance.
+	MaintenanceContentType string `json:"maintenanceContentType,omitempty"`
+	// MaintenanceBody Default body of the 503 responses in maintenance.
+	MaintenanceBody string `json:"maintenanceBody,omitempty"`
+	// MaintenanceRetryAfter Default seconds of the Retry-After header of the responses in maintenance, 0 is not set.
+	MaintenanceRetryAfter int `json:"maintenanceRetryAfter,omitempty"`
+
+	// NormalizePathEncoding Match the routes by the path decoded until no percent-encoding remains, e.g. the double-encoded
+	// /public/..%252Fadmin is matched as /admin. The request is still forwarded with the encoding of client.
+	NormalizePathEncoding bool `json:"normalizePathEncoding,omitempty"`
+	// LowercasePath Lowercase the request path before matching and forwarding, the query string is not changed.
+	LowercasePath bool `json:"lowercasePath,omitempty"`
+	// LowercasePathPrefixes Only the paths with the prefixes are lowercased, the prefixes are case insensitive, all paths if not set.
+	LowercasePathPrefixes []string `json:"lowercasePathPrefixes,omitempty"`
+	// TrailingSlash Normalize the trailing slash of the request path before matching, strip or add, the path is not changed if not set.
+	// The node can override the normalization of the path forwarded to it.
+	TrailingSlash string `json:"trailingSlash,omitempty"`
+	// TrailingSlashRedirect Redirect the client to the normalized path instead of rewriting it, 301 for GET and HEAD, 308 for the others.
+	TrailingSlashRedirect bool `json:"trailingSlashRedirect,omitempty"`
+
+	// DefaultCluster Cluster of the requests not matched by any aggregation, routing or cluster, e.g. a fallback app or a 404 service.
+	// The requests are responded 503 if not set.
+	DefaultCluster string `json:"defaultCluster,omitempty"`
+
+	// RouteConfigFile Routing config file of clusters, servers, binds, aggregations and routings, it replaces the config loaded from etcd.
+	RouteConfigFile string `json:"routeConfigFile,omitempty"`
+	// WatchRouteConfig Reload the routes when the RouteConfigFile changed, the invalid changes are ignored.
+	WatchRouteConfig bool `json:"watchRouteConfig"`
+	// RouteConfigDebounce Duration to coalesce the rapid changes of RouteConfigFile, unit is millisecond, default is 500.
+	RouteConfigDebounce int `json:"routeConfigDebounce"`
+
 	// Maximum number of connections which may be established to server
 	MaxConns int `json:"maxConns"`
+	// MaxConnsPerHost Maximum number of connections to every backend server, default is MaxConns.
+	MaxConnsPerHost int `json:"maxConnsPerHost"`
+	// MaxConnWaitTimeout Maximum duration to wait for a free connection if MaxConnsPerHost is reached, unit is millisecond, 0 is fail immediately.
+	MaxConnWaitTimeout int `json:"maxConnWaitTimeout"`
 	// MaxConnDuration Keep-alive connections are closed after this duration.
 	MaxConnDuration int `json:"maxConnDuration"`
 	// MaxIdleConnDuration Idle keep-alive connections are closed after this duration.
@@ -28,9 +107,197 @@ type Conf struct {
 	WriteTimeout int `json:"writeTimeout"`
 	// MaxResponseBodySize Maximum response body size.
 	MaxResponseBodySize int `json:"maxResponseBodySize"`
+	// MaxRequestBodySize Maximum request body size forward to server, the node can override it.
+	MaxRequestBodySize int `json:"maxRequestBodySize"`
+
+	// Streaming copy the response body to client incrementally, not buffer the whole body. Merge request never streaming.
+	// The streaming body is stopped at MaxResponseBodySize and MaxBodySize, except the server-sent events.
+	Streaming bool `json:"streaming"`
+	// BodyBufferSize Bytes of the whole body buffered in memory by the filters, e.g. the transform of the streaming response,
+	// the bigger body spill to a temp file, default is 1MB.
+	BodyBufferSize int `json:"bodyBufferSize,omitempty"`
+	// BodyBufferDir Dir of the temp files of the spilled bodies, default is the temp dir of os.
+	BodyBufferDir string `json:"bodyBufferDir,omitempty"`
+	// FlushInterval Interval to flush the streaming response to client, unit is millisecond, 0 is flush only the buffer is full.
+	FlushInterval int `json:"flushInterval"`
+
+	// MaxRetries Maximum retry times to other servers when proxy fail, only idempotent requests retry.
+	MaxRetries int `json:"maxRetries"`
+	// RetryBackoff Base backoff before retry, unit is millisecond, double every retry.
+	RetryBackoff int `json:"retryBackoff"`
+	// RetryAfterCooldown Stop routing to the server for the Retry-After of its 429 or 503 response.
+	RetryAfterCooldown bool `json:"retryAfterCooldown"`
+	// MaxRetryAfterCooldown Maximum cooldown of the server by Retry-After, unit is second, default is 60.
+	MaxRetryAfterCooldown int `json:"maxRetryAfterCooldown"`
+
+	// MaxBodySize Maximum response body size used by max-body filter, the node can override it.
+	MaxBodySize int `json:"maxBodySize"`
+
+	// GzipMinSize Minimum response body size to compress by gzip filter.
+	GzipMinSize int `json:"gzipMinSize"`
+	// GzipContentTypes Response content-type prefixes compressed by gzip filter, default is text, json, javascript and xml.
+	GzipContentTypes []string `json:"gzipContentTypes"`
+
+	// RateLimit Requests per second of every client ip used by client-rate-limit filter, the node can override it.
+	RateLimit int `json:"rateLimit"`
+	// RateLimitBurst Maximum burst requests of every client ip used by client-rate-limit filter, default is RateLimit.
+	RateLimitBurst int `json:"rateLimitBurst"`
+	// TrustXForwardedFor Use the first ip of X-Forwarded-For header as the client ip.
+	TrustXForwardedFor bool `json:"trustXForwardedFor"`
+	// TrustedProxies CIDRs of the trusted proxies, e.g. the load balancers. If set, the X-Forwarded-For header is walked
+	// from the right skipping the trusted proxies to find the client ip, only if the remote ip is trusted.
+	TrustedProxies []string `json:"trustedProxies"`
+	// ForwardedFormat Format of the forwarded headers sent to backend servers, x-forwarded, forwarded (RFC 7239) or both,
+	// default is x-forwarded.
+	ForwardedFormat string `json:"forwardedFormat,omitempty"`
+
+	// HopHeaders Headers removed from the requests to backend servers and the responses to clients by head filter,
+	// besides the hop-by-hop headers of RFC 7230 and the headers listed in the Connection header.
+	HopHeaders []string `json:"hopHeaders"`
+
+	// PathBlackList Regexps of the request paths denied by blacklist filter with 403.
+	PathBlackList []string `json:"pathBlackList"`
+	// PathWhiteList Regexps of the request paths allowed by blacklist filter, the other paths are responded 404 if set.
+	PathWhiteList []string `json:"pathWhiteList"`
+
+	// JWTSecret HMAC secret used by jwt filter.
+	JWTSecret string `json:"-"`
+	// JWTPublicKeyFile RSA public key PEM file used by jwt filter.
+	JWTPublicKeyFile string `json:"jwtPublicKeyFile"`
+	// JWTClaims Claims copied to the runtime vars as "jwt.<claim>" by jwt filter.
+	JWTClaims []string `json:"jwtClaims"`
+	// JWTSkipPaths Path prefixes skip the validation of jwt filter, matched on the segment boundary.
+	JWTSkipPaths []string `json:"jwtSkipPaths"`
+
+	// BasicAuthUsers Users of basicauth filter, user -> bcrypt hash of the password, e.g. $2a$10$... generated by
+	// htpasswd -nbB user password. Every request is verified by the hash, the cost of it is the latency added.
+	BasicAuthUsers map[string]string `json:"-"`
+	// BasicAuthRealm Realm of the WWW-Authenticate header responded by basicauth filter, default is gateway.
+	BasicAuthRealm string `json:"basicAuthRealm"`
+	// BasicAuthSkipPaths Path prefixes skip the authentication of basicauth filter, matched on the segment boundary.
+	BasicAuthSkipPaths []string `json:"basicAuthSkipPaths"`
+
+	// APIKeyHeader Header of the api key used by apikey filter, default is X-Api-Key.
+	APIKeyHeader string `json:"apiKeyHeader"`
+	// APIKeyQuery Query param of the api key used by apikey filter, if the header is not set.
+	APIKeyQuery string `json:"apiKeyQuery"`
+	// APIKeys Static api keys, api key -> account id.
+	APIKeys map[string]string `json:"-"`
+	// APIKeyValidateURL External validation endpoint, GET with query param key, a valid key is responsed 200 with {"accountId": "id"}.
+	APIKeyValidateURL string `json:"apiKeyValidateURL"`
+	// APIKeyCacheTTL Cache duration of the external validation results, unit is second, default is 60.
+	APIKeyCacheTTL int `json:"apiKeyCacheTTL"`
+	// APIKeyValidateRate Maximum external validation calls per second, 0 is unlimited.
+	APIKeyValidateRate int `json:"apiKeyValidateRate"`
+
+	// OAuthIntrospectURL RFC 7662 token introspection endpoint used by oauth-introspect filter.
+	OAuthIntrospectURL string `json:"oauthIntrospectURL"`
+	// OAuthClientID Client id to authenticate to the introspection endpoint by basic auth.
+	OAuthClientID string `json:"oauthClientID"`
+	// OAuthClientSecret Client secret to authenticate to the introspection endpoint by basic auth.
+	OAuthClientSecret string `json:"-"`
+	// OAuthIntrospectCacheTTL Cache duration of the introspection results, unit is second, default is 30,
+	// the active result is not cached after the token expired.
+	OAuthIntrospectCacheTTL int `json:"oauthIntrospectCacheTTL"`
+	// OAuthIntrospectFailOpen Pass the requests if the introspection endpoint fail, the requests are responsed 503 if not set.
+	OAuthIntrospectFailOpen bool `json:"oauthIntrospectFailOpen"`
+	// OAuthClaims Members of the active introspection response copied to the runtime vars as "oauth.<claim>",
+	// besides scope, client_id, username and sub.
+	OAuthClaims []string `json:"oauthClaims"`
+
+	// AuthzScopeVars Runtime vars of the scopes and roles checked by authz filter, the values are separated by spaces
+	// or commas, or the json arrays. Default is oauth.scope, jwt.scope, jwt.scp and jwt.roles.
+	AuthzScopeVars []string `json:"authzScopeVars"`
+
+	// HMACSecret Secret of the request signatures verified by hmac-verify filter, the signature is the hex encoded
+	// HMAC-SHA256 of "<method>\n<request uri>\n<timestamp>\n<body>", the request uri is the path and the query string.
+	HMACSecret string `json:"-"`
+	// HMACSignatureHeader Header of the request signature, default is X-Signature, the "sha256=" prefix is allowed.
+	HMACSignatureHeader string `json:"hmacSignatureHeader"`
+	// HMACTimestampHeader Header of the request unix timestamp in seconds, default is X-Timestamp.
+	HMACTimestampHeader string `json:"hmacTimestampHeader"`
+	// HMACTolerance Maximum difference between the request timestamp and now to prevent the replay attacks,
+	// unit is second, default is 300.
+	HMACTolerance int `json:"hmacTolerance"`
+
+	// AccessLogSampleRate Rate of the requests logged by access-log filter, between 0 and 1, 0 is log all requests.
+	AccessLogSampleRate float64 `json:"accessLogSampleRate"`
+	// AccessLogBodyOnError Log the response body of backend server only if the proxy fail.
+	AccessLogBodyOnError bool `json:"accessLogBodyOnError"`
+	// AccessLogFormat Format of access-log filter, text or json, default is text.
+	AccessLogFormat string `json:"accessLogFormat"`
+	// AccessLogFilterTimings Record the duration of each filter, logged by access-log filter, the filters are not timed if not set.
+	AccessLogFilterTimings bool `json:"accessLogFilterTimings"`
+	// SlowRequestThreshold Requests slower than this are logged with the timing breakdown as warn, regardless of the access log sampling,
+	// unit is millisecond, 0 is disabled.
+	SlowRequestThreshold int `json:"slowRequestThreshold"`
+
+	// CORSAllowOrigins Origins allowed by cors filter, "*" allow all, "*.example.com" allow the subdomains.
+	CORSAllowOrigins []string `json:"corsAllowOrigins"`
+	// CORSAllowMethods Methods allowed by cors filter, default is GET, HEAD and POST.
+	CORSAllowMethods []string `json:"corsAllowMethods"`
+	// CORSAllowHeaders Request headers allowed by cors filter, default allow the headers requested.
+	CORSAllowHeaders []string `json:"corsAllowHeaders"`
+	// CORSExposeHeaders Response headers exposed to the browser by cors filter.
+	CORSExposeHeaders []string `json:"corsExposeHeaders"`
+	// CORSAllowCredentials Allow the browser send the credentials.
+	CORSAllowCredentials bool `json:"corsAllowCredentials"`
+	// CORSMaxAge Duration the preflight result is cached by the browser, unit is second.
+	CORSMaxAge int `json:"corsMaxAge"`
+
+	// CacheTTL Duration the responses are cached by cache filter, unit is second, the node can override it, 0 is not cache.
+	CacheTTL int `json:"cacheTTL"`
+	// CacheMaxSize Maximum bytes of the responses cached, the least recently used are evicted, default is 64MB.
+	CacheMaxSize int `json:"cacheMaxSize"`
+	// CacheKeyHeaders Request headers used as the cache key besides the method and uri, e.g. Accept-Encoding.
+	CacheKeyHeaders []string `json:"cacheKeyHeaders"`
+
+	// SingleFlightKeyHeaders Request headers used as the key of single-flight filter besides the method and uri, e.g. Authorization.
+	SingleFlightKeyHeaders []string `json:"singleFlightKeyHeaders"`
+
+	// IdempotencyTTL Duration the first response of an Idempotency-Key is replayed by idempotency filter, unit is second, default is 3600.
+	IdempotencyTTL int `json:"idempotencyTTL"`
+	// IdempotencyMethods Methods of the requests handled by idempotency filter, default is POST and PATCH.
+	IdempotencyMethods []string `json:"idempotencyMethods"`
+	// IdempotencyMaxSize Maximum bytes of the responses stored by idempotency filter, default is 64MB.
+	IdempotencyMaxSize int `json:"idempotencyMaxSize"`
+
+	// AffinitySecret HMAC secret to sign the affinity cookies of nodes, a random secret is used if not set,
+	// then the cookies are invalid after restart.
+	AffinitySecret string `json:"-"`
+
+	// MetricsAddr Addr of the prometheus metrics endpoint "/metrics", if not set, the metrics is not exposed.
+	MetricsAddr string `json:"metricsAddr,omitempty"`
+
+	// GRPCAddr Addr of the h2c listener of gRPC nodes, if not set, the gRPC calls are not proxied.
+	GRPCAddr string `json:"grpcAddr,omitempty"`
+
+	// EnableTracing Propagate the W3C trace context to backend servers, a new trace is started if the request has no trace context.
+	EnableTracing bool `json:"enableTracing"`
+
+	// ErrorResponses The bodies of the gateway error responses by the status code or class, e.g. "503" or "5xx",
+	// the status code is used before the class. The error responses have no body if not set.
+	ErrorResponses map[string]ErrorResponse `json:"errorResponses,omitempty"`
+
+	// RequestIDPattern The pattern of X-Request-Id supplied by client, a new id is generated if not match.
+	RequestIDPattern string `json:"requestIdPattern,omitempty"`
 
 	// EnablePPROF enable pprof
 	EnablePPROF bool `json:"enablePPROF"`
 	// PPROFAddr pprof addr
 	PPROFAddr string `json:"pprofAddr,omitempty"`
 }
+
+// ErrorResponse the body template of error response, the ${request_id}, ${status}, ${error} and ${reason} in Body are replaced,
+// the ${error} is the status text, the ${reason} is the error of gateway.
+// The values are escaped as json strings if ContentType is json.
+type ErrorResponse struct {
+	ContentType string `json:"contentType"`
+	Body        string `json:"body"`
+}
+
+// TLSCert certificate and private key files
+type TLSCert struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
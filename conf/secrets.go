@@ -0,0 +1,38 @@
+package conf
+
+import (
+	"encoding/json"
+)
+
+// secrets the secret fields of Conf in the config file
+type secrets struct {
+	MgrToken          string            `json:"mgrToken"`
+	JWTSecret         string            `json:"jwtSecret"`
+	BasicAuthUsers    map[string]string `json:"basicAuthUsers"`
+	APIKeys           map[string]string `json:"apiKeys"`
+	OAuthClientSecret string            `json:"oauthClientSecret"`
+	HMACSecret        string            `json:"hmacSecret"`
+	AffinitySecret    string            `json:"affinitySecret"`
+}
+
+// UnmarshalJSON read the conf and the secrets from the config file
+func (c *Conf) UnmarshalJSON(data []byte) error {
+	type plain Conf
+	if err := json.Unmarshal(data, (*plain)(c)); nil != err {
+		return err
+	}
+
+	s := &secrets{}
+	if err := json.Unmarshal(data, s); nil != err {
+		return err
+	}
+
+	c.MgrToken = s.MgrToken
+	c.JWTSecret = s.JWTSecret
+	c.BasicAuthUsers = s.BasicAuthUsers
+	c.APIKeys = s.APIKeys
+	c.OAuthClientSecret = s.OAuthClientSecret
+	c.HMACSecret = s.HMACSecret
+	c.AffinitySecret = s.AffinitySecret
+	return nil
+}
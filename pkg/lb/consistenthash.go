@@ -0,0 +1,157 @@
+package lb
+
+import (
+	"container/list"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// DefaultReplicas default virtual nodes of every server in the hash ring
+	DefaultReplicas = 160
+)
+
+// KeyLoadBalance the loadBalance select the server by the key of request
+type KeyLoadBalance interface {
+	LoadBalance
+	SelectByKey(key []byte, servers *list.List) int
+}
+
+// AddrServer the server has a unique addr, used as the key of server in hash ring
+type AddrServer interface {
+	GetAddr() string
+}
+
+// ConsistentHash consistent hash loadBalance impl, the requests of the same key select the same server,
+// only the keys of the removed server are remapped if the servers changed
+type ConsistentHash struct {
+	sync.Mutex
+	replicas int
+	ring     *hashRing
+}
+
+// NewConsistentHash create a ConsistentHash with the default replicas
+func NewConsistentHash() LoadBalance {
+	return NewConsistentHashWithReplicas(DefaultReplicas)
+}
+
+// NewConsistentHashWithReplicas create a ConsistentHash, every server has replicas virtual nodes in the hash ring
+func NewConsistentHashWithReplicas(replicas int) LoadBalance {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+
+	return &ConsistentHash{
+		replicas: replicas,
+		ring:     &hashRing{},
+	}
+}
+
+// Select select a server from servers by the hash of request path
+func (ch *ConsistentHash) Select(req *fasthttp.Request, servers *list.List) int {
+	return ch.SelectByKey(req.URI().Path(), servers)
+}
+
+// SelectByKey select a server from servers by the hash of key
+func (ch *ConsistentHash) SelectByKey(key []byte, servers *list.List) int {
+	if 0 >= servers.Len() {
+		return -1
+	}
+
+	addrs := make([]string, 0, servers.Len())
+	for iter := servers.Front(); iter != nil; iter = iter.Next() {
+		addrs = append(addrs, getAddr(iter.Value))
+	}
+
+	h := fnv.New32a()
+	h.Write(key)
+	return ch.getRing(addrs).get(h.Sum32())
+}
+
+// getRing returns the hash ring of servers, the ring is rebuilt if the servers changed
+func (ch *ConsistentHash) getRing(addrs []string) *hashRing {
+	ch.Lock()
+	defer ch.Unlock()
+
+	if !ch.ring.sameAddrs(addrs) {
+		ch.ring = newHashRing(addrs, ch.replicas)
+	}
+
+	return ch.ring
+}
+
+type hashRing struct {
+	addrs   []string
+	hashes  []uint32
+	indexes []int
+}
+
+func newHashRing(addrs []string, replicas int) *hashRing {
+	ring := &hashRing{
+		addrs: addrs,
+	}
+
+	points := make(map[uint32]int, len(addrs)*replicas)
+	for index, addr := range addrs {
+		for i := 0; i < replicas; i++ {
+			sum := md5.Sum([]byte(addr + "#" + strconv.Itoa(i)))
+			hash := binary.BigEndian.Uint32(sum[:4])
+
+			// the collided point belongs to the smaller addr, independent of the servers order
+			if prev, ok := points[hash]; !ok || addr < addrs[prev] {
+				points[hash] = index
+			}
+		}
+	}
+
+	for hash := range points {
+		ring.hashes = append(ring.hashes, hash)
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+
+	ring.indexes = make([]int, len(ring.hashes))
+	for i, hash := range ring.hashes {
+		ring.indexes[i] = points[hash]
+	}
+
+	return ring
+}
+
+func (ring *hashRing) sameAddrs(addrs []string) bool {
+	if len(ring.addrs) != len(addrs) {
+		return false
+	}
+
+	for i, addr := range addrs {
+		if ring.addrs[i] != addr {
+			return false
+		}
+	}
+
+	return true
+}
+
+// get returns the index of server, the first point clockwise from the hash
+func (ring *hashRing) get(hash uint32) int {
+	i := sort.Search(len(ring.hashes), func(i int) bool { return ring.hashes[i] >= hash })
+	if i == len(ring.hashes) {
+		i = 0
+	}
+
+	return ring.indexes[i]
+}
+
+func getAddr(value interface{}) string {
+	if svr, ok := value.(AddrServer); ok {
+		return svr.GetAddr()
+	}
+
+	return fmt.Sprintf("%p", value)
+}
@@ -0,0 +1,71 @@
+package lb
+
+import (
+	"container/list"
+	"fmt"
+	"testing"
+)
+
+type addrServer string
+
+func (s addrServer) GetAddr() string {
+	return string(s)
+}
+
+func selectAddrs(ch KeyLoadBalance, servers *list.List, keys int) map[string]string {
+	addrs := make(map[string]string)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		index := ch.SelectByKey([]byte(key), servers)
+
+		e := servers.Front()
+		for ; index > 0; index-- {
+			e = e.Next()
+		}
+		addrs[key] = e.Value.(AddrServer).GetAddr()
+	}
+
+	return addrs
+}
+
+func TestConsistentHashRemap(t *testing.T) {
+	servers := list.New()
+	for i := 0; i < 5; i++ {
+		servers.PushBack(addrServer(fmt.Sprintf("127.0.0.1:%d", 8080+i)))
+	}
+
+	ch := NewConsistentHash().(KeyLoadBalance)
+	keys := 10000
+	before := selectAddrs(ch, servers, keys)
+
+	counts := make(map[string]int)
+	for _, addr := range before {
+		counts[addr]++
+	}
+	for addr, count := range counts {
+		if count < keys/10 || count > keys*3/10 {
+			t.Errorf("%s expect about:<%d>, acture:<%d>", addr, keys/5, count)
+		}
+	}
+
+	removed := servers.Remove(servers.Front().Next()).(AddrServer).GetAddr()
+	after := selectAddrs(ch, servers, keys)
+
+	for key, addr := range before {
+		if addr == removed {
+			if after[key] == removed {
+				t.Errorf("%s expect remapped, acture:<%s>", key, after[key])
+			}
+		} else if after[key] != addr {
+			t.Errorf("%s expect:<%s>, acture:<%s>", key, addr, after[key])
+		}
+	}
+
+	// the order of servers is not matter
+	servers.PushBack(addrServer(removed))
+	for key, addr := range selectAddrs(ch, servers, keys) {
+		if before[key] != addr {
+			t.Errorf("%s expect:<%s>, acture:<%s>", key, before[key], addr)
+		}
+	}
+}
@@ -9,16 +9,29 @@ import (
 const (
 	// ROUNDROBIN round robin
 	ROUNDROBIN = "ROUNDROBIN"
+	// WEIGHTROBIN weight round robin
+	WEIGHTROBIN = "WEIGHTROBIN"
+	// LEASTCONNECTION least connection
+	LEASTCONNECTION = "LEASTCONNECTION"
+	// CONSISTENTHASH consistent hash
+	CONSISTENTHASH = "CONSISTENTHASH"
+)
+
+const (
+	fullWeightRate = 100
 )
 
 var (
-	supportLbs = []string{ROUNDROBIN}
+	supportLbs = []string{ROUNDROBIN, WEIGHTROBIN, LEASTCONNECTION, CONSISTENTHASH}
 )
 
 var (
 	// LBS map loadBalance name and process function
 	LBS = map[string]func() LoadBalance{
-		ROUNDROBIN: NewRoundRobin,
+		ROUNDROBIN:      NewRoundRobin,
+		WEIGHTROBIN:     NewWeightRobin,
+		LEASTCONNECTION: NewLeastConnection,
+		CONSISTENTHASH:  NewConsistentHash,
 	}
 )
 
@@ -27,12 +40,51 @@ type LoadBalance interface {
 	Select(req *fasthttp.Request, servers *list.List) int
 }
 
+// Server the backend server info used by loadBalance
+type Server interface {
+	GetWeight() int
+	GetActiveConns() int64
+}
+
+// SlowStartServer the backend server ramps up its weight after it becomes healthy
+type SlowStartServer interface {
+	// GetWeightRate returns the rate of the weight in percent, between 1 and 100
+	GetWeightRate() int
+}
+
 // GetSupportLBS return supported loadBalances
 func GetSupportLBS() []string {
 	return supportLbs
 }
 
-// NewLoadBalance create a LoadBalance
+// NewLoadBalance create a LoadBalance, if name is unknown, use ROUNDROBIN
 func NewLoadBalance(name string) LoadBalance {
-	return LBS[name]()
+	if fn, ok := LBS[name]; ok {
+		return fn()
+	}
+
+	return LBS[ROUNDROBIN]()
+}
+
+// getWeight returns the weight scaled by the rate of slow start,
+// the gcd of the weights keeps the ratio if no server is in the slow start
+func getWeight(value interface{}) int {
+	weight := 1
+	if svr, ok := value.(Server); ok && svr.GetWeight() > 0 {
+		weight = svr.GetWeight()
+	}
+
+	if svr, ok := value.(SlowStartServer); ok {
+		return weight * svr.GetWeightRate()
+	}
+
+	return weight * fullWeightRate
+}
+
+func getActiveConns(value interface{}) int64 {
+	if svr, ok := value.(Server); ok {
+		return svr.GetActiveConns()
+	}
+
+	return 0
 }
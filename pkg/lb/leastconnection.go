@@ -0,0 +1,53 @@
+package lb
+
+import (
+	"container/list"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+// LeastConnection least connection loadBalance impl
+type LeastConnection struct {
+	ops *uint64
+}
+
+// NewLeastConnection create a LeastConnection
+func NewLeastConnection() LoadBalance {
+	var ops uint64
+	ops = 0
+
+	return LeastConnection{
+		ops: &ops,
+	}
+}
+
+// Select select a server from servers which has the least active connections,
+// if some servers has the same active connections, using RoundRobin
+func (lc LeastConnection) Select(req *fasthttp.Request, servers *list.List) int {
+	l := servers.Len()
+
+	if 0 >= l {
+		return -1
+	}
+
+	conns := make([]int64, l)
+	i := 0
+	for iter := servers.Front(); iter != nil; iter = iter.Next() {
+		conns[i] = getActiveConns(iter.Value)
+		i++
+	}
+
+	start := int(atomic.AddUint64(lc.ops, 1) % uint64(l))
+	selected := start
+
+	for i := 1; i < l; i++ {
+		index := (start + i) % l
+
+		if conns[index] < conns[selected] {
+			selected = index
+		}
+	}
+
+	return selected
+}
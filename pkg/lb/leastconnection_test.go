@@ -0,0 +1,58 @@
+package lb
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestLeastConnectionSelect(t *testing.T) {
+	slow := &testServer{}
+	fast := &testServer{}
+
+	servers := list.New()
+	servers.PushBack(slow)
+	servers.PushBack(fast)
+
+	lb := NewLeastConnection()
+	req := &fasthttp.Request{}
+
+	counts := make([]int, servers.Len())
+	for i := 0; i < 1000; i++ {
+		// slow backend responsed every 100 requests
+		if i%100 == 0 {
+			slow.active = 0
+		}
+
+		// fast backend responsed before next request
+		index := lb.Select(req, servers)
+		counts[index]++
+
+		if index == 0 {
+			slow.active++
+		}
+	}
+
+	if counts[0] >= counts[1]/10 {
+		t.Errorf("slow backend expect fewer requests, slow:<%d>, fast:<%d>", counts[0], counts[1])
+	}
+}
+
+func TestLeastConnectionSelectWithSameConns(t *testing.T) {
+	servers := list.New()
+	servers.PushBack(&testServer{})
+	servers.PushBack(&testServer{})
+
+	lb := NewLeastConnection()
+	req := &fasthttp.Request{}
+
+	counts := make([]int, servers.Len())
+	for i := 0; i < 100; i++ {
+		counts[lb.Select(req, servers)]++
+	}
+
+	if counts[0] != 50 || counts[1] != 50 {
+		t.Errorf("expect:<50,50>, acture:<%d,%d>", counts[0], counts[1])
+	}
+}
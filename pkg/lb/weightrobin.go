@@ -0,0 +1,78 @@
+package lb
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// WeightRobin weight round robin loadBalance impl
+type WeightRobin struct {
+	lock   *sync.Mutex
+	index  int
+	weight int
+	gcd    int
+}
+
+// NewWeightRobin create a WeightRobin
+func NewWeightRobin() LoadBalance {
+	return &WeightRobin{
+		lock:  &sync.Mutex{},
+		index: -1,
+	}
+}
+
+// Select select a server from servers using WeightRobin
+func (w *WeightRobin) Select(req *fasthttp.Request, servers *list.List) int {
+	l := servers.Len()
+
+	if 0 >= l {
+		return -1
+	}
+
+	weights := make([]int, l)
+	max := 0
+	i := 0
+	for iter := servers.Front(); iter != nil; iter = iter.Next() {
+		weights[i] = getWeight(iter.Value)
+
+		if weights[i] > max {
+			max = weights[i]
+		}
+
+		i++
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.gcd = weights[0]
+	for _, weight := range weights[1:] {
+		w.gcd = gcd(w.gcd, weight)
+	}
+
+	for {
+		w.index = (w.index + 1) % l
+
+		if w.index == 0 {
+			w.weight -= w.gcd
+
+			if w.weight <= 0 {
+				w.weight = max
+			}
+		}
+
+		if weights[w.index] >= w.weight {
+			return w.index
+		}
+	}
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
@@ -0,0 +1,108 @@
+package lb
+
+import (
+	"container/list"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+type testServer struct {
+	weight int
+	active int64
+}
+
+func (s *testServer) GetWeight() int {
+	return s.weight
+}
+
+func (s *testServer) GetActiveConns() int64 {
+	return s.active
+}
+
+func TestWeightRobinSelect(t *testing.T) {
+	servers := list.New()
+	servers.PushBack(&testServer{weight: 1})
+	servers.PushBack(&testServer{weight: 2})
+	servers.PushBack(&testServer{weight: 3})
+
+	lb := NewWeightRobin()
+	req := &fasthttp.Request{}
+
+	total := 10000
+	counts := make([]int, servers.Len())
+	for i := 0; i < total; i++ {
+		counts[lb.Select(req, servers)]++
+	}
+
+	for index, weight := range []int{1, 2, 3} {
+		expect := total * weight / 6
+		diff := counts[index] - expect
+
+		if diff < 0 {
+			diff = -diff
+		}
+
+		if diff > total/100 {
+			t.Errorf("server <%d> expect:<%d>, acture:<%d>", index, expect, counts[index])
+		}
+	}
+}
+
+func TestWeightRobinSelectWithNoServers(t *testing.T) {
+	lb := NewWeightRobin()
+
+	if lb.Select(&fasthttp.Request{}, list.New()) != -1 {
+		t.Error("expect -1 with no servers")
+	}
+}
+
+func TestNewLoadBalanceDefault(t *testing.T) {
+	if _, ok := NewLoadBalance("").(RoundRobin); !ok {
+		t.Error("expect RoundRobin with empty name")
+	}
+}
+
+type testSlowStartServer struct {
+	testServer
+	rate int
+}
+
+func (s *testSlowStartServer) GetWeightRate() int {
+	return s.rate
+}
+
+func TestWeightRobinSlowStart(t *testing.T) {
+	warm := &testSlowStartServer{testServer: testServer{weight: 1}, rate: 100}
+	fresh := &testSlowStartServer{testServer: testServer{weight: 1}}
+
+	servers := list.New()
+	servers.PushBack(warm)
+	servers.PushBack(fresh)
+
+	lb := NewWeightRobin()
+	req := &fasthttp.Request{}
+
+	prev := -1
+	for _, rate := range []int{1, 10, 50, 100} {
+		fresh.rate = rate
+
+		total := 10000
+		count := 0
+		for i := 0; i < total; i++ {
+			if lb.Select(req, servers) == 1 {
+				count++
+			}
+		}
+
+		if count <= prev {
+			t.Errorf("rate <%d> expect the share increased, prev:<%d>, acture:<%d>", rate, prev, count)
+		}
+
+		expect := total * rate / (100 + rate)
+		if diff := count - expect; diff > total/100 || diff < -total/100 {
+			t.Errorf("rate <%d> expect:<%d>, acture:<%d>", rate, expect, count)
+		}
+		prev = count
+	}
+}
@@ -0,0 +1,375 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// ContentType the content type of text exposition format
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+	// DefaultMaxSeries the default max series of a metric vec
+	DefaultMaxSeries = 1024
+	// OverflowLabelValue the label value of the series exceeds the max series
+	OverflowLabelValue = "other"
+)
+
+var (
+	// DefaultBuckets the default buckets of histogram in seconds
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	labelValueEscaper = strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`)
+)
+
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry metrics registry, support prometheus text exposition format
+type Registry struct {
+	sync.RWMutex
+	metrics []metric
+}
+
+// NewRegistry create a registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounterVec create and register a counter vec
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec: newVec(name, help, "counter", labels)}
+	r.register(v)
+	return v
+}
+
+// NewGaugeVec create and register a gauge vec
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{vec: newVec(name, help, "gauge", labels)}
+	r.register(v)
+	return v
+}
+
+// NewHistogramVec create and register a histogram vec, the buckets must be sorted
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	v := &HistogramVec{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	r.register(v)
+	return v
+}
+
+func (r *Registry) register(m metric) {
+	r.Lock()
+	r.metrics = append(r.metrics, m)
+	r.Unlock()
+}
+
+// Export write all metrics in text exposition format
+func (r *Registry) Export(w io.Writer) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, m := range r.metrics {
+		m.write(w)
+	}
+}
+
+// ServeHTTP http handler of metrics
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	buf := &bytes.Buffer{}
+	r.Export(buf)
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Write(buf.Bytes())
+}
+
+// vec the series of a metric, the series more than maxSeries are merged to the overflow series
+type vec struct {
+	sync.RWMutex
+	name      string
+	help      string
+	kind      string
+	labels    []string
+	maxSeries int
+	series    map[string]interface{}
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	return vec{
+		name:      name,
+		help:      help,
+		kind:      kind,
+		labels:    labels,
+		maxSeries: DefaultMaxSeries,
+		series:    make(map[string]interface{}),
+	}
+}
+
+func (v *vec) get(values []string, create func() interface{}) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, but got %d values", v.name, len(v.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	v.RLock()
+	s, ok := v.series[key]
+	v.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.Lock()
+	defer v.Unlock()
+
+	if s, ok = v.series[key]; ok {
+		return s
+	}
+
+	if len(v.series) >= v.maxSeries {
+		overflow := make([]string, len(values))
+		for i := range overflow {
+			overflow[i] = OverflowLabelValue
+		}
+		key = strings.Join(overflow, "\xff")
+
+		if s, ok = v.series[key]; ok {
+			return s
+		}
+	}
+
+	s = create()
+	v.series[key] = s
+	return s
+}
+
+// each call fn with the sorted series
+func (v *vec) each(fn func(labels string, s interface{})) {
+	v.RLock()
+	defer v.RUnlock()
+
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fn(v.formatLabels(key), v.series[key])
+	}
+}
+
+func (v *vec) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+func (v *vec) formatLabels(key string) string {
+	if len(v.labels) == 0 {
+		return ""
+	}
+
+	values := strings.Split(key, "\xff")
+	pairs := make([]string, len(v.labels))
+	for i, label := range v.labels {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", label, labelValueEscaper.Replace(values[i]))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// value a float64 value
+type value struct {
+	sync.Mutex
+	v float64
+}
+
+func (v *value) add(delta float64) {
+	v.Lock()
+	v.v += delta
+	v.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.Lock()
+	defer v.Unlock()
+	return v.v
+}
+
+// Counter a monotonically increasing counter
+type Counter struct {
+	value
+}
+
+// Inc increase 1
+func (c *Counter) Inc() {
+	c.add(1)
+}
+
+// Add add the delta, the delta must be positive
+func (c *Counter) Add(delta float64) {
+	if delta > 0 {
+		c.add(delta)
+	}
+}
+
+// Value return current value
+func (c *Counter) Value() float64 {
+	return c.get()
+}
+
+// CounterVec counters partitioned by labels
+type CounterVec struct {
+	vec
+}
+
+// With return the counter of the label values
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.get(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (v *CounterVec) write(w io.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, s interface{}) {
+		writeSample(w, v.name, labels, s.(*Counter).Value())
+	})
+}
+
+// Gauge a value can go up and down
+type Gauge struct {
+	value
+}
+
+// Inc increase 1
+func (g *Gauge) Inc() {
+	g.add(1)
+}
+
+// Dec decrease 1
+func (g *Gauge) Dec() {
+	g.add(-1)
+}
+
+// Value return current value
+func (g *Gauge) Value() float64 {
+	return g.get()
+}
+
+// GaugeVec gauges partitioned by labels
+type GaugeVec struct {
+	vec
+}
+
+// With return the gauge of the label values
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.get(values, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+func (v *GaugeVec) write(w io.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, s interface{}) {
+		writeSample(w, v.name, labels, s.(*Gauge).Value())
+	})
+}
+
+// Histogram count the observations in buckets
+type Histogram struct {
+	sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe add a observation
+func (h *Histogram) Observe(v float64) {
+	h.Lock()
+	defer h.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += v
+}
+
+// Count return the count of observations
+func (h *Histogram) Count() uint64 {
+	h.Lock()
+	defer h.Unlock()
+	return h.count
+}
+
+// HistogramVec histograms partitioned by labels
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// With return the histogram of the label values
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.get(values, func() interface{} {
+		return &Histogram{
+			buckets: v.buckets,
+			counts:  make([]uint64, len(v.buckets)),
+		}
+	}).(*Histogram)
+}
+
+func (v *HistogramVec) write(w io.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, s interface{}) {
+		h := s.(*Histogram)
+		h.Lock()
+		defer h.Unlock()
+
+		for i, upper := range h.buckets {
+			writeSample(w, v.name+"_bucket", joinLabels(labels, "le=\""+formatFloat(upper)+"\""), float64(h.counts[i]))
+		}
+		writeSample(w, v.name+"_bucket", joinLabels(labels, `le="+Inf"`), float64(h.count))
+		writeSample(w, v.name+"_sum", labels, h.sum)
+		writeSample(w, v.name+"_count", labels, float64(h.count))
+	})
+}
+
+func joinLabels(labels, label string) string {
+	if "" == labels {
+		return label
+	}
+
+	return labels + "," + label
+}
+
+func writeSample(w io.Writer, name, labels string, v float64) {
+	if "" == labels {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(v))
+		return
+	}
+
+	fmt.Fprintf(w, "%s{%s} %s\n", name, labels, formatFloat(v))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
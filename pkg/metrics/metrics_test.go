@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Total requests.", "code")
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1})
+
+	requests.With("200").Inc()
+	requests.With("200").Inc()
+	requests.With("502").Inc()
+	latency.With().Observe(0.5)
+
+	buf := &bytes.Buffer{}
+	r.Export(buf)
+
+	expect := `# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{code="200"} 2
+requests_total{code="502"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 0
+latency_seconds_bucket{le="1"} 1
+latency_seconds_bucket{le="+Inf"} 1
+latency_seconds_sum 0.5
+latency_seconds_count 1
+`
+	if buf.String() != expect {
+		t.Errorf("expect:<%s>, acture:<%s>", expect, buf.String())
+	}
+}
+
+func TestMaxSeries(t *testing.T) {
+	r := NewRegistry()
+	gauge := r.NewGaugeVec("gauge", "Gauge.", "key")
+	gauge.maxSeries = 2
+
+	gauge.With("a").Inc()
+	gauge.With("b").Inc()
+	gauge.With("c").Inc()
+	gauge.With("d").Inc()
+
+	if len(gauge.series) != 3 {
+		t.Errorf("expect:<3>, acture:<%d>", len(gauge.series))
+	}
+
+	if value := gauge.With("e").Value(); value != 2 {
+		t.Errorf("expect:<2>, acture:<%v>", value)
+	}
+
+	buf := &bytes.Buffer{}
+	r.Export(buf)
+	if !strings.Contains(buf.String(), `gauge{key="other"} 2`) {
+		t.Errorf("expect overflow series, acture:<%s>", buf.String())
+	}
+}
+
+func TestRollingHistogram(t *testing.T) {
+	h := NewRollingHistogram(time.Minute, 6)
+	now := time.Unix(1000, 0)
+
+	if q := h.quantileAt(0.5, now); q != 0 {
+		t.Errorf("expect:<0>, acture:<%s>", q)
+	}
+
+	for i := 1; i <= 100; i++ {
+		h.observeAt(time.Duration(i)*time.Millisecond, now)
+	}
+
+	// the estimation is the upper bound of the bucket, less than 19% more than the real value
+	for _, c := range []struct {
+		q      float64
+		expect time.Duration
+	}{{q: 0.5, expect: 50 * time.Millisecond}, {q: 0.99, expect: 99 * time.Millisecond}} {
+		if value := h.quantileAt(c.q, now); value < c.expect || value > c.expect*119/100 {
+			t.Errorf("expect:<%s>, acture:<%s>", c.expect, value)
+		}
+	}
+
+	// the expired slots are out of the window
+	h.observeAt(time.Second, now.Add(time.Minute))
+	if value := h.quantileAt(0.5, now.Add(time.Minute)); value < time.Second || value > time.Second*119/100 {
+		t.Errorf("expect:<%s>, acture:<%s>", time.Second, value)
+	}
+}
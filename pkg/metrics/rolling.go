@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	rollingBucketCount = 80
+	rollingBucketBase  = 100 * time.Microsecond
+)
+
+// the upper bounds of the rolling histogram buckets, 4 buckets per doubling from 100us to about 88s
+var rollingBounds = newRollingBounds()
+
+func newRollingBounds() []time.Duration {
+	bounds := make([]time.Duration, rollingBucketCount)
+	for i := range bounds {
+		bounds[i] = time.Duration(float64(rollingBucketBase) * math.Pow(2, float64(i)/4))
+	}
+
+	return bounds
+}
+
+// RollingHistogram the histogram of the durations observed in the recent window, used to estimate the quantiles.
+// The window is divided to slots, the expired slot is reset when it is reused.
+type RollingHistogram struct {
+	sync.Mutex
+	slot   time.Duration
+	epochs []int64
+	counts [][]uint64
+}
+
+// NewRollingHistogram create a rolling histogram of the window divided to slots
+func NewRollingHistogram(window time.Duration, slots int) *RollingHistogram {
+	h := &RollingHistogram{
+		slot:   window / time.Duration(slots),
+		epochs: make([]int64, slots),
+		counts: make([][]uint64, slots),
+	}
+
+	for i := range h.counts {
+		h.counts[i] = make([]uint64, rollingBucketCount+1)
+		h.epochs[i] = -1
+	}
+
+	return h
+}
+
+// Observe add a observation at now
+func (h *RollingHistogram) Observe(d time.Duration) {
+	h.observeAt(d, time.Now())
+}
+
+func (h *RollingHistogram) observeAt(d time.Duration, now time.Time) {
+	bucket := rollingBucketCount
+	for i, upper := range rollingBounds {
+		if d <= upper {
+			bucket = i
+			break
+		}
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	epoch := now.UnixNano() / int64(h.slot)
+	index := int(epoch % int64(len(h.epochs)))
+	if h.epochs[index] != epoch {
+		h.epochs[index] = epoch
+		for i := range h.counts[index] {
+			h.counts[index][i] = 0
+		}
+	}
+
+	h.counts[index][bucket]++
+}
+
+// Quantile returns the upper bound of the bucket of the quantile in the window, 0 if no observation
+func (h *RollingHistogram) Quantile(q float64) time.Duration {
+	return h.quantileAt(q, time.Now())
+}
+
+func (h *RollingHistogram) quantileAt(q float64, now time.Time) time.Duration {
+	h.Lock()
+	defer h.Unlock()
+
+	epoch := now.UnixNano() / int64(h.slot)
+	counts := make([]uint64, rollingBucketCount+1)
+	var total uint64
+	for index, slotEpoch := range h.epochs {
+		if slotEpoch < 0 || epoch-slotEpoch >= int64(len(h.epochs)) {
+			continue
+		}
+
+		for i, count := range h.counts[index] {
+			counts[i] += count
+			total += count
+		}
+	}
+
+	if 0 == total {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var cumulative uint64
+	for i, count := range counts {
+		cumulative += count
+		if cumulative >= rank {
+			if i == rollingBucketCount {
+				break
+			}
+
+			return rollingBounds[i]
+		}
+	}
+
+	return rollingBounds[rollingBucketCount-1]
+}
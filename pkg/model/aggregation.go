@@ -1,27 +1,608 @@
 package model
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"regexp"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/CodisLabs/codis/pkg/utils/atomic2"
 	"github.com/valyala/fasthttp"
 )
 
+const (
+	// SchemeHTTPS the https scheme of node
+	SchemeHTTPS = "https"
+
+	// TransportFastHTTP the HTTP/1.1 transport of fasthttp, the default transport of node
+	TransportFastHTTP = "fasthttp"
+	// TransportHTTP2 the HTTP/2 transport of net/http, for the HTTP/2 only backend servers
+	TransportHTTP2 = "http2"
+)
+
+var (
+	// ErrInvalidCAFile the CA file has no certificates
+	ErrInvalidCAFile = errors.New("invalid CA file")
+	// ErrInvalidCanaryPercent the canary percent is not in [0, 100]
+	ErrInvalidCanaryPercent = errors.New("invalid canary percent")
+	// ErrInvalidMirrorPercent the mirror percent is not in [0, 100]
+	ErrInvalidMirrorPercent = errors.New("invalid mirror percent")
+	// ErrInvalidFaultPercent the delay or abort percent of fault is not in [0, 100]
+	ErrInvalidFaultPercent = errors.New("invalid fault percent")
+	// ErrInvalidTransport the transport is not fasthttp or http2
+	ErrInvalidTransport = errors.New("invalid transport")
+)
+
+var (
+	// tlsConfigs the shared tls configs of the nodes by the tls options
+	tlsConfigs sync.Map
+)
+
 // Node aggregation node struct
 type Node struct {
 	ClusterName string `json:"clusterName,omitempty"`
 	URL         string `json:"url,omitempty"`
 	Rewrite     string `json:"rewrite,omitempty"`
 	AttrName    string `json:"attrName,omitempty"`
+	// RewritePattern the regexp of request path, the matched path is rewritten to RewriteTo, e.g. ^/api/v1/(.*)$
+	RewritePattern string `json:"rewritePattern,omitempty"`
+	// RewriteTo the path rewritten to, support the capture groups, e.g. /$1
+	RewriteTo string `json:"rewriteTo,omitempty"`
+	// RewriteQuery the RewritePattern match the path with query string, and RewriteTo replace the query string,
+	// otherwise the query string of request is preserved
+	RewriteQuery bool `json:"rewriteQuery,omitempty"`
+	// Scheme the scheme to connect the backend servers of node, http or https, default is http
+	Scheme string `json:"scheme,omitempty"`
+	// InsecureSkipVerify skip the verification of the https backend server certificates
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	// CAFile the CA bundle to verify the https backend server certificates, default is the system roots
+	CAFile string `json:"caFile,omitempty"`
+	// ServerName the SNI and the name to verify of the https backend servers, default is the host of server addr
+	ServerName string `json:"serverName,omitempty"`
+	// Transport the transport to the backend servers of node, fasthttp or http2, default is fasthttp,
+	// the http2 transport use h2c if the scheme is http
+	Transport string `json:"transport,omitempty"`
+	// GRPC the node is a gRPC service proxied by the gRPC listener, the url pattern match /service/method
+	GRPC bool `json:"grpc,omitempty"`
+	// HostHeader the host header forward to the node, the backend server addr is still used to connect
+	HostHeader string `json:"hostHeader,omitempty"`
+	// StripPrefix the path prefix removed from the request path, e.g. /svc-a/users -> /users
+	StripPrefix string `json:"stripPrefix,omitempty"`
+	// AddPrefix the path prefix added to the request path after StripPrefix
+	AddPrefix string `json:"addPrefix,omitempty"`
+	// TrailingSlash the trailing slash normalization of the path forwarded to the node, strip, add or keep,
+	// it overrides the global normalization, if not set, use the global normalization
+	TrailingSlash string `json:"trailingSlash,omitempty"`
+	// RewriteLocation the Location header of the redirect responses pointing to the backend server is rewritten
+	// to the gateway host, the StripPrefix and AddPrefix are reversed
+	RewriteLocation bool `json:"rewriteLocation,omitempty"`
+	// CookieRewrite the rules to rewrite the Domain, Path and the security attributes of the Set-Cookie headers
+	CookieRewrite *CookieRewrite `json:"cookieRewrite,omitempty"`
+	// Timeout the timeout of backend server round trip, if not set, use the global timeout
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// MaxBodySize the max response body size of backend server, used by max-body filter
+	MaxBodySize int `json:"maxBodySize,omitempty"`
+	// MaxRequestBodySize the max request body size forward to the node, if not set, use the global limit
+	MaxRequestBodySize int `json:"maxRequestBodySize,omitempty"`
+	// RateLimit requests per second of every client ip, used by client-rate-limit filter
+	RateLimit int `json:"rateLimit,omitempty"`
+	// RateLimitBurst maximum burst requests of every client ip, used by client-rate-limit filter
+	RateLimitBurst int `json:"rateLimitBurst,omitempty"`
+	// MaxConcurrency maximum concurrent requests to the node, the excess requests are rejected
+	MaxConcurrency int `json:"maxConcurrency,omitempty"`
+	// MaxConcurrencyQueue maximum requests waiting for the concurrency of the node
+	MaxConcurrencyQueue int `json:"maxConcurrencyQueue,omitempty"`
+	// MaxConcurrencyWait maximum duration of the request waiting for the concurrency of the node
+	MaxConcurrencyWait time.Duration `json:"maxConcurrencyWait,omitempty"`
+	// CacheTTL the duration the responses of node are cached by cache filter, if not set, use the global ttl
+	CacheTTL time.Duration `json:"cacheTTL,omitempty"`
+	// Canary split the traffic of node to the canary cluster by percent
+	Canary *CanarySplit `json:"canary,omitempty"`
+	// Mirror copy the requests of node to the shadow cluster by percent, the shadow responses are discarded
+	Mirror *MirrorConfig `json:"mirror,omitempty"`
+	// Affinity route the requests of a client to the same server by the affinity cookie
+	Affinity *SessionAffinity `json:"affinity,omitempty"`
+	// Mock the canned response of node, the mocked node is responded by mock filter without backend servers
+	Mock *MockResponse `json:"mock,omitempty"`
+	// Fault the delay and abort injected by fault filter, used to test the resilience of clients
+	Fault *FaultInjection `json:"fault,omitempty"`
+	// IPFilter the allowlist and denylist of the client ip, used by ip-filter filter
+	IPFilter *IPFilter `json:"ipFilter,omitempty"`
+	// BasicAuth the requests of node are authenticated by basicauth filter
+	BasicAuth bool `json:"basicAuth,omitempty"`
+	// RequiredScopes the scopes required by authz filter, the AND/OR expression, e.g. "read AND (write OR admin)"
+	RequiredScopes string `json:"requiredScopes,omitempty"`
+	// ClaimHeaders the jwt claims injected to the request headers, claim name -> header name
+	ClaimHeaders map[string]string `json:"claimHeaders,omitempty"`
+	// RequestHeaders the rules to change the request headers forward to the node, used by headers filter
+	RequestHeaders *HeaderRules `json:"requestHeaders,omitempty"`
+	// ResponseHeaders the rules to change the response headers of the node, used by headers filter
+	ResponseHeaders *HeaderRules `json:"responseHeaders,omitempty"`
+	// RequestTransform the template to rewrite the request body forward to the node, used by transform filter
+	RequestTransform *BodyTransform `json:"requestTransform,omitempty"`
+	// ResponseTransform the template to rewrite the response body of the node, used by transform filter
+	ResponseTransform *BodyTransform `json:"responseTransform,omitempty"`
+	// RequestValidation the required params, headers and json schema of the client requests, used by validate-request filter
+	RequestValidation *RequestValidation `json:"requestValidation,omitempty"`
+	// ResponseValidation the json schema to validate the responses of the node, used by validate-response filter
+	ResponseValidation *SchemaValidation `json:"responseValidation,omitempty"`
+	// ErrorPages the pages of the error responses by the status code or class, e.g. "503" or "5xx",
+	// the 4xx and 5xx responses of the backend servers are replaced too
+	ErrorPages map[string]*ErrorPage `json:"errorPages,omitempty"`
+	// HeaderRoutes the requests are sent to the cluster of the first matched route by the headers,
+	// the requests not matched are sent to the cluster of node and its canary split
+	HeaderRoutes []*HeaderRoute `json:"headerRoutes,omitempty"`
+	// QueryRoutes the requests are sent to the cluster of the first matched route by the query params,
+	// the header routes are matched before
+	QueryRoutes []*QueryRoute `json:"queryRoutes,omitempty"`
+	// MatchMethods the node is selected only for the requests of the methods, e.g. GET, all methods if not set
+	MatchMethods []string `json:"matchMethods,omitempty"`
+	// Produces the content types produced by the node, e.g. application/json. The requests are sent to the node
+	// of the best match of the Accept header among the nodes with the produced types, 406 if nothing matches
+	Produces []string `json:"produces,omitempty"`
+	// Methods the OPTIONS and HEAD handling of node at gateway, used by method filter
+	Methods *MethodRules `json:"methods,omitempty"`
+	// Maintenance the node is in maintenance, the requests are responded 503 without calling the backend servers
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+	// Filters the names of the registered filters executed for the node in the order, all registered filters in the registry order if not set
+	Filters []string `json:"filters,omitempty"`
+	// DisabledFilters the names of the registered filters skipped for the node
+	DisabledFilters []string `json:"disabledFilters,omitempty"`
+
+	rewriteRegexp   *regexp.Regexp
+	scopeExpr       scopeExpr
+	tlsOnce         sync.Once
+	tlsConfig       *tls.Config
+	tlsErr          error
+	concurrencyOnce sync.Once
+	concurrency     chan struct{}
+	waiting         atomic2.Int64
+	stats           statsHolder
+}
+
+// CanarySplit split the traffic between the cluster of node and the canary cluster
+type CanarySplit struct {
+	// ClusterName the canary cluster
+	ClusterName string `json:"clusterName,omitempty"`
+	// Percent the percent of the requests to the canary cluster, 0 - 100
+	Percent int `json:"percent,omitempty"`
+	// StickyHeader the requests with the same header value go to the same cluster
+	StickyHeader string `json:"stickyHeader,omitempty"`
+	// StickyCookie the requests with the same cookie value go to the same cluster, used if the header is not set
+	StickyCookie string `json:"stickyCookie,omitempty"`
+}
+
+// MirrorConfig the shadow traffic of node
+type MirrorConfig struct {
+	// ClusterName the shadow cluster
+	ClusterName string `json:"clusterName,omitempty"`
+	// Percent the percent of the requests mirrored to the shadow cluster, 0 - 100
+	Percent int `json:"percent,omitempty"`
+}
+
+// SessionAffinity the cookie of server affinity, the cookie value is signed by the proxy
+type SessionAffinity struct {
+	// CookieName the name of affinity cookie, default is GATEWAY_AFFINITY
+	CookieName string `json:"cookieName,omitempty"`
+	// Path the path of affinity cookie, default is /
+	Path string `json:"path,omitempty"`
+	// MaxAge the max age of affinity cookie, 0 is a session cookie
+	MaxAge time.Duration `json:"maxAge,omitempty"`
+}
+
+// FaultInjection the faults of fault filter, the delay and abort are chosen independently
+type FaultInjection struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Delay the duration the request is delayed before proxy
+	Delay time.Duration `json:"delay,omitempty"`
+	// DelayPercent the percent of the requests delayed, 0 - 100
+	DelayPercent int `json:"delayPercent,omitempty"`
+	// AbortStatusCode the status code responded to the aborted request, default is 503
+	AbortStatusCode int `json:"abortStatusCode,omitempty"`
+	// AbortPercent the percent of the requests aborted without backend servers, 0 - 100
+	AbortPercent int `json:"abortPercent,omitempty"`
+}
+
+// MockResponse the canned response of mock filter
+type MockResponse struct {
+	Enabled    bool              `json:"enabled,omitempty"`
+	StatusCode int               `json:"statusCode,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	// BodyFile the file of body, used if the body is not set
+	BodyFile string `json:"bodyFile,omitempty"`
+}
+
+// IsHTTP2 returns true if the node use the HTTP/2 transport
+func (n *Node) IsHTTP2() bool {
+	return TransportHTTP2 == n.Transport
+}
+
+// IsMocked returns true if the node is responded by the mock response
+func (n *Node) IsMocked() bool {
+	return nil != n.Mock && n.Mock.Enabled
+}
+
+// SelectCluster returns the cluster of the request, and true if it is the canary cluster.
+// The header routes and the query routes are matched first in order.
+// The request with the sticky header or cookie is split by the hash of value, others are split randomly.
+func (n *Node) SelectCluster(req *fasthttp.Request) (string, bool) {
+	for _, route := range n.HeaderRoutes {
+		if route.Matches(req) {
+			return route.ClusterName, false
+		}
+	}
+
+	for _, route := range n.QueryRoutes {
+		if route.Matches(req) {
+			return route.ClusterName, false
+		}
+	}
+
+	if nil == n.Canary || n.Canary.Percent <= 0 {
+		return n.ClusterName, false
+	}
+
+	var key []byte
+	if "" != n.Canary.StickyHeader {
+		key = req.Header.Peek(n.Canary.StickyHeader)
+	}
+	if len(key) == 0 && "" != n.Canary.StickyCookie {
+		key = req.Header.Cookie(n.Canary.StickyCookie)
+	}
+
+	var bucket int
+	if len(key) > 0 {
+		h := fnv.New32a()
+		h.Write(key)
+		bucket = int(h.Sum32() % 100)
+	} else {
+		bucket = rand.Intn(100)
+	}
+
+	if bucket < n.Canary.Percent {
+		return n.Canary.ClusterName, true
+	}
+
+	return n.ClusterName, false
+}
+
+// ShouldMirror returns true if the request is mirrored to the shadow cluster
+func (n *Node) ShouldMirror() bool {
+	return nil != n.Mirror && n.Mirror.Percent > 0 && rand.Intn(100) < n.Mirror.Percent
+}
+
+// RewriteURI returns the request uri rewritten by RewritePattern, returns false if not match
+func (n *Node) RewriteURI(req *fasthttp.Request) (string, bool) {
+	if nil == n.rewriteRegexp {
+		return "", false
+	}
+
+	value := req.URI().Path()
+	if n.RewriteQuery {
+		value = req.URI().RequestURI()
+	}
+
+	match := n.rewriteRegexp.FindSubmatchIndex(value)
+	if nil == match {
+		return "", false
+	}
+
+	uri := n.rewriteRegexp.Expand(nil, []byte(n.RewriteTo), value, match)
+	if !n.RewriteQuery {
+		if query := req.URI().QueryString(); len(query) > 0 {
+			uri = append(append(uri, '?'), query...)
+		}
+	}
+
+	return string(uri), true
+}
+
+// TLSConfig returns the tls config to connect the backend servers, nil if the scheme is not https
+func (n *Node) TLSConfig() (*tls.Config, error) {
+	if SchemeHTTPS != n.Scheme {
+		return nil, nil
+	}
+
+	n.tlsOnce.Do(func() {
+		n.tlsConfig, n.tlsErr = n.newTLSConfig()
+	})
+
+	return n.tlsConfig, n.tlsErr
+}
+
+// newTLSConfig returns the tls config of the options of node, the nodes with the same options share the config,
+// so the conns kept by the config are reused by the nodes loaded again, and the configs are not grown by the reloads.
+func (n *Node) newTLSConfig() (*tls.Config, error) {
+	var data []byte
+	if "" != n.CAFile {
+		value, err := ioutil.ReadFile(n.CAFile)
+		if nil != err {
+			return nil, err
+		}
+		data = value
+	}
+
+	key := fmt.Sprintf("%t/%s/%x", n.InsecureSkipVerify, n.ServerName, sha256.Sum256(data))
+	if config, ok := tlsConfigs.Load(key); ok {
+		return config.(*tls.Config), nil
+	}
+
+	config := &tls.Config{
+		InsecureSkipVerify: n.InsecureSkipVerify,
+		ServerName:         n.ServerName,
+	}
+
+	if len(data) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, ErrInvalidCAFile
+		}
+	}
+
+	actual, _ := tlsConfigs.LoadOrStore(key, config)
+	return actual.(*tls.Config), nil
+}
+
+// HasPrefixRewrite returns true if the node has StripPrefix or AddPrefix
+func (n *Node) HasPrefixRewrite() bool {
+	return "" != n.StripPrefix || "" != n.AddPrefix
+}
+
+// PrefixPath returns the path with StripPrefix removed and AddPrefix added,
+// the prefix is stripped only on the segment boundary.
+func (n *Node) PrefixPath(path string) string {
+	strip := strings.TrimSuffix(n.StripPrefix, "/")
+	if "" != strip && strings.HasPrefix(path, strip) {
+		rest := path[len(strip):]
+		if "" == rest || '/' == rest[0] {
+			path = rest
+		}
+	}
+
+	path = strings.TrimSuffix(n.AddPrefix, "/") + path
+	if "" == path {
+		return "/"
+	}
+
+	return path
+}
+
+// ReversePrefixPath returns the request path of the backend path, AddPrefix is removed and StripPrefix is added back,
+// the path without AddPrefix is not changed
+func (n *Node) ReversePrefixPath(path string) string {
+	add := strings.TrimSuffix(n.AddPrefix, "/")
+	if "" != add {
+		if !strings.HasPrefix(path, add) {
+			return path
+		}
+
+		rest := path[len(add):]
+		if "" != rest && '/' != rest[0] {
+			return path
+		}
+		path = rest
+	}
+
+	path = strings.TrimSuffix(n.StripPrefix, "/") + path
+	if "" == path {
+		return "/"
+	}
+
+	return path
+}
+
+// MatchesMethod returns true if the node is selected for the method of req
+func (n *Node) MatchesMethod(req *fasthttp.Request) bool {
+	if len(n.MatchMethods) == 0 {
+		return true
+	}
+
+	method := req.Header.Method()
+	for _, m := range n.MatchMethods {
+		if bytes.EqualFold(method, []byte(m)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stats returns the request stats of node
+func (n *Node) Stats() *RequestStats {
+	return n.stats.get()
+}
+
+// compile compile the regexp of node
+func (n *Node) compile() error {
+	n.rewriteRegexp = nil
+
+	if nil != n.Canary && (n.Canary.Percent < 0 || n.Canary.Percent > 100) {
+		return ErrInvalidCanaryPercent
+	}
+
+	if nil != n.Mirror && (n.Mirror.Percent < 0 || n.Mirror.Percent > 100) {
+		return ErrInvalidMirrorPercent
+	}
+
+	if nil != n.Fault && (n.Fault.DelayPercent < 0 || n.Fault.DelayPercent > 100 ||
+		n.Fault.AbortPercent < 0 || n.Fault.AbortPercent > 100) {
+		return ErrInvalidFaultPercent
+	}
+
+	for _, route := range n.HeaderRoutes {
+		if nil == route {
+			return ErrInvalidHeaderMatch
+		}
+
+		if err := route.compile(); nil != err {
+			return err
+		}
+	}
+
+	for _, route := range n.QueryRoutes {
+		if nil == route {
+			return ErrInvalidParamMatch
+		}
+
+		if err := route.compile(); nil != err {
+			return err
+		}
+	}
+
+	if err := validateErrorPages(n.ErrorPages); nil != err {
+		return err
+	}
+
+	n.scopeExpr = nil
+	if "" != n.RequiredScopes {
+		expr, err := compileScopeExpr(n.RequiredScopes)
+		if nil != err {
+			return err
+		}
+		n.scopeExpr = expr
+	}
+
+	if nil != n.CookieRewrite {
+		if err := n.CookieRewrite.validate(); nil != err {
+			return err
+		}
+	}
+
+	if nil != n.IPFilter {
+		if err := n.IPFilter.compile(); nil != err {
+			return err
+		}
+	}
+
+	for _, transform := range []*BodyTransform{n.RequestTransform, n.ResponseTransform} {
+		if nil != transform {
+			if err := transform.compile(); nil != err {
+				return err
+			}
+		}
+	}
+
+	if !IsValidTrailingSlash(n.TrailingSlash) {
+		return ErrInvalidTrailingSlash
+	}
+
+	if nil != n.RequestValidation {
+		if err := n.RequestValidation.compile(); nil != err {
+			return err
+		}
+	}
+
+	if nil != n.ResponseValidation {
+		if err := n.ResponseValidation.compile(); nil != err {
+			return err
+		}
+	}
+
+	if "" != n.Transport && TransportFastHTTP != n.Transport && TransportHTTP2 != n.Transport {
+		return ErrInvalidTransport
+	}
+
+	if "" == n.RewritePattern {
+		return nil
+	}
+
+	reg, err := regexp.Compile(n.RewritePattern)
+	if nil != err {
+		return err
+	}
+
+	n.rewriteRegexp = reg
+	return nil
+}
+
+// HeaderRules the rules to change headers, applied in order: remove, rename, add, add if absent.
+// The values to add may reference variables, e.g. ${client_ip}, ${jwt.sub}
+type HeaderRules struct {
+	Add    map[string]string `json:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+	// Rename old name -> new name
+	Rename map[string]string `json:"rename,omitempty"`
+	// AddIfAbsent the headers are added only if not set, e.g. the default Cache-Control of the responses
+	AddIfAbsent map[string]string `json:"addIfAbsent,omitempty"`
+}
+
+// AcquireConcurrency acquire a concurrency of the node, returns false if the node reach the MaxConcurrency,
+// if the MaxConcurrencyQueue is set, wait at most MaxConcurrencyWait. The concurrency acquired must be released.
+func (n *Node) AcquireConcurrency() bool {
+	if n.MaxConcurrency <= 0 {
+		return true
+	}
+
+	n.concurrencyOnce.Do(func() {
+		n.concurrency = make(chan struct{}, n.MaxConcurrency)
+	})
+
+	select {
+	case n.concurrency <- struct{}{}:
+		return true
+	default:
+	}
+
+	if n.MaxConcurrencyQueue <= 0 || n.MaxConcurrencyWait <= 0 {
+		return false
+	}
+
+	defer n.waiting.Decr()
+	if n.waiting.Incr() > int64(n.MaxConcurrencyQueue) {
+		return false
+	}
+
+	timer := time.NewTimer(n.MaxConcurrencyWait)
+	defer timer.Stop()
+
+	select {
+	case n.concurrency <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// ReleaseConcurrency release the concurrency acquired
+func (n *Node) ReleaseConcurrency() {
+	if n.MaxConcurrency > 0 {
+		<-n.concurrency
+	}
 }
 
 // Aggregation aggregation struct
 // a aggregation container a url and some nodes
 type Aggregation struct {
-	URL     string         `json:"url"`
-	Nodes   []*Node        `json:"nodes"`
-	Pattern *regexp.Regexp `json:"-"`
+	URL string `json:"url"`
+	// Path the path template matched instead of the URL regexp, e.g. /users/{id}/orders or /static/*file,
+	// the params are the runtime vars path.{name}, and replace the {name} of the node rewrite.
+	// The URL is the key of aggregation, it is the Path if not set.
+	Path  string  `json:"path,omitempty"`
+	Nodes []*Node `json:"nodes"`
+	// Merge the merge of the sub-responses of nodes, default is {"attrName": body} and fail if any node failed
+	Merge *MergeConfig `json:"merge,omitempty"`
+	// Priority the aggregation of the highest priority is selected if the request matches more than one,
+	// the ties are broken by the longer literal prefix of url, then the config order
+	Priority int            `json:"priority,omitempty"`
+	Pattern  *regexp.Regexp `json:"-"`
+
+	rank routeRank
+	path *pathTemplate
+	// prefix the literal prefix of the anchored URL pattern, used to index the aggregation
+	prefix   string
+	anchored bool
 }
 
 // UnMarshalAggregation unmarshal
@@ -56,11 +637,15 @@ func (a *Aggregation) Marshal() []byte {
 	return v
 }
 
-func (a *Aggregation) getNodeURL(req *fasthttp.Request, node *Node) string {
+func (a *Aggregation) getNodeURL(req *fasthttp.Request, node *Node, params map[string]string) string {
 	if node.Rewrite == "" {
 		return node.URL
 	}
 
+	if nil != a.path {
+		return expandPathParams(node.Rewrite, params)
+	}
+
 	return a.Pattern.ReplaceAllString(string(req.URI().RequestURI()), node.Rewrite)
 }
 
@@ -68,7 +653,69 @@ func (a *Aggregation) matches(req *fasthttp.Request) bool {
 	return a.Pattern.Match(req.URI().RequestURI())
 }
 
-func (a *Aggregation) updateFrom(ang *Aggregation) {
-	a.URL = ang.URL
-	a.Nodes = ang.Nodes
+// hasMethodNode returns true if any node is selected for the method of req,
+// the aggregation without the node of request method is not matched
+func (a *Aggregation) hasMethodNode(req *fasthttp.Request) bool {
+	for _, node := range a.Nodes {
+		if node.MatchesMethod(req) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *Aggregation) compile() error {
+	if "" != a.Path {
+		return a.compilePath()
+	}
+
+	pattern, err := regexp.Compile(a.URL)
+	if nil != err {
+		return err
+	}
+
+	if err := a.compileNodes(); nil != err {
+		return err
+	}
+
+	a.Pattern = pattern
+	a.rank = newRouteRank(a.Priority, pattern)
+	a.prefix, a.anchored = anchoredPrefix(a.URL)
+	return nil
+}
+
+func (a *Aggregation) compilePath() error {
+	path, err := parsePathTemplate(a.Path)
+	if nil != err {
+		return err
+	}
+
+	if err := a.compileNodes(); nil != err {
+		return err
+	}
+
+	if "" == a.URL {
+		a.URL = a.Path
+	}
+
+	a.path = path
+	a.rank = routeRank{priority: a.Priority, prefix: path.prefix, order: routeOrderSeq.Incr()}
+	return nil
+}
+
+func (a *Aggregation) compileNodes() error {
+	if nil != a.Merge {
+		if err := a.Merge.validate(); nil != err {
+			return err
+		}
+	}
+
+	for _, node := range a.Nodes {
+		if err := node.compile(); nil != err {
+			return err
+		}
+	}
+
+	return nil
 }
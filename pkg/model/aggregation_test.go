@@ -0,0 +1,301 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestNodeRewriteURI(t *testing.T) {
+	cases := []struct {
+		node   *Node
+		uri    string
+		expect string
+		ok     bool
+	}{
+		{node: &Node{RewritePattern: "^/api/v1/(.*)$", RewriteTo: "/$1"}, uri: "/api/v1/users/1", expect: "/users/1", ok: true},
+		{node: &Node{RewritePattern: "^/api/(v[0-9]+)/(.*)$", RewriteTo: "/$2/${1}"}, uri: "/api/v2/users", expect: "/users/v2", ok: true},
+		{node: &Node{RewritePattern: "^/api/v1/(.*)$", RewriteTo: "/$1"}, uri: "/other/users", expect: "", ok: false},
+		{node: &Node{RewritePattern: "^/api/v1/(.*)$", RewriteTo: "/$1"}, uri: "/api/v1/users?id=1&name=a", expect: "/users?id=1&name=a", ok: true},
+		{node: &Node{RewritePattern: `^/api/users\?id=([0-9]+)$`, RewriteTo: "/users/$1", RewriteQuery: true}, uri: "/api/users?id=1", expect: "/users/1", ok: true},
+		{node: &Node{}, uri: "/api/v1/users", expect: "", ok: false},
+	}
+
+	for _, c := range cases {
+		if err := c.node.compile(); nil != err {
+			t.Fatalf("compile err: %s", err)
+		}
+
+		req := &fasthttp.Request{}
+		req.SetRequestURI(c.uri)
+
+		uri, ok := c.node.RewriteURI(req)
+		if uri != c.expect || ok != c.ok {
+			t.Errorf("expect:<%s,%v>, acture:<%s,%v>", c.expect, c.ok, uri, ok)
+		}
+	}
+}
+
+func TestAggregationCompileError(t *testing.T) {
+	ang := NewAggregation("^/api$", []*Node{&Node{RewritePattern: "(("}})
+	if nil == ang.compile() {
+		t.Errorf("expect compile error")
+	}
+}
+
+func TestNodePrefixPath(t *testing.T) {
+	cases := []struct {
+		strip  string
+		add    string
+		path   string
+		expect string
+	}{
+		{strip: "/svc-a", path: "/svc-a/users", expect: "/users"},
+		{strip: "/svc-a/", path: "/svc-a/users", expect: "/users"},
+		{strip: "/svc-a", path: "/svc-a", expect: "/"},
+		{strip: "/svc-a", path: "/svc-a/", expect: "/"},
+		{strip: "/svc-a", path: "/svc-ab/users", expect: "/svc-ab/users"},
+		{strip: "/svc-a", path: "/other", expect: "/other"},
+		{add: "/v2", path: "/users", expect: "/v2/users"},
+		{add: "/v2/", path: "/users", expect: "/v2/users"},
+		{add: "/v2", path: "/", expect: "/v2/"},
+		{strip: "/svc-a", add: "/v2", path: "/svc-a/users", expect: "/v2/users"},
+		{strip: "/svc-a", add: "/v2", path: "/svc-a", expect: "/v2"},
+	}
+
+	for _, c := range cases {
+		node := &Node{StripPrefix: c.strip, AddPrefix: c.add}
+		if path := node.PrefixPath(c.path); path != c.expect {
+			t.Errorf("%+v expect:<%s>, acture:<%s>", c, c.expect, path)
+		}
+	}
+}
+
+func TestNodeReversePrefixPath(t *testing.T) {
+	cases := []struct {
+		strip  string
+		add    string
+		path   string
+		expect string
+	}{
+		{strip: "/svc-a", path: "/users", expect: "/svc-a/users"},
+		{strip: "/svc-a", path: "/", expect: "/svc-a/"},
+		{add: "/v2", path: "/v2/users", expect: "/users"},
+		{add: "/v2", path: "/v2", expect: "/"},
+		{add: "/v2", path: "/v20/users", expect: "/v20/users"},
+		{add: "/v2", path: "/other", expect: "/other"},
+		{strip: "/svc-a", add: "/v2", path: "/v2/users", expect: "/svc-a/users"},
+		{strip: "/svc-a", add: "/v2", path: "/v2", expect: "/svc-a"},
+	}
+
+	for _, c := range cases {
+		node := &Node{StripPrefix: c.strip, AddPrefix: c.add}
+		if path := node.ReversePrefixPath(c.path); path != c.expect {
+			t.Errorf("%+v expect:<%s>, acture:<%s>", c, c.expect, path)
+		}
+	}
+}
+
+func TestNodeSelectCluster(t *testing.T) {
+	node := &Node{
+		ClusterName: "stable",
+		Canary:      &CanarySplit{ClusterName: "canary", Percent: 5, StickyHeader: "X-User"},
+	}
+
+	ratio := func(sticky bool) float64 {
+		canaries := 0
+		for i := 0; i < 20000; i++ {
+			req := &fasthttp.Request{}
+			if sticky {
+				req.Header.Set("X-User", fmt.Sprintf("user-%d", i))
+			}
+
+			name, canary := node.SelectCluster(req)
+			if canary != (name == "canary") {
+				t.Fatalf("expect:<%v>, acture:<%s>", canary, name)
+			}
+
+			if canary {
+				canaries++
+			}
+		}
+
+		return float64(canaries) / 20000
+	}
+
+	for _, sticky := range []bool{false, true} {
+		if r := ratio(sticky); math.Abs(r-0.05) > 0.01 {
+			t.Errorf("sticky %v expect:<%.2f>, acture:<%.4f>", sticky, 0.05, r)
+		}
+	}
+
+	// the same user always go to the same cluster
+	req := &fasthttp.Request{}
+	req.Header.Set("X-User", "user-1")
+	expect, _ := node.SelectCluster(req)
+	for i := 0; i < 100; i++ {
+		if name, _ := node.SelectCluster(req); name != expect {
+			t.Fatalf("expect:<%s>, acture:<%s>", expect, name)
+		}
+	}
+
+	req = &fasthttp.Request{}
+	req.Header.SetCookie("user", "user-1")
+	node.Canary.StickyCookie = "user"
+	cookieExpect, _ := node.SelectCluster(req)
+	for i := 0; i < 100; i++ {
+		if name, _ := node.SelectCluster(req); name != cookieExpect {
+			t.Fatalf("expect:<%s>, acture:<%s>", cookieExpect, name)
+		}
+	}
+
+	node.Canary.Percent = 101
+	if node.compile() != ErrInvalidCanaryPercent {
+		t.Errorf("expect:<%s>", ErrInvalidCanaryPercent)
+	}
+}
+
+func TestAggregationMergeConfig(t *testing.T) {
+	agn := NewAggregation("^/merge$", nil)
+	if merge := agn.GetMerge(); !merge.FailAll() || "" != merge.NonJSON {
+		t.Errorf("expect:<fail all>, acture:<%+v>", merge)
+	}
+
+	agn.Merge = &MergeConfig{NonJSON: MergeNonJSONBase64, Failure: MergeFailureNull}
+	if err := agn.compile(); nil != err {
+		t.Errorf("expect:<nil>, acture:<%s>", err)
+	}
+
+	if agn.GetMerge().FailAll() {
+		t.Errorf("expect:<not fail all>")
+	}
+
+	agn.Merge.PartialStatusCode = 500
+	if err := agn.compile(); ErrInvalidMergeConfig != err {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrInvalidMergeConfig, err)
+	}
+
+	agn.Merge.PartialStatusCode = 0
+	agn.Merge.Failure = "ignore"
+	if err := agn.compile(); ErrInvalidMergeConfig != err {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrInvalidMergeConfig, err)
+	}
+}
+
+func TestNodeErrorPage(t *testing.T) {
+	node := &Node{ErrorPages: map[string]*ErrorPage{
+		"503": &ErrorPage{Body: "unavailable"},
+		"5xx": &ErrorPage{Body: "failure"},
+	}}
+	if err := node.compile(); nil != err {
+		t.Fatalf("compile err: %s", err)
+	}
+
+	for code, expect := range map[int]string{503: "unavailable", 502: "failure", 404: ""} {
+		page, ok := node.GetErrorPage(code)
+		if ok != ("" != expect) || (ok && page.Body != expect) {
+			t.Errorf("%d expect:<%s>, acture:<%+v>", code, expect, page)
+		}
+	}
+
+	for _, status := range []string{"200", "5x", "50x", "6xx"} {
+		node := &Node{ErrorPages: map[string]*ErrorPage{status: &ErrorPage{}}}
+		if err := node.compile(); err != ErrInvalidErrorPageStatus {
+			t.Errorf("%s expect:<%s>, acture:<%v>", status, ErrInvalidErrorPageStatus, err)
+		}
+	}
+}
+
+func TestNodeHeaderRoutes(t *testing.T) {
+	node := &Node{
+		ClusterName: "stable",
+		HeaderRoutes: []*HeaderRoute{
+			&HeaderRoute{ClusterName: "beta", Headers: []*HeaderMatch{&HeaderMatch{Name: "X-Variant", Exact: "beta"}}},
+			&HeaderRoute{ClusterName: "mobile", Headers: []*HeaderMatch{
+				&HeaderMatch{Name: "User-Agent", Regexp: "(?i)android|iphone"},
+				&HeaderMatch{Name: "X-App-Version", Prefix: "2."},
+			}},
+			&HeaderRoute{ClusterName: "debug", Headers: []*HeaderMatch{&HeaderMatch{Name: "X-Debug"}}},
+		},
+	}
+	if err := node.compile(); nil != err {
+		t.Fatalf("compile err: %s", err)
+	}
+
+	cases := []struct {
+		headers map[string]string
+		expect  string
+	}{
+		{headers: map[string]string{"X-Variant": "beta", "X-Debug": "1"}, expect: "beta"},
+		{headers: map[string]string{"X-Variant": "beta2"}, expect: "stable"},
+		{headers: map[string]string{"User-Agent": "Mozilla (iPhone)", "X-App-Version": "2.1"}, expect: "mobile"},
+		{headers: map[string]string{"User-Agent": "Mozilla (iPhone)", "X-App-Version": "1.9"}, expect: "stable"},
+		{headers: map[string]string{"X-Debug": "1"}, expect: "debug"},
+		{headers: map[string]string{}, expect: "stable"},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		for name, value := range c.headers {
+			req.Header.Set(name, value)
+		}
+
+		if name, canary := node.SelectCluster(req); name != c.expect || canary {
+			t.Errorf("%v expect:<%s>, acture:<%s>", c.headers, c.expect, name)
+		}
+	}
+
+	node.HeaderRoutes[0].Headers[0].Prefix = "b"
+	if err := node.compile(); err != ErrInvalidHeaderMatch {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrInvalidHeaderMatch, err)
+	}
+}
+
+func TestNodeQueryRoutes(t *testing.T) {
+	node := &Node{
+		ClusterName: "default",
+		HeaderRoutes: []*HeaderRoute{
+			&HeaderRoute{ClusterName: "beta", Headers: []*HeaderMatch{&HeaderMatch{Name: "X-Variant", Exact: "beta"}}},
+		},
+		QueryRoutes: []*QueryRoute{
+			&QueryRoute{ClusterName: "eu", Params: []*ParamMatch{&ParamMatch{Name: "region", Exact: "eu"}}},
+			&QueryRoute{ClusterName: "us", Params: []*ParamMatch{&ParamMatch{Name: "region", Regexp: "^us-(east|west)$"}}},
+		},
+	}
+	if err := node.compile(); nil != err {
+		t.Fatalf("compile err: %s", err)
+	}
+
+	cases := []struct {
+		uri     string
+		variant string
+		expect  string
+	}{
+		{uri: "/api?region=eu", expect: "eu"},
+		{uri: "/api?id=1&region=us-west", expect: "us"},
+		{uri: "/api?region=asia", expect: "default"},
+		{uri: "/api?region=", expect: "default"},
+		{uri: "/api", expect: "default"},
+		// the header routes are matched before
+		{uri: "/api?region=eu", variant: "beta", expect: "beta"},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		req.SetRequestURI(c.uri)
+		if "" != c.variant {
+			req.Header.Set("X-Variant", c.variant)
+		}
+
+		if name, _ := node.SelectCluster(req); name != c.expect {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.uri, c.expect, name)
+		}
+	}
+
+	node.QueryRoutes[0].Params[0].Name = ""
+	if err := node.compile(); err != ErrInvalidParamMatch {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrInvalidParamMatch, err)
+	}
+}
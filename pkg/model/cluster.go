@@ -3,9 +3,13 @@ package model
 import (
 	"container/list"
 	"encoding/json"
+	"errors"
 	"io"
 	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/CodisLabs/codis/pkg/utils/log"
 	"github.com/fagongzi/gateway/pkg/lb"
@@ -13,17 +17,51 @@ import (
 	"github.com/valyala/fasthttp"
 )
 
+const (
+	// HashKeyIP the client ip is the hash key of CONSISTENTHASH loadbalance
+	HashKeyIP = "ip"
+	// HashKeyHeaderPrefix the header is the hash key, e.g. header:X-User-Id
+	HashKeyHeaderPrefix = "header:"
+	// HashKeyPathPrefix the path segment is the hash key, the first segment is 1, e.g. path:2 of /users/1 is 1
+	HashKeyPathPrefix = "path:"
+)
+
+var (
+	// ErrInvalidHashKey the hash key is not ip, header:<name> or path:<index>
+	ErrInvalidHashKey = errors.New("invalid hash key")
+)
+
 // Cluster cluster
 type Cluster struct {
 	Name        string   `json:"name,omitempty"`
 	Pattern     string   `json:"pattern,omitempty"`
 	LbName      string   `json:"lbName,omitempty"`
 	BindServers []string `json:"bindServers,omitempty"`
+	// RetryNonIdempotent retry the non idempotent requests(e.g. POST) when proxy fail
+	RetryNonIdempotent bool `json:"retryNonIdempotent,omitempty"`
+	// HashKey the request key of CONSISTENTHASH loadbalance, ip, header:<name> or path:<index>, default is ip
+	HashKey string `json:"hashKey,omitempty"`
+	// HashReplicas the virtual nodes of every server in the hash ring, default is 160
+	HashReplicas int `json:"hashReplicas,omitempty"`
+
+	// OutlierInterval interval to detect the outlier servers by their error rates and p99 latencies, unit second, 0 is disabled
+	OutlierInterval int `json:"outlierInterval,omitempty"`
+	// OutlierErrorRateFactor the server is ejected if its error rate in the interval exceeds the median of cluster by the factor, 0 is not checked
+	OutlierErrorRateFactor float64 `json:"outlierErrorRateFactor,omitempty"`
+	// OutlierLatencyFactor the server is ejected if its p99 latency in the recent 10 seconds exceeds the median of cluster by the factor, 0 is not checked
+	OutlierLatencyFactor float64 `json:"outlierLatencyFactor,omitempty"`
+	// OutlierMinRequests minimum requests of the server in the interval to be detected, default is 10
+	OutlierMinRequests int `json:"outlierMinRequests,omitempty"`
+	// OutlierEjectDuration duration the outlier server is ejected, unit second, default is 30
+	OutlierEjectDuration int `json:"outlierEjectDuration,omitempty"`
 
 	regexp *regexp.Regexp
 	svrs   *list.List
 	rwLock *sync.RWMutex
 	lb     lb.LoadBalance
+
+	outlierDetectedAt time.Time
+	outlierCounts     map[string]outlierCounts
 }
 
 // UnMarshalCluster unmarshal
@@ -36,6 +74,12 @@ func UnMarshalCluster(data []byte) *Cluster {
 	}
 
 	c, _ := NewCluster(v.Name, v.Pattern, v.LbName)
+	c.RetryNonIdempotent = v.RetryNonIdempotent
+	c.OutlierInterval = v.OutlierInterval
+	c.OutlierErrorRateFactor = v.OutlierErrorRateFactor
+	c.OutlierLatencyFactor = v.OutlierLatencyFactor
+	c.OutlierMinRequests = v.OutlierMinRequests
+	c.OutlierEjectDuration = v.OutlierEjectDuration
 
 	return c
 }
@@ -72,9 +116,13 @@ func (c *Cluster) init() error {
 		return err
 	}
 
+	if !isValidHashKey(c.HashKey) {
+		return ErrInvalidHashKey
+	}
+
 	c.regexp = reg
 	c.svrs = list.New()
-	c.lb = lb.NewLoadBalance(c.LbName)
+	c.lb = c.newLoadBalance()
 	c.rwLock = &sync.RWMutex{}
 
 	return nil
@@ -88,9 +136,17 @@ func (c *Cluster) updateFrom(cluster *Cluster) {
 
 	c.Pattern = cluster.Pattern
 	c.LbName = cluster.LbName
+	c.RetryNonIdempotent = cluster.RetryNonIdempotent
+	c.HashKey = cluster.HashKey
+	c.HashReplicas = cluster.HashReplicas
+	c.OutlierInterval = cluster.OutlierInterval
+	c.OutlierErrorRateFactor = cluster.OutlierErrorRateFactor
+	c.OutlierLatencyFactor = cluster.OutlierLatencyFactor
+	c.OutlierMinRequests = cluster.OutlierMinRequests
+	c.OutlierEjectDuration = cluster.OutlierEjectDuration
 
 	c.regexp, _ = regexp.Compile(c.Pattern)
-	c.lb = lb.NewLoadBalance(c.LbName)
+	c.lb = c.newLoadBalance()
 
 	log.Infof("Cluster <%s> updated, %+v", c.Name, c)
 }
@@ -100,8 +156,8 @@ func (c *Cluster) doInEveryBindServers(callback func(string)) {
 	defer c.rwLock.Unlock()
 
 	for iter := c.svrs.Back(); iter != nil; iter = iter.Prev() {
-		addr, _ := iter.Value.(string)
-		callback(addr)
+		svr, _ := iter.Value.(*Server)
+		callback(svr.Addr)
 	}
 }
 
@@ -113,7 +169,13 @@ func (c *Cluster) unbind(svr *Server) {
 }
 
 func (c *Cluster) doUnBind(svr *Server) {
-	util.Remove(c.svrs, svr.Addr)
+	for iter := c.svrs.Front(); iter != nil; iter = iter.Next() {
+		if binded, _ := iter.Value.(*Server); binded.Addr == svr.Addr {
+			c.svrs.Remove(iter)
+			break
+		}
+	}
+
 	log.Infof("UnBind <%s,%s> succ.", svr.Addr, c.Name)
 }
 
@@ -121,36 +183,131 @@ func (c *Cluster) bind(svr *Server) {
 	c.rwLock.Lock()
 	defer c.rwLock.Unlock()
 
-	if util.IndexOf(c.svrs, svr.Addr) >= 0 {
-		log.Infof("Bind <%s,%s> already created.", svr.Addr, c.Name)
-		return
+	for iter := c.svrs.Front(); iter != nil; iter = iter.Next() {
+		if binded, _ := iter.Value.(*Server); binded.Addr == svr.Addr {
+			log.Infof("Bind <%s,%s> already created.", svr.Addr, c.Name)
+			return
+		}
 	}
 
-	c.svrs.PushBack(svr.Addr)
+	c.svrs.PushBack(svr)
 
 	log.Infof("Bind <%s,%s> created.", svr.Addr, c.Name)
 }
 
+func (c *Cluster) newLoadBalance() lb.LoadBalance {
+	if lb.CONSISTENTHASH == c.LbName {
+		return lb.NewConsistentHashWithReplicas(c.HashReplicas)
+	}
+
+	return lb.NewLoadBalance(c.LbName)
+}
+
 // Select return a server using spec loadbalance
 func (c *Cluster) Select(req *fasthttp.Request) string {
+	return c.selectServer(req, "", nil)
+}
+
+// selectServer return a server using spec loadbalance exclude the spec servers,
+// the clientIP is used by the hash key of CONSISTENTHASH loadbalance
+func (c *Cluster) selectServer(req *fasthttp.Request, clientIP string, excludes map[string]bool) string {
 	c.rwLock.RLock()
 	defer c.rwLock.RUnlock()
 
-	index := c.lb.Select(req, c.svrs)
+	svrs := c.availableServers()
+	for iter := svrs.Front(); iter != nil && len(excludes) > 0; {
+		next := iter.Next()
+		if svr, _ := iter.Value.(*Server); excludes[svr.Addr] {
+			svrs.Remove(iter)
+		}
+		iter = next
+	}
+
+	var index int
+	if klb, ok := c.lb.(lb.KeyLoadBalance); ok {
+		index = klb.SelectByKey(c.getHashKey(req, clientIP), svrs)
+	} else {
+		index = c.lb.Select(req, svrs)
+	}
 
 	if 0 > index {
 		return ""
 	}
 
-	e := util.Get(c.svrs, index)
+	e := util.Get(svrs, index)
 
 	if nil == e {
 		return ""
 	}
 
-	s, _ := e.Value.(string)
+	s, _ := e.Value.(*Server)
+
+	return s.Addr
+}
+
+// selectBy return the first available server matched
+func (c *Cluster) selectBy(match func(*Server) bool) string {
+	c.rwLock.RLock()
+	defer c.rwLock.RUnlock()
+
+	for iter := c.availableServers().Front(); iter != nil; iter = iter.Next() {
+		if svr, _ := iter.Value.(*Server); match(svr) {
+			return svr.Addr
+		}
+	}
+
+	return ""
+}
+
+// getHashKey returns the hash key of request, the path is used if the key is empty
+func (c *Cluster) getHashKey(req *fasthttp.Request, clientIP string) []byte {
+	var key []byte
+
+	switch {
+	case strings.HasPrefix(c.HashKey, HashKeyHeaderPrefix):
+		key = req.Header.Peek(c.HashKey[len(HashKeyHeaderPrefix):])
+	case strings.HasPrefix(c.HashKey, HashKeyPathPrefix):
+		index, _ := strconv.Atoi(c.HashKey[len(HashKeyPathPrefix):])
+		segments := strings.Split(strings.Trim(string(req.URI().Path()), "/"), "/")
+		if index <= len(segments) {
+			key = []byte(segments[index-1])
+		}
+	default:
+		key = []byte(clientIP)
+	}
+
+	if len(key) == 0 {
+		return req.URI().Path()
+	}
+
+	return key
+}
+
+func isValidHashKey(key string) bool {
+	switch {
+	case "" == key || HashKeyIP == key:
+		return true
+	case strings.HasPrefix(key, HashKeyHeaderPrefix):
+		return len(key) > len(HashKeyHeaderPrefix)
+	case strings.HasPrefix(key, HashKeyPathPrefix):
+		index, err := strconv.Atoi(key[len(HashKeyPathPrefix):])
+		return nil == err && index > 0
+	}
+
+	return false
+}
+
+// availableServers return servers which circuit is not close, not draining, not cooling down and not ejected
+func (c *Cluster) availableServers() *list.List {
+	svrs := list.New()
+
+	for iter := c.svrs.Front(); iter != nil; iter = iter.Next() {
+		if svr, _ := iter.Value.(*Server); !svr.IsDraining() && !svr.IsCoolingDown() && !svr.IsEjected() && svr.circuitAvailable() {
+			svrs.PushBack(svr)
+		}
+	}
 
-	return s
+	return svrs
 }
 
 // Matches return true if req matches
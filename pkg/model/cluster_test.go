@@ -0,0 +1,62 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/lb"
+	"github.com/valyala/fasthttp"
+)
+
+func TestClusterHashKey(t *testing.T) {
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/users/1/orders")
+	req.Header.Set("X-User", "u1")
+
+	cases := map[string]string{
+		"":              "127.0.0.1",
+		HashKeyIP:       "127.0.0.1",
+		"header:X-User": "u1",
+		"header:X-None": "/users/1/orders",
+		"path:2":        "1",
+		"path:4":        "/users/1/orders",
+	}
+
+	for hashKey, expect := range cases {
+		c := &Cluster{Name: "c", Pattern: "^/", LbName: lb.CONSISTENTHASH, HashKey: hashKey}
+		if err := c.init(); nil != err {
+			t.Fatalf("%s init err: %s", hashKey, err)
+		}
+
+		if key := string(c.getHashKey(req, "127.0.0.1")); key != expect {
+			t.Errorf("%s expect:<%s>, acture:<%s>", hashKey, expect, key)
+		}
+	}
+
+	for _, hashKey := range []string{"cookie", "header:", "path:0", "path:a"} {
+		c := &Cluster{Name: "c", Pattern: "^/", LbName: lb.CONSISTENTHASH, HashKey: hashKey}
+		if err := c.init(); err != ErrInvalidHashKey {
+			t.Errorf("%s expect:<%s>, acture:<%v>", hashKey, ErrInvalidHashKey, err)
+		}
+	}
+}
+
+func TestClusterSelectExclude(t *testing.T) {
+	c, _ := NewCluster("c", "^/", lb.CONSISTENTHASH)
+	for _, addr := range []string{"a", "b"} {
+		svr := &Server{Addr: addr}
+		svr.init()
+		c.bind(svr)
+	}
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/")
+
+	addr := c.selectServer(req, "127.0.0.1", nil)
+	if addr == "" {
+		t.Fatalf("expect a server, acture:<%s>", addr)
+	}
+
+	if next := c.selectServer(req, "127.0.0.1", map[string]bool{addr: true}); next == "" || next == addr {
+		t.Errorf("expect the other server, acture:<%s>", next)
+	}
+}
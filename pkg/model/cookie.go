@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalidSameSite the SameSite of cookie rewrite is not Lax, Strict or None
+	ErrInvalidSameSite = errors.New("invalid cookie SameSite")
+)
+
+// CookieRewrite the rules to rewrite the Set-Cookie headers of the responses of node,
+// the attributes not configured are kept
+type CookieRewrite struct {
+	// Domains the internal domain -> the external domain, the Domain attribute is removed if the external domain is empty
+	Domains map[string]string `json:"domains,omitempty"`
+	// Paths the internal path -> the external path, the path not mapped is reversed by the prefix rewrite of node
+	Paths map[string]string `json:"paths,omitempty"`
+	// Secure add the Secure attribute
+	Secure bool `json:"secure,omitempty"`
+	// HTTPOnly add the HttpOnly attribute
+	HTTPOnly bool `json:"httpOnly,omitempty"`
+	// SameSite set the SameSite attribute, Lax, Strict or None
+	SameSite string `json:"sameSite,omitempty"`
+}
+
+func (r *CookieRewrite) validate() error {
+	switch strings.ToLower(r.SameSite) {
+	case "", "lax", "strict", "none":
+		return nil
+	}
+
+	return ErrInvalidSameSite
+}
+
+// RewriteCookie returns the Set-Cookie header value rewritten by the CookieRewrite of node
+func (n *Node) RewriteCookie(cookie string) string {
+	r := n.CookieRewrite
+	if nil == r {
+		return cookie
+	}
+
+	parts := strings.Split(cookie, ";")
+	attrs := []string{strings.TrimSpace(parts[0])}
+	secure, httpOnly := false, false
+	for _, part := range parts[1:] {
+		attr := strings.TrimSpace(part)
+		name, value := attr, ""
+		if index := strings.IndexByte(attr, '='); index >= 0 {
+			name, value = strings.TrimSpace(attr[:index]), strings.TrimSpace(attr[index+1:])
+		}
+
+		switch strings.ToLower(name) {
+		case "domain":
+			if domain, ok := r.mapDomain(value); ok {
+				if "" == domain {
+					continue
+				}
+				attr = "Domain=" + domain
+			}
+		case "path":
+			attr = "Path=" + n.rewriteCookiePath(value)
+		case "secure":
+			secure = true
+		case "httponly":
+			httpOnly = true
+		case "samesite":
+			if "" != r.SameSite {
+				continue
+			}
+		case "":
+			continue
+		}
+
+		attrs = append(attrs, attr)
+	}
+
+	if r.Secure && !secure {
+		attrs = append(attrs, "Secure")
+	}
+	if r.HTTPOnly && !httpOnly {
+		attrs = append(attrs, "HttpOnly")
+	}
+	if "" != r.SameSite {
+		attrs = append(attrs, "SameSite="+r.SameSite)
+	}
+
+	return strings.Join(attrs, "; ")
+}
+
+// mapDomain returns the external domain of the internal domain, the leading dot and the case are ignored
+func (r *CookieRewrite) mapDomain(domain string) (string, bool) {
+	domain = strings.TrimPrefix(domain, ".")
+	for internal, external := range r.Domains {
+		if strings.EqualFold(strings.TrimPrefix(internal, "."), domain) {
+			return external, true
+		}
+	}
+
+	return "", false
+}
+
+func (n *Node) rewriteCookiePath(path string) string {
+	if external, ok := n.CookieRewrite.Paths[path]; ok {
+		return external
+	}
+
+	if n.HasPrefixRewrite() {
+		return n.ReversePrefixPath(path)
+	}
+
+	return path
+}
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestNodeRewriteCookie(t *testing.T) {
+	node := &Node{
+		StripPrefix: "/svc-a",
+		AddPrefix:   "/v2",
+		CookieRewrite: &CookieRewrite{
+			Domains:  map[string]string{"svc-a.internal": "example.com", "legacy.internal": ""},
+			Paths:    map[string]string{"/admin": "/console"},
+			Secure:   true,
+			HTTPOnly: true,
+			SameSite: "Lax",
+		},
+	}
+
+	cases := []struct {
+		cookie string
+		expect string
+	}{
+		{
+			cookie: "sid=1; Domain=.svc-a.internal; Path=/v2/users; Max-Age=60",
+			expect: "sid=1; Domain=example.com; Path=/svc-a/users; Max-Age=60; Secure; HttpOnly; SameSite=Lax",
+		},
+		// the mapped path, the removed domain and the replaced SameSite
+		{
+			cookie: "token=2; domain=legacy.internal; path=/admin; secure; SameSite=None",
+			expect: "token=2; Path=/console; secure; HttpOnly; SameSite=Lax",
+		},
+		// the domain not mapped
+		{
+			cookie: "lang=en; Domain=other.com; HttpOnly",
+			expect: "lang=en; Domain=other.com; HttpOnly; Secure; SameSite=Lax",
+		},
+	}
+
+	for _, c := range cases {
+		if cookie := node.RewriteCookie(c.cookie); cookie != c.expect {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.cookie, c.expect, cookie)
+		}
+	}
+
+	node.CookieRewrite.SameSite = "loose"
+	if err := node.compile(); ErrInvalidSameSite != err {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrInvalidSameSite, err)
+	}
+}
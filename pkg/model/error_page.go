@@ -0,0 +1,50 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+)
+
+var (
+	// ErrInvalidErrorPageStatus the key of error page is not a status code or a status class
+	ErrInvalidErrorPageStatus = errors.New("invalid error page status")
+)
+
+// ErrorPage the page responded instead of the error response of node, the ${request_id}, ${status}, ${error}
+// and ${reason} in Body are replaced, the values are escaped as json strings if ContentType is json
+type ErrorPage struct {
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+}
+
+// GetErrorPage returns the error page of the status code, the status code is used before the class, e.g. 503 before 5xx
+func (n *Node) GetErrorPage(code int) (*ErrorPage, bool) {
+	if len(n.ErrorPages) == 0 {
+		return nil, false
+	}
+
+	if page, ok := n.ErrorPages[strconv.Itoa(code)]; ok {
+		return page, true
+	}
+
+	page, ok := n.ErrorPages[strconv.Itoa(code/100)+"xx"]
+	return page, ok
+}
+
+func validateErrorPages(pages map[string]*ErrorPage) error {
+	for status, page := range pages {
+		if nil == page || len(status) != 3 || status[0] < '4' || status[0] > '5' {
+			return ErrInvalidErrorPageStatus
+		}
+
+		if status[1:] == "xx" {
+			continue
+		}
+
+		if _, err := strconv.Atoi(status); nil != err {
+			return ErrInvalidErrorPageStatus
+		}
+	}
+
+	return nil
+}
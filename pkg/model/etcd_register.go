@@ -62,10 +62,11 @@ func (e EtcdStore) GetProxies() ([]*ProxyInfo, error) {
 }
 
 // ChangeLogLevel change proxy log level
-func (e EtcdStore) ChangeLogLevel(addr string, level string) error {
+func (e EtcdStore) ChangeLogLevel(addr, token, level string) error {
 	rpcClient, _ := net.RpcClient("tcp", addr, time.Second*5)
 
 	req := SetLogReq{
+		Token: token,
 		Level: level,
 	}
 
@@ -77,12 +78,13 @@ func (e EtcdStore) ChangeLogLevel(addr string, level string) error {
 }
 
 // AddAnalysisPoint add a analysis point
-func (e EtcdStore) AddAnalysisPoint(proxyAddr, serverAddr string, secs int) error {
+func (e EtcdStore) AddAnalysisPoint(proxyAddr, token, serverAddr string, secs int) error {
 	rpcClient, _ := net.RpcClient("tcp", proxyAddr, time.Second*5)
 
 	req := AddAnalysisPointReq{
-		Addr: serverAddr,
-		Secs: secs,
+		Token: token,
+		Addr:  serverAddr,
+		Secs:  secs,
 	}
 
 	rsp := &AddAnalysisPointRsp{
@@ -93,7 +95,7 @@ func (e EtcdStore) AddAnalysisPoint(proxyAddr, serverAddr string, secs int) erro
 }
 
 // GetAnalysisPoint return analysis point data
-func (e EtcdStore) GetAnalysisPoint(proxyAddr, serverAddr string, secs int) (*GetAnalysisPointRsp, error) {
+func (e EtcdStore) GetAnalysisPoint(proxyAddr, token, serverAddr string, secs int) (*GetAnalysisPointRsp, error) {
 	rpcClient, err := net.RpcClient("tcp", proxyAddr, time.Second*5)
 
 	if nil != err {
@@ -101,8 +103,9 @@ func (e EtcdStore) GetAnalysisPoint(proxyAddr, serverAddr string, secs int) (*Ge
 	}
 
 	req := GetAnalysisPointReq{
-		Addr: serverAddr,
-		Secs: secs,
+		Token: token,
+		Addr:  serverAddr,
+		Secs:  secs,
 	}
 
 	rsp := &GetAnalysisPointRsp{}
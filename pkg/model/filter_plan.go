@@ -0,0 +1,31 @@
+package model
+
+import (
+	"strings"
+)
+
+// HasFilterPlan returns true if the node changes the order or the set of the registered filters
+func (n *Node) HasFilterPlan() bool {
+	return len(n.Filters) > 0 || len(n.DisabledFilters) > 0
+}
+
+// FilterEnabled returns true if the filter is executed for the node, the name is case insensitive
+func (n *Node) FilterEnabled(name string) bool {
+	for _, disabled := range n.DisabledFilters {
+		if strings.EqualFold(disabled, name) {
+			return false
+		}
+	}
+
+	if len(n.Filters) == 0 {
+		return true
+	}
+
+	for _, enabled := range n.Filters {
+		if strings.EqualFold(enabled, name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestNodeFilterEnabled(t *testing.T) {
+	cases := []struct {
+		node    *Node
+		name    string
+		enabled bool
+	}{
+		{node: &Node{}, name: "CACHE", enabled: true},
+		{node: &Node{DisabledFilters: []string{"cache"}}, name: "CACHE", enabled: false},
+		{node: &Node{DisabledFilters: []string{"cache"}}, name: "CLIENT-RATE-LIMIT", enabled: true},
+		{node: &Node{Filters: []string{"CLIENT-RATE-LIMIT"}}, name: "CACHE", enabled: false},
+		{node: &Node{Filters: []string{"CLIENT-RATE-LIMIT"}}, name: "client-rate-limit", enabled: true},
+		{node: &Node{Filters: []string{"CACHE"}, DisabledFilters: []string{"CACHE"}}, name: "CACHE", enabled: false},
+	}
+
+	for i, c := range cases {
+		if enabled := c.node.FilterEnabled(c.name); enabled != c.enabled {
+			t.Errorf("case %d expect:<%t>, acture:<%t>", i, c.enabled, enabled)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrInvalidCIDR the range of ip filter is not a CIDR or an ip
+	ErrInvalidCIDR = errors.New("invalid CIDR")
+)
+
+// IPFilter the CIDR allowlist and denylist of the client ip, used by ip-filter filter,
+// the denylist is checked first, the client ip must be in the allowlist if it is not empty
+type IPFilter struct {
+	// Allow the allowed CIDRs or ips, e.g. 10.0.0.0/8, ::1
+	Allow []string `json:"allow,omitempty"`
+	// Deny the denied CIDRs or ips
+	Deny []string `json:"deny,omitempty"`
+	// TrustXForwardedFor use the first ip of X-Forwarded-For header as the client ip,
+	// otherwise the client ip resolved by the trusted proxies
+	TrustXForwardedFor bool `json:"trustXForwardedFor,omitempty"`
+
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func (f *IPFilter) compile() error {
+	allow, err := ParseCIDRs(f.Allow)
+	if nil != err {
+		return err
+	}
+
+	deny, err := ParseCIDRs(f.Deny)
+	if nil != err {
+		return err
+	}
+
+	f.allow = allow
+	f.deny = deny
+	return nil
+}
+
+// Allowed returns true if the ip is not denied and in the allowlist,
+// the invalid ip is only allowed if there is no range
+func (f *IPFilter) Allowed(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if nil == parsed {
+		return len(f.allow) == 0 && len(f.deny) == 0
+	}
+
+	if ContainsIP(f.deny, parsed) {
+		return false
+	}
+
+	return len(f.allow) == 0 || ContainsIP(f.allow, parsed)
+}
+
+// ContainsIP returns true if the ip is in any of the nets
+func ContainsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseCIDRs parse the CIDRs, the ip is parsed as a single ip range
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if nil == ip {
+				return nil, ErrInvalidCIDR
+			}
+
+			bits := 8 * net.IPv6len
+			if v4 := ip.To4(); nil != v4 {
+				ip, bits = v4, 8*net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(value)
+		if nil != err {
+			return nil, ErrInvalidCIDR
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
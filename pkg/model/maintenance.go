@@ -0,0 +1,10 @@
+package model
+
+// Maintenance the 503 response of the gateway or the node in maintenance, the upstream servers are not called.
+// The empty fields use the configured defaults.
+type Maintenance struct {
+	ContentType string `json:"contentType,omitempty"`
+	Body        string `json:"body,omitempty"`
+	// RetryAfter the seconds of the Retry-After header
+	RetryAfter int `json:"retryAfter,omitempty"`
+}
@@ -1,7 +1,12 @@
 package model
 
+import (
+	"time"
+)
+
 // SetLogReq SetLogReq
 type SetLogReq struct {
+	Token string
 	Level string
 }
 
@@ -10,6 +15,17 @@ type SetLogRsp struct {
 	Code int
 }
 
+// ReloadReq ReloadReq, the Config is the json of RouteConfig
+type ReloadReq struct {
+	Token  string
+	Config []byte
+}
+
+// ReloadRsp ReloadRsp
+type ReloadRsp struct {
+	Code int
+}
+
 // SetReqHeadStaticMappingReq SetReqHeadStaticMappingReq
 type SetReqHeadStaticMappingReq struct {
 	Name  string
@@ -23,7 +39,8 @@ type SetReqHeadStaticMappingRsp struct {
 
 // AddAnalysisPointReq AddAnalysisPointReq
 type AddAnalysisPointReq struct {
-	Addr string
+	Token string
+	Addr  string
 	Secs int
 }
 
@@ -34,7 +51,8 @@ type AddAnalysisPointRsp struct {
 
 // GetAnalysisPointReq GetAnalysisPointReq
 type GetAnalysisPointReq struct {
-	Addr string
+	Token string
+	Addr  string
 	Secs int
 }
 
@@ -51,3 +69,163 @@ type GetAnalysisPointRsp struct {
 	Min                    int `json:"min"`
 	Avg                    int `json:"avg"`
 }
+
+// ListReq ListReq
+type ListReq struct {
+	Token string
+}
+
+// ListRsp ListRsp, the Config is the json of RouteConfig
+type ListRsp struct {
+	Code    int
+	Config  []byte
+	Servers []*ServerStatus
+}
+
+// ServerStatus the runtime status of server
+type ServerStatus struct {
+	Addr        string  `json:"addr"`
+	Status      Status  `json:"status"`
+	Circuit     Circuit `json:"circuit"`
+	Draining    bool    `json:"draining"`
+	CoolingDown bool    `json:"coolingDown"`
+	Ejected     bool    `json:"ejected"`
+	ActiveConns int64   `json:"activeConns"`
+}
+
+// AddServerReq AddServerReq, the server is bind to the clusters
+type AddServerReq struct {
+	Token    string
+	Server   *Server
+	Clusters []string
+}
+
+// AddServerRsp AddServerRsp
+type AddServerRsp struct {
+	Code int
+}
+
+// RemoveServerReq RemoveServerReq
+type RemoveServerReq struct {
+	Token string
+	Addr  string
+}
+
+// RemoveServerRsp RemoveServerRsp
+type RemoveServerRsp struct {
+	Code int
+}
+
+// DrainServerReq DrainServerReq, the draining server does not accept new requests
+type DrainServerReq struct {
+	Token    string
+	Addr     string
+	Draining bool
+}
+
+// DrainServerRsp DrainServerRsp
+type DrainServerRsp struct {
+	Code int
+}
+
+// StatsReq StatsReq
+type StatsReq struct {
+	Token string
+}
+
+// StatsRsp StatsRsp
+type StatsRsp struct {
+	Code    int
+	Servers []*ServerStats
+	Nodes   []*NodeStats
+}
+
+// ServerStats the request stats of server, the InFlight is the active connections
+type ServerStats struct {
+	RequestStatsSnapshot
+	Addr    string  `json:"addr"`
+	Status  Status  `json:"status"`
+	Circuit Circuit `json:"circuit"`
+	// LastCheckAt the time of the last health check, zero if never checked
+	LastCheckAt      time.Time `json:"lastCheckAt"`
+	LastCheckSucceed bool      `json:"lastCheckSucceed"`
+}
+
+// NodeStats the request stats of node, the stats are reset if the aggregation is reloaded
+type NodeStats struct {
+	RequestStatsSnapshot
+	AggregationURL string `json:"aggregationURL"`
+	// Index the index of node in the aggregation
+	Index       int    `json:"index"`
+	ClusterName string `json:"clusterName"`
+	URL         string `json:"url"`
+}
+
+// SetCanaryReq SetCanaryReq, the node is the index in the aggregation
+type SetCanaryReq struct {
+	Token   string
+	URL     string
+	Node    int
+	Percent int
+}
+
+// SetCanaryRsp SetCanaryRsp
+type SetCanaryRsp struct {
+	Code int
+}
+
+// SetMaintenanceReq SetMaintenanceReq, the whole gateway if the URL is empty, otherwise the node is the index in the aggregation.
+// The Maintenance is optional, the configured defaults are used if not set.
+type SetMaintenanceReq struct {
+	Token       string
+	URL         string
+	Node        int
+	Enabled     bool
+	Maintenance *Maintenance
+}
+
+// SetMaintenanceRsp SetMaintenanceRsp
+type SetMaintenanceRsp struct {
+	Code int
+}
+
+// RouteTestReq RouteTestReq, the request is routed without forwarding to the server
+type RouteTestReq struct {
+	Token   string
+	Method  string
+	URI     string
+	Host    string
+	Headers map[string]string
+	// ClientIP the client ip used by the consistent hash, the client ip of the headers is used if not set
+	ClientIP string
+}
+
+// RouteTestRsp RouteTestRsp, the Filters are the names of the registered filters in the execution order,
+// the filters of each result are changed by the filter plan of node
+type RouteTestRsp struct {
+	Code        int
+	Maintenance bool
+	Filters     []string
+	Results     []*RouteTestResult
+}
+
+// RouteTestResult the route decision of a request or a sub-request of the merge
+type RouteTestResult struct {
+	AggregationURL string `json:"aggregationURL,omitempty"`
+	// Node the index of node in the aggregation, -1 if routed by the routing or the cluster
+	Node        int    `json:"node"`
+	ClusterName string `json:"clusterName,omitempty"`
+	Canary      bool   `json:"canary,omitempty"`
+	Mocked      bool   `json:"mocked,omitempty"`
+	Maintenance bool   `json:"maintenance,omitempty"`
+	// Server the addr of the selected server, empty if no server available
+	Server string            `json:"server,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+	// Filters the names of the filters executed for the node in the order
+	Filters []string `json:"filters,omitempty"`
+	// URI the rewritten request uri sent to the server
+	URI  string `json:"uri"`
+	Host string `json:"host"`
+	// Error the request is rejected by the rewrite, e.g. the rewritten path is malicious
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,156 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrInvalidHeaderMatch the header match has no name or more than one of exact, prefix and regexp
+	ErrInvalidHeaderMatch = errors.New("invalid header match")
+	// ErrInvalidParamMatch the query param match has no name or more than one of exact, prefix and regexp
+	ErrInvalidParamMatch = errors.New("invalid param match")
+)
+
+// HeaderRoute the requests with all the matched headers are sent to the cluster
+type HeaderRoute struct {
+	ClusterName string         `json:"clusterName"`
+	Headers     []*HeaderMatch `json:"headers"`
+}
+
+// HeaderMatch match the value of request header by the exact value, the prefix or the regexp,
+// the request has the non-empty header is matched if none of them is set
+type HeaderMatch struct {
+	Name   string `json:"name"`
+	Exact  string `json:"exact,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Regexp string `json:"regexp,omitempty"`
+
+	regexp *regexp.Regexp
+}
+
+// QueryRoute the requests with all the matched query params are sent to the cluster
+type QueryRoute struct {
+	ClusterName string        `json:"clusterName"`
+	Params      []*ParamMatch `json:"params"`
+}
+
+// ParamMatch match the value of query param by the exact value, the prefix or the regexp,
+// the request has the non-empty param is matched if none of them is set
+type ParamMatch struct {
+	Name   string `json:"name"`
+	Exact  string `json:"exact,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	Regexp string `json:"regexp,omitempty"`
+
+	regexp *regexp.Regexp
+}
+
+func (m *HeaderMatch) compile() (err error) {
+	m.regexp, err = compileValueMatch(m.Name, m.Exact, m.Prefix, m.Regexp, ErrInvalidHeaderMatch)
+	return err
+}
+
+// Matches returns true if the header of req is matched
+func (m *HeaderMatch) Matches(req *fasthttp.Request) bool {
+	return matchValue(req.Header.Peek(m.Name), m.Exact, m.Prefix, m.regexp)
+}
+
+func (m *ParamMatch) compile() (err error) {
+	m.regexp, err = compileValueMatch(m.Name, m.Exact, m.Prefix, m.Regexp, ErrInvalidParamMatch)
+	return err
+}
+
+// Matches returns true if the query param of req is matched, the query string is parsed once for the request
+func (m *ParamMatch) Matches(req *fasthttp.Request) bool {
+	return matchValue(req.URI().QueryArgs().Peek(m.Name), m.Exact, m.Prefix, m.regexp)
+}
+
+func (r *HeaderRoute) compile() error {
+	for _, m := range r.Headers {
+		if nil == m {
+			return ErrInvalidHeaderMatch
+		}
+
+		if err := m.compile(); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Matches returns true if all the headers of req are matched
+func (r *HeaderRoute) Matches(req *fasthttp.Request) bool {
+	for _, m := range r.Headers {
+		if !m.Matches(req) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *QueryRoute) compile() error {
+	for _, m := range r.Params {
+		if nil == m {
+			return ErrInvalidParamMatch
+		}
+
+		if err := m.compile(); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Matches returns true if all the query params of req are matched
+func (r *QueryRoute) Matches(req *fasthttp.Request) bool {
+	for _, m := range r.Params {
+		if !m.Matches(req) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compileValueMatch(name, exact, prefix, pattern string, invalid error) (*regexp.Regexp, error) {
+	set := 0
+	for _, value := range []string{exact, prefix, pattern} {
+		if "" != value {
+			set++
+		}
+	}
+
+	if "" == name || set > 1 {
+		return nil, invalid
+	}
+
+	if "" == pattern {
+		return nil, nil
+	}
+
+	return regexp.Compile(pattern)
+}
+
+func matchValue(value []byte, exact, prefix string, pattern *regexp.Regexp) bool {
+	if len(value) == 0 {
+		return false
+	}
+
+	switch {
+	case "" != exact:
+		return string(value) == exact
+	case "" != prefix:
+		return bytes.HasPrefix(value, []byte(prefix))
+	case nil != pattern:
+		return pattern.Match(value)
+	default:
+		return true
+	}
+}
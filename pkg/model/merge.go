@@ -0,0 +1,92 @@
+package model
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	// MergeNonJSONRaw the body of sub-response is merged as is, the default
+	MergeNonJSONRaw = "raw"
+	// MergeNonJSONBase64 the non-JSON body of sub-response is merged as a base64 string
+	MergeNonJSONBase64 = "base64"
+	// MergeNonJSONError the non-JSON body of sub-response is a failed sub-response
+	MergeNonJSONError = "error"
+
+	// MergeFailureFail a failed sub-response fail the whole merge, the default
+	MergeFailureFail = "fail"
+	// MergeFailureNull the failed sub-response is merged as null
+	MergeFailureNull = "null"
+	// MergeFailureError the failed sub-response is merged as {"code":502,"error":"..."}
+	MergeFailureError = "error"
+)
+
+var (
+	// ErrInvalidMergeConfig the nonJSON or failure policy of merge is unknown, the timeout is negative or the partial status code is not 2xx
+	ErrInvalidMergeConfig = errors.New("invalid merge config")
+
+	defaultMerge = &MergeConfig{}
+)
+
+// MergeConfig the merge of the sub-responses of aggregation nodes,
+// the sub-responses are merged as {"attrName": body} and wrapped by the envelope if set
+type MergeConfig struct {
+	// Envelope the key of the merged object, e.g. data -> {"data":{"attrName": body}}
+	Envelope string `json:"envelope,omitempty"`
+	// NonJSON the policy of the non-JSON sub-response, raw, base64 or error
+	NonJSON string `json:"nonJSON,omitempty"`
+	// Failure the policy of the failed sub-response, fail, null or error
+	Failure string `json:"failure,omitempty"`
+	// PartialStatusCode the status code of the merged response if some sub-responses failed, default is 200, e.g. 207
+	PartialStatusCode int `json:"partialStatusCode,omitempty"`
+	// Timeout the max duration of the sub-requests, the slow sub-requests are canceled and failed after it
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// GetMerge returns the merge config of aggregation, the default if not set
+func (a *Aggregation) GetMerge() *MergeConfig {
+	if nil == a.Merge {
+		return defaultMerge
+	}
+
+	return a.Merge
+}
+
+// FailAll returns true if a failed sub-response fail the whole merge
+func (m *MergeConfig) FailAll() bool {
+	return "" == m.Failure || MergeFailureFail == m.Failure
+}
+
+func (m *MergeConfig) validate() error {
+	switch m.NonJSON {
+	case "", MergeNonJSONRaw, MergeNonJSONBase64, MergeNonJSONError:
+	default:
+		return ErrInvalidMergeConfig
+	}
+
+	switch m.Failure {
+	case "", MergeFailureFail, MergeFailureNull, MergeFailureError:
+	default:
+		return ErrInvalidMergeConfig
+	}
+
+	if m.Timeout < 0 {
+		return ErrInvalidMergeConfig
+	}
+
+	if 0 != m.PartialStatusCode && (m.PartialStatusCode < 200 || m.PartialStatusCode > 299) {
+		return ErrInvalidMergeConfig
+	}
+
+	return nil
+}
+
+// GetPartialStatusCode returns the status code of the merged response if some sub-responses failed
+func (m *MergeConfig) GetPartialStatusCode() int {
+	if 0 == m.PartialStatusCode {
+		return http.StatusOK
+	}
+
+	return m.PartialStatusCode
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"strings"
+)
+
+// MethodRules the OPTIONS and HEAD requests of node handled by gateway, used by method filter
+type MethodRules struct {
+	// Allow the methods of the Allow header, the OPTIONS requests are responded 204 by gateway if set,
+	// the CORS preflight requests are not handled
+	Allow []string `json:"allow,omitempty"`
+	// HeadAsGet send the HEAD requests as GET to the backend servers, and strip the body of the responses
+	HeadAsGet bool `json:"headAsGet,omitempty"`
+}
+
+// AllowHeader returns the value of the Allow header
+func (r *MethodRules) AllowHeader() string {
+	methods := make([]string, len(r.Allow))
+	for i, method := range r.Allow {
+		methods[i] = strings.ToUpper(method)
+	}
+
+	return strings.Join(methods, ", ")
+}
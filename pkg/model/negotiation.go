@@ -0,0 +1,149 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrNotAcceptable no node of the aggregation produces the content types acceptable by the Accept header
+	ErrNotAcceptable = errors.New("not acceptable")
+)
+
+// mediaRange the media range of the Accept header, e.g. text/*;q=0.5
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+// parseAccept parse the media ranges of the Accept header, the empty header accepts any media type
+func parseAccept(accept string) []mediaRange {
+	if "" == strings.TrimSpace(accept) {
+		return []mediaRange{{typ: "*", subtype: "*", q: 1}}
+	}
+
+	var ranges []mediaRange
+	for _, value := range strings.Split(accept, ",") {
+		params := strings.Split(value, ";")
+		typ, subtype := splitMediaType(params[0])
+		if "" == typ {
+			continue
+		}
+
+		r := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 || !strings.EqualFold(kv[0], "q") {
+				continue
+			}
+
+			// the invalid q-value is not acceptable
+			q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+			if nil != err || q < 0 || q > 1 {
+				q = 0
+			}
+			r.q = q
+		}
+
+		ranges = append(ranges, r)
+	}
+
+	return ranges
+}
+
+// splitMediaType returns the lower case type and subtype, e.g. application/json
+func splitMediaType(value string) (string, string) {
+	value = strings.ToLower(strings.TrimSpace(strings.SplitN(value, ";", 2)[0]))
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 || "" == parts[0] || "" == parts[1] {
+		return "", ""
+	}
+
+	return parts[0], parts[1]
+}
+
+// quality returns the q-value of the media type by the most specific range matched, 0 if not acceptable
+func quality(ranges []mediaRange, mediaType string) float64 {
+	typ, subtype := splitMediaType(mediaType)
+	if "" == typ {
+		return 0
+	}
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		}
+
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+
+	return q
+}
+
+// acceptQuality returns the highest q-value of the produced types of node
+func (n *Node) acceptQuality(ranges []mediaRange) float64 {
+	max := 0.0
+	for _, produce := range n.Produces {
+		if q := quality(ranges, produce); q > max {
+			max = q
+		}
+	}
+
+	return max
+}
+
+// negotiate returns the nodes selected by the Accept header of req, the nodes without the produced types are
+// not negotiated, only the best node of the others is selected, the first one if the q-values are equal.
+// ErrNotAcceptable if no node produces an acceptable content type.
+func negotiate(req *fasthttp.Request, nodes []*Node) ([]*Node, error) {
+	var ranges []mediaRange
+	var best *Node
+	bestQ := 0.0
+	negotiated := false
+
+	for _, node := range nodes {
+		if len(node.Produces) == 0 {
+			continue
+		}
+
+		if !negotiated {
+			ranges = parseAccept(string(req.Header.Peek("Accept")))
+			negotiated = true
+		}
+
+		if q := node.acceptQuality(ranges); q > bestQ {
+			best, bestQ = node, q
+		}
+	}
+
+	if !negotiated {
+		return nodes, nil
+	}
+
+	if nil == best {
+		return nil, ErrNotAcceptable
+	}
+
+	// keep the order of the nodes
+	var result []*Node
+	for _, node := range nodes {
+		if node == best || len(node.Produces) == 0 {
+			result = append(result, node)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseAcceptQuality(t *testing.T) {
+	cases := []struct {
+		accept    string
+		mediaType string
+		expect    float64
+	}{
+		{accept: "", mediaType: "application/json", expect: 1},
+		{accept: "application/json", mediaType: "application/json", expect: 1},
+		{accept: "application/json", mediaType: "application/xml", expect: 0},
+		{accept: "application/xml;q=0.9, */*;q=0.1", mediaType: "application/json", expect: 0.1},
+		{accept: "application/*;q=0.5, application/json;q=0.8", mediaType: "application/json", expect: 0.8},
+		{accept: "application/*;q=0.5, application/json;q=0.8", mediaType: "application/xml", expect: 0.5},
+		{accept: "Application/JSON; charset=utf-8", mediaType: "application/json", expect: 1},
+		{accept: "application/json;q=0, */*", mediaType: "application/json", expect: 0},
+		{accept: "application/json;q=high", mediaType: "application/json", expect: 0},
+	}
+
+	for _, c := range cases {
+		if q := quality(parseAccept(c.accept), c.mediaType); q != c.expect {
+			t.Errorf("%s %s expect:<%v>, acture:<%v>", c.accept, c.mediaType, c.expect, q)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	json := &Node{URL: "/json", Produces: []string{"application/json"}}
+	xml := &Node{URL: "/xml", Produces: []string{"application/xml", "text/xml"}}
+	other := &Node{URL: "/other"}
+
+	cases := []struct {
+		accept string
+		nodes  []*Node
+		expect []*Node
+		err    error
+	}{
+		{accept: "application/json", nodes: []*Node{json, xml}, expect: []*Node{json}},
+		{accept: "text/xml", nodes: []*Node{json, xml}, expect: []*Node{xml}},
+		{accept: "application/json;q=0.5, application/xml", nodes: []*Node{json, xml}, expect: []*Node{xml}},
+		{accept: "*/*", nodes: []*Node{json, xml}, expect: []*Node{json}},
+		{accept: "", nodes: []*Node{xml, json}, expect: []*Node{xml}},
+		{accept: "application/json", nodes: []*Node{other, xml, json}, expect: []*Node{other, json}},
+		{accept: "text/html", nodes: []*Node{other}, expect: []*Node{other}},
+		{accept: "text/html", nodes: []*Node{json, xml}, err: ErrNotAcceptable},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		if "" != c.accept {
+			req.Header.Set("Accept", c.accept)
+		}
+
+		nodes, err := negotiate(req, c.nodes)
+		if err != c.err {
+			t.Errorf("%s expect:<%v>, acture:<%v>", c.accept, c.err, err)
+			continue
+		}
+
+		if len(nodes) != len(c.expect) {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.accept, len(c.expect), len(nodes))
+			continue
+		}
+
+		for i := range nodes {
+			if nodes[i] != c.expect[i] {
+				t.Errorf("%s expect:<%s>, acture:<%s>", c.accept, c.expect[i].URL, nodes[i].URL)
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"sort"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+const (
+	// the latencies of the outlier detection are estimated in the recent 10 seconds,
+	// the ejected server is reinstated without the latencies before ejection
+	outlierLatencyWindow = 10 * time.Second
+	outlierLatencySlots  = 5
+
+	outlierDetectKey  = "outlier-detection"
+	outlierDetectTick = time.Second
+
+	defaultOutlierMinRequests   = 10
+	defaultOutlierEjectDuration = 30
+)
+
+// outlierCounts the request counters of server at the last detection
+type outlierCounts struct {
+	requests int64
+	failures int64
+	ejected  bool
+}
+
+type outlierSample struct {
+	svr       *Server
+	errorRate float64
+	latency   time.Duration
+}
+
+// detectOutliers detect the outlier servers of all clusters, the clusters are detected every OutlierInterval
+func (r *RouteTable) detectOutliers(key string) {
+	r.rwLock.RLock()
+	now := time.Now()
+	for _, cluster := range r.clusters {
+		cluster.detectOutliers(now)
+	}
+	r.rwLock.RUnlock()
+
+	r.tw.AddWithId(outlierDetectTick, outlierDetectKey, r.detectOutliers)
+}
+
+// detectOutliers eject the servers which error rate or p99 latency exceeds the median of cluster by the factor,
+// the servers with too few requests in the interval are not detected
+func (c *Cluster) detectOutliers(now time.Time) {
+	c.rwLock.Lock()
+	defer c.rwLock.Unlock()
+
+	if c.OutlierInterval <= 0 || now.Sub(c.outlierDetectedAt) < time.Duration(c.OutlierInterval)*time.Second {
+		return
+	}
+	c.outlierDetectedAt = now
+
+	minRequests := int64(c.OutlierMinRequests)
+	if minRequests <= 0 {
+		minRequests = defaultOutlierMinRequests
+	}
+
+	counts := make(map[string]outlierCounts, c.svrs.Len())
+	var samples []*outlierSample
+	for iter := c.svrs.Front(); iter != nil; iter = iter.Next() {
+		svr, _ := iter.Value.(*Server)
+		stats := svr.Stats()
+		current := outlierCounts{
+			requests: stats.requests.Get(),
+			failures: stats.failures.Get(),
+			ejected:  svr.IsEjected(),
+		}
+		counts[svr.Addr] = current
+
+		prev, ok := c.outlierCounts[svr.Addr]
+		if prev.ejected && !current.ejected {
+			log.Infof("Outlier Server <%s> of cluster <%s> reinstated.", svr.Addr, c.Name)
+		}
+
+		requests := current.requests - prev.requests
+		if !ok || current.ejected || requests < minRequests {
+			continue
+		}
+
+		samples = append(samples, &outlierSample{
+			svr:       svr,
+			errorRate: float64(current.failures-prev.failures) / float64(requests),
+			latency:   svr.outlierLatency.Quantile(0.99),
+		})
+	}
+	c.outlierCounts = counts
+
+	// the median of one server is itself
+	if len(samples) < 2 {
+		return
+	}
+
+	errorRates := make([]float64, len(samples))
+	latencies := make([]float64, len(samples))
+	for i, sample := range samples {
+		errorRates[i] = sample.errorRate
+		latencies[i] = float64(sample.latency)
+	}
+	medianErrorRate := median(errorRates)
+	medianLatency := median(latencies)
+
+	ejectDuration := c.OutlierEjectDuration
+	if ejectDuration <= 0 {
+		ejectDuration = defaultOutlierEjectDuration
+	}
+
+	for _, sample := range samples {
+		errorOutlier := c.OutlierErrorRateFactor > 0 && sample.errorRate > 0 && sample.errorRate > medianErrorRate*c.OutlierErrorRateFactor
+		latencyOutlier := c.OutlierLatencyFactor > 0 && float64(sample.latency) > medianLatency*c.OutlierLatencyFactor
+		if !errorOutlier && !latencyOutlier {
+			continue
+		}
+
+		sample.svr.eject(time.Duration(ejectDuration) * time.Second)
+		ejected := c.outlierCounts[sample.svr.Addr]
+		ejected.ejected = true
+		c.outlierCounts[sample.svr.Addr] = ejected
+
+		log.Warnf("Outlier Server <%s> of cluster <%s> ejected <%ds>, error rate <%.4f>, p99 <%s>.",
+			sample.svr.Addr, c.Name, ejectDuration, sample.errorRate, sample.latency)
+	}
+}
+
+// median returns the lower median of values
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	return values[(len(values)-1)/2]
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/lb"
+	"github.com/valyala/fasthttp"
+)
+
+func newOutlierCluster(t *testing.T, addrs ...string) (*Cluster, map[string]*Server) {
+	c := &Cluster{
+		Name:                   "c",
+		Pattern:                "^/",
+		LbName:                 lb.ROUNDROBIN,
+		OutlierInterval:        10,
+		OutlierErrorRateFactor: 2,
+		OutlierLatencyFactor:   3,
+		OutlierEjectDuration:   30,
+	}
+	if err := c.init(); nil != err {
+		t.Fatalf("init err: %s", err)
+	}
+
+	svrs := make(map[string]*Server)
+	for _, addr := range addrs {
+		svr := &Server{Addr: addr}
+		svr.init()
+		c.bind(svr)
+		svrs[addr] = svr
+	}
+
+	return c, svrs
+}
+
+func TestOutlierSlowServerEjected(t *testing.T) {
+	c, svrs := newOutlierCluster(t, "a", "b", "c", "slow")
+
+	now := time.Now()
+	c.detectOutliers(now)
+
+	for addr, svr := range svrs {
+		latency := 10 * time.Millisecond
+		if "slow" == addr {
+			latency = 500 * time.Millisecond
+		}
+
+		for i := 0; i < 20; i++ {
+			svr.RecordRequest(latency, true)
+		}
+	}
+
+	// not detected before the interval
+	c.detectOutliers(now.Add(time.Second))
+	if svrs["slow"].IsEjected() {
+		t.Fatal("expect not detected before the interval")
+	}
+
+	c.detectOutliers(now.Add(10 * time.Second))
+	for addr, svr := range svrs {
+		if ejected := svr.IsEjected(); ejected != ("slow" == addr) {
+			t.Errorf("%s expect ejected:<%v>, acture:<%v>", addr, "slow" == addr, ejected)
+		}
+	}
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/")
+	for i := 0; i < 10; i++ {
+		if addr := c.Select(req); "slow" == addr {
+			t.Fatal("expect the ejected server not selected")
+		}
+	}
+
+	// the ejection is expired
+	svrs["slow"].ejectedUntil.Set(time.Now().Add(-time.Second).UnixNano())
+	if svrs["slow"].IsEjected() || c.availableServers().Len() != len(svrs) {
+		t.Error("expect the slow server reinstated")
+	}
+}
+
+func TestOutlierErrorServerEjected(t *testing.T) {
+	c, svrs := newOutlierCluster(t, "a", "b", "failing")
+
+	now := time.Now()
+	c.detectOutliers(now)
+
+	for addr, svr := range svrs {
+		for i := 0; i < 20; i++ {
+			svr.RecordRequest(10*time.Millisecond, "failing" != addr || i%2 == 0)
+		}
+	}
+
+	c.detectOutliers(now.Add(10 * time.Second))
+	for addr, svr := range svrs {
+		if ejected := svr.IsEjected(); ejected != ("failing" == addr) {
+			t.Errorf("%s expect ejected:<%v>, acture:<%v>", addr, "failing" == addr, ejected)
+		}
+	}
+}
+
+func TestOutlierWithTooFewRequests(t *testing.T) {
+	c, svrs := newOutlierCluster(t, "a", "slow")
+
+	now := time.Now()
+	c.detectOutliers(now)
+
+	svrs["a"].RecordRequest(10*time.Millisecond, true)
+	svrs["slow"].RecordRequest(time.Second, false)
+
+	c.detectOutliers(now.Add(10 * time.Second))
+	if svrs["slow"].IsEjected() {
+		t.Error("expect not ejected with too few requests")
+	}
+}
@@ -0,0 +1,204 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+const (
+	// PathCatchAllParam the param name of the catch-all segment without name, e.g. /static/*
+	PathCatchAllParam = "wildcard"
+)
+
+var (
+	// ErrInvalidPathTemplate the path template is not begin with /, or has a invalid param or catch-all segment
+	ErrInvalidPathTemplate = errors.New("invalid path template")
+)
+
+type segmentKind int
+
+const (
+	segmentStatic = segmentKind(iota)
+	segmentParam
+	segmentCatchAll
+)
+
+type pathSegment struct {
+	kind  segmentKind
+	value string
+}
+
+// pathTemplate the path template of aggregation, the segments are static, {name} params or the trailing *name catch-all
+type pathTemplate struct {
+	segments []pathSegment
+	prefix   int
+}
+
+func parsePathTemplate(path string) (*pathTemplate, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, ErrInvalidPathTemplate
+	}
+
+	t := &pathTemplate{}
+	values := strings.Split(path[1:], "/")
+	static := true
+	for i, value := range values {
+		segment := pathSegment{kind: segmentStatic, value: value}
+
+		switch {
+		case strings.HasPrefix(value, "*"):
+			if i != len(values)-1 {
+				return nil, ErrInvalidPathTemplate
+			}
+
+			segment.kind = segmentCatchAll
+			segment.value = value[1:]
+			if "" == segment.value {
+				segment.value = PathCatchAllParam
+			}
+		case strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}"):
+			segment.kind = segmentParam
+			segment.value = value[1 : len(value)-1]
+			if "" == segment.value {
+				return nil, ErrInvalidPathTemplate
+			}
+		}
+
+		if strings.ContainsAny(segment.value, "{}*") {
+			return nil, ErrInvalidPathTemplate
+		}
+
+		if static && segmentStatic == segment.kind {
+			t.prefix += len(value) + 1
+		} else {
+			static = false
+		}
+
+		t.segments = append(t.segments, segment)
+	}
+
+	// the slash before the first param is the literal prefix too
+	if !static {
+		t.prefix++
+	}
+
+	return t, nil
+}
+
+// params returns the values of the params and the catch-all of the matched path segments
+func (t *pathTemplate) params(segments []string) map[string]string {
+	var params map[string]string
+	for i, segment := range t.segments {
+		if segmentStatic == segment.kind {
+			continue
+		}
+
+		if nil == params {
+			params = make(map[string]string)
+		}
+
+		if segmentCatchAll == segment.kind {
+			params[segment.value] = strings.Join(segments[i:], "/")
+		} else {
+			params[segment.value] = segments[i]
+		}
+	}
+
+	return params
+}
+
+// expand replace the {name} in value by the params
+func expandPathParams(value string, params map[string]string) string {
+	for name, param := range params {
+		value = strings.Replace(value, "{"+name+"}", param, -1)
+	}
+
+	return value
+}
+
+func splitPath(path []byte) []string {
+	return strings.Split(strings.TrimPrefix(string(path), "/"), "/")
+}
+
+// pathTrie the trie of the path templates, the static segments are matched before the params,
+// and the params before the catch-all
+type pathTrie struct {
+	static    map[string]*pathTrie
+	param     *pathTrie
+	ends      []*Aggregation
+	catchAlls []*Aggregation
+}
+
+func newPathTrie(angs map[string]*Aggregation) *pathTrie {
+	var sorted []*Aggregation
+	for _, ang := range angs {
+		if nil != ang.path {
+			sorted = append(sorted, ang)
+		}
+	}
+
+	if len(sorted) == 0 {
+		return nil
+	}
+
+	// the same templates are matched in the config order
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].rank.order < sorted[j].rank.order
+	})
+
+	root := &pathTrie{}
+	for _, ang := range sorted {
+		root.add(ang)
+	}
+
+	return root
+}
+
+func (t *pathTrie) add(ang *Aggregation) {
+	node := t
+	for _, segment := range ang.path.segments {
+		switch segment.kind {
+		case segmentCatchAll:
+			node.catchAlls = append(node.catchAlls, ang)
+			return
+		case segmentParam:
+			if nil == node.param {
+				node.param = &pathTrie{}
+			}
+			node = node.param
+		default:
+			if nil == node.static {
+				node.static = make(map[string]*pathTrie)
+			}
+			if _, ok := node.static[segment.value]; !ok {
+				node.static[segment.value] = &pathTrie{}
+			}
+			node = node.static[segment.value]
+		}
+	}
+
+	node.ends = append(node.ends, ang)
+}
+
+// match visit the aggregations of the matched templates in the precedence order
+func (t *pathTrie) match(segments []string, visit func(*Aggregation)) {
+	if len(segments) == 0 {
+		for _, ang := range t.ends {
+			visit(ang)
+		}
+		return
+	}
+
+	if next, ok := t.static[segments[0]]; ok {
+		next.match(segments[1:], visit)
+	}
+
+	if nil != t.param && "" != segments[0] {
+		t.param.match(segments[1:], visit)
+	}
+
+	for _, ang := range t.catchAlls {
+		visit(ang)
+	}
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"regexp"
+
+	"github.com/CodisLabs/codis/pkg/utils/atomic2"
+)
+
+// the sequence of the aggregations and routings added to route table, used as the config order
+var routeOrderSeq atomic2.Int64
+
+// routeRank the rank of the matched aggregations and routings of a request, the higher priority wins,
+// then the longer literal prefix of url pattern, then the former in config
+type routeRank struct {
+	priority int
+	prefix   int
+	order    int64
+}
+
+func newRouteRank(priority int, pattern *regexp.Regexp) routeRank {
+	prefix, _ := pattern.LiteralPrefix()
+	return routeRank{
+		priority: priority,
+		prefix:   len(prefix),
+		order:    routeOrderSeq.Incr(),
+	}
+}
+
+// before returns true if the rank r wins the other
+func (r routeRank) before(other routeRank) bool {
+	if r.priority != other.priority {
+		return r.priority > other.priority
+	}
+
+	if r.prefix != other.prefix {
+		return r.prefix > other.prefix
+	}
+
+	return r.order < other.order
+}
+
+// keepOrder keep the config order of the replaced route
+func (r *routeRank) keepOrder(old routeRank) {
+	r.order = old.order
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fagongzi/gateway/conf"
+)
+
+func TestProxyInfoSecrets(t *testing.T) {
+	data := `{"addr":":80","mgrToken":"secret-token","jwtSecret":"secret-jwt","basicAuthUsers":{"user":"secret-hash"},"apiKeys":{"key":"secret-account"},
+		"oauthClientSecret":"secret-oauth","hmacSecret":"secret-hmac","affinitySecret":"secret-affinity"}`
+
+	cnf := &conf.Conf{}
+	if err := json.Unmarshal([]byte(data), cnf); nil != err {
+		t.Fatalf("unmarshal err: %s", err)
+	}
+
+	if cnf.Addr != ":80" || cnf.MgrToken != "secret-token" || cnf.JWTSecret != "secret-jwt" || cnf.BasicAuthUsers["user"] != "secret-hash" ||
+		cnf.APIKeys["key"] != "secret-account" || cnf.OAuthClientSecret != "secret-oauth" || cnf.HMACSecret != "secret-hmac" || cnf.AffinitySecret != "secret-affinity" {
+		t.Errorf("expect the secrets read from the config file, acture:<%+v>", cnf)
+	}
+
+	value := (&ProxyInfo{Conf: cnf}).Marshal()
+	for _, secret := range []string{"secret-token", "secret-jwt", "secret-hash", "secret-account", "secret-oauth", "secret-hmac", "secret-affinity"} {
+		if strings.Contains(value, secret) {
+			t.Errorf("expect the secret <%s> not registered, acture:<%s>", secret, value)
+		}
+	}
+
+	if info := UnMarshalProxyInfo([]byte(value)); nil == info.Conf || info.Conf.Addr != ":80" {
+		t.Errorf("expect:<:80>, acture:<%+v>", info.Conf)
+	}
+}
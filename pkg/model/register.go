@@ -1,14 +1,14 @@
-package model
-
-// Register register
-type Register interface {
-	Registry(proxyInfo *ProxyInfo) error
-
-	GetProxies() ([]*ProxyInfo, error)
-
-	ChangeLogLevel(proxyAddr string, level string) error
-
-	AddAnalysisPoint(proxyAddr, serverAddr string, secs int) error
-
-	GetAnalysisPoint(proxyAddr, serverAddr string, secs int) (*GetAnalysisPointRsp, error)
-}
+package model
+
+// Register register, the token of the manager requests is the MgrToken of the proxies
+type Register interface {
+	Registry(proxyInfo *ProxyInfo) error
+
+	GetProxies() ([]*ProxyInfo, error)
+
+	ChangeLogLevel(proxyAddr, token, level string) error
+
+	AddAnalysisPoint(proxyAddr, token, serverAddr string, secs int) error
+
+	GetAnalysisPoint(proxyAddr, token, serverAddr string, secs int) (*GetAnalysisPointRsp, error)
+}
@@ -0,0 +1,503 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+// RouteConfig the whole routing config of route table
+type RouteConfig struct {
+	Clusters     []*Cluster     `json:"clusters"`
+	Servers      []*Server      `json:"servers"`
+	Binds        []*Bind        `json:"binds"`
+	Aggregations []*Aggregation `json:"aggregations"`
+	Routings     []*Routing     `json:"routings"`
+}
+
+// routeSnapshot the structures of route table, they are not changed after swapped in
+type routeSnapshot struct {
+	clusters     map[string]*Cluster
+	svrs         map[string]*Server
+	mapping      map[string]map[string]*Cluster
+	aggregations map[string]*Aggregation
+	routings     map[string]*Routing
+}
+
+// Reload replace all the clusters, servers, binds, aggregations and routings by the cfg.
+// The cfg is validated before swapped, the route table is not changed if the cfg is invalid.
+// The in-flight Select calls see either the old or the new config, and the results already
+// returned keep referencing the old structures.
+// The existing servers keep their status and health checks, the servers with the changed health check
+// are added again and start to check from Down.
+func (r *RouteTable) Reload(cfg *RouteConfig) error {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	return r.doReload(cfg)
+}
+
+// Update change a copy of the current config by fn, and reload the route table by it.
+// The updates are serialized, the route table is not changed if fn returns error or the result is invalid.
+func (r *RouteTable) Update(fn func(cfg *RouteConfig) error) error {
+	r.reloadLock.Lock()
+	defer r.reloadLock.Unlock()
+
+	cfg := r.Config()
+	if err := fn(cfg); nil != err {
+		return err
+	}
+
+	return r.doReload(cfg)
+}
+
+// Config returns a copy of the current config
+func (r *RouteTable) Config() *RouteConfig {
+	r.rwLock.RLock()
+	current := &RouteConfig{}
+	for _, cluster := range r.clusters {
+		current.Clusters = append(current.Clusters, cluster)
+	}
+	for _, svr := range r.svrs {
+		current.Servers = append(current.Servers, svr)
+	}
+	for addr, binded := range r.mapping {
+		for name := range binded {
+			current.Binds = append(current.Binds, &Bind{ServerAddr: addr, ClusterName: name})
+		}
+	}
+	for _, ang := range r.aggregations {
+		current.Aggregations = append(current.Aggregations, ang)
+	}
+	for _, routing := range r.routings {
+		current.Routings = append(current.Routings, routing)
+	}
+	// the aggregations and routings keep the config order, it is the tiebreak of the priority
+	sort.Slice(current.Aggregations, func(i, j int) bool {
+		return current.Aggregations[i].rank.order < current.Aggregations[j].rank.order
+	})
+	sort.Slice(current.Routings, func(i, j int) bool {
+		return current.Routings[i].rank.order < current.Routings[j].rank.order
+	})
+	data, _ := json.Marshal(current)
+	r.rwLock.RUnlock()
+
+	// the copy has no runtime state of the current structures
+	cfg := &RouteConfig{}
+	json.Unmarshal(data, cfg)
+	return cfg
+}
+
+// ServerStatuses returns the runtime status of all servers
+func (r *RouteTable) ServerStatuses() []*ServerStatus {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	statuses := make([]*ServerStatus, 0, len(r.svrs))
+	for _, svr := range r.svrs {
+		statuses = append(statuses, &ServerStatus{
+			Addr:        svr.Addr,
+			Status:      svr.Status,
+			Circuit:     svr.GetCircuit(),
+			Draining:    svr.IsDraining(),
+			CoolingDown: svr.IsCoolingDown(),
+			Ejected:     svr.IsEjected(),
+			ActiveConns: svr.GetActiveConns(),
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Addr < statuses[j].Addr
+	})
+	return statuses
+}
+
+// Stats returns the request stats of all servers and nodes
+func (r *RouteTable) Stats() ([]*ServerStats, []*NodeStats) {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	svrs := make([]*ServerStats, 0, len(r.svrs))
+	for _, svr := range r.svrs {
+		stats := &ServerStats{
+			RequestStatsSnapshot: svr.Stats().Snapshot(),
+			Addr:                 svr.Addr,
+			Status:               svr.Status,
+			Circuit:              svr.GetCircuit(),
+		}
+		stats.InFlight = svr.GetActiveConns()
+		stats.LastCheckAt, stats.LastCheckSucceed = svr.GetLastCheck()
+		svrs = append(svrs, stats)
+	}
+
+	var nodes []*NodeStats
+	for _, ang := range r.aggregations {
+		for index, node := range ang.Nodes {
+			nodes = append(nodes, &NodeStats{
+				RequestStatsSnapshot: node.Stats().Snapshot(),
+				AggregationURL:       ang.URL,
+				Index:                index,
+				ClusterName:          node.ClusterName,
+				URL:                  node.URL,
+			})
+		}
+	}
+
+	sort.Slice(svrs, func(i, j int) bool {
+		return svrs[i].Addr < svrs[j].Addr
+	})
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].AggregationURL != nodes[j].AggregationURL {
+			return nodes[i].AggregationURL < nodes[j].AggregationURL
+		}
+
+		return nodes[i].Index < nodes[j].Index
+	})
+	return svrs, nodes
+}
+
+// DrainServer stop or resume sending new requests to the server, the in-flight requests are not affected
+func (r *RouteTable) DrainServer(addr string, draining bool) error {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	svr, ok := r.svrs[addr]
+	if !ok {
+		return ErrServerNotFound
+	}
+
+	svr.draining.Set(draining)
+	log.Infof("Server <%s> draining <%t>", addr, draining)
+	return nil
+}
+
+func (r *RouteTable) doReload(cfg *RouteConfig) error {
+	snapshot, err := newRouteSnapshot(cfg)
+	if nil != err {
+		return err
+	}
+
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	// the status of server is not config
+	diffs := []*routeDiff{
+		diffRoute("clusters", toConfigs(r.clusters), toConfigs(snapshot.clusters)),
+		diffRoute("servers", toConfigs(r.svrs), toConfigs(snapshot.svrs), "status"),
+		diffRoute("binds", toBindConfigs(r.mapping), toBindConfigs(snapshot.mapping)),
+		diffRoute("aggregations", toConfigs(r.aggregations), toConfigs(snapshot.aggregations)),
+		diffRoute("routings", toConfigs(r.routings), toConfigs(snapshot.routings)),
+	}
+
+	for addr, svr := range snapshot.svrs {
+		old, ok := r.svrs[addr]
+		if ok && old.sameCheck(svr) {
+			old.updateFrom(svr)
+			snapshot.svrs[addr] = old
+			continue
+		}
+
+		// the server with the changed health check is removed and added again to restart the check
+		if ok {
+			old.stopCheck()
+			r.removeFromCheck(old)
+		}
+		r.doAddServer(svr)
+	}
+
+	for addr, svr := range r.svrs {
+		if _, ok := snapshot.svrs[addr]; !ok {
+			svr.stopCheck()
+			r.removeFromCheck(svr)
+		}
+	}
+
+	for addr, binded := range snapshot.mapping {
+		if svr := snapshot.svrs[addr]; svr.Status == Up {
+			for _, cluster := range binded {
+				cluster.bind(svr)
+			}
+		}
+	}
+
+	r.clusters = snapshot.clusters
+	r.svrs = snapshot.svrs
+	r.mapping = snapshot.mapping
+	r.aggregations = snapshot.aggregations
+	r.index = newAggregationIndex(r.aggregations)
+	r.routings = snapshot.routings
+
+	log.Infof("RouteTable reloaded, clusters <%d>, servers <%d>, aggregations <%d>, routings <%d>",
+		len(r.clusters), len(r.svrs), len(r.aggregations), len(r.routings))
+
+	for _, diff := range diffs {
+		if diff.changed() {
+			log.Infof("RouteTable reloaded %s, added <%v>, removed <%v>, modified <%v>",
+				diff.kind, diff.added, diff.removed, diff.modified)
+		}
+	}
+
+	return nil
+}
+
+// LoadRouteConfig load the routing config from the json file
+func LoadRouteConfig(file string) (*RouteConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if nil != err {
+		return nil, err
+	}
+
+	cfg := &RouteConfig{}
+	err = json.Unmarshal(data, cfg)
+	if nil != err {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// WatchFile check the routing config file every interval, and reload the route table when the file changed.
+// The changes in debounce are coalesced into one reload, the invalid config is logged and ignored.
+// It returns when the stopCh is closed.
+func (r *RouteTable) WatchFile(file string, interval, debounce time.Duration, stopCh <-chan struct{}) {
+	var modTime, changedAt time.Time
+	var size int64
+	var loaded []byte
+
+	if info, err := os.Stat(file); nil == err {
+		modTime, size = info.ModTime(), info.Size()
+		loaded, _ = ioutil.ReadFile(file)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Infof("RouteTable start watch file <%s>.", file)
+
+	for {
+		select {
+		case <-stopCh:
+			log.Infof("RouteTable stop watch file <%s>.", file)
+			return
+		case now := <-ticker.C:
+			info, err := os.Stat(file)
+			if nil != err {
+				continue
+			}
+
+			if !info.ModTime().Equal(modTime) || info.Size() != size {
+				modTime, size = info.ModTime(), info.Size()
+				changedAt = now
+				continue
+			}
+
+			if changedAt.IsZero() || now.Sub(changedAt) < debounce {
+				continue
+			}
+			changedAt = time.Time{}
+
+			data, err := ioutil.ReadFile(file)
+			if nil != err {
+				log.WarnErrorf(err, "RouteTable read file <%s> fail.", file)
+				continue
+			}
+
+			if bytes.Equal(data, loaded) {
+				continue
+			}
+			loaded = data
+
+			r.reloadData(file, data)
+		}
+	}
+}
+
+func (r *RouteTable) reloadData(file string, data []byte) {
+	cfg := &RouteConfig{}
+	err := json.Unmarshal(data, cfg)
+	if nil == err {
+		err = r.Reload(cfg)
+	}
+
+	if nil != err {
+		log.WarnErrorf(err, "RouteTable reload file <%s> fail, ignored.", file)
+	}
+}
+
+// newRouteSnapshot validate the cfg, and create the structures of route table
+func newRouteSnapshot(cfg *RouteConfig) (*routeSnapshot, error) {
+	s := &routeSnapshot{
+		clusters:     make(map[string]*Cluster),
+		svrs:         make(map[string]*Server),
+		mapping:      make(map[string]map[string]*Cluster),
+		aggregations: make(map[string]*Aggregation),
+		routings:     make(map[string]*Routing),
+	}
+
+	for _, cluster := range cfg.Clusters {
+		if _, ok := s.clusters[cluster.Name]; ok {
+			return nil, ErrClusterExists
+		}
+
+		if err := cluster.init(); nil != err {
+			return nil, err
+		}
+
+		s.clusters[cluster.Name] = cluster
+	}
+
+	for _, svr := range cfg.Servers {
+		if _, ok := s.svrs[svr.Addr]; ok {
+			return nil, ErrServerExists
+		}
+
+		s.svrs[svr.Addr] = svr
+		s.mapping[svr.Addr] = make(map[string]*Cluster)
+	}
+
+	for _, b := range cfg.Binds {
+		binded, ok := s.mapping[b.ServerAddr]
+		if !ok {
+			return nil, ErrServerNotFound
+		}
+
+		cluster, ok := s.clusters[b.ClusterName]
+		if !ok {
+			return nil, ErrClusterNotFound
+		}
+
+		if _, ok := binded[cluster.Name]; ok {
+			return nil, ErrBindExists
+		}
+
+		binded[cluster.Name] = cluster
+	}
+
+	for _, ang := range cfg.Aggregations {
+		if err := ang.compile(); nil != err {
+			return nil, err
+		}
+
+		if _, ok := s.aggregations[ang.URL]; ok {
+			return nil, ErrAggregationExists
+		}
+
+		for _, node := range ang.Nodes {
+			if _, ok := s.clusters[node.ClusterName]; !ok && !node.IsMocked() {
+				return nil, ErrClusterNotFound
+			}
+
+			if nil != node.Canary {
+				if _, ok := s.clusters[node.Canary.ClusterName]; !ok {
+					return nil, ErrClusterNotFound
+				}
+			}
+
+			if nil != node.Mirror {
+				if _, ok := s.clusters[node.Mirror.ClusterName]; !ok {
+					return nil, ErrClusterNotFound
+				}
+			}
+		}
+
+		s.aggregations[ang.URL] = ang
+	}
+
+	for _, routing := range cfg.Routings {
+		if _, ok := s.routings[routing.ID]; ok {
+			return nil, ErrRoutingExists
+		}
+
+		if err := routing.Check(); nil != err {
+			return nil, err
+		}
+
+		if _, ok := s.clusters[routing.ClusterName]; !ok {
+			return nil, ErrClusterNotFound
+		}
+
+		s.routings[routing.ID] = routing
+	}
+
+	return s, nil
+}
+
+// routeDiff the changes of a kind of config
+type routeDiff struct {
+	kind     string
+	added    []string
+	removed  []string
+	modified []string
+}
+
+func (d *routeDiff) changed() bool {
+	return len(d.added) > 0 || len(d.removed) > 0 || len(d.modified) > 0
+}
+
+// diffRoute compare the configs by the json, the ignores fields are not compared
+func diffRoute(kind string, olds, news map[string][]byte, ignores ...string) *routeDiff {
+	diff := &routeDiff{kind: kind}
+
+	for key, value := range news {
+		old, ok := olds[key]
+		if !ok {
+			diff.added = append(diff.added, key)
+		} else if !sameConfig(old, value, ignores) {
+			diff.modified = append(diff.modified, key)
+		}
+	}
+
+	for key := range olds {
+		if _, ok := news[key]; !ok {
+			diff.removed = append(diff.removed, key)
+		}
+	}
+
+	sort.Strings(diff.added)
+	sort.Strings(diff.removed)
+	sort.Strings(diff.modified)
+	return diff
+}
+
+func sameConfig(a, b []byte, ignores []string) bool {
+	var x, y map[string]interface{}
+	json.Unmarshal(a, &x)
+	json.Unmarshal(b, &y)
+
+	for _, field := range ignores {
+		delete(x, field)
+		delete(y, field)
+	}
+
+	return reflect.DeepEqual(x, y)
+}
+
+func toConfigs(values interface{}) map[string][]byte {
+	configs := make(map[string][]byte)
+
+	v := reflect.ValueOf(values)
+	for _, key := range v.MapKeys() {
+		data, _ := json.Marshal(v.MapIndex(key).Interface())
+		configs[key.String()] = data
+	}
+
+	return configs
+}
+
+func toBindConfigs(mapping map[string]map[string]*Cluster) map[string][]byte {
+	configs := make(map[string][]byte)
+
+	for addr, binded := range mapping {
+		for name := range binded {
+			configs[addr+","+name] = nil
+		}
+	}
+
+	return configs
+}
@@ -0,0 +1,390 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// emptyStore a store without data only for test
+type emptyStore struct{}
+
+func (s emptyStore) SaveBind(bind *Bind) error                        { return nil }
+func (s emptyStore) UnBind(bind *Bind) error                          { return nil }
+func (s emptyStore) GetBinds() ([]*Bind, error)                       { return nil, nil }
+func (s emptyStore) SaveCluster(cluster *Cluster) error               { return nil }
+func (s emptyStore) UpdateCluster(cluster *Cluster) error             { return nil }
+func (s emptyStore) DeleteCluster(name string) error                  { return nil }
+func (s emptyStore) GetClusters() ([]*Cluster, error)                 { return nil, nil }
+func (s emptyStore) GetCluster(name string, b bool) (*Cluster, error) { return nil, nil }
+func (s emptyStore) GetBindedClusters(addr string) ([]string, error)  { return nil, nil }
+func (s emptyStore) SaveServer(svr *Server) error                     { return nil }
+func (s emptyStore) UpdateServer(svr *Server) error                   { return nil }
+func (s emptyStore) DeleteServer(addr string) error                   { return nil }
+func (s emptyStore) GetServers() ([]*Server, error)                   { return nil, nil }
+func (s emptyStore) GetServer(addr string, b bool) (*Server, error)   { return nil, nil }
+func (s emptyStore) GetBindedServers(name string) ([]string, error)   { return nil, nil }
+func (s emptyStore) SaveAggregation(agn *Aggregation) error           { return nil }
+func (s emptyStore) UpdateAggregation(agn *Aggregation) error         { return nil }
+func (s emptyStore) DeleteAggregation(url string) error               { return nil }
+func (s emptyStore) GetAggregations() ([]*Aggregation, error)         { return nil, nil }
+func (s emptyStore) SaveRouting(routing *Routing) error               { return nil }
+func (s emptyStore) GetRoutings() ([]*Routing, error)                 { return nil, nil }
+func (s emptyStore) Clean() error                                     { return nil }
+func (s emptyStore) GC() error                                        { return nil }
+
+func (s emptyStore) Watch(evtCh chan *Evt, stopCh chan bool) error {
+	<-stopCh
+	return nil
+}
+
+// newTestRouteConfig create the config of version, the servers and clusters are named by the version
+func newTestRouteConfig(version string) *RouteConfig {
+	cfg := &RouteConfig{}
+	ang := &Aggregation{URL: "^/api$"}
+
+	for i := 0; i < 2; i++ {
+		name := fmt.Sprintf("%s-%d", version, i)
+		addr := fmt.Sprintf("127.0.0.%d:80", len(cfg.Servers)+1)
+
+		cfg.Clusters = append(cfg.Clusters, &Cluster{Name: name, Pattern: "^/", LbName: "ROUNDROBIN"})
+		cfg.Servers = append(cfg.Servers, &Server{Addr: addr})
+		cfg.Binds = append(cfg.Binds, &Bind{ClusterName: name, ServerAddr: addr})
+		ang.Nodes = append(ang.Nodes, &Node{ClusterName: name, URL: "/" + name})
+	}
+
+	cfg.Aggregations = append(cfg.Aggregations, ang)
+	return cfg
+}
+
+func TestReload(t *testing.T) {
+	r := NewRouteTable(emptyStore{})
+
+	err := r.Reload(newTestRouteConfig("v1"))
+	if nil != err {
+		t.Fatalf("reload err: %s", err)
+	}
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/api")
+
+	results := r.Select(req)
+	if len(results) != 2 || results[0].Node.ClusterName != "v1-0" || nil == results[0].Svr {
+		t.Fatalf("expect:<v1-0>, acture:<%+v>", results)
+	}
+
+	// the invalid config is rejected, and the route table is not changed
+	invalid := newTestRouteConfig("v2")
+	invalid.Binds = append(invalid.Binds, &Bind{ClusterName: "unknown", ServerAddr: "127.0.0.1:80"})
+	if err := r.Reload(invalid); err != ErrClusterNotFound {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrClusterNotFound, err)
+	}
+
+	invalid = newTestRouteConfig("v2")
+	invalid.Aggregations[0].URL = "^/api($"
+	if err := r.Reload(invalid); nil == err {
+		t.Errorf("expect the invalid aggregation is rejected")
+	}
+
+	results = r.Select(req)
+	if len(results) != 2 || results[0].Node.ClusterName != "v1-0" {
+		t.Errorf("expect:<v1-0>, acture:<%+v>", results)
+	}
+}
+
+func TestReloadServerCheck(t *testing.T) {
+	r := NewRouteTable(emptyStore{})
+
+	cfg := newTestRouteConfig("v1")
+	if err := r.Reload(cfg); nil != err {
+		t.Fatalf("reload err: %s", err)
+	}
+
+	svr := r.svrs[cfg.Servers[0].Addr]
+	if svr.Status != Up {
+		t.Fatalf("expect:<%v>, acture:<%v>", Up, svr.Status)
+	}
+
+	// the server keep the status if the health check is not changed
+	cfg = newTestRouteConfig("v1")
+	cfg.Servers[0].Weight = 2
+	if err := r.Reload(cfg); nil != err {
+		t.Fatalf("reload err: %s", err)
+	}
+
+	if value := r.svrs[cfg.Servers[0].Addr]; value != svr || value.Weight != 2 {
+		t.Errorf("expect:<%p,2>, acture:<%p,%d>", svr, value, value.Weight)
+	}
+
+	// the server is added again to check by the new check path
+	cfg = newTestRouteConfig("v1")
+	cfg.Servers[0].CheckPath = "/health"
+	cfg.Servers[0].CheckDuration = 60
+	if err := r.Reload(cfg); nil != err {
+		t.Fatalf("reload err: %s", err)
+	}
+
+	value := r.svrs[cfg.Servers[0].Addr]
+	if value == svr || value.CheckPath != "/health" || value.Status != Down {
+		t.Errorf("expect:<new,/health,%v>, acture:<%v,%s,%v>", Down, value == svr, value.CheckPath, value.Status)
+	}
+
+	if !svr.checkStopped.Get() {
+		t.Errorf("expect the check of the old server stopped")
+	}
+}
+
+func TestReloadConcurrentSelect(t *testing.T) {
+	r := NewRouteTable(emptyStore{})
+	r.Reload(newTestRouteConfig("v0"))
+
+	stopped := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req := &fasthttp.Request{}
+			req.SetRequestURI("/api")
+
+			for {
+				select {
+				case <-stopped:
+					return
+				default:
+				}
+
+				results := r.Select(req)
+				if len(results) != 2 {
+					t.Errorf("expect:<%d>, acture:<%d>", 2, len(results))
+					return
+				}
+
+				// all the results are in the same version
+				version := results[0].Node.ClusterName[:2]
+				for _, result := range results {
+					if result.Node.ClusterName[:2] != version || nil == result.Cluster ||
+						result.Cluster.Name != result.Node.ClusterName || nil == result.Svr {
+						t.Errorf("torn read: <%+v>", result)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= 100; i++ {
+		if err := r.Reload(newTestRouteConfig(fmt.Sprintf("v%d", i%10))); nil != err {
+			t.Fatalf("reload err: %s", err)
+		}
+	}
+
+	close(stopped)
+	wg.Wait()
+}
+
+func TestWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "route")
+	if nil != err {
+		t.Fatalf("create dir err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "route.json")
+	write := func(data []byte) {
+		if err := ioutil.WriteFile(file, data, 0600); nil != err {
+			t.Fatalf("write file err: %s", err)
+		}
+	}
+
+	cfg := newTestRouteConfig("v1")
+	data, _ := json.Marshal(cfg)
+	write(data)
+
+	cfg, err = LoadRouteConfig(file)
+	if nil != err {
+		t.Fatalf("load err: %s", err)
+	}
+
+	r := NewRouteTable(emptyStore{})
+	if err := r.Reload(cfg); nil != err {
+		t.Fatalf("reload err: %s", err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go r.WatchFile(file, 10*time.Millisecond, 50*time.Millisecond, stopCh)
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/new")
+
+	waitSelect := func() []*RouteResult {
+		for i := 0; i < 100; i++ {
+			if results := r.Select(req); len(results) > 0 && nil != results[0].Node {
+				return results
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		return nil
+	}
+
+	// the invalid config is ignored
+	time.Sleep(20 * time.Millisecond)
+	write([]byte("{invalid"))
+	time.Sleep(200 * time.Millisecond)
+
+	// the new route takes effect
+	cfg = newTestRouteConfig("v2")
+	cfg.Aggregations = append(cfg.Aggregations, &Aggregation{
+		URL:   "^/new$",
+		Nodes: []*Node{&Node{ClusterName: "v2-0", URL: "/new"}},
+	})
+	data, _ = json.Marshal(cfg)
+	write(data)
+
+	results := waitSelect()
+	if len(results) != 1 || results[0].Node.ClusterName != "v2-0" {
+		t.Errorf("expect:<v2-0>, acture:<%+v>", results)
+	}
+}
+
+func TestSelectPriority(t *testing.T) {
+	cfg := &RouteConfig{}
+	for _, name := range []string{"api", "users", "admin", "orders", "orders-exact", "low", "high"} {
+		cfg.Clusters = append(cfg.Clusters, &Cluster{Name: name, Pattern: "^/", LbName: "ROUNDROBIN"})
+	}
+
+	for _, ang := range []*Aggregation{
+		&Aggregation{URL: "^/api/", Nodes: []*Node{&Node{ClusterName: "api"}}},
+		&Aggregation{URL: "^/api/users", Nodes: []*Node{&Node{ClusterName: "users"}}},
+		&Aggregation{URL: "admin", Priority: 10, Nodes: []*Node{&Node{ClusterName: "admin"}}},
+		// the same prefix, the former in config wins
+		&Aggregation{URL: "^/api/orders", Nodes: []*Node{&Node{ClusterName: "orders"}}},
+		&Aggregation{URL: "^/api/orders$", Nodes: []*Node{&Node{ClusterName: "orders-exact"}}},
+	} {
+		cfg.Aggregations = append(cfg.Aggregations, ang)
+	}
+
+	for name, priority := range map[string]int{"low": 0, "high": 1} {
+		routing, err := NewRouting(`desc = "test";
+		deadline = 100;
+		rule = ["$query_id == 1"];
+		`, name, "^/route")
+		if nil != err {
+			t.Fatalf("create routing err: %s", err)
+		}
+
+		routing.Priority = priority
+		cfg.Routings = append(cfg.Routings, routing)
+	}
+
+	r := NewRouteTable(emptyStore{})
+	if err := r.Reload(cfg); nil != err {
+		t.Fatalf("reload err: %s", err)
+	}
+
+	cases := []struct {
+		uri    string
+		expect string
+	}{
+		{uri: "/api/products", expect: "api"},
+		{uri: "/api/users/1", expect: "users"},
+		{uri: "/api/users/admin", expect: "admin"},
+		{uri: "/api/orders", expect: "orders"},
+		{uri: "/route?id=1", expect: "high"},
+	}
+
+	for i := 0; i < 20; i++ {
+		for _, c := range cases {
+			req := &fasthttp.Request{}
+			req.SetRequestURI(c.uri)
+
+			results := r.Select(req)
+			if len(results) != 1 || nil == results[0].Cluster || results[0].Cluster.Name != c.expect {
+				t.Fatalf("%s expect:<%s>, acture:<%+v>", c.uri, c.expect, results)
+			}
+		}
+	}
+
+	// the config order is kept
+	current := r.Config()
+	for i, ang := range cfg.Aggregations {
+		if current.Aggregations[i].URL != ang.URL {
+			t.Errorf("expect:<%s>, acture:<%s>", ang.URL, current.Aggregations[i].URL)
+		}
+	}
+}
+
+func TestSelectPathTemplate(t *testing.T) {
+	cfg := &RouteConfig{}
+	for _, name := range []string{"orders", "user", "new", "static", "regexp", "fallback"} {
+		cfg.Clusters = append(cfg.Clusters, &Cluster{Name: name, Pattern: "^/", LbName: "ROUNDROBIN"})
+	}
+
+	cfg.Aggregations = []*Aggregation{
+		&Aggregation{Path: "/users/{id}/orders/{order}", Nodes: []*Node{&Node{ClusterName: "orders"}}},
+		&Aggregation{Path: "/users/{id}", Nodes: []*Node{&Node{ClusterName: "user"}}},
+		&Aggregation{Path: "/users/new", Nodes: []*Node{&Node{ClusterName: "new"}}},
+		&Aggregation{Path: "/static/*file", Nodes: []*Node{&Node{ClusterName: "static"}}},
+		&Aggregation{Path: "/*", Nodes: []*Node{&Node{ClusterName: "fallback"}}},
+		&Aggregation{URL: "^/static/v2/", Nodes: []*Node{&Node{ClusterName: "regexp"}}},
+	}
+
+	r := NewRouteTable(emptyStore{})
+	if err := r.Reload(cfg); nil != err {
+		t.Fatalf("reload err: %s", err)
+	}
+
+	cases := []struct {
+		uri    string
+		expect string
+		params map[string]string
+	}{
+		{uri: "/users/1/orders/2?a=b", expect: "orders", params: map[string]string{"id": "1", "order": "2"}},
+		{uri: "/users/1", expect: "user", params: map[string]string{"id": "1"}},
+		// the static segment before the param
+		{uri: "/users/new", expect: "new"},
+		{uri: "/static/js/app.js", expect: "static", params: map[string]string{"file": "js/app.js"}},
+		{uri: "/static/", expect: "static", params: map[string]string{"file": ""}},
+		// the longer literal prefix of the regexp
+		{uri: "/static/v2/app.js", expect: "regexp"},
+		{uri: "/users/1/orders", expect: "fallback", params: map[string]string{PathCatchAllParam: "users/1/orders"}},
+		{uri: "/users/", expect: "fallback", params: map[string]string{PathCatchAllParam: "users/"}},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		req.SetRequestURI(c.uri)
+
+		results := r.Select(req)
+		if len(results) != 1 || results[0].Cluster.Name != c.expect {
+			t.Errorf("%s expect:<%s>, acture:<%+v>", c.uri, c.expect, results)
+			continue
+		}
+
+		if len(results[0].Params) != len(c.params) {
+			t.Errorf("%s expect:<%v>, acture:<%v>", c.uri, c.params, results[0].Params)
+		}
+		for name, value := range c.params {
+			if results[0].Params[name] != value {
+				t.Errorf("%s expect:<%v>, acture:<%v>", c.uri, c.params, results[0].Params)
+			}
+		}
+	}
+
+	for _, path := range []string{"users", "/users/{}", "/static/*/x", "/users/{id}x"} {
+		if err := (&Aggregation{Path: path}).compile(); err != ErrInvalidPathTemplate {
+			t.Errorf("%s expect:<%s>, acture:<%v>", path, ErrInvalidPathTemplate, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+const (
+	// maxUnescapeRounds the path escaped more times is checked by the path unescaped by these rounds
+	maxUnescapeRounds = 8
+)
+
+var (
+	// ErrMaliciousPath the rewritten path has the null bytes or the disguised traversal sequences
+	ErrMaliciousPath = errors.New("malicious path")
+)
+
+// CleanRewritePath returns the uri rewritten from the client input with the dot segments of the path removed,
+// the path never goes above the root. The path with the null bytes or the traversal sequences disguised from
+// the gateway is rejected, e.g. ..%2f, %2e%2e/ and ..;/ are decoded or normalized by some servers to ../
+func CleanRewritePath(uri string) (string, error) {
+	if strings.IndexByte(uri, 0) >= 0 {
+		return "", ErrMaliciousPath
+	}
+
+	prefix, path, query := splitRewriteURI(uri)
+	unescaped := unescapePath(path)
+	if strings.IndexByte(unescaped, 0) >= 0 {
+		return "", ErrMaliciousPath
+	}
+
+	plain := countDotSegments(strings.Split(path, "/"), false)
+	if countDotSegments(strings.FieldsFunc(unescaped, isPathSeparator), true) > plain {
+		return "", ErrMaliciousPath
+	}
+
+	if 0 == plain {
+		return uri, nil
+	}
+
+	return prefix + removeDotSegments(path) + query, nil
+}
+
+// splitRewriteURI split the uri to the scheme and host, the path and the query string with the leading ?
+func splitRewriteURI(uri string) (prefix, path, query string) {
+	path = uri
+	if index := strings.IndexByte(path, '?'); index >= 0 {
+		path, query = path[:index], path[index:]
+	}
+
+	if index := strings.Index(path, "://"); index >= 0 && !strings.HasPrefix(path, "/") {
+		prefix, path = path[:index+3], path[index+3:]
+		index = strings.IndexByte(path, '/')
+		if index < 0 {
+			return prefix + path, "", query
+		}
+		prefix, path = prefix+path[:index], path[index:]
+	}
+
+	return prefix, path, query
+}
+
+func unescapePath(path string) string {
+	for i := 0; i < maxUnescapeRounds && strings.IndexByte(path, '%') >= 0; i++ {
+		unescaped, err := url.PathUnescape(path)
+		if nil != err || unescaped == path {
+			break
+		}
+		path = unescaped
+	}
+
+	return path
+}
+
+func isPathSeparator(c rune) bool {
+	return '/' == c || '\\' == c
+}
+
+// countDotSegments returns the count of . and .. segments, the ;params of the segments are removed if trimParams
+func countDotSegments(segments []string, trimParams bool) int {
+	count := 0
+	for _, segment := range segments {
+		if index := strings.IndexByte(segment, ';'); trimParams && index >= 0 {
+			segment = segment[:index]
+		}
+
+		if "." == segment || ".." == segment {
+			count++
+		}
+	}
+
+	return count
+}
+
+// removeDotSegments remove the . and .. segments of the path, the .. of the root is ignored
+func removeDotSegments(path string) string {
+	parts := strings.Split(path, "/")
+	segments := make([]string, 0, len(parts))
+	for index, part := range parts {
+		switch part {
+		case ".":
+		case "..":
+			if len(segments) > 1 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, part)
+			continue
+		}
+
+		// the path ends with the dot segment is a directory, e.g. /users/1/.. -> /users/
+		if index == len(parts)-1 {
+			segments = append(segments, "")
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
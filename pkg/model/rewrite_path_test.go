@@ -0,0 +1,39 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestCleanRewritePath(t *testing.T) {
+	cases := []struct {
+		uri    string
+		expect string
+		err    error
+	}{
+		{uri: "/users/1?id=1", expect: "/users/1?id=1"},
+		{uri: "/internal/../users?path=../a", expect: "/users?path=../a"},
+		{uri: "/internal/./users/", expect: "/internal/users/"},
+		{uri: "/internal/users/..", expect: "/internal/"},
+		{uri: "/../../etc/passwd", expect: "/etc/passwd"},
+		{uri: "http://example.com/a/../b?c", expect: "http://example.com/b?c"},
+		{uri: "/files/...", expect: "/files/..."},
+		{uri: "/files/a;b", expect: "/files/a;b"},
+		{uri: "/users?q=%00", expect: "/users?q=%00"},
+		{uri: "/internal/..%2fadmin", err: ErrMaliciousPath},
+		{uri: "/internal/..%2Fadmin", err: ErrMaliciousPath},
+		{uri: "/internal/%2e%2e/admin", err: ErrMaliciousPath},
+		{uri: "/internal/..%252fadmin", err: ErrMaliciousPath},
+		{uri: "/internal/..;/admin", err: ErrMaliciousPath},
+		{uri: "/internal/..\\admin", err: ErrMaliciousPath},
+		{uri: "/internal/admin%00.json", err: ErrMaliciousPath},
+		{uri: "/internal/admin%2500.json", err: ErrMaliciousPath},
+		{uri: "/internal/admin\x00.json", err: ErrMaliciousPath},
+	}
+
+	for _, c := range cases {
+		uri, err := CleanRewritePath(c.uri)
+		if uri != c.expect || err != c.err {
+			t.Errorf("%q expect:<%s,%v>, acture:<%s,%v>", c.uri, c.expect, c.err, uri, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package model
+
+import (
+	"regexp/syntax"
+	"unicode/utf8"
+
+	"github.com/valyala/fasthttp"
+)
+
+// aggregationIndex the index of the aggregations of route table, the path templates are matched by the trie of segments,
+// the regexp aggregations anchored by a literal prefix are looked up by the radix tree of prefixes,
+// so only the regexps of the matched prefixes are executed, the others are matched one by one
+type aggregationIndex struct {
+	templates map[string]*Aggregation
+	paths     *pathTrie
+	prefixes  *prefixTree
+	others    map[string]*Aggregation
+}
+
+func newAggregationIndex(angs map[string]*Aggregation) *aggregationIndex {
+	idx := &aggregationIndex{
+		templates: make(map[string]*Aggregation),
+		prefixes:  &prefixTree{},
+		others:    make(map[string]*Aggregation),
+	}
+
+	for _, ang := range angs {
+		idx.doAdd(ang)
+	}
+	idx.paths = newPathTrie(idx.templates)
+
+	return idx
+}
+
+func (idx *aggregationIndex) add(ang *Aggregation) {
+	idx.doAdd(ang)
+
+	if nil != ang.path {
+		idx.paths = newPathTrie(idx.templates)
+	}
+}
+
+func (idx *aggregationIndex) doAdd(ang *Aggregation) {
+	if nil != ang.path {
+		idx.templates[ang.URL] = ang
+	} else if ang.anchored {
+		idx.prefixes.add(ang.prefix, ang)
+	} else {
+		idx.others[ang.URL] = ang
+	}
+}
+
+func (idx *aggregationIndex) remove(ang *Aggregation) {
+	if nil != ang.path {
+		delete(idx.templates, ang.URL)
+		idx.paths = newPathTrie(idx.templates)
+	} else if ang.anchored {
+		idx.prefixes.remove(ang.prefix, ang)
+	} else {
+		delete(idx.others, ang.URL)
+	}
+}
+
+// match returns the selected aggregation of req and the path segments matched by the path template,
+// the selection is the same as matching all the aggregations one by one
+func (idx *aggregationIndex) match(req *fasthttp.Request) (selected *Aggregation, segments []string) {
+	// the precedence of the path templates is kept if the priorities are same
+	if nil != idx.paths {
+		segments = splitPath(req.URI().Path())
+		idx.paths.match(segments, func(agn *Aggregation) {
+			if (nil == selected || agn.Priority > selected.Priority) && agn.hasMethodNode(req) {
+				selected = agn
+			}
+		})
+	}
+
+	visit := func(agn *Aggregation) {
+		if (nil == selected || agn.rank.before(selected.rank)) && agn.matches(req) && agn.hasMethodNode(req) {
+			selected = agn
+		}
+	}
+
+	idx.prefixes.match(req.URI().RequestURI(), visit)
+	for _, agn := range idx.others {
+		visit(agn)
+	}
+
+	return selected, segments
+}
+
+// anchoredPrefix returns the literal prefix of the URI matched by the regexp,
+// returns false if the regexp is not anchored at the begin of text
+func anchoredPrefix(expr string) (string, bool) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if nil != err {
+		return "", false
+	}
+
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+
+	if len(subs) == 0 || subs[0].Op != syntax.OpBeginText {
+		return "", false
+	}
+
+	var prefix []rune
+	for _, sub := range subs[1:] {
+		if sub.Op != syntax.OpLiteral || sub.Flags&syntax.FoldCase != 0 {
+			break
+		}
+
+		for _, c := range sub.Rune {
+			// the invalid bytes of URI are matched by the RuneError
+			if c == utf8.RuneError {
+				return string(prefix), true
+			}
+			prefix = append(prefix, c)
+		}
+	}
+
+	return string(prefix), true
+}
+
+// prefixTree the radix tree of the literal prefixes, every node has the aggregations of the prefix from root
+type prefixTree struct {
+	prefix   string
+	children []*prefixTree
+	values   []*Aggregation
+}
+
+func (t *prefixTree) add(key string, ang *Aggregation) {
+	node := t
+	for "" != key {
+		child := node.child(key[0])
+		if nil == child {
+			node.children = append(node.children, &prefixTree{prefix: key, values: []*Aggregation{ang}})
+			return
+		}
+
+		n := commonPrefixLen(key, child.prefix)
+		if n < len(child.prefix) {
+			// split the child at the common prefix
+			split := &prefixTree{
+				prefix:   child.prefix[n:],
+				children: child.children,
+				values:   child.values,
+			}
+			child.prefix = child.prefix[:n]
+			child.children = []*prefixTree{split}
+			child.values = nil
+		}
+
+		node = child
+		key = key[n:]
+	}
+
+	node.values = append(node.values, ang)
+}
+
+// remove remove the aggregation of key, returns true if the node is empty and should be removed from the parent
+func (t *prefixTree) remove(key string, ang *Aggregation) bool {
+	if "" == key {
+		for i, value := range t.values {
+			if value == ang {
+				t.values = append(t.values[:i], t.values[i+1:]...)
+				break
+			}
+		}
+	} else if child := t.child(key[0]); nil != child && len(key) >= len(child.prefix) && key[:len(child.prefix)] == child.prefix {
+		if child.remove(key[len(child.prefix):], ang) {
+			t.removeChild(child)
+		}
+	}
+
+	return len(t.values) == 0 && len(t.children) == 0
+}
+
+// match visit the aggregations of all the prefixes of key
+func (t *prefixTree) match(key []byte, visit func(*Aggregation)) {
+	node := t
+	for {
+		for _, ang := range node.values {
+			visit(ang)
+		}
+
+		if len(key) == 0 {
+			return
+		}
+
+		child := node.child(key[0])
+		if nil == child || len(key) < len(child.prefix) || string(key[:len(child.prefix)]) != child.prefix {
+			return
+		}
+
+		node = child
+		key = key[len(child.prefix):]
+	}
+}
+
+func (t *prefixTree) child(c byte) *prefixTree {
+	for _, child := range t.children {
+		if child.prefix[0] == c {
+			return child
+		}
+	}
+
+	return nil
+}
+
+func (t *prefixTree) removeChild(target *prefixTree) {
+	for i, child := range t.children {
+		if child == target {
+			t.children = append(t.children[:i], t.children[i+1:]...)
+			return
+		}
+	}
+}
+
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+
+	return n
+}
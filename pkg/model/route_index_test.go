@@ -0,0 +1,144 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+// linearSelect select the aggregation by matching all the regexp aggregations one by one
+func linearSelect(angs map[string]*Aggregation, req *fasthttp.Request) *Aggregation {
+	var selected *Aggregation
+	for _, agn := range angs {
+		if (nil == selected || agn.rank.before(selected.rank)) && agn.matches(req) && agn.hasMethodNode(req) {
+			selected = agn
+		}
+	}
+
+	return selected
+}
+
+func newTestIndexAggregations(t testing.TB, urls map[string]int) map[string]*Aggregation {
+	angs := make(map[string]*Aggregation)
+	for url, priority := range urls {
+		ang := &Aggregation{URL: url, Priority: priority, Nodes: []*Node{&Node{ClusterName: "app"}}}
+		if err := ang.compile(); nil != err {
+			t.Fatalf("compile %s err: %s", url, err)
+		}
+		angs[url] = ang
+	}
+
+	return angs
+}
+
+func TestAnchoredPrefix(t *testing.T) {
+	cases := []struct {
+		expr     string
+		prefix   string
+		anchored bool
+	}{
+		{expr: "^/api/v1/", prefix: "/api/v1/", anchored: true},
+		{expr: "^/api/(v1|v2)/users", prefix: "/api/", anchored: true},
+		{expr: "^/api/users?", prefix: "/api/user", anchored: true},
+		{expr: "^.*", prefix: "", anchored: true},
+		{expr: "(?i)^/api/", prefix: "", anchored: true},
+		{expr: "/api/", prefix: "", anchored: false},
+		{expr: "^/a|^/b", prefix: "", anchored: false},
+		{expr: "(?m)^/api/", prefix: "", anchored: false},
+	}
+
+	for _, c := range cases {
+		prefix, anchored := anchoredPrefix(c.expr)
+		if prefix != c.prefix || anchored != c.anchored {
+			t.Errorf("%s expect:<%s, %v>, acture:<%s, %v>", c.expr, c.prefix, c.anchored, prefix, anchored)
+		}
+	}
+}
+
+func TestAggregationIndex(t *testing.T) {
+	angs := newTestIndexAggregations(t, map[string]int{
+		"^/api/":             0,
+		"^/api/v1/":          0,
+		"^/api/v1/users$":    0,
+		"^/api/(v1|v2)/":     1,
+		"^/api/v2/orders":    0,
+		"^/apis":             0,
+		"^/static/.*\\.js$":  0,
+		"(?i)^/admin/":       0,
+		"^/a|^/b":            0,
+		"users":              0,
+		"^.*\\?debug=1":      2,
+		"^/health$":          0,
+		"^/health/":          0,
+		"^/api/v1/users\\?":  0,
+		"^/\\x{FFFD}invalid": 0,
+	})
+
+	idx := newAggregationIndex(angs)
+	uris := []string{
+		"/", "/api", "/api/", "/api/v1/", "/api/v1/users", "/api/v1/users?id=1", "/api/v2/orders",
+		"/api/v3/", "/apis/1", "/static/app.js", "/static/app.css", "/ADMIN/1", "/admin/1", "/a", "/b/1",
+		"/orders/users", "/health", "/health/check", "/api/v1/?debug=1", "/x", "/\xffinvalid",
+	}
+
+	check := func() {
+		for _, uri := range uris {
+			req := &fasthttp.Request{}
+			req.SetRequestURI(uri)
+
+			expect := linearSelect(angs, req)
+			selected, _ := idx.match(req)
+			if expect != selected {
+				t.Errorf("%s expect:<%+v>, acture:<%+v>", uri, expect, selected)
+			}
+		}
+	}
+	check()
+
+	// the index is updated with the aggregations
+	for _, url := range []string{"^/api/v1/", "^/api/(v1|v2)/", "users", "^/health$"} {
+		idx.remove(angs[url])
+		delete(angs, url)
+		check()
+	}
+
+	for url, ang := range newTestIndexAggregations(t, map[string]int{"^/api/v1/": 0, "^/he": 0, "^/": 0}) {
+		angs[url] = ang
+		idx.add(ang)
+	}
+	check()
+}
+
+func newBenchmarkIndexAggregations(b *testing.B, count int) map[string]*Aggregation {
+	urls := make(map[string]int, count)
+	for i := 0; i < count; i++ {
+		urls[fmt.Sprintf("^/svc%d/api/", i)] = 0
+	}
+	urls["^/svc[0-9]+/health$"] = 0
+	urls["\\?debug=1"] = 1
+
+	return newTestIndexAggregations(b, urls)
+}
+
+func BenchmarkSelectAggregation(b *testing.B) {
+	for _, count := range []int{1000, 10000} {
+		angs := newBenchmarkIndexAggregations(b, count)
+		idx := newAggregationIndex(angs)
+
+		req := &fasthttp.Request{}
+		req.SetRequestURI(fmt.Sprintf("/svc%d/api/users?id=1", count/2))
+
+		b.Run(fmt.Sprintf("linear-%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				linearSelect(angs, req)
+			}
+		})
+
+		b.Run(fmt.Sprintf("index-%d", count), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				idx.match(req)
+			}
+		})
+	}
+}
@@ -80,7 +80,11 @@ type Routing struct {
 	ID          string `json:"id,omitempty"`
 	Cfg         string `json:"cfg,omitempty"`
 	URL         string `json:"url,omitempty"`
+	// Priority the routing of the highest priority is selected if the request matches more than one,
+	// the ties are broken by the longer literal prefix of url, then the config order
+	Priority int `json:"priority,omitempty"`
 
+	rank     routeRank
 	desc     string
 	deadline int64
 	regexp   *regexp.Regexp
@@ -143,6 +147,7 @@ func (r *Routing) init() error {
 	}
 
 	r.regexp = reg
+	r.rank = newRouteRank(r.Priority, reg)
 
 	cfg, err := forge.ParseString(r.Cfg)
 
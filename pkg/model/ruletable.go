@@ -2,7 +2,8 @@ package model
 
 import (
 	"errors"
-	"regexp"
+	"io"
+	"net/http"
 	"sync"
 	"time"
 
@@ -38,20 +39,42 @@ var (
 type RouteResult struct {
 	Aggregation *Aggregation
 	Node        *Node
+	Cluster     *Cluster
 	Svr         *Server
 	Err         error
 	Code        int
 	Res         *fasthttp.Response
+	Stream      io.ReadCloser
 	Merge       bool
+	// Canary the request is split to the canary cluster of node
+	Canary bool
+	// Deadline the deadline of the merge, the sub-request is canceled after it
+	Deadline time.Time
+	// Params the params of the path template of aggregation
+	Params map[string]string
+	// RequestID and ClientIP are resolved from the client request before the merge sub-requests run
+	// concurrently, the headers of the shared client request are not safe to read by them
+	RequestID string
+	ClientIP  string
 }
 
 // Release release resp
 func (result *RouteResult) Release() {
+	result.CloseStream()
+
 	if nil != result.Res {
 		fasthttp.ReleaseResponse(result.Res)
 	}
 }
 
+// CloseStream close the response body stream
+func (result *RouteResult) CloseStream() {
+	if nil != result.Stream {
+		result.Stream.Close()
+		result.Stream = nil
+	}
+}
+
 // NeedRewrite need rewrite
 func (result *RouteResult) NeedRewrite() bool {
 	return result.Node != nil && result.Node.Rewrite != ""
@@ -60,7 +83,7 @@ func (result *RouteResult) NeedRewrite() bool {
 // GetRealPath get real path
 func (result *RouteResult) GetRealPath(req *fasthttp.Request) string {
 	if nil != result.Node {
-		return result.Aggregation.getNodeURL(req, result.Node)
+		return result.Aggregation.getNodeURL(req, result.Node, result.Params)
 	}
 
 	return ""
@@ -68,13 +91,18 @@ func (result *RouteResult) GetRealPath(req *fasthttp.Request) string {
 
 // RouteTable route table
 type RouteTable struct {
-	rwLock *sync.RWMutex
+	rwLock     *sync.RWMutex
+	reloadLock sync.Mutex
 
 	clusters     map[string]*Cluster
 	svrs         map[string]*Server
 	mapping      map[string]map[string]*Cluster
 	aggregations map[string]*Aggregation
 	routings     map[string]*Routing
+	// index the index of aggregations, to select the aggregation without matching all of them
+	index *aggregationIndex
+	// defaultCluster the cluster of the requests matched nothing, the requests are not routed if it's empty
+	defaultCluster string
 
 	tw             *goetty.HashedTimeWheel
 	evtChan        chan *Server
@@ -100,6 +128,7 @@ func NewRouteTable(store Store) *RouteTable {
 		clusters:     make(map[string]*Cluster),
 		svrs:         make(map[string]*Server),
 		aggregations: make(map[string]*Aggregation),
+		index:        newAggregationIndex(nil),
 		routings:     make(map[string]*Routing),
 		mapping:      make(map[string]map[string]*Cluster), // serverAddr -> map[clusterName]*Cluster
 
@@ -110,6 +139,7 @@ func NewRouteTable(store Store) *RouteTable {
 
 	go rt.changed()
 	go rt.watch()
+	tw.AddWithId(outlierDetectTick, outlierDetectKey, rt.detectOutliers)
 
 	return rt
 }
@@ -166,15 +196,20 @@ func (r *RouteTable) AddNewAggregation(ang *Aggregation) error {
 	r.rwLock.Lock()
 	defer r.rwLock.Unlock()
 
+	// the URL of path template is set by compile
+	err := ang.compile()
+	if nil != err {
+		return err
+	}
+
 	_, ok := r.aggregations[ang.URL]
 
 	if ok {
 		return ErrAggregationExists
 	}
 
-	ang.Pattern = regexp.MustCompile(ang.URL)
-
 	r.aggregations[ang.URL] = ang
+	r.index.add(ang)
 
 	log.Infof("Aggregation <%s> added", ang.URL)
 
@@ -186,13 +221,23 @@ func (r *RouteTable) UpdateAggregation(ang *Aggregation) error {
 	r.rwLock.Lock()
 	defer r.rwLock.Unlock()
 
-	old, ok := r.aggregations[ang.URL]
+	err := ang.compile()
+	if nil != err {
+		return err
+	}
+
+	_, ok := r.aggregations[ang.URL]
 
 	if !ok {
 		return ErrAggregationNotFound
 	}
 
-	old.updateFrom(ang)
+	// replace the aggregation, the route results of old one are not changed
+	old := r.aggregations[ang.URL]
+	ang.rank.keepOrder(old.rank)
+	r.aggregations[ang.URL] = ang
+	r.index.remove(old)
+	r.index.add(ang)
 
 	log.Infof("Aggregation <%s> updated", ang.URL)
 
@@ -204,13 +249,14 @@ func (r *RouteTable) DeleteAggregation(url string) error {
 	r.rwLock.Lock()
 	defer r.rwLock.Unlock()
 
-	_, ok := r.aggregations[url]
+	ang, ok := r.aggregations[url]
 
 	if !ok {
 		return ErrAggregationNotFound
 	}
 
 	delete(r.aggregations, url)
+	r.index.remove(ang)
 
 	log.Infof("Aggregation <%s> deleted", url)
 
@@ -277,26 +323,33 @@ func (r *RouteTable) AddNewServer(svr *Server) error {
 		return ErrServerExists
 	}
 
+	r.svrs[svr.Addr] = svr
+	r.mapping[svr.Addr] = make(map[string]*Cluster)
+	r.doAddServer(svr)
+
+	log.Infof("Server <%s> added", svr.Addr)
+
+	return nil
+}
+
+// doAddServer init the server and start check, the lock must be held
+func (r *RouteTable) doAddServer(svr *Server) {
 	svr.prevStatus = Down
 	svr.Status = Down
 	svr.useCheckDuration = svr.CheckDuration
-	r.svrs[svr.Addr] = svr
-
-	binded := make(map[string]*Cluster)
-	r.mapping[svr.Addr] = binded
 
 	svr.init()
 
-	// start check
-	r.addToCheck(svr)
+	// start check, a server without check path is always up
+	if svr.checkEnabled() {
+		r.addToCheck(svr)
+	} else {
+		svr.changeTo(Up)
+	}
 
 	r.analysiser.addNewAnalysis(svr.Addr)
 	// 1 secs default add to use
 	r.analysiser.AddRecentCount(svr.Addr, 1)
-
-	log.Infof("Server <%s> added", svr.Addr)
-
-	return nil
 }
 
 // UpdateCluster update cluster
@@ -439,9 +492,14 @@ func (r *RouteTable) doUnBind(svr *Server, cluster *Cluster, withLock bool) {
 
 // Select return route result
 func (r *RouteTable) Select(req *fasthttp.Request) []*RouteResult {
+	return r.SelectByClient(req, "")
+}
+
+// SelectByClient return route result, the clientIP is used by the hash key of CONSISTENTHASH loadbalance
+func (r *RouteTable) SelectByClient(req *fasthttp.Request, clientIP string) []*RouteResult {
 	r.rwLock.RLock()
 
-	matches, results := r.selectAggregation(req)
+	matches, results := r.selectAggregation(req, clientIP)
 
 	if matches {
 		r.rwLock.RUnlock()
@@ -449,63 +507,152 @@ func (r *RouteTable) Select(req *fasthttp.Request) []*RouteResult {
 	}
 
 	var targetCluster *Cluster
+	var target *Routing
 
 	for _, routing := range r.routings {
-		if routing.Matches(req) {
-			targetCluster = r.clusters[routing.ClusterName]
-			break
+		if (nil == target || routing.rank.before(target.rank)) && routing.Matches(req) {
+			target = routing
 		}
 	}
 
+	if nil != target {
+		targetCluster = r.clusters[target.ClusterName]
+	}
+
 	if nil != targetCluster {
 		r.rwLock.RUnlock()
-		return []*RouteResult{&RouteResult{Svr: r.doSelectServer(req, targetCluster)}}
+		return []*RouteResult{&RouteResult{Cluster: targetCluster, Svr: r.doSelectServer(req, clientIP, targetCluster)}}
 	}
 
+	matched := false
 	for _, cluster := range r.clusters {
-		svr := r.selectServer(req, cluster)
+		// the default cluster is not matched by its pattern
+		if cluster.Name == r.defaultCluster || !cluster.Matches(req) {
+			continue
+		}
+
+		matched = true
+		svr := r.doSelectServer(req, clientIP, cluster)
 
 		if nil != svr {
 			r.rwLock.RUnlock()
-			return []*RouteResult{&RouteResult{Svr: svr}}
+			return []*RouteResult{&RouteResult{Cluster: cluster, Svr: svr}}
 		}
 	}
 
+	if cluster, ok := r.clusters[r.defaultCluster]; ok && !matched {
+		r.rwLock.RUnlock()
+		return []*RouteResult{&RouteResult{Cluster: cluster, Svr: r.doSelectServer(req, clientIP, cluster)}}
+	}
+
 	r.rwLock.RUnlock()
 	return nil
 }
 
-func (r *RouteTable) selectAggregation(req *fasthttp.Request) (matches bool, results []*RouteResult) {
-	matches = false
+// SetDefaultCluster set the cluster of the requests not matched by any aggregation, routing or cluster,
+// the pattern of the default cluster is not used
+func (r *RouteTable) SetDefaultCluster(clusterName string) {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
 
-	for _, agn := range r.aggregations {
-		if agn.matches(req) {
-			matches = true
-			results = make([]*RouteResult, len(agn.Nodes))
+	r.defaultCluster = clusterName
+}
 
-			for index, node := range agn.Nodes {
-				results[index] = &RouteResult{
-					Aggregation: agn,
-					Node:        node,
-					Svr:         r.selectServer(req, r.clusters[node.ClusterName]),
-				}
-			}
+func (r *RouteTable) selectAggregation(req *fasthttp.Request, clientIP string) (matches bool, results []*RouteResult) {
+	selected, segments := r.index.match(req)
+	if nil == selected {
+		return false, nil
+	}
+
+	var params map[string]string
+	if nil != selected.path {
+		params = selected.path.params(segments)
+	}
+
+	var nodes []*Node
+	for _, node := range selected.Nodes {
+		if node.MatchesMethod(req) {
+			nodes = append(nodes, node)
 		}
 	}
 
-	return matches, results
+	nodes, err := negotiate(req, nodes)
+	if nil != err {
+		return true, []*RouteResult{&RouteResult{Aggregation: selected, Err: err, Code: http.StatusNotAcceptable, Params: params}}
+	}
+
+	for _, node := range nodes {
+		clusterName, canary := node.SelectCluster(req)
+		cluster := r.clusters[clusterName]
+		result := &RouteResult{
+			Aggregation: selected,
+			Node:        node,
+			Cluster:     cluster,
+			Canary:      canary,
+			Params:      params,
+		}
+
+		// the mocked node need no server
+		if !node.IsMocked() {
+			result.Svr = r.selectServer(req, clientIP, cluster)
+		}
+		results = append(results, result)
+	}
+
+	return true, results
 }
 
-func (r *RouteTable) selectServer(req *fasthttp.Request, cluster *Cluster) *Server {
+func (r *RouteTable) selectServer(req *fasthttp.Request, clientIP string, cluster *Cluster) *Server {
 	if cluster.Matches(req) {
-		return r.doSelectServer(req, cluster)
+		return r.doSelectServer(req, clientIP, cluster)
 	}
 
 	return nil
 }
 
-func (r *RouteTable) doSelectServer(req *fasthttp.Request, cluster *Cluster) *Server {
-	addr := cluster.Select(req) // 这里有可能会被锁住，会被正在修改bind关系的cluster锁住
+func (r *RouteTable) doSelectServer(req *fasthttp.Request, clientIP string, cluster *Cluster) *Server {
+	addr := cluster.selectServer(req, clientIP, nil) // 这里有可能会被锁住，会被正在修改bind关系的cluster锁住
+	svr, _ := r.svrs[addr]
+	return svr
+}
+
+// SelectClusterServer return a server of the spec cluster, nil if the cluster is not found or no server available
+func (r *RouteTable) SelectClusterServer(req *fasthttp.Request, clientIP string, clusterName string) *Server {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	cluster, ok := r.clusters[clusterName]
+	if !ok {
+		return nil
+	}
+
+	return r.doSelectServer(req, clientIP, cluster)
+}
+
+// SelectServerBy return the available server of the result cluster matched, nil if no server matched
+func (r *RouteTable) SelectServerBy(result *RouteResult, match func(*Server) bool) *Server {
+	if nil == result.Cluster {
+		return nil
+	}
+
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	addr := result.Cluster.selectBy(match)
+	svr, _ := r.svrs[addr]
+	return svr
+}
+
+// SelectServerExclude return a server of the result cluster, exclude the spec servers
+func (r *RouteTable) SelectServerExclude(req *fasthttp.Request, clientIP string, result *RouteResult, excludes map[string]bool) *Server {
+	if nil == result.Cluster {
+		return nil
+	}
+
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	addr := result.Cluster.selectServer(req, clientIP, excludes)
 	svr, _ := r.svrs[addr]
 	return svr
 }
@@ -692,6 +839,34 @@ func (r *RouteTable) loadAggregations() {
 	}
 }
 
+// StartCheck start check all servers, the servers without check path are not checked
+func (r *RouteTable) StartCheck() {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	for _, svr := range r.svrs {
+		if svr.checkEnabled() {
+			svr.startCheck()
+			r.addToCheck(svr)
+		}
+	}
+
+	log.Info("RouteTable check started.")
+}
+
+// StopCheck stop check all servers
+func (r *RouteTable) StopCheck() {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	for _, svr := range r.svrs {
+		svr.stopCheck()
+		r.removeFromCheck(svr)
+	}
+
+	log.Info("RouteTable check stopped.")
+}
+
 func (r *RouteTable) removeFromCheck(svr *Server) {
 	r.tw.Cancel(svr.Addr)
 }
@@ -701,7 +876,13 @@ func (r *RouteTable) addToCheck(svr *Server) {
 }
 
 func (r *RouteTable) check(addr string) {
-	svr, _ := r.svrs[addr]
+	r.rwLock.RLock()
+	svr, ok := r.svrs[addr]
+	r.rwLock.RUnlock()
+
+	if !ok {
+		return
+	}
 
 	if svr.check(r.addToCheck) {
 		svr.changeTo(Up)
@@ -0,0 +1,364 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrInvalidSchema the json schema of validation is invalid
+	ErrInvalidSchema = errors.New("invalid json schema")
+	// ErrNonJSONResponse the response validated is not json
+	ErrNonJSONResponse = errors.New("non json response")
+	// ErrNonJSONRequest the request validated is not json
+	ErrNonJSONRequest = errors.New("non json request")
+)
+
+// SchemaValidation validate the json body by the json schema, the body is only checked to be a valid json
+// if the schema is not set. Used by validate-request and validate-response filters.
+type SchemaValidation struct {
+	// SchemaFile the json schema file, loaded when the node is added or updated
+	SchemaFile string `json:"schemaFile,omitempty"`
+	// RejectNonJSON the bodies not json or encoded are failed, they are skipped if not set
+	RejectNonJSON bool `json:"rejectNonJSON,omitempty"`
+
+	schema *JSONSchema
+}
+
+func (v *SchemaValidation) compile() error {
+	v.schema = nil
+	if "" == v.SchemaFile {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(v.SchemaFile)
+	if nil != err {
+		return err
+	}
+
+	schema := &JSONSchema{}
+	if err := json.Unmarshal(data, schema); nil != err {
+		return ErrInvalidSchema
+	}
+
+	if err := schema.compile(); nil != err {
+		return err
+	}
+
+	v.schema = schema
+	return nil
+}
+
+// IsJSON returns true if the content type is json, e.g. application/json, application/problem+json
+func (v *SchemaValidation) IsJSON(contentType []byte) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(string(contentType), ";", 2)[0]))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Validate returns the violation of the json body, ErrMalformedJSON if the body is not a valid json
+func (v *SchemaValidation) Validate(body []byte) error {
+	var data interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); nil != err || decoder.More() {
+		return ErrMalformedJSON
+	}
+
+	if nil == v.schema {
+		return nil
+	}
+
+	return v.schema.validate("$", data)
+}
+
+// RequestValidation the required query params and headers and the json body of the client requests to the node,
+// used by validate-request filter. The body is validated only if the schema file is set.
+type RequestValidation struct {
+	// RequiredParams the query params required
+	RequiredParams []string `json:"requiredParams,omitempty"`
+	// RequiredHeaders the headers required
+	RequiredHeaders []string `json:"requiredHeaders,omitempty"`
+
+	SchemaValidation
+}
+
+// ValidateRequest returns the first violation of the request, ErrNonJSONRequest if the body is not json and rejected
+func (v *RequestValidation) ValidateRequest(req *fasthttp.Request) error {
+	for _, name := range v.RequiredParams {
+		if len(req.URI().QueryArgs().Peek(name)) == 0 {
+			return fmt.Errorf("missing required param <%s>", name)
+		}
+	}
+
+	for _, name := range v.RequiredHeaders {
+		if len(req.Header.Peek(name)) == 0 {
+			return fmt.Errorf("missing required header <%s>", name)
+		}
+	}
+
+	if "" == v.SchemaFile {
+		return nil
+	}
+
+	if !v.IsJSON(req.Header.ContentType()) || len(req.Header.Peek("Content-Encoding")) > 0 {
+		if v.RejectNonJSON {
+			return ErrNonJSONRequest
+		}
+		return nil
+	}
+
+	return v.Validate(req.Body())
+}
+
+// JSONSchema a subset of the json schema: type, enum, properties, required, additionalProperties, items,
+// minimum, maximum, minLength, maxLength, pattern, minItems and maxItems
+type JSONSchema struct {
+	Type                 schemaTypes            `json:"type,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes the type of schema, a type name or an array of type names
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); nil == err {
+		*t = schemaTypes{name}
+		return nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(data, &names); nil != err {
+		return err
+	}
+
+	*t = schemaTypes(names)
+	return nil
+}
+
+func (s *JSONSchema) compile() error {
+	for _, name := range s.Type {
+		switch name {
+		case "object", "array", "string", "number", "integer", "boolean", "null":
+		default:
+			return ErrInvalidSchema
+		}
+	}
+
+	if "" != s.Pattern {
+		pattern, err := regexp.Compile(s.Pattern)
+		if nil != err {
+			return err
+		}
+		s.pattern = pattern
+	}
+
+	for _, value := range s.Properties {
+		if nil == value {
+			return ErrInvalidSchema
+		}
+
+		if err := value.compile(); nil != err {
+			return err
+		}
+	}
+
+	if nil != s.Items {
+		return s.Items.compile()
+	}
+
+	return nil
+}
+
+func (s *JSONSchema) validate(path string, value interface{}) error {
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		return fmt.Errorf("%s: expect type <%s>, acture <%s>", path, strings.Join(s.Type, ","), schemaTypeOf(value))
+	}
+
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		return fmt.Errorf("%s: not in enum", path)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return s.validateObject(path, v)
+	case []interface{}:
+		return s.validateArray(path, v)
+	case string:
+		return s.validateString(path, v)
+	case json.Number:
+		return s.validateNumber(path, v)
+	}
+
+	return nil
+}
+
+func (s *JSONSchema) validateObject(path string, value map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := value[name]; !ok {
+			return fmt.Errorf("%s: missing required property <%s>", path, name)
+		}
+	}
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	// the first violation is stable
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		if !ok {
+			if nil != s.AdditionalProperties && !*s.AdditionalProperties {
+				return fmt.Errorf("%s: additional property <%s>", path, name)
+			}
+			continue
+		}
+
+		if err := property.validate(path+"."+name, value[name]); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *JSONSchema) validateArray(path string, value []interface{}) error {
+	if nil != s.MinItems && len(value) < *s.MinItems {
+		return fmt.Errorf("%s: expect min items <%d>, acture <%d>", path, *s.MinItems, len(value))
+	}
+
+	if nil != s.MaxItems && len(value) > *s.MaxItems {
+		return fmt.Errorf("%s: expect max items <%d>, acture <%d>", path, *s.MaxItems, len(value))
+	}
+
+	if nil == s.Items {
+		return nil
+	}
+
+	for index, item := range value {
+		if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, index), item); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *JSONSchema) validateString(path string, value string) error {
+	length := utf8.RuneCountInString(value)
+	if nil != s.MinLength && length < *s.MinLength {
+		return fmt.Errorf("%s: expect min length <%d>, acture <%d>", path, *s.MinLength, length)
+	}
+
+	if nil != s.MaxLength && length > *s.MaxLength {
+		return fmt.Errorf("%s: expect max length <%d>, acture <%d>", path, *s.MaxLength, length)
+	}
+
+	if nil != s.pattern && !s.pattern.MatchString(value) {
+		return fmt.Errorf("%s: not match pattern <%s>", path, s.Pattern)
+	}
+
+	return nil
+}
+
+func (s *JSONSchema) validateNumber(path string, value json.Number) error {
+	n, err := value.Float64()
+	if nil != err {
+		return fmt.Errorf("%s: invalid number <%s>", path, value)
+	}
+
+	if nil != s.Minimum && n < *s.Minimum {
+		return fmt.Errorf("%s: expect minimum <%v>, acture <%s>", path, *s.Minimum, value)
+	}
+
+	if nil != s.Maximum && n > *s.Maximum {
+		return fmt.Errorf("%s: expect maximum <%v>, acture <%s>", path, *s.Maximum, value)
+	}
+
+	return nil
+}
+
+func (s *JSONSchema) matchesType(value interface{}) bool {
+	actual := schemaTypeOf(value)
+	for _, name := range s.Type {
+		if name == actual {
+			return true
+		}
+
+		// the integer is a number
+		if "number" == name && "integer" == actual {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *JSONSchema) inEnum(value interface{}) bool {
+	for _, item := range s.Enum {
+		if equalJSON(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func schemaTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if n, err := v.Float64(); nil == err && n == math.Trunc(n) {
+			return "integer"
+		}
+		return "number"
+	}
+
+	return "unknown"
+}
+
+// equalJSON compare the enum value decoded as float64 with the value decoded as json.Number
+func equalJSON(expect, value interface{}) bool {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		return nil == err && expect == f
+	}
+
+	return reflect.DeepEqual(expect, value)
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testUserSchema = `{
+	"type": "object",
+	"required": ["id", "name"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "integer", "minimum": 1},
+		"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+		"role": {"enum": ["admin", "user"]},
+		"score": {"type": ["number", "null"], "maximum": 100},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+	}
+}`
+
+func newTestSchemaValidation(t *testing.T, schema string) *SchemaValidation {
+	dir, err := ioutil.TempDir("", "schema")
+	if nil != err {
+		t.Fatalf("create temp dir err: %s", err)
+	}
+
+	file := filepath.Join(dir, "schema.json")
+	if err := ioutil.WriteFile(file, []byte(schema), 0644); nil != err {
+		t.Fatalf("write schema err: %s", err)
+	}
+
+	v := &SchemaValidation{SchemaFile: file}
+	err = v.compile()
+	os.RemoveAll(dir)
+	if nil != err {
+		t.Fatalf("compile schema err: %s", err)
+	}
+
+	return v
+}
+
+func TestSchemaValidation(t *testing.T) {
+	v := newTestSchemaValidation(t, testUserSchema)
+
+	cases := []struct {
+		body  string
+		valid bool
+	}{
+		{body: `{"id":1,"name":"zhangsan"}`, valid: true},
+		{body: `{"id":2,"name":"lisi","role":"admin","score":99.5,"tags":["a","b"]}`, valid: true},
+		{body: `{"id":3,"name":"wangwu","score":null}`, valid: true},
+		{body: `{"id":1}`, valid: false},
+		{body: `{"id":1.5,"name":"zhangsan"}`, valid: false},
+		{body: `{"id":0,"name":"zhangsan"}`, valid: false},
+		{body: `{"id":"1","name":"zhangsan"}`, valid: false},
+		{body: `{"id":1,"name":"Zhang"}`, valid: false},
+		{body: `{"id":1,"name":""}`, valid: false},
+		{body: `{"id":1,"name":"zhangsan","role":"root"}`, valid: false},
+		{body: `{"id":1,"name":"zhangsan","score":101}`, valid: false},
+		{body: `{"id":1,"name":"zhangsan","tags":["a",1]}`, valid: false},
+		{body: `{"id":1,"name":"zhangsan","tags":["a","b","c"]}`, valid: false},
+		{body: `{"id":1,"name":"zhangsan","age":18}`, valid: false},
+		{body: `[{"id":1,"name":"zhangsan"}]`, valid: false},
+	}
+
+	for _, c := range cases {
+		if err := v.Validate([]byte(c.body)); (nil == err) != c.valid {
+			t.Errorf("%s expect:<%v>, acture:<%v>", c.body, c.valid, err)
+		}
+	}
+
+	if err := v.Validate([]byte(`{"id":1`)); ErrMalformedJSON != err {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrMalformedJSON, err)
+	}
+}
+
+func TestSchemaValidationWithInvalidSchema(t *testing.T) {
+	for _, schema := range []string{`{"type":"int"}`, `{"properties":{"id":{"pattern":"("}}}`, `[]`} {
+		dir, _ := ioutil.TempDir("", "schema")
+		file := filepath.Join(dir, "schema.json")
+		ioutil.WriteFile(file, []byte(schema), 0644)
+
+		v := &SchemaValidation{SchemaFile: file}
+		if nil == v.compile() {
+			t.Errorf("%s expect error", schema)
+		}
+		os.RemoveAll(dir)
+	}
+
+	node := &Node{ResponseValidation: &SchemaValidation{SchemaFile: "/not/exists.json"}}
+	if nil == node.compile() {
+		t.Errorf("expect error")
+	}
+}
+
+func TestSchemaValidationIsJSON(t *testing.T) {
+	v := &SchemaValidation{}
+	cases := map[string]bool{
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"application/problem+json":        true,
+		"text/html":                       false,
+		"":                                false,
+	}
+
+	for contentType, expect := range cases {
+		if value := v.IsJSON([]byte(contentType)); value != expect {
+			t.Errorf("%s expect:<%v>, acture:<%v>", contentType, expect, value)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalidScopeExpr the required scopes of node is not a valid AND/OR expression
+	ErrInvalidScopeExpr = errors.New("invalid scope expression")
+)
+
+// scopeExpr the compiled expression of the required scopes
+type scopeExpr interface {
+	allow(scopes map[string]bool) bool
+}
+
+type scopeTerm string
+
+func (e scopeTerm) allow(scopes map[string]bool) bool {
+	return scopes[string(e)]
+}
+
+type scopeAnd []scopeExpr
+
+func (e scopeAnd) allow(scopes map[string]bool) bool {
+	for _, sub := range e {
+		if !sub.allow(scopes) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type scopeOr []scopeExpr
+
+func (e scopeOr) allow(scopes map[string]bool) bool {
+	for _, sub := range e {
+		if sub.allow(scopes) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowScopes returns true if the scopes satisfy the RequiredScopes of node, the node without RequiredScopes allow all
+func (n *Node) AllowScopes(scopes map[string]bool) bool {
+	if nil == n.scopeExpr {
+		return true
+	}
+
+	return n.scopeExpr.allow(scopes)
+}
+
+// compileScopeExpr compile the expression of scopes, e.g. "read AND (write OR admin)",
+// the operators are case insensitive and AND binds tighter than OR
+func compileScopeExpr(expr string) (scopeExpr, error) {
+	p := &scopeParser{tokens: tokenizeScopeExpr(expr)}
+	if len(p.tokens) == 0 {
+		return nil, ErrInvalidScopeExpr
+	}
+
+	e, err := p.parseOr()
+	if nil != err {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, ErrInvalidScopeExpr
+	}
+
+	return e, nil
+}
+
+func tokenizeScopeExpr(expr string) []string {
+	expr = strings.Replace(expr, "(", " ( ", -1)
+	expr = strings.Replace(expr, ")", " ) ", -1)
+	return strings.Fields(expr)
+}
+
+type scopeParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *scopeParser) next(operator string) bool {
+	if p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], operator) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *scopeParser) parseOr() (scopeExpr, error) {
+	var or scopeOr
+	for {
+		e, err := p.parseAnd()
+		if nil != err {
+			return nil, err
+		}
+		or = append(or, e)
+
+		if !p.next("OR") {
+			break
+		}
+	}
+
+	if len(or) == 1 {
+		return or[0], nil
+	}
+
+	return or, nil
+}
+
+func (p *scopeParser) parseAnd() (scopeExpr, error) {
+	var and scopeAnd
+	for {
+		e, err := p.parseTerm()
+		if nil != err {
+			return nil, err
+		}
+		and = append(and, e)
+
+		if !p.next("AND") {
+			break
+		}
+	}
+
+	if len(and) == 1 {
+		return and[0], nil
+	}
+
+	return and, nil
+}
+
+func (p *scopeParser) parseTerm() (scopeExpr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, ErrInvalidScopeExpr
+	}
+
+	if p.next("(") {
+		e, err := p.parseOr()
+		if nil != err {
+			return nil, err
+		}
+
+		if !p.next(")") {
+			return nil, ErrInvalidScopeExpr
+		}
+
+		return e, nil
+	}
+
+	token := p.tokens[p.pos]
+	if ")" == token || strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR") {
+		return nil, ErrInvalidScopeExpr
+	}
+
+	p.pos++
+	return scopeTerm(token), nil
+}
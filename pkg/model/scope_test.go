@@ -0,0 +1,59 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestNodeAllowScopes(t *testing.T) {
+	cases := []struct {
+		expr   string
+		scopes []string
+		expect bool
+	}{
+		{expr: "read", scopes: []string{"read"}, expect: true},
+		{expr: "read", scopes: []string{"write"}, expect: false},
+		{expr: "read AND write", scopes: []string{"read"}, expect: false},
+		{expr: "read and write", scopes: []string{"read", "write"}, expect: true},
+		{expr: "read OR write", scopes: []string{"write"}, expect: true},
+		{expr: "read AND (write OR admin)", scopes: []string{"read", "admin"}, expect: true},
+		{expr: "read AND (write OR admin)", scopes: []string{"admin"}, expect: false},
+		// AND binds tighter than OR
+		{expr: "admin OR read AND write", scopes: []string{"admin"}, expect: true},
+		{expr: "admin OR read AND write", scopes: []string{"read"}, expect: false},
+		{expr: "(admin)", scopes: nil, expect: false},
+	}
+
+	for _, c := range cases {
+		node := &Node{RequiredScopes: c.expr}
+		if err := node.compile(); nil != err {
+			t.Fatalf("%s compile err: %s", c.expr, err)
+		}
+
+		scopes := make(map[string]bool)
+		for _, scope := range c.scopes {
+			scopes[scope] = true
+		}
+
+		if allowed := node.AllowScopes(scopes); allowed != c.expect {
+			t.Errorf("%s %v expect:<%v>, acture:<%v>", c.expr, c.scopes, c.expect, allowed)
+		}
+	}
+
+	if !(&Node{}).AllowScopes(nil) {
+		t.Error("expect the node without required scopes allow all")
+	}
+}
+
+func TestNodeInvalidScopeExpr(t *testing.T) {
+	for _, expr := range []string{"AND", "read AND", "read OR OR write", "(read", "read)", "read write", "()"} {
+		node := &Node{RequiredScopes: expr}
+		if err := node.compile(); ErrInvalidScopeExpr != err {
+			t.Errorf("%s expect:<%s>, acture:<%v>", expr, ErrInvalidScopeExpr, err)
+		}
+	}
+
+	agn := NewAggregation("^/admin$", []*Node{&Node{ClusterName: "app", RequiredScopes: "admin AND"}})
+	if err := NewRouteTable(emptyStore{}).AddNewAggregation(agn); ErrInvalidScopeExpr != err {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrInvalidScopeExpr, err)
+	}
+}
@@ -5,16 +5,21 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"sync"
 	"time"
 
+	"github.com/CodisLabs/codis/pkg/utils/atomic2"
 	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/pkg/metrics"
 )
 
 const (
 	// CheckSuccess check backend server, if response body is "OK", is heath
 	CheckSuccess = "OK"
+	// RateBase base of the HalfTrafficRate
+	RateBase = 100
 )
 
 // Status status
@@ -51,20 +56,32 @@ type Server struct {
 	Schema string `json:"schema,omitempty"`
 	Addr   string `json:"addr,omitempty"`
 
-	// CheckPath begin with / checkpath, expect return OK.
+	// CheckPath begin with / checkpath, expect return OK. The server without check path is not checked and is up at once,
+	// the outlier detection and the circuit breaker still eject it if it fails.
 	CheckPath string `json:"checkPath,omitempty"`
 	// CheckDuration check interval, unit second
 	CheckDuration int `json:"checkDuration,omitempty"`
 	// CheckTimeout timeout to check server
 	CheckTimeout int `json:"checkTimeout,omitempty"`
+	// CheckExpectCode expect response code of checkpath, if not set, expect 200 and body is "OK"
+	CheckExpectCode int `json:"checkExpectCode,omitempty"`
 	// Status Server status
 	Status Status `json:"status,omitempty"`
 
+	// Weight the backend server weight, used by WEIGHTROBIN loadBalance
+	Weight int `json:"weight,omitempty"`
+	// SlowStart duration to ramp the weight from near zero to full after the server becomes healthy, unit second,
+	// the server becomes healthy when it's added or checked up, or its circuit is recovered. Used by WEIGHTROBIN loadBalance
+	SlowStart int `json:"slowStart,omitempty"`
+
 	// MaxQPS the backend server max qps support
-	MaxQPS          int `json:"maxQPS,omitempty"`
-	HalfToOpen      int `json:"halfToOpen,omitempty"`
+	MaxQPS int `json:"maxQPS,omitempty"`
+	// HalfToOpen the seconds of the circuit close before change to half
+	HalfToOpen int `json:"halfToOpen,omitempty"`
+	// HalfTrafficRate the percent of the requests to a half circuit server which can be the trial request, 0 is 100
 	HalfTrafficRate int `json:"halfTrafficRate,omitempty"`
-	CloseCount      int `json:"closeCount,omitempty"`
+	// CloseCount the continuous failure count to close the circuit, 0 is never close
+	CloseCount int `json:"closeCount,omitempty"`
 
 	BindClusters []string `json:"bindClusters,omitempty"`
 
@@ -73,10 +90,26 @@ type Server struct {
 	prevStatus       Status
 	useCheckDuration int
 
-	circuit Circuit
-	lock    *sync.Mutex
-
-	checkStopped bool
+	circuit               Circuit
+	circuitFailureCount   int
+	circuitClosedAt       time.Time
+	circuitHalfTrialing   bool
+	circuitHalfTrialingAt time.Time
+	lock                  *sync.Mutex
+
+	activeConns   atomic2.Int64
+	draining      atomic2.Bool
+	cooldownUntil atomic2.Int64
+	healthyAt     atomic2.Int64
+	ejectedUntil  atomic2.Int64
+	stats         statsHolder
+	// outlierLatency the latencies of the recent requests used by the outlier detection
+	outlierLatency *metrics.RollingHistogram
+
+	lastCheckAt      atomic2.Int64
+	lastCheckSucceed atomic2.Bool
+
+	checkStopped atomic2.Bool
 }
 
 // UnMarshalServer unmarshal
@@ -119,6 +152,9 @@ func (s *Server) updateFrom(svr *Server) {
 		defer s.UnLock()
 	}
 
+	s.Weight = svr.Weight
+	s.SlowStart = svr.SlowStart
+	s.CheckExpectCode = svr.CheckExpectCode
 	s.MaxQPS = svr.MaxQPS
 	s.HalfToOpen = svr.HalfToOpen
 	s.HalfTrafficRate = svr.HalfTrafficRate
@@ -127,24 +163,244 @@ func (s *Server) updateFrom(svr *Server) {
 	log.Infof("Server <%s> updated, %+v", s.Addr, s)
 }
 
+// sameCheck returns true if the health check of svr is same as s, the check is not changed by updateFrom
+func (s *Server) sameCheck(svr *Server) bool {
+	return s.Schema == svr.Schema && s.CheckPath == svr.CheckPath &&
+		s.CheckDuration == svr.CheckDuration && s.CheckTimeout == svr.CheckTimeout
+}
+
+// GetAddr return addr of server
+func (s *Server) GetAddr() string {
+	return s.Addr
+}
+
+// GetWeight return weight of server
+func (s *Server) GetWeight() int {
+	return s.Weight
+}
+
+// GetWeightRate returns the rate of the weight in percent, it's ramped from 1 to 100 in the slow start
+func (s *Server) GetWeightRate() int {
+	if s.SlowStart <= 0 {
+		return 100
+	}
+
+	elapsed := time.Now().UnixNano() - s.healthyAt.Get()
+	window := int64(time.Duration(s.SlowStart) * time.Second)
+	if elapsed >= window {
+		return 100
+	}
+
+	if rate := int(elapsed * 100 / window); rate > 1 {
+		return rate
+	}
+
+	return 1
+}
+
+// IsDraining returns true if the server does not accept new requests
+func (s *Server) IsDraining() bool {
+	return s.draining.Get()
+}
+
+// Cooldown stop routing to the server for the duration, the longer cooldown is kept
+func (s *Server) Cooldown(d time.Duration) {
+	until := time.Now().Add(d).UnixNano()
+	for {
+		prev := s.cooldownUntil.Get()
+		if prev >= until || s.cooldownUntil.CompareAndSwap(prev, until) {
+			return
+		}
+	}
+}
+
+// IsCoolingDown returns true if the server is in the cooldown, the selection skip it
+func (s *Server) IsCoolingDown() bool {
+	return time.Now().UnixNano() < s.cooldownUntil.Get()
+}
+
+// IsEjected returns true if the server is ejected as an outlier, the selection skip it
+func (s *Server) IsEjected() bool {
+	return time.Now().UnixNano() < s.ejectedUntil.Get()
+}
+
+func (s *Server) eject(d time.Duration) {
+	s.ejectedUntil.Set(time.Now().Add(d).UnixNano())
+}
+
+// GetActiveConns return the count of in-flight requests
+func (s *Server) GetActiveConns() int64 {
+	return s.activeConns.Get()
+}
+
+// IncrActiveConns incr the count of in-flight requests
+func (s *Server) IncrActiveConns() {
+	s.activeConns.Incr()
+}
+
+// DecrActiveConns decr the count of in-flight requests
+func (s *Server) DecrActiveConns() {
+	s.activeConns.Decr()
+}
+
 // GetCircuit return circuit status
 func (s *Server) GetCircuit() Circuit {
+	s.Lock()
+	defer s.UnLock()
+
 	return s.circuit
 }
 
 // OpenCircuit set circuit open status
 func (s *Server) OpenCircuit() {
-	s.circuit = CircuitOpen
+	s.setCircuit(CircuitOpen)
 }
 
 // CloseCircuit set circuit close status
 func (s *Server) CloseCircuit() {
-	s.circuit = CircuitClose
+	s.setCircuit(CircuitClose)
 }
 
 // HalfCircuit set circuit half status
 func (s *Server) HalfCircuit() {
-	s.circuit = CircuitHalf
+	s.setCircuit(CircuitHalf)
+}
+
+func (s *Server) setCircuit(circuit Circuit) {
+	s.Lock()
+	defer s.UnLock()
+
+	s.circuit = circuit
+}
+
+// CircuitAllow return true if the request can be sent to the server.
+// A half circuit server only allow one trial request at the same time,
+// and only HalfTrafficRate percent of the requests can be the trial request.
+func (s *Server) CircuitAllow() bool {
+	s.Lock()
+	defer s.UnLock()
+
+	s.checkCircuitHalf()
+
+	switch s.circuit {
+	case CircuitOpen:
+		return true
+	case CircuitHalf:
+		if s.isCircuitHalfTrialing() {
+			return false
+		}
+
+		if s.HalfTrafficRate > 0 && rand.Intn(RateBase) >= s.HalfTrafficRate {
+			return false
+		}
+
+		s.circuitHalfTrialing = true
+		s.circuitHalfTrialingAt = time.Now()
+		return true
+	default:
+		return false
+	}
+}
+
+// CircuitSucceed record a succeed request, a half circuit server change to open
+func (s *Server) CircuitSucceed() {
+	s.Lock()
+	defer s.UnLock()
+
+	s.circuitFailureCount = 0
+
+	if s.circuit == CircuitHalf {
+		s.circuitHalfTrialing = false
+		s.circuit = CircuitOpen
+		s.healthyAt.Set(time.Now().UnixNano())
+		log.Warnf("Circuit Server <%s> change to open.", s.Addr)
+	}
+}
+
+// CircuitFailure record a failure request, the server change to close
+// if it's half circuit or continuous failure count reach CloseCount
+func (s *Server) CircuitFailure() {
+	s.Lock()
+	defer s.UnLock()
+
+	s.circuitFailureCount++
+
+	if s.circuit == CircuitHalf ||
+		(s.circuit == CircuitOpen && s.CloseCount > 0 && s.circuitFailureCount >= s.CloseCount) {
+		s.closeCircuit()
+	}
+}
+
+// CircuitCancel record a canceled request, it's neither succeed nor failure,
+// the trial request of a half circuit server is released
+func (s *Server) CircuitCancel() {
+	s.Lock()
+	defer s.UnLock()
+
+	if s.circuit == CircuitHalf {
+		s.circuitHalfTrialing = false
+	}
+}
+
+func (s *Server) circuitAvailable() bool {
+	s.Lock()
+	defer s.UnLock()
+
+	s.checkCircuitHalf()
+
+	return s.circuit == CircuitOpen || (s.circuit == CircuitHalf && !s.isCircuitHalfTrialing())
+}
+
+func (s *Server) closeCircuit() {
+	s.circuit = CircuitClose
+	s.circuitFailureCount = 0
+	s.circuitClosedAt = time.Now()
+	s.circuitHalfTrialing = false
+
+	log.Warnf("Circuit Server <%s> change to close.", s.Addr)
+}
+
+// Stats returns the request stats of server
+func (s *Server) Stats() *RequestStats {
+	return s.stats.get()
+}
+
+// RecordRequest record a finished request in the stats and the outlier detection
+func (s *Server) RecordRequest(latency time.Duration, success bool) {
+	s.Stats().Record(latency, success)
+
+	if nil != s.outlierLatency {
+		s.outlierLatency.Observe(latency)
+	}
+}
+
+// GetLastCheck returns the time and the result of the last health check, the time is zero if never checked
+func (s *Server) GetLastCheck() (time.Time, bool) {
+	at := s.lastCheckAt.Get()
+	if 0 == at {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, at), s.lastCheckSucceed.Get()
+}
+
+func (s *Server) checkCircuitHalf() {
+	if s.circuit == CircuitClose && time.Since(s.circuitClosedAt) >= s.getHalfToOpen() {
+		s.circuit = CircuitHalf
+		s.circuitHalfTrialing = false
+
+		log.Warnf("Circuit Server <%s> change to half.", s.Addr)
+	}
+}
+
+// isCircuitHalfTrialing return true if a trial request is in flight,
+// a trial request never completed is expired after HalfToOpen
+func (s *Server) isCircuitHalfTrialing() bool {
+	return s.circuitHalfTrialing && time.Since(s.circuitHalfTrialingAt) < s.getHalfToOpen()
+}
+
+func (s *Server) getHalfToOpen() time.Duration {
+	return time.Duration(s.HalfToOpen) * time.Second
 }
 
 // Lock lock
@@ -164,11 +420,16 @@ func (s *Server) init() {
 
 	s.circuit = CircuitOpen
 	s.lock = &sync.Mutex{}
-	s.checkStopped = false
+	s.outlierLatency = metrics.NewRollingHistogram(outlierLatencyWindow, outlierLatencySlots)
+	s.checkStopped.Set(false)
 }
 
 func (s *Server) stopCheck() {
-	s.checkStopped = true
+	s.checkStopped.Set(true)
+}
+
+func (s *Server) startCheck() {
+	s.checkStopped.Set(false)
 }
 
 func (s *Server) getCheckTimeout() time.Duration {
@@ -182,13 +443,16 @@ func (s *Server) getCheckTimeout() time.Duration {
 func (s *Server) check(cb func(*Server)) bool {
 	succ := false
 	defer func() {
+		s.lastCheckAt.Set(time.Now().UnixNano())
+		s.lastCheckSucceed.Set(succ)
+
 		if succ {
 			s.reset()
 		} else {
 			s.fail()
 		}
 
-		if !s.checkStopped {
+		if !s.checkStopped.Get() {
 			cb(s)
 		}
 	}()
@@ -204,6 +468,16 @@ func (s *Server) check(cb func(*Server)) bool {
 
 	defer resp.Body.Close()
 
+	if 0 != s.CheckExpectCode {
+		succ = s.CheckExpectCode == resp.StatusCode
+
+		if !succ {
+			log.Warnf("Server <%s, %s, %d, %d> check fail.", s.Addr, s.CheckPath, resp.StatusCode, s.checkFailCount+1)
+		}
+
+		return succ
+	}
+
 	if http.StatusOK != resp.StatusCode {
 		log.Warnf("Server <%s, %s, %d, %d> check fail.", s.Addr, s.CheckPath, resp.StatusCode, s.checkFailCount+1)
 		return succ
@@ -218,6 +492,11 @@ func (s *Server) check(cb func(*Server)) bool {
 	return succ
 }
 
+// checkEnabled returns true if the server is checked by the check path
+func (s *Server) checkEnabled() bool {
+	return "" != s.CheckPath
+}
+
 func (s *Server) getCheckURL() string {
 	return fmt.Sprintf("%s://%s%s", s.Schema, s.Addr, s.CheckPath)
 }
@@ -235,6 +514,10 @@ func (s *Server) reset() {
 func (s *Server) changeTo(status Status) {
 	s.prevStatus = s.Status
 	s.Status = status
+
+	if s.prevStatus == Down && s.Status == Up {
+		s.healthyAt.Set(time.Now().UnixNano())
+	}
 }
 
 func (s *Server) statusChanged() bool {
@@ -0,0 +1,305 @@
+package model
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newCheckServer(code int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		w.Write([]byte(body))
+	}))
+}
+
+func newTestServer(url string) *Server {
+	svr := &Server{
+		Schema:    "http",
+		Addr:      strings.TrimPrefix(url, "http://"),
+		CheckPath: "/check",
+	}
+	svr.init()
+	svr.stopCheck()
+
+	return svr
+}
+
+func TestCheckWithExpectCode(t *testing.T) {
+	ts := newCheckServer(http.StatusNoContent, "")
+	defer ts.Close()
+
+	svr := newTestServer(ts.URL)
+	svr.CheckExpectCode = http.StatusNoContent
+
+	if !svr.check(nil) {
+		t.Error("check expect succ")
+	}
+
+	svr.CheckExpectCode = http.StatusOK
+
+	if svr.check(nil) {
+		t.Error("check expect fail")
+	}
+}
+
+func TestCheckWithDefault(t *testing.T) {
+	ts := newCheckServer(http.StatusOK, CheckSuccess)
+	defer ts.Close()
+
+	svr := newTestServer(ts.URL)
+
+	if !svr.check(nil) {
+		t.Error("check expect succ")
+	}
+}
+
+func TestCheckWithDownServer(t *testing.T) {
+	ts := newCheckServer(http.StatusOK, CheckSuccess)
+	ts.Close()
+
+	svr := newTestServer(ts.URL)
+
+	if svr.check(nil) {
+		t.Error("check expect fail")
+	}
+}
+
+func TestAddServerWithoutCheckPath(t *testing.T) {
+	r := NewRouteTable(emptyStore{})
+
+	unchecked := &Server{Addr: "127.0.0.1:80"}
+	checked := &Server{Addr: "127.0.0.2:80", CheckPath: "/check", CheckDuration: 60}
+	r.AddNewServer(unchecked)
+	r.AddNewServer(checked)
+
+	// the server without check path is up at once, the checked server is down until the check succeed
+	if unchecked.Status != Up {
+		t.Errorf("expect:<%v>, acture:<%v>", Up, unchecked.Status)
+	}
+
+	if checked.Status != Down {
+		t.Errorf("expect:<%v>, acture:<%v>", Down, checked.Status)
+	}
+
+	r.StopCheck()
+	r.StartCheck()
+	if unchecked.Status != Up {
+		t.Errorf("expect:<%v>, acture:<%v>", Up, unchecked.Status)
+	}
+}
+
+func newCircuitServer() *Server {
+	svr := &Server{
+		Addr:       "127.0.0.1:8080",
+		CloseCount: 3,
+		HalfToOpen: 10,
+	}
+	svr.init()
+
+	return svr
+}
+
+func TestCircuitOpenToClose(t *testing.T) {
+	svr := newCircuitServer()
+
+	for i := 0; i < svr.CloseCount-1; i++ {
+		svr.CircuitFailure()
+	}
+
+	if svr.GetCircuit() != CircuitOpen {
+		t.Errorf("expect:<%d>, acture:<%d>", CircuitOpen, svr.GetCircuit())
+	}
+
+	svr.CircuitSucceed()
+	svr.CircuitFailure()
+
+	if svr.GetCircuit() != CircuitOpen {
+		t.Error("continuous failure count expect reset by succeed")
+	}
+
+	svr.CircuitFailure()
+	svr.CircuitFailure()
+
+	if svr.GetCircuit() != CircuitClose {
+		t.Errorf("expect:<%d>, acture:<%d>", CircuitClose, svr.GetCircuit())
+	}
+
+	if svr.CircuitAllow() || svr.circuitAvailable() {
+		t.Error("close circuit expect not allow")
+	}
+}
+
+func TestCircuitCloseToHalf(t *testing.T) {
+	svr := newCircuitServer()
+	svr.closeCircuit()
+	svr.circuitClosedAt = time.Now().Add(-svr.getHalfToOpen())
+
+	if !svr.circuitAvailable() {
+		t.Error("half circuit expect available")
+	}
+
+	if svr.GetCircuit() != CircuitHalf {
+		t.Errorf("expect:<%d>, acture:<%d>", CircuitHalf, svr.GetCircuit())
+	}
+
+	if !svr.CircuitAllow() {
+		t.Error("half circuit expect allow a trial request")
+	}
+
+	if svr.CircuitAllow() || svr.circuitAvailable() {
+		t.Error("half circuit expect only allow one trial request")
+	}
+}
+
+func TestCircuitHalfToOpen(t *testing.T) {
+	svr := newCircuitServer()
+	svr.HalfCircuit()
+
+	svr.CircuitAllow()
+	svr.CircuitSucceed()
+
+	if svr.GetCircuit() != CircuitOpen {
+		t.Errorf("expect:<%d>, acture:<%d>", CircuitOpen, svr.GetCircuit())
+	}
+}
+
+func TestCircuitHalfToClose(t *testing.T) {
+	svr := newCircuitServer()
+	svr.HalfCircuit()
+
+	svr.CircuitAllow()
+	svr.CircuitFailure()
+
+	if svr.GetCircuit() != CircuitClose {
+		t.Errorf("expect:<%d>, acture:<%d>", CircuitClose, svr.GetCircuit())
+	}
+}
+
+func TestCheckLastResult(t *testing.T) {
+	ts := newCheckServer(http.StatusOK, CheckSuccess)
+	defer ts.Close()
+
+	svr := newTestServer(ts.URL)
+	if at, _ := svr.GetLastCheck(); !at.IsZero() {
+		t.Errorf("expect:<zero>, acture:<%s>", at)
+	}
+
+	svr.check(nil)
+	if at, succeed := svr.GetLastCheck(); at.IsZero() || !succeed {
+		t.Errorf("expect:<succeed>, acture:<%s, %v>", at, succeed)
+	}
+
+	svr.CheckExpectCode = http.StatusNoContent
+	svr.check(nil)
+	if _, succeed := svr.GetLastCheck(); succeed {
+		t.Error("expect:<fail>, acture:<succeed>")
+	}
+}
+
+func TestSlowStartWeightRate(t *testing.T) {
+	svr := newCircuitServer()
+	if svr.GetWeightRate() != 100 {
+		t.Errorf("expect:<100>, acture:<%d>", svr.GetWeightRate())
+	}
+
+	svr.SlowStart = 10
+	svr.Status = Down
+	svr.changeTo(Up)
+	if rate := svr.GetWeightRate(); rate != 1 {
+		t.Errorf("fresh server expect:<1>, acture:<%d>", rate)
+	}
+
+	prev := 0
+	for _, elapsed := range []int{1, 5, 9} {
+		svr.healthyAt.Set(time.Now().Add(-time.Duration(elapsed) * time.Second).UnixNano())
+		rate := svr.GetWeightRate()
+		if rate <= prev || rate > 100 {
+			t.Errorf("elapsed <%ds> expect the rate increased from <%d>, acture:<%d>", elapsed, prev, rate)
+		}
+		prev = rate
+	}
+
+	svr.healthyAt.Set(time.Now().Add(-10 * time.Second).UnixNano())
+	if rate := svr.GetWeightRate(); rate != 100 {
+		t.Errorf("expect:<100>, acture:<%d>", rate)
+	}
+
+	// the recovered circuit restart the slow start
+	svr.HalfCircuit()
+	svr.CircuitAllow()
+	svr.CircuitSucceed()
+	if rate := svr.GetWeightRate(); rate != 1 {
+		t.Errorf("recovered server expect:<1>, acture:<%d>", rate)
+	}
+}
+
+func TestCircuitHalfTrafficRate(t *testing.T) {
+	allowed := func(rate int) int {
+		svr := newCircuitServer()
+		svr.HalfCircuit()
+		svr.HalfTrafficRate = rate
+
+		count := 0
+		for i := 0; i < 50; i++ {
+			if svr.CircuitAllow() {
+				count++
+				svr.CircuitCancel()
+			}
+		}
+		return count
+	}
+
+	if count := allowed(0); count != 50 {
+		t.Errorf("expect:<50>, acture:<%d>", count)
+	}
+
+	if count := allowed(1); count >= 50 {
+		t.Errorf("expect limited by HalfTrafficRate, acture:<%d>", count)
+	}
+}
+
+func TestCircuitCancel(t *testing.T) {
+	svr := newCircuitServer()
+	svr.HalfCircuit()
+
+	svr.CircuitAllow()
+	svr.CircuitCancel()
+
+	if svr.GetCircuit() != CircuitHalf {
+		t.Errorf("expect:<%d>, acture:<%d>", CircuitHalf, svr.GetCircuit())
+	}
+
+	if !svr.CircuitAllow() {
+		t.Error("canceled trial request expect released")
+	}
+}
+
+func TestCircuitConcurrent(t *testing.T) {
+	svr := newCircuitServer()
+	svr.CloseCount = 1
+
+	wg := &sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			svr.CircuitFailure()
+			svr.OpenCircuit()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			svr.GetCircuit()
+		}
+	}()
+	wg.Wait()
+
+	if svr.GetCircuit() != CircuitOpen {
+		t.Errorf("expect:<%d>, acture:<%d>", CircuitOpen, svr.GetCircuit())
+	}
+}
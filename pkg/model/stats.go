@@ -0,0 +1,89 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/atomic2"
+	"github.com/fagongzi/gateway/pkg/metrics"
+)
+
+const (
+	// the latency quantiles are estimated in the recent minute
+	statsLatencyWindow = time.Minute
+	statsLatencySlots  = 6
+)
+
+// RequestStats the counters and the latencies of the requests, the counters are atomic to read cheaply
+type RequestStats struct {
+	requests atomic2.Int64
+	inFlight atomic2.Int64
+	failures atomic2.Int64
+	latency  *metrics.RollingHistogram
+}
+
+func newRequestStats() *RequestStats {
+	return &RequestStats{
+		latency: metrics.NewRollingHistogram(statsLatencyWindow, statsLatencySlots),
+	}
+}
+
+// Begin add a in-flight request, returns the func to record it finished
+func (s *RequestStats) Begin() func(success bool) {
+	s.inFlight.Incr()
+	start := time.Now()
+
+	return func(success bool) {
+		s.inFlight.Decr()
+		s.Record(time.Since(start), success)
+	}
+}
+
+// Record record a finished request
+func (s *RequestStats) Record(latency time.Duration, success bool) {
+	s.requests.Incr()
+	if !success {
+		s.failures.Incr()
+	}
+
+	s.latency.Observe(latency)
+}
+
+// Snapshot returns the current stats
+func (s *RequestStats) Snapshot() RequestStatsSnapshot {
+	requests := s.requests.Get()
+	failures := s.failures.Get()
+
+	return RequestStatsSnapshot{
+		Requests:  requests,
+		InFlight:  s.inFlight.Get(),
+		Successes: requests - failures,
+		Errors:    failures,
+		P50:       s.latency.Quantile(0.5),
+		P99:       s.latency.Quantile(0.99),
+	}
+}
+
+// RequestStatsSnapshot the stats of requests at a time, the latencies are of the recent minute
+type RequestStatsSnapshot struct {
+	Requests  int64         `json:"requests"`
+	InFlight  int64         `json:"inFlight"`
+	Successes int64         `json:"successes"`
+	Errors    int64         `json:"errors"`
+	P50       time.Duration `json:"p50"`
+	P99       time.Duration `json:"p99"`
+}
+
+// statsHolder create the stats at the first use
+type statsHolder struct {
+	once  sync.Once
+	stats *RequestStats
+}
+
+func (h *statsHolder) get() *RequestStats {
+	h.once.Do(func() {
+		h.stats = newRequestStats()
+	})
+
+	return h.stats
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// TrailingSlashStrip remove the trailing slashes of the path, e.g. /users/ -> /users
+	TrailingSlashStrip = "strip"
+	// TrailingSlashAdd add a trailing slash to the path, e.g. /users -> /users/,
+	// the path of a file is not changed, e.g. /app.js
+	TrailingSlashAdd = "add"
+	// TrailingSlashKeep the path is not changed, used by node to disable the global normalization
+	TrailingSlashKeep = "keep"
+)
+
+var (
+	// ErrInvalidTrailingSlash the trailing slash normalization is not strip, add or keep
+	ErrInvalidTrailingSlash = errors.New("invalid trailing slash")
+)
+
+// IsValidTrailingSlash returns true if the trailing slash normalization is empty, strip, add or keep
+func IsValidTrailingSlash(mode string) bool {
+	return "" == mode || TrailingSlashStrip == mode || TrailingSlashAdd == mode || TrailingSlashKeep == mode
+}
+
+// NormalizeTrailingSlash returns the path normalized by the mode, the root path is not changed
+func NormalizeTrailingSlash(path, mode string) string {
+	if "" == path || "/" == path {
+		return path
+	}
+
+	switch mode {
+	case TrailingSlashStrip:
+		if stripped := strings.TrimRight(path, "/"); "" != stripped {
+			return stripped
+		}
+		return "/"
+	case TrailingSlashAdd:
+		if strings.HasSuffix(path, "/") || strings.Contains(path[strings.LastIndex(path, "/")+1:], ".") {
+			return path
+		}
+		return path + "/"
+	}
+
+	return path
+}
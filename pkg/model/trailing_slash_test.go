@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestNormalizeTrailingSlash(t *testing.T) {
+	cases := []struct {
+		path   string
+		mode   string
+		expect string
+	}{
+		{path: "/users/", mode: TrailingSlashStrip, expect: "/users"},
+		{path: "/users//", mode: TrailingSlashStrip, expect: "/users"},
+		{path: "/users", mode: TrailingSlashStrip, expect: "/users"},
+		{path: "/", mode: TrailingSlashStrip, expect: "/"},
+		{path: "/users", mode: TrailingSlashAdd, expect: "/users/"},
+		{path: "/users/", mode: TrailingSlashAdd, expect: "/users/"},
+		{path: "/static/app.js", mode: TrailingSlashAdd, expect: "/static/app.js"},
+		{path: "/", mode: TrailingSlashAdd, expect: "/"},
+		{path: "/users/", mode: TrailingSlashKeep, expect: "/users/"},
+		{path: "/users/", mode: "", expect: "/users/"},
+	}
+
+	for _, c := range cases {
+		if value := NormalizeTrailingSlash(c.path, c.mode); value != c.expect {
+			t.Errorf("%s %s expect:<%s>, acture:<%s>", c.path, c.mode, c.expect, value)
+		}
+	}
+}
+
+func TestNodeTrailingSlashCompile(t *testing.T) {
+	node := &Node{TrailingSlash: "remove"}
+	if err := node.compile(); ErrInvalidTrailingSlash != err {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrInvalidTrailingSlash, err)
+	}
+
+	node = &Node{TrailingSlash: TrailingSlashKeep}
+	if err := node.compile(); nil != err {
+		t.Errorf("expect:<nil>, acture:<%v>", err)
+	}
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultTransformContentType = "application/json"
+)
+
+var (
+	// ErrMalformedJSON the body to transform is not a valid json
+	ErrMalformedJSON = errors.New("malformed json body")
+
+	transformFuncs = template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}
+)
+
+// BodyTransform the template to rewrite the json body, the parsed body is the data of template,
+// the func json encode a value, e.g. {"name": {{json .user.name}}}
+type BodyTransform struct {
+	// Template the go template of the new body
+	Template string `json:"template,omitempty"`
+	// ContentTypes the content-type prefixes of the body transformed, default is application/json
+	ContentTypes []string `json:"contentTypes,omitempty"`
+
+	tmpl *template.Template
+}
+
+func (t *BodyTransform) compile() error {
+	tmpl, err := template.New("transform").Funcs(transformFuncs).Option("missingkey=zero").Parse(t.Template)
+	if nil != err {
+		return err
+	}
+
+	t.tmpl = tmpl
+	return nil
+}
+
+// Matches returns true if the body of content type is transformed
+func (t *BodyTransform) Matches(contentType []byte) bool {
+	if len(t.ContentTypes) == 0 {
+		return bytes.HasPrefix(contentType, []byte(defaultTransformContentType))
+	}
+
+	for _, prefix := range t.ContentTypes {
+		if strings.HasPrefix(string(contentType), prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Transform returns the new body by the template, ErrMalformedJSON if the body is not a valid json
+func (t *BodyTransform) Transform(body []byte) ([]byte, error) {
+	var data interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// the numbers are not changed by float64
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); nil != err {
+		return nil, ErrMalformedJSON
+	}
+
+	if decoder.More() {
+		return nil, ErrMalformedJSON
+	}
+
+	buf := &bytes.Buffer{}
+	if err := t.tmpl.Execute(buf, data); nil != err {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultAffinityCookie = "GATEWAY_AFFINITY"
+	defaultAffinityPath   = "/"
+)
+
+// newAffinitySecret returns the secret to sign the affinity cookies
+func newAffinitySecret(config *conf.Conf) []byte {
+	if "" != config.AffinitySecret {
+		return []byte(config.AffinitySecret)
+	}
+
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
+
+// affinityToken the opaque cookie value of the server, the client can not forge the value of other servers
+func (p *Proxy) affinityToken(cluster *model.Cluster, svr *model.Server) string {
+	mac := hmac.New(sha256.New, p.affinitySecret)
+	mac.Write([]byte(cluster.Name))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(svr.Addr))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// selectAffinityServer change the result server to the server of the affinity cookie if it is available,
+// returns the cookie value matched, empty if the normal selected server is used
+func (p *Proxy) selectAffinityServer(req *fasthttp.Request, result *model.RouteResult) string {
+	if nil == result.Node || nil == result.Node.Affinity || nil == result.Svr {
+		return ""
+	}
+
+	token := req.Header.Cookie(getAffinityCookie(result.Node.Affinity))
+	if len(token) == 0 {
+		return ""
+	}
+
+	svr := p.routeTable.SelectServerBy(result, func(svr *model.Server) bool {
+		return hmac.Equal(token, []byte(p.affinityToken(result.Cluster, svr)))
+	})
+	if nil == svr {
+		return ""
+	}
+
+	result.Svr = svr
+	return string(token)
+}
+
+// setAffinityCookie set the affinity cookie to the response if the server is changed
+func (p *Proxy) setAffinityCookie(result *model.RouteResult, token string) {
+	if nil == result.Node || nil == result.Node.Affinity || nil == result.Svr || nil == result.Res {
+		return
+	}
+
+	value := p.affinityToken(result.Cluster, result.Svr)
+	if value == token {
+		return
+	}
+
+	affinity := result.Node.Affinity
+	path := affinity.Path
+	if "" == path {
+		path = defaultAffinityPath
+	}
+
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+
+	cookie.SetKey(getAffinityCookie(affinity))
+	cookie.SetValue(value)
+	cookie.SetPath(path)
+	cookie.SetHTTPOnly(true)
+	if affinity.MaxAge > 0 {
+		cookie.SetExpire(time.Now().Add(affinity.MaxAge))
+	}
+
+	result.Res.Header.SetCookie(cookie)
+}
+
+func getAffinityCookie(affinity *model.SessionAffinity) string {
+	if "" != affinity.CookieName {
+		return affinity.CookieName
+	}
+
+	return defaultAffinityCookie
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func doTestAffinityRequest(p *Proxy, cookie string) (string, string) {
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/api")
+	req.Header.SetHost("gateway")
+	if "" != cookie {
+		req.Header.SetCookie(defaultAffinityCookie, cookie)
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+	p.ReverseProxyHandler(ctx)
+
+	c := &fasthttp.Cookie{}
+	c.SetKey(defaultAffinityCookie)
+	ctx.Response.Header.Cookie(c)
+
+	return string(ctx.Response.Body()), string(c.Value())
+}
+
+func TestAffinity(t *testing.T) {
+	b1 := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("b1"))
+	})
+	defer b1.Close()
+
+	b2 := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("b2"))
+	})
+	defer b2.Close()
+
+	p := newTestProxy(t, newTestConf(), "", b1, b2)
+	p.RegistryFilter(FilterHeader)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/api",
+			Affinity:    &model.SessionAffinity{},
+		},
+	}))
+
+	// set on first
+	first, cookie := doTestAffinityRequest(p, "")
+	if "" == cookie {
+		t.Fatalf("expect affinity cookie, acture:<%s>", cookie)
+	}
+
+	// stick on subsequent
+	for i := 0; i < 10; i++ {
+		body, value := doTestAffinityRequest(p, cookie)
+		if body != first {
+			t.Errorf("expect:<%s>, acture:<%s>", first, body)
+		}
+
+		if "" != value {
+			t.Errorf("expect no cookie, acture:<%s>", value)
+		}
+	}
+
+	// forged cookie use the normal selection
+	_, value := doTestAffinityRequest(p, "forged")
+	if "" == value || "forged" == value {
+		t.Errorf("expect new cookie, acture:<%s>", value)
+	}
+
+	// fallback when down
+	down := b1
+	if "b2" == first {
+		down = b2
+	}
+	p.routeTable.UnBind(down.addr(), testClusterName)
+
+	for i := 0; i < 2; i++ {
+		body, value := doTestAffinityRequest(p, cookie)
+		if body == first {
+			t.Errorf("expect not:<%s>, acture:<%s>", first, body)
+		}
+
+		if "" == value || cookie == value {
+			t.Errorf("expect new cookie, acture:<%s>", value)
+		}
+	}
+}
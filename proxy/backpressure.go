@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultMaxRetryAfterCooldown = 60 * time.Second
+)
+
+// cooldown stop routing to the overloaded server for the Retry-After of its 429 or 503 response,
+// the cooldown is capped by MaxRetryAfterCooldown
+func (p *Proxy) cooldown(svr *model.Server, res *fasthttp.Response) {
+	if !p.config.RetryAfterCooldown || nil == res {
+		return
+	}
+
+	if code := res.StatusCode(); code != http.StatusTooManyRequests && code != http.StatusServiceUnavailable {
+		return
+	}
+
+	d, ok := parseRetryAfter(string(res.Header.Peek(headerRetryAfter)), time.Now())
+	if !ok {
+		return
+	}
+
+	if max := p.getMaxRetryAfterCooldown(); d > max {
+		d = max
+	}
+
+	svr.Cooldown(d)
+	log.Warnf("Server <%s> cooldown <%s> by Retry-After", svr.Addr, d)
+}
+
+func (p *Proxy) getMaxRetryAfterCooldown() time.Duration {
+	if p.config.MaxRetryAfterCooldown > 0 {
+		return time.Duration(p.config.MaxRetryAfterCooldown) * time.Second
+	}
+
+	return defaultMaxRetryAfterCooldown
+}
+
+// parseRetryAfter parse the Retry-After of delay seconds or http date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if "" == value {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); nil == err {
+		if seconds <= 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	at, err := http.ParseTime(value)
+	if nil != err || !at.After(now) {
+		return 0, false
+	}
+
+	return at.Sub(now), true
+}
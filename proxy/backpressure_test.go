@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/lb"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		value  string
+		expect time.Duration
+		ok     bool
+	}{
+		{value: "2", expect: 2 * time.Second, ok: true},
+		{value: " 120 ", expect: 120 * time.Second, ok: true},
+		{value: "Sun, 01 Jan 2017 00:00:30 GMT", expect: 30 * time.Second, ok: true},
+		{value: "Sat, 31 Dec 2016 23:59:00 GMT", ok: false},
+		{value: "0", ok: false},
+		{value: "-1", ok: false},
+		{value: "soon", ok: false},
+		{value: "", ok: false},
+	}
+
+	for _, c := range cases {
+		d, ok := parseRetryAfter(c.value, now)
+		if d != c.expect || ok != c.ok {
+			t.Errorf("%s expect:<%s,%v>, acture:<%s,%v>", c.value, c.expect, c.ok, d, ok)
+		}
+	}
+}
+
+func TestRetryAfterCooldown(t *testing.T) {
+	var overloaded int32 = 1
+	bad := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&overloaded) == 1 {
+			w.Header().Set(headerRetryAfter, "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("OK"))
+	})
+	defer bad.Close()
+
+	good := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer good.Close()
+
+	cnf := newTestConf()
+	cnf.RetryAfterCooldown = true
+	p := newTestProxy(t, cnf, lb.ROUNDROBIN, bad, good)
+
+	for i := 0; i < 2; i++ {
+		doTestRequest(p, "GET", "/api")
+	}
+
+	if requests := atomic.LoadInt32(&bad.requests); requests != 1 {
+		t.Fatalf("expect:<1>, acture:<%d>", requests)
+	}
+
+	// the bad server is skipped in the Retry-After window
+	for i := 0; i < 10; i++ {
+		if ctx := doTestRequest(p, "GET", "/api"); ctx.Response.StatusCode() != http.StatusOK {
+			t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+		}
+	}
+
+	if requests := atomic.LoadInt32(&bad.requests); requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+
+	if !p.routeTable.GetServer(bad.addr()).IsCoolingDown() {
+		t.Errorf("expect cooling down")
+	}
+
+	atomic.StoreInt32(&overloaded, 0)
+	time.Sleep(1100 * time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		doTestRequest(p, "GET", "/api")
+	}
+
+	if requests := atomic.LoadInt32(&bad.requests); requests != 3 {
+		t.Errorf("expect:<3>, acture:<%d>", requests)
+	}
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	defaultBodyBufferSize = 1024 * 1024
+	bodyBufferFilePrefix  = "gateway-body-"
+)
+
+// BodyBuffer buffer the whole body for the filters, the body is kept in memory up to the threshold,
+// and the whole body spill to a temp file beyond it. The temp file is removed by Close.
+type BodyBuffer struct {
+	threshold int
+	dir       string
+	mem       bytes.Buffer
+	file      *os.File
+	size      int64
+	detached  bool
+}
+
+func newBodyBuffer(threshold int, dir string) *BodyBuffer {
+	if threshold <= 0 {
+		threshold = defaultBodyBufferSize
+	}
+
+	return &BodyBuffer{
+		threshold: threshold,
+		dir:       dir,
+	}
+}
+
+// Write append the data to the body, the body spill to the temp file if it exceeds the threshold
+func (b *BodyBuffer) Write(p []byte) (int, error) {
+	if nil == b.file && b.mem.Len()+len(p) > b.threshold {
+		if err := b.spill(); nil != err {
+			return 0, err
+		}
+	}
+
+	if nil == b.file {
+		n, _ := b.mem.Write(p)
+		b.size += int64(n)
+		return n, nil
+	}
+
+	n, err := b.file.Write(p)
+	b.size += int64(n)
+	return n, err
+}
+
+func (b *BodyBuffer) spill() error {
+	file, err := ioutil.TempFile(b.dir, bodyBufferFilePrefix)
+	if nil != err {
+		return err
+	}
+
+	if _, err := file.Write(b.mem.Bytes()); nil != err {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	b.file = file
+	b.mem = bytes.Buffer{}
+	return nil
+}
+
+// Size returns the size of the body
+func (b *BodyBuffer) Size() int64 {
+	return b.size
+}
+
+// Spilled returns true if the body is in the temp file
+func (b *BodyBuffer) Spilled() bool {
+	return nil != b.file
+}
+
+// Bytes returns the whole body, the spilled body is read from the temp file
+func (b *BodyBuffer) Bytes() ([]byte, error) {
+	if nil == b.file {
+		return b.mem.Bytes(), nil
+	}
+
+	return ioutil.ReadFile(b.file.Name())
+}
+
+// Stream returns the reader of the whole body, the caller owns the buffer, it is closed by the reader
+func (b *BodyBuffer) Stream() (io.ReadCloser, error) {
+	b.detached = true
+
+	if nil == b.file {
+		return &bodyBufferReader{Reader: bytes.NewReader(b.mem.Bytes()), buffer: b}, nil
+	}
+
+	if _, err := b.file.Seek(0, io.SeekStart); nil != err {
+		return nil, err
+	}
+
+	return &bodyBufferReader{Reader: b.file, buffer: b}, nil
+}
+
+// Close release the body and remove the temp file
+func (b *BodyBuffer) Close() error {
+	b.mem = bytes.Buffer{}
+	if nil == b.file {
+		return nil
+	}
+
+	file := b.file
+	b.file = nil
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+type bodyBufferReader struct {
+	io.Reader
+	buffer *BodyBuffer
+}
+
+func (r *bodyBufferReader) Close() error {
+	return r.buffer.Close()
+}
+
+// BufferBody read the whole body by the BodyBuffer, the buffer is closed when the proxy of request is done,
+// unless it is detached by Stream
+func (c *FilterContext) BufferBody(r io.Reader) (*BodyBuffer, error) {
+	b := newBodyBuffer(c.bodyBufferSize, c.bodyBufferDir)
+	c.OnDone(func() {
+		if !b.detached {
+			b.Close()
+		}
+	})
+
+	_, err := io.Copy(b, r)
+	return b, err
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func tempBodyFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, bodyBufferFilePrefix+"*"))
+	if nil != err {
+		t.Fatalf("glob err: %s", err)
+	}
+
+	return files
+}
+
+func TestBodyBufferInMemory(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "body-buffer")
+	defer os.RemoveAll(dir)
+
+	c := &FilterContext{bodyBufferSize: 16, bodyBufferDir: dir}
+	b, err := c.BufferBody(strings.NewReader("0123456789"))
+	if nil != err {
+		t.Fatalf("buffer body err: %s", err)
+	}
+
+	if b.Spilled() || b.Size() != 10 {
+		t.Errorf("expect:<in memory 10>, acture:<%v %d>", b.Spilled(), b.Size())
+	}
+
+	if body, _ := b.Bytes(); string(body) != "0123456789" {
+		t.Errorf("expect:<0123456789>, acture:<%s>", body)
+	}
+
+	if files := tempBodyFiles(t, dir); len(files) != 0 {
+		t.Errorf("expect:<0>, acture:<%d>", len(files))
+	}
+
+	c.done()
+}
+
+func TestBodyBufferSpill(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "body-buffer")
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	c := &FilterContext{bodyBufferSize: 16, bodyBufferDir: dir}
+	b, err := c.BufferBody(bytes.NewReader(data))
+	if nil != err {
+		t.Fatalf("buffer body err: %s", err)
+	}
+
+	if !b.Spilled() || b.Size() != int64(len(data)) {
+		t.Errorf("expect:<spilled %d>, acture:<%v %d>", len(data), b.Spilled(), b.Size())
+	}
+
+	if body, _ := b.Bytes(); !bytes.Equal(body, data) {
+		t.Errorf("expect:<%s>, acture:<%s>", data, body)
+	}
+
+	if files := tempBodyFiles(t, dir); len(files) != 1 {
+		t.Fatalf("expect:<1>, acture:<%d>", len(files))
+	}
+
+	c.done()
+	if files := tempBodyFiles(t, dir); len(files) != 0 {
+		t.Errorf("expect the temp file removed, acture:<%v>", files)
+	}
+}
+
+func TestBodyBufferStream(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "body-buffer")
+	defer os.RemoveAll(dir)
+
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	c := &FilterContext{bodyBufferSize: 16, bodyBufferDir: dir}
+	b, _ := c.BufferBody(bytes.NewReader(data))
+
+	stream, err := b.Stream()
+	if nil != err {
+		t.Fatalf("stream err: %s", err)
+	}
+
+	// the detached buffer is owned by the stream
+	c.done()
+	if files := tempBodyFiles(t, dir); len(files) != 1 {
+		t.Fatalf("expect:<1>, acture:<%d>", len(files))
+	}
+
+	if body, _ := ioutil.ReadAll(stream); !bytes.Equal(body, data) {
+		t.Errorf("expect:<%s>, acture:<%s>", data, body)
+	}
+
+	stream.Close()
+	if files := tempBodyFiles(t, dir); len(files) != 0 {
+		t.Errorf("expect the temp file removed, acture:<%v>", files)
+	}
+}
+
+func TestTransformStreamingBodyBuffer(t *testing.T) {
+	large := `{"id":"` + strings.Repeat("x", 64) + `"}`
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, "application/json")
+		if r.URL.Path == "/large" {
+			w.Write([]byte(large))
+			return
+		}
+
+		w.Write([]byte(`{"id":1}`))
+	})
+	defer backend.Close()
+
+	dir, _ := ioutil.TempDir("", "body-buffer")
+	defer os.RemoveAll(dir)
+
+	cnf := newTestConf()
+	cnf.Streaming = true
+	cnf.BodyBufferSize = 32
+	cnf.BodyBufferDir = dir
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterTransform)
+	for _, uri := range []string{"/small", "/large"} {
+		p.routeTable.AddNewAggregation(model.NewAggregation("^"+uri+"$", []*model.Node{
+			&model.Node{
+				ClusterName:       testClusterName,
+				URL:               uri,
+				ResponseTransform: &model.BodyTransform{Template: `{"user":{"id":{{json .id}}}}`},
+			},
+		}))
+	}
+
+	ln := startTestProxy(t, p)
+	defer ln.Close()
+
+	cases := []struct {
+		uri    string
+		expect string
+	}{
+		{uri: "/small", expect: `{"user":{"id":1}}`},
+		// the spilled body is not transformed
+		{uri: "/large", expect: large},
+	}
+
+	for _, c := range cases {
+		res, err := http.Get("http://" + ln.Addr().String() + c.uri)
+		if nil != err {
+			t.Fatalf("%s request err: %s", c.uri, err)
+		}
+
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK || string(body) != c.expect {
+			t.Errorf("%s expect:<%s>, acture:<%d %s>", c.uri, c.expect, res.StatusCode, body)
+		}
+
+		if files := tempBodyFiles(t, dir); len(files) != 0 {
+			t.Errorf("%s expect the temp file removed, acture:<%v>", c.uri, files)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrCircuitClose server is in circuit close
+	ErrCircuitClose = errors.New("server is in circuit close")
+	// ErrCircuitHalf server is in circuit half
+	ErrCircuitHalf = errors.New("server is in circuit half")
+	// ErrCircuitHalfLimited server is in circuit half, traffic limit
+	ErrCircuitHalfLimited = errors.New("server is in circuit half, traffic limit")
+)
+
+// getCircuitErr returns the error of the server not allowed by its circuit
+func getCircuitErr(svr *model.Server) error {
+	if svr.GetCircuit() == model.CircuitHalf {
+		return ErrCircuitHalfLimited
+	}
+
+	return ErrCircuitClose
+}
+
+func isCircuitErr(err error) bool {
+	return err == ErrCircuitClose || err == ErrCircuitHalfLimited
+}
+
+// recordCircuit record the result of the request to the circuit of server,
+// the 5xx and the transport errors are failures, the user canceled request is not counted
+func recordCircuit(svr *model.Server, res *fasthttp.Response, err error) {
+	switch {
+	case nil != err && strings.HasPrefix(err.Error(), ErrPrefixRequestCancel):
+		svr.CircuitCancel()
+	case nil != err || res.StatusCode() >= fasthttp.StatusInternalServerError:
+		svr.CircuitFailure()
+	default:
+		svr.CircuitSucceed()
+	}
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestCircuitContext(t *testing.T, p *Proxy, svr *model.Server) (*FilterContext, *fasthttp.Request) {
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/api")
+	req.Header.SetHost("gateway")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+
+	results := p.routeTable.Select(&ctx.Request)
+	if len(results) != 1 {
+		t.Fatalf("expect:<1>, acture:<%d>", len(results))
+	}
+	results[0].Svr = svr
+
+	c := &FilterContext{
+		ctx:        ctx,
+		result:     results[0],
+		rb:         p.routeTable,
+		runtimeVar: make(map[string]string),
+	}
+	return c, copyRequest(&ctx.Request)
+}
+
+func TestCircuitRetryServer(t *testing.T) {
+	bad := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer bad.Close()
+
+	good := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer good.Close()
+
+	cnf := newTestConf()
+	cnf.MaxRetries = 1
+	p := newTestProxy(t, cnf, "", bad, good)
+	badSvr := p.routeTable.GetServer(bad.addr())
+	badSvr.CloseCount = 1
+	badSvr.HalfToOpen = 10
+	goodSvr := p.routeTable.GetServer(good.addr())
+	goodSvr.HalfToOpen = 10
+	goodSvr.HalfCircuit()
+
+	// the failure of the first server and the trial of the retry server are both recorded
+	c, outreq := newTestCircuitContext(t, p, badSvr)
+	res, err := p.doRequest(c, outreq)
+	if nil != err || res.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%v>, err:<%v>", http.StatusOK, res, err)
+	}
+	if badSvr.GetCircuit() != model.CircuitClose {
+		t.Errorf("bad expect:<%d>, acture:<%d>", model.CircuitClose, badSvr.GetCircuit())
+	}
+	if goodSvr.GetCircuit() != model.CircuitOpen {
+		t.Errorf("good expect:<%d>, acture:<%d>", model.CircuitOpen, goodSvr.GetCircuit())
+	}
+
+	// the half circuit server with a trial in flight is skipped
+	c, outreq = newTestCircuitContext(t, p, goodSvr)
+	goodSvr.HalfCircuit()
+	goodSvr.CircuitAllow()
+	res, err = p.doRequest(c, outreq)
+	if err != ErrCircuitHalfLimited || nil != res {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrCircuitHalfLimited, err)
+	}
+	if atomic.LoadInt32(&good.requests) != 1 || atomic.LoadInt32(&bad.requests) != 1 {
+		t.Errorf("expect:<1,1>, acture:<%d,%d>", good.requests, bad.requests)
+	}
+	if 0 != c.Retries() {
+		t.Errorf("skip expect:<0>, acture:<%d>", c.Retries())
+	}
+	if code := p.getFailureStatusCode(err, res); code != http.StatusServiceUnavailable {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestCircuitSkipServer(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	other := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer other.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend, other)
+	svr := p.routeTable.GetServer(backend.addr())
+	svr.HalfToOpen = 10
+	svr.HalfCircuit()
+	svr.CircuitAllow()
+
+	// the skipped server is not a retry, so it's skipped without MaxRetries
+	c, outreq := newTestCircuitContext(t, p, svr)
+	res, err := p.doRequest(c, outreq)
+	if nil != err || res.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%v>, err:<%v>", http.StatusOK, res, err)
+	}
+	if c.result.Svr.Addr != other.addr() || atomic.LoadInt32(&backend.requests) != 0 {
+		t.Errorf("expect:<%s>, acture:<%s>", other.addr(), c.result.Svr.Addr)
+	}
+}
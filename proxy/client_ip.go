@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	clientIPRuntimeVar = "client_ip"
+)
+
+func newTrustedProxies(config *conf.Conf) []*net.IPNet {
+	nets, err := model.ParseCIDRs(config.TrustedProxies)
+	if nil != err {
+		log.PanicErrorf(err, "Proxy parse trusted proxies <%v> fail", config.TrustedProxies)
+	}
+
+	return nets
+}
+
+// getClientIP returns the real client ip of the request, see resolveClientIP.
+// The for of Forwarded header is used if the request has no X-Forwarded-For header.
+func (p *Proxy) getClientIP(ctx *fasthttp.RequestCtx) string {
+	xff := ctx.Request.Header.Peek(headerXForwardedFor)
+	if len(xff) == 0 {
+		xff = forwardedFor(ctx.Request.Header.Peek(headerForwarded))
+	}
+
+	return p.resolveClientIP(ctx.RemoteIP(), xff)
+}
+
+// resolveClientIP returns the real client ip by the remote ip and the X-Forwarded-For header.
+// If the trusted proxies are configured, the X-Forwarded-For is only used if the remote ip is trusted,
+// the ips are walked from the right and the first untrusted ip is the client ip.
+// Otherwise the first ip of X-Forwarded-For is used if TrustXForwardedFor, the remote ip if not.
+func (p *Proxy) resolveClientIP(remoteIP net.IP, xff []byte) string {
+	if len(p.trustedProxies) == 0 {
+		if p.config.TrustXForwardedFor {
+			if ip := firstForwardedIP(xff); "" != ip {
+				return ip
+			}
+		}
+
+		return remoteIP.String()
+	}
+
+	client := remoteIP
+	for len(xff) > 0 && model.ContainsIP(p.trustedProxies, client) {
+		hop := xff
+		if index := bytes.LastIndexByte(xff, ','); index >= 0 {
+			hop, xff = xff[index+1:], xff[:index]
+		} else {
+			xff = nil
+		}
+
+		ip := net.ParseIP(string(bytes.TrimSpace(hop)))
+		if nil == ip {
+			break
+		}
+		client = ip
+	}
+
+	return client.String()
+}
+
+// firstForwardedIP returns the first ip of X-Forwarded-For header, the ip is the client ip if all proxies are trusted
+func firstForwardedIP(xff []byte) string {
+	if index := bytes.IndexByte(xff, ','); index >= 0 {
+		xff = xff[:index]
+	}
+
+	return string(bytes.TrimSpace(xff))
+}
+
+// isTrustedProxy returns the remote ip is trusted to forward the X-Forwarded and Forwarded headers,
+// all remote ips are trusted by TrustXForwardedFor if the trusted proxies are not configured
+func (p *Proxy) isTrustedProxy(remoteIP net.IP) bool {
+	if len(p.trustedProxies) == 0 {
+		return p.config.TrustXForwardedFor
+	}
+
+	return model.ContainsIP(p.trustedProxies, remoteIP)
+}
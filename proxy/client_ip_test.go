@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	cnf := newTestConf()
+	cnf.TrustedProxies = []string{"10.0.0.0/8", "fd00::/8"}
+	p := NewProxy(cnf, model.NewRouteTable(memStore{}))
+
+	cases := []struct {
+		remote string
+		xff    string
+		expect string
+	}{
+		// the spoofed X-Forwarded-For from the untrusted client
+		{remote: "1.2.3.4", xff: "5.6.7.8", expect: "1.2.3.4"},
+		// the legitimate chain: client, the untrusted proxy of client, the load balancers
+		{remote: "10.0.0.1", xff: "9.9.9.9, 1.2.3.4, 10.0.0.2", expect: "1.2.3.4"},
+		{remote: "10.0.0.1", xff: "1.2.3.4", expect: "1.2.3.4"},
+		{remote: "fd00::1", xff: "2001:db8::1, fd00::2", expect: "2001:db8::1"},
+		// all the hops are trusted
+		{remote: "10.0.0.1", xff: "10.0.0.3, 10.0.0.2", expect: "10.0.0.3"},
+		// the invalid hop stop the walk
+		{remote: "10.0.0.1", xff: "1.2.3.4, unknown, 10.0.0.2", expect: "10.0.0.2"},
+		{remote: "10.0.0.1", xff: "", expect: "10.0.0.1"},
+	}
+
+	for _, c := range cases {
+		if ip := p.resolveClientIP(net.ParseIP(c.remote), []byte(c.xff)); ip != c.expect {
+			t.Errorf("%s <%s> expect:<%s>, acture:<%s>", c.remote, c.xff, c.expect, ip)
+		}
+	}
+
+	// the first ip of X-Forwarded-For without trusted proxies
+	cnf = newTestConf()
+	cnf.TrustXForwardedFor = true
+	p = NewProxy(cnf, model.NewRouteTable(memStore{}))
+	if ip := p.resolveClientIP(net.ParseIP("1.2.3.4"), []byte("5.6.7.8, 10.0.0.1")); ip != "5.6.7.8" {
+		t.Errorf("expect:<5.6.7.8>, acture:<%s>", ip)
+	}
+
+	cnf.TrustXForwardedFor = false
+	if ip := p.resolveClientIP(net.ParseIP("1.2.3.4"), []byte("5.6.7.8")); ip != "1.2.3.4" {
+		t.Errorf("expect:<1.2.3.4>, acture:<%s>", ip)
+	}
+}
+
+func TestClientIPRuntimeVar(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.TrustedProxies = []string{"10.0.0.0/8"}
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterIPFilter)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/admin$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/admin", IPFilter: &model.IPFilter{Allow: []string{"192.168.0.0/16"}}},
+	}))
+
+	// the client behind the load balancer
+	if ctx := doTestIPFilterRequest(p, "/admin", "10.0.0.1", "192.168.1.1"); ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	// the spoofed X-Forwarded-For
+	if ctx := doTestIPFilterRequest(p, "/admin", "172.16.0.1", "192.168.1.1"); ctx.Response.StatusCode() != http.StatusForbidden {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusForbidden, ctx.Response.StatusCode())
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	var received http.Header
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.TrustedProxies = []string{"10.0.0.0/8"}
+	p := newTestProxy(t, cnf, "", backend)
+
+	cases := []struct {
+		remote string
+		header map[string]string
+		xff    string
+		proto  string
+		host   string
+	}{
+		// the headers of the client
+		{remote: "1.2.3.4", xff: "1.2.3.4", proto: "http", host: "gateway"},
+		// the spoofed headers of the untrusted client are overwritten
+		{
+			remote: "1.2.3.4",
+			header: map[string]string{"X-Forwarded-For": "5.6.7.8", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil"},
+			xff:    "1.2.3.4", proto: "http", host: "gateway",
+		},
+		// the headers of the trusted load balancer are kept
+		{
+			remote: "10.0.0.1",
+			header: map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com"},
+			xff:    "1.2.3.4, 10.0.0.1", proto: "https", host: "example.com",
+		},
+		{remote: "10.0.0.1", xff: "10.0.0.1", proto: "http", host: "gateway"},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/")
+		req.Header.SetHost("gateway")
+		for key, value := range c.header {
+			req.Header.Set(key, value)
+		}
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, &net.TCPAddr{IP: net.ParseIP(c.remote), Port: 10000}, nil)
+		p.ReverseProxyHandler(ctx)
+
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+		}
+
+		if value := received.Get("X-Forwarded-For"); value != c.xff {
+			t.Errorf("%s %v expect:<%s>, acture:<%s>", c.remote, c.header, c.xff, value)
+		}
+
+		if value := received.Get("X-Forwarded-Proto"); value != c.proto {
+			t.Errorf("%s %v expect:<%s>, acture:<%s>", c.remote, c.header, c.proto, value)
+		}
+
+		if value := received.Get("X-Forwarded-Host"); value != c.host {
+			t.Errorf("%s %v expect:<%s>, acture:<%s>", c.remote, c.header, c.host, value)
+		}
+	}
+}
+
+func TestForwardedHeadersProxyChain(t *testing.T) {
+	var received http.Header
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	// the inner gateway trusts the edge gateway
+	cnf := newTestConf()
+	cnf.TrustedProxies = []string{"127.0.0.0/8"}
+	inner := startTestProxy(t, newTestProxy(t, cnf, "", backend))
+	defer inner.Close()
+
+	edge := newTestProxy(t, newTestConf(), "", &testBackend{Server: &httptest.Server{URL: "http://" + inner.Addr().String()}})
+	ln := startTestProxy(t, edge)
+	defer ln.Close()
+
+	req, _ := http.NewRequest("GET", "http://"+ln.Addr().String()+"/", nil)
+	req.Host = "example.com"
+	req.Header.Set("X-Forwarded-For", "5.6.7.8")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rsp, err := http.DefaultClient.Do(req)
+	if nil != err {
+		t.Fatalf("request err: %s", err)
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, rsp.StatusCode)
+	}
+
+	// the spoofed X-Forwarded-For is dropped by the edge, the edge is appended by the inner
+	if value := received.Get("X-Forwarded-For"); value != "127.0.0.1, 127.0.0.1" {
+		t.Errorf("expect:<127.0.0.1, 127.0.0.1>, acture:<%s>", value)
+	}
+
+	if value := received.Get("X-Forwarded-Proto"); value != "http" {
+		t.Errorf("expect:<http>, acture:<%s>", value)
+	}
+
+	if value := received.Get("X-Forwarded-Host"); value != "example.com" {
+		t.Errorf("expect:<example.com>, acture:<%s>", value)
+	}
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"net"
+	"time"
+)
+
+// connRateLimitListener limit the new connections accepted per second by a token bucket,
+// the connections beyond the limit are closed immediately.
+type connRateLimitListener struct {
+	net.Listener
+
+	rate    int
+	burst   int
+	buckets *tokenBuckets
+}
+
+func newConnRateLimitListener(ln net.Listener, rate, burst int) net.Listener {
+	if burst <= 0 {
+		burst = rate
+	}
+
+	return &connRateLimitListener{
+		Listener: ln,
+		rate:     rate,
+		burst:    burst,
+		buckets:  newTokenBuckets(),
+	}
+}
+
+func (l *connRateLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if nil != err {
+			return nil, err
+		}
+
+		// all connections share the bucket of the zero key
+		if ok, _ := l.buckets.take(bucketKey{}, l.rate, l.burst, time.Now()); ok {
+			return conn, nil
+		}
+
+		conn.Close()
+	}
+}
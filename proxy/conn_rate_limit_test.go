@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestConnRateLimit(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.Addr = "127.0.0.1:0"
+	cnf.ServerConnRateLimit = 1
+	cnf.ServerConnRateLimitBurst = 2
+	p := newTestProxy(t, cnf, "", backend)
+
+	ln, err := p.newListener()
+	if nil != err {
+		t.Fatalf("listen err: %s", err)
+	}
+	defer ln.Close()
+	go fasthttp.Serve(ln, p.ReverseProxyHandler)
+
+	get := func() bool {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if nil != err {
+			t.Fatalf("dial err: %s", err)
+		}
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(time.Second * 2))
+		conn.Write([]byte("GET / HTTP/1.1\r\nHost: gateway\r\n\r\n"))
+		res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		return nil == err && res.StatusCode == http.StatusOK
+	}
+
+	accepted := 0
+	for i := 0; i < 5; i++ {
+		if get() {
+			accepted++
+		}
+	}
+
+	if accepted != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", accepted)
+	}
+
+	time.Sleep(time.Second)
+	if !get() {
+		t.Errorf("expect the connection accepted after the token refilled")
+	}
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	errorVarRequestID = "request_id"
+	errorVarStatus    = "status"
+	errorVarError     = "error"
+	errorVarReason    = "reason"
+)
+
+// writeError respond the failure status code, the body is the error page of node or the configured error
+// response of the code, the body is empty if neither is configured
+func (p *Proxy) writeError(ctx *fasthttp.RequestCtx, node *model.Node, code int, err error) {
+	ctx.SetStatusCode(code)
+
+	if er, ok := p.getErrorResponse(node, code); ok {
+		writeErrorResponse(ctx, er, code, err)
+	}
+}
+
+// writeErrorPage replace the 4xx or 5xx response of backend server by the error page,
+// only the nodes with error pages replace the responses
+func (p *Proxy) writeErrorPage(ctx *fasthttp.RequestCtx, result *model.RouteResult) bool {
+	code := result.Res.StatusCode()
+	if nil == result.Node || len(result.Node.ErrorPages) == 0 || code < fasthttp.StatusBadRequest {
+		return false
+	}
+
+	er, ok := p.getErrorResponse(result.Node, code)
+	if !ok {
+		return false
+	}
+
+	result.CloseStream()
+	ctx.Response.Header.Del("Content-Encoding")
+	writeErrorResponse(ctx, er, code, nil)
+	return true
+}
+
+// getErrorResponse returns the error page of node, or the configured error response
+func (p *Proxy) getErrorResponse(node *model.Node, code int) (conf.ErrorResponse, bool) {
+	if nil != node {
+		if page, ok := node.GetErrorPage(code); ok {
+			return conf.ErrorResponse{ContentType: page.ContentType, Body: page.Body}, true
+		}
+	}
+
+	if len(p.config.ErrorResponses) == 0 {
+		return conf.ErrorResponse{}, false
+	}
+
+	if er, ok := p.config.ErrorResponses[strconv.Itoa(code)]; ok {
+		return er, true
+	}
+
+	er, ok := p.config.ErrorResponses[strconv.Itoa(code/100)+"xx"]
+	return er, ok
+}
+
+func writeErrorResponse(ctx *fasthttp.RequestCtx, er conf.ErrorResponse, code int, err error) {
+	reason := http.StatusText(code)
+	if nil != err {
+		reason = err.Error()
+	}
+
+	vars := map[string]string{
+		errorVarRequestID: getRequestID(ctx),
+		errorVarStatus:    strconv.Itoa(code),
+		errorVarError:     http.StatusText(code),
+		errorVarReason:    reason,
+	}
+
+	ctx.Response.ResetBody()
+	if "" != er.ContentType {
+		ctx.SetContentType(er.ContentType)
+	}
+	ctx.SetBody(expandErrorVars(er.Body, vars, strings.Contains(er.ContentType, "json")))
+}
+
+// expandErrorVars replace ${var} in body by vars, the unknown vars are kept
+func expandErrorVars(body string, vars map[string]string, escapeJSON bool) []byte {
+	buf := bytes.Buffer{}
+	for {
+		start := strings.Index(body, "${")
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(body[start:], '}')
+		if end < 0 {
+			break
+		}
+
+		buf.WriteString(body[:start])
+		if value, ok := vars[body[start+2:start+end]]; !ok {
+			buf.WriteString(body[start : start+end+1])
+		} else if escapeJSON {
+			data, _ := json.Marshal(value)
+			buf.Write(data[1 : len(data)-1])
+		} else {
+			buf.WriteString(value)
+		}
+		body = body[start+end+1:]
+	}
+
+	buf.WriteString(body)
+	return buf.Bytes()
+}
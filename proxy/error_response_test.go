@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestErrorResponse(t *testing.T) {
+	cnf := newTestConf()
+	cnf.PathWhiteList = []string{"^/api"}
+	cnf.ErrorResponses = map[string]conf.ErrorResponse{
+		"5xx": conf.ErrorResponse{
+			ContentType: "application/json",
+			Body:        `{"error":"${error}","reason":"${reason}","request_id":"${request_id}","code":${status}}`,
+		},
+		"404": conf.ErrorResponse{
+			ContentType: "text/plain",
+			Body:        "not found ${unknown}",
+		},
+	}
+
+	p := newTestProxy(t, cnf, "")
+	p.RegistryFilter(FilterBlackList)
+
+	ctx := doTestRequest(p, "GET", "/api")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusServiceUnavailable, ctx.Response.StatusCode())
+	}
+
+	if contentType := string(ctx.Response.Header.ContentType()); contentType != "application/json" {
+		t.Errorf("expect:<application/json>, acture:<%s>", contentType)
+	}
+
+	value := make(map[string]interface{})
+	if err := json.Unmarshal(ctx.Response.Body(), &value); nil != err {
+		t.Fatalf("unmarshal <%s> err: %s", ctx.Response.Body(), err)
+	}
+
+	requestID := string(ctx.Response.Header.Peek(headerXRequestID))
+	if value["error"] != http.StatusText(http.StatusServiceUnavailable) || value["reason"] != ErrNoServer.Error() ||
+		value["request_id"] != requestID || "" == requestID || value["code"] != float64(http.StatusServiceUnavailable) {
+		t.Errorf("expect:<%s>, acture:<%s>", requestID, ctx.Response.Body())
+	}
+
+	// the status code is used before the class
+	ctx = doTestRequest(p, "GET", "/other")
+	if ctx.Response.StatusCode() != http.StatusNotFound || string(ctx.Response.Body()) != "not found ${unknown}" ||
+		string(ctx.Response.Header.ContentType()) != "text/plain" {
+		t.Errorf("expect:<404, not found ${unknown}>, acture:<%d, %s>", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	// no body by default
+	p = newTestProxy(t, newTestConf(), "")
+	ctx = doTestRequest(p, "GET", "/api")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable || len(ctx.Response.Body()) != 0 {
+		t.Errorf("expect:<503, empty>, acture:<%d, %s>", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
+
+func TestExpandErrorVars(t *testing.T) {
+	vars := map[string]string{errorVarReason: `say "hi"`}
+
+	if value := string(expandErrorVars(`{"reason":"${reason}"}`, vars, true)); value != `{"reason":"say \"hi\""}` {
+		t.Errorf("expect:<escaped>, acture:<%s>", value)
+	}
+
+	if value := string(expandErrorVars("${reason} ${", vars, false)); value != `say "hi" ${` {
+		t.Errorf("expect:<raw>, acture:<%s>", value)
+	}
+}
+
+func TestNodeErrorPage(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("missing") != "" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("upstream"))
+			return
+		}
+
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.ErrorResponses = map[string]conf.ErrorResponse{
+		"5xx": conf.ErrorResponse{ContentType: "application/json", Body: `{"code":${status}}`},
+	}
+
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/site", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			ErrorPages: map[string]*model.ErrorPage{
+				"4xx": &model.ErrorPage{ContentType: "text/html", Body: "<h1>${status} ${error}</h1>"},
+			},
+		},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/app", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			ErrorPages: map[string]*model.ErrorPage{
+				"503": &model.ErrorPage{Body: "maintenance"},
+			},
+		},
+	}))
+
+	cases := []struct {
+		uri         string
+		code        int
+		contentType string
+		body        string
+	}{
+		{uri: "/site?missing=1", code: http.StatusNotFound, contentType: "text/html", body: "<h1>404 Not Found</h1>"},
+		{uri: "/site", code: http.StatusOK, body: "OK"},
+		// the node without error pages
+		{uri: "/api?missing=1", code: http.StatusNotFound, body: "upstream"},
+	}
+
+	for _, c := range cases {
+		ctx := doTestRequest(p, "GET", c.uri)
+		if ctx.Response.StatusCode() != c.code || string(ctx.Response.Body()) != c.body {
+			t.Errorf("%s expect:<%d, %s>, acture:<%d, %s>", c.uri, c.code, c.body, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+
+		if contentType := string(ctx.Response.Header.ContentType()); "" != c.contentType && contentType != c.contentType {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.uri, c.contentType, contentType)
+		}
+	}
+
+	// the gateway error fallback to the global error response
+	p.routeTable.UnBind(backend.addr(), testClusterName)
+	ctx := doTestRequest(p, "GET", "/site")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable || string(ctx.Response.Body()) != `{"code":503}` {
+		t.Errorf("expect:<503, {\"code\":503}>, acture:<%d, %s>", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	// the gateway error use the error page of node first
+	ctx = doTestRequest(p, "GET", "/app")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable || string(ctx.Response.Body()) != "maintenance" {
+		t.Errorf("expect:<503, maintenance>, acture:<%d, %s>", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"errors"
 	"strings"
+	"sync"
 
 	"github.com/fagongzi/gateway/conf"
 )
@@ -23,12 +24,98 @@ const (
 	FilterBlackList = "BLACKLIST"
 	// FilterAnalysis analysis filter
 	FilterAnalysis = "ANALYSIS"
-	// FilterRateLimiting limit filter
+	// FilterRateLimiting qps limit filter of server, see FilterClientRateLimit to limit every client
 	FilterRateLimiting = "RATE-LIMITING"
 	// FilterCircuitBreake circuit breake filter
 	FilterCircuitBreake = "CIRCUIT-BREAKE"
+	// FilterMaxBody max response body size filter
+	FilterMaxBody = "MAX-BODY"
+	// FilterGzip gzip response compression filter
+	FilterGzip = "GZIP"
+	// FilterGunzip gzip response decompression filter
+	FilterGunzip = "GUNZIP"
+	// FilterClientRateLimit token bucket rate limit filter of client ip
+	FilterClientRateLimit = "CLIENT-RATE-LIMIT"
+	// FilterJWT jwt validation filter
+	FilterJWT = "JWT"
+	// FilterAPIKey api key authentication filter
+	FilterAPIKey = "APIKEY"
+	// FilterAccessLog sampling access log filter
+	FilterAccessLog = "ACCESS-LOG"
+	// FilterHeaderRules add, remove and rename headers filter
+	FilterHeaderRules = "HEADERS"
+	// FilterCORS cors filter
+	FilterCORS = "CORS"
+	// FilterCache response cache filter
+	FilterCache = "CACHE"
+	// FilterMock mock response filter
+	FilterMock = "MOCK"
+	// FilterFault fault injection filter
+	FilterFault = "FAULT"
+	// FilterTransform request and response body transformation filter
+	FilterTransform = "TRANSFORM"
+	// FilterIPFilter client ip allowlist and denylist filter
+	FilterIPFilter = "IP-FILTER"
+	// FilterSingleFlight identical requests deduplication filter
+	FilterSingleFlight = "SINGLE-FLIGHT"
+	// FilterMethod OPTIONS and HEAD short-circuit filter
+	FilterMethod = "METHOD"
+	// FilterBasicAuth http basic authentication filter
+	FilterBasicAuth = "BASICAUTH"
+	// FilterOAuthIntrospect oauth2 token introspection filter
+	FilterOAuthIntrospect = "OAUTH-INTROSPECT"
+	// FilterAuthz scope and role authorization filter
+	FilterAuthz = "AUTHZ"
+	// FilterHMACVerify request signature verification filter
+	FilterHMACVerify = "HMAC-VERIFY"
+	// FilterIdempotency Idempotency-Key response replay filter
+	FilterIdempotency = "IDEMPOTENCY"
+	// FilterValidateRequest required params, headers and json schema request validation filter
+	FilterValidateRequest = "VALIDATE-REQUEST"
+	// FilterValidateResponse json schema response validation filter
+	FilterValidateResponse = "VALIDATE-RESPONSE"
 )
 
+// FilterFactory create the custom filter of the proxy
+type FilterFactory func(config *conf.Conf, proxy *Proxy) (Filter, error)
+
+var (
+	factoriesLock sync.RWMutex
+	factories     = make(map[string]FilterFactory)
+)
+
+// RegisterFilterFactory register the factory of the custom filter, the filter is registered to the proxy
+// by the name in RegistryFilter. The name is case insensitive, and the built-in filters can not be replaced.
+// It panics if the name is registered twice or the factory is nil.
+func RegisterFilterFactory(name string, factory FilterFactory) {
+	if nil == factory {
+		panic("proxy: register nil filter factory " + name)
+	}
+
+	name = strings.ToUpper(name)
+
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic("proxy: register filter factory twice " + name)
+	}
+
+	factories[name] = factory
+}
+
+func newCustomFilter(name string, config *conf.Conf, proxy *Proxy) (Filter, error) {
+	factoriesLock.RLock()
+	factory, ok := factories[name]
+	factoriesLock.RUnlock()
+
+	if !ok {
+		return nil, ErrKnownFilter
+	}
+
+	return factory(config, proxy)
+}
+
 func newFilter(name string, config *conf.Conf, proxy *Proxy) (Filter, error) {
 	input := strings.ToUpper(name)
 
@@ -47,7 +134,53 @@ func newFilter(name string, config *conf.Conf, proxy *Proxy) (Filter, error) {
 		return newRateLimitingFilter(config, proxy), nil
 	case FilterCircuitBreake:
 		return newCircuitBreakeFilter(config, proxy), nil
+	case FilterMaxBody:
+		return newMaxBodyFilter(config, proxy), nil
+	case FilterGzip:
+		return newGzipFilter(config, proxy), nil
+	case FilterGunzip:
+		return newGunzipFilter(config, proxy), nil
+	case FilterClientRateLimit:
+		return newClientRateLimitFilter(config, proxy), nil
+	case FilterJWT:
+		return newJWTFilter(config, proxy), nil
+	case FilterAPIKey:
+		return newAPIKeyFilter(config, proxy), nil
+	case FilterAccessLog:
+		return newAccessLogFilter(config, proxy), nil
+	case FilterHeaderRules:
+		return newHeaderRulesFilter(config, proxy), nil
+	case FilterCORS:
+		return newCORSFilter(config, proxy), nil
+	case FilterCache:
+		return newCacheFilter(config, proxy), nil
+	case FilterMock:
+		return newMockFilter(config, proxy), nil
+	case FilterFault:
+		return newFaultFilter(config, proxy), nil
+	case FilterTransform:
+		return newTransformFilter(config, proxy), nil
+	case FilterIPFilter:
+		return newIPFilterFilter(config, proxy), nil
+	case FilterSingleFlight:
+		return newSingleFlightFilter(config, proxy), nil
+	case FilterMethod:
+		return newMethodFilter(config, proxy), nil
+	case FilterBasicAuth:
+		return newBasicAuthFilter(config, proxy), nil
+	case FilterOAuthIntrospect:
+		return newOAuthIntrospectFilter(config, proxy), nil
+	case FilterAuthz:
+		return newAuthzFilter(config, proxy), nil
+	case FilterHMACVerify:
+		return newHMACVerifyFilter(config, proxy), nil
+	case FilterIdempotency:
+		return newIdempotencyFilter(config, proxy), nil
+	case FilterValidateRequest:
+		return newValidateRequestFilter(config, proxy), nil
+	case FilterValidateResponse:
+		return newValidateResponseFilter(config, proxy), nil
 	default:
-		return nil, ErrKnownFilter
+		return newCustomFilter(input, config, proxy)
 	}
 }
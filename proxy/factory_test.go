@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+// tenantFilter the custom filter only use the exported api
+type tenantFilter struct {
+	BaseFilter
+	header string
+}
+
+func (f tenantFilter) Name() string {
+	return "TENANT"
+}
+
+func (f tenantFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	tenant := string(c.Ctx().Request.Header.Peek(f.header))
+	if "" == tenant {
+		res := fasthttp.AcquireResponse()
+		res.SetStatusCode(http.StatusForbidden)
+		res.SetBodyString("tenant required")
+		return c.Respond(res)
+	}
+
+	c.SetRuntimeVar("tenant", tenant)
+	c.OutRequest().Header.Set("X-Tenant-ID", c.RuntimeVar("tenant"))
+	return f.BaseFilter.Pre(c)
+}
+
+func (f tenantFilter) Post(c *FilterContext) (statusCode int, err error) {
+	c.Result().Res.Header.Set("X-Tenant", c.RuntimeVar("tenant"))
+	return f.BaseFilter.Post(c)
+}
+
+func TestRegisterFilterFactory(t *testing.T) {
+	RegisterFilterFactory("tenant", func(config *conf.Conf, proxy *Proxy) (Filter, error) {
+		return tenantFilter{header: "X-Tenant"}, nil
+	})
+	RegisterFilterFactory("invalid", func(config *conf.Conf, proxy *Proxy) (Filter, error) {
+		return nil, errors.New("invalid config")
+	})
+
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Tenant-ID")))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter("Tenant")
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/api")
+	req.Header.SetHost("gateway")
+	req.Header.Set("X-Tenant", "acme")
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+	p.ReverseProxyHandler(ctx)
+
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != "acme" {
+		t.Errorf("expect:<%d acme>, acture:<%d %s>", http.StatusOK, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	if value := string(ctx.Response.Header.Peek("X-Tenant")); value != "acme" {
+		t.Errorf("expect:<acme>, acture:<%s>", value)
+	}
+
+	ctx = doTestRequest(p, "GET", "/api")
+	if ctx.Response.StatusCode() != http.StatusForbidden || string(ctx.Response.Body()) != "tenant required" {
+		t.Errorf("expect:<%d>, acture:<%d %s>", http.StatusForbidden, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	if _, err := newFilter("invalid", p.config, p); nil == err || err.Error() != "invalid config" {
+		t.Errorf("expect:<invalid config>, acture:<%v>", err)
+	}
+	if _, err := newFilter("unknown", p.config, p); err != ErrKnownFilter {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrKnownFilter, err)
+	}
+
+	func() {
+		defer func() {
+			if nil == recover() {
+				t.Errorf("expect panic of the duplicate factory")
+			}
+		}()
+
+		RegisterFilterFactory("TENANT", func(config *conf.Conf, proxy *Proxy) (Filter, error) {
+			return tenantFilter{}, nil
+		})
+	}()
+}
@@ -2,8 +2,11 @@ package proxy
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/tls"
 	"io"
 	"net"
+	"net/http/httputil"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,6 +27,8 @@ var clientConnPool sync.Pool
 type FastHTTPClient struct {
 	conf *conf.Conf
 
+	MaxConnsPerHost     int           `json:"maxConnsPerHost"`
+	MaxConnWaitTimeout  time.Duration `json:"maxConnWaitTimeout"`
 	MaxConnDuration     time.Duration `json:"maxConnDuration"`
 	MaxIdleConnDuration time.Duration `json:"maxIdleConnDuration"`
 	ReadTimeout         time.Duration `json:"readTimeout"`
@@ -32,27 +37,87 @@ type FastHTTPClient struct {
 	clientName  atomic.Value
 	lastUseTime uint32
 
+	hostsLock sync.Mutex
+	hosts     map[hostKey]*hostClient
+
+	readerPool sync.Pool
+	writerPool sync.Pool
+}
+
+// hostKey the backend server addr and the tls config to connect, nil is plain http. The nodes of the same
+// tls options share the tls config, so the conns are not grown by the reloads of the nodes.
+type hostKey struct {
+	addr      string
+	tlsConfig *tls.Config
+}
+
+// hostClient the conns to a backend server, the conns are kept by the server and the tls config,
+// a conn dialed to a server is never reused by the request of another server, e.g. the retry.
+type hostClient struct {
+	addr      string
+	tlsConfig *tls.Config
+
 	connsLock  sync.Mutex
 	connsCount int
 	conns      []*clientConn
+	connsWait  []chan struct{}
+}
 
-	readerPool sync.Pool
-	writerPool sync.Pool
+// notifyWaiter wake up the first waiter of free conn, the connsLock must be held
+func (hc *hostClient) notifyWaiter() {
+	if len(hc.connsWait) == 0 {
+		return
+	}
+
+	close(hc.connsWait[0])
+	hc.connsWait[0] = nil
+	hc.connsWait = hc.connsWait[1:]
+}
+
+// removeWaiter remove the waiter of timeout, returns false if it is notified already
+func (hc *hostClient) removeWaiter(wait chan struct{}) bool {
+	hc.connsLock.Lock()
+	defer hc.connsLock.Unlock()
+
+	for i, w := range hc.connsWait {
+		if w == wait {
+			hc.connsWait = append(hc.connsWait[:i], hc.connsWait[i+1:]...)
+			return true
+		}
+	}
+
+	return false
 }
 
 // NewFastHTTPClient create FastHTTPClient instance
 func NewFastHTTPClient(conf *conf.Conf) *FastHTTPClient {
-	return &FastHTTPClient{
+	c := &FastHTTPClient{
 		conf:                conf,
+		MaxConnsPerHost:     conf.MaxConnsPerHost,
+		MaxConnWaitTimeout:  time.Duration(conf.MaxConnWaitTimeout) * time.Millisecond,
 		MaxConnDuration:     time.Duration(conf.MaxConnDuration) * time.Second,
 		MaxIdleConnDuration: time.Duration(conf.MaxIdleConnDuration) * time.Second,
 		ReadTimeout:         time.Duration(conf.ReadTimeout) * time.Second,
 		WriteTimeout:        time.Duration(conf.WriteTimeout) * time.Second,
+		hosts:               make(map[hostKey]*hostClient),
+	}
+
+	if c.MaxConnsPerHost <= 0 {
+		c.MaxConnsPerHost = conf.MaxConns
 	}
+	if c.MaxConnsPerHost <= 0 {
+		c.MaxConnsPerHost = fasthttp.DefaultMaxConnsPerHost
+	}
+	if c.MaxIdleConnDuration <= 0 {
+		c.MaxIdleConnDuration = fasthttp.DefaultMaxIdleConnDuration
+	}
+
+	return c
 }
 
 type clientConn struct {
-	c net.Conn
+	c  net.Conn
+	hc *hostClient
 
 	createdTime time.Time
 	lastUseTime time.Time
@@ -63,25 +128,153 @@ type clientConn struct {
 
 // Do do proxy
 func (c *FastHTTPClient) Do(req *fasthttp.Request, addr string) (*fasthttp.Response, error) {
-	resp, retry, err := c.do(req, addr)
+	return c.DoDeadline(req, addr, time.Time{})
+}
+
+// DoDeadline do proxy, the request must be finished before the deadline.
+// The zero deadline means only use the ReadTimeout and WriteTimeout.
+func (c *FastHTTPClient) DoDeadline(req *fasthttp.Request, addr string, deadline time.Time) (*fasthttp.Response, error) {
+	return c.DoWithLimit(req, addr, nil, deadline, c.conf.MaxResponseBodySize)
+}
+
+// DoWithLimit do proxy, the request must be finished before the deadline,
+// and the response body size must be less than maxBodySize.
+// The conn is tls if the tlsConfig is not nil.
+func (c *FastHTTPClient) DoWithLimit(req *fasthttp.Request, addr string, tlsConfig *tls.Config, deadline time.Time, maxBodySize int) (*fasthttp.Response, error) {
+	resp, retry, err := c.do(req, addr, tlsConfig, deadline, maxBodySize)
 	if err != nil && retry && isIdempotent(req) {
-		resp, _, err = c.do(req, addr)
+		resp, _, err = c.do(req, addr, tlsConfig, deadline, maxBodySize)
 	}
 	if err == io.EOF {
 		err = fasthttp.ErrConnectionClosed
 	}
+	if isTimeout(err) {
+		err = fasthttp.ErrTimeout
+	}
 	return resp, err
 }
 
-func (c *FastHTTPClient) do(req *fasthttp.Request, addr string) (*fasthttp.Response, bool, error) {
+func (c *FastHTTPClient) do(req *fasthttp.Request, addr string, tlsConfig *tls.Config, deadline time.Time, maxBodySize int) (*fasthttp.Response, bool, error) {
 	resp := fasthttp.AcquireResponse()
 
-	ok, err := c.doNonNilReqResp(req, resp, addr)
+	ok, err := c.doNonNilReqResp(req, resp, addr, tlsConfig, deadline, maxBodySize)
 
 	return resp, ok, err
 }
 
-func (c *FastHTTPClient) doNonNilReqResp(req *fasthttp.Request, resp *fasthttp.Response, addr string) (bool, error) {
+// DoStream do proxy, the response body is streamed if the streaming func returns true
+// after the response header is read, otherwise the body is read like DoWithLimit and
+// the returned stream is nil. The stream is read from the conn of backend server,
+// it must be closed after use.
+func (c *FastHTTPClient) DoStream(req *fasthttp.Request, addr string, tlsConfig *tls.Config, deadline time.Time, maxBodySize int, streaming func(*fasthttp.Response) bool) (*fasthttp.Response, io.ReadCloser, error) {
+	resp, body, retry, err := c.doStream(req, addr, tlsConfig, deadline, maxBodySize, streaming)
+	if err != nil && retry && isIdempotent(req) {
+		resp, body, _, err = c.doStream(req, addr, tlsConfig, deadline, maxBodySize, streaming)
+	}
+	if err == io.EOF {
+		err = fasthttp.ErrConnectionClosed
+	}
+	if isTimeout(err) {
+		err = fasthttp.ErrTimeout
+	}
+	return resp, body, err
+}
+
+func (c *FastHTTPClient) doStream(req *fasthttp.Request, addr string, tlsConfig *tls.Config, deadline time.Time, maxBodySize int, streaming func(*fasthttp.Response) bool) (*fasthttp.Response, io.ReadCloser, bool, error) {
+	resp := fasthttp.AcquireResponse()
+
+	cc, resetConnection, retry, err := c.sendRequest(req, resp, addr, tlsConfig, deadline)
+	if err != nil {
+		return resp, nil, retry, err
+	}
+
+	br := c.acquireReader(cc.c)
+	err = resp.Header.Read(br)
+	if err == nil && resp.StatusCode() == fasthttp.StatusContinue {
+		err = resp.Header.Read(br)
+	}
+	if err != nil {
+		c.releaseReader(br)
+		c.closeConn(cc)
+		return resp, nil, err == io.EOF, err
+	}
+
+	body := &streamBody{
+		client:    c,
+		cc:        cc,
+		br:        br,
+		keepalive: !resetConnection && !req.ConnectionClose() && !resp.ConnectionClose(),
+	}
+
+	contentLength := resp.Header.ContentLength()
+	switch {
+	case req.Header.IsHead() || !hasResponseBody(resp.StatusCode()):
+		body.Reader = io.LimitReader(br, 0)
+		body.noBody = true
+	case contentLength >= 0:
+		body.Reader = io.LimitReader(br, int64(contentLength))
+	case contentLength == -1:
+		body.Reader = httputil.NewChunkedReader(br)
+		body.chunked = true
+	default:
+		// identity body is finished by closing the conn
+		body.Reader = br
+		body.keepalive = false
+	}
+
+	if !streaming(resp) {
+		err = body.readTo(resp, maxBodySize)
+		body.Close()
+		return resp, nil, false, err
+	}
+
+	body.timeoutPerRead = true
+	// the server-sent events are endless, they are not limited
+	if isEventStream(resp) {
+		return resp, body, false, nil
+	}
+
+	if maxBodySize > 0 && !body.noBody && contentLength > maxBodySize {
+		body.Close()
+		return resp, nil, false, fasthttp.ErrBodyTooLarge
+	}
+
+	return resp, newLimitBody(body, maxBodySize), false, nil
+}
+
+func (c *FastHTTPClient) doNonNilReqResp(req *fasthttp.Request, resp *fasthttp.Response, addr string, tlsConfig *tls.Config, deadline time.Time, maxBodySize int) (bool, error) {
+	cc, resetConnection, retry, err := c.sendRequest(req, resp, addr, tlsConfig, deadline)
+	if err != nil {
+		return retry, err
+	}
+
+	if !req.Header.IsGet() && req.Header.IsHead() {
+		resp.SkipBody = true
+	}
+
+	br := c.acquireReader(cc.c)
+	if err = resp.ReadLimitBody(br, maxBodySize); err != nil {
+		c.releaseReader(br)
+		c.closeConn(cc)
+		if err == io.EOF {
+			return true, err
+		}
+		return false, err
+	}
+	c.releaseReader(br)
+
+	if resetConnection || req.ConnectionClose() || resp.ConnectionClose() {
+		c.closeConn(cc)
+	} else {
+		c.releaseConn(cc)
+	}
+
+	return false, err
+}
+
+// sendRequest write the request to the conn of addr, and set the read deadline of the conn.
+// The conn returned must be released or closed by the caller.
+func (c *FastHTTPClient) sendRequest(req *fasthttp.Request, resp *fasthttp.Response, addr string, tlsConfig *tls.Config, deadline time.Time) (*clientConn, bool, bool, error) {
 	if req == nil {
 		panic("BUG: req cannot be nil")
 	}
@@ -95,14 +288,25 @@ func (c *FastHTTPClient) doNonNilReqResp(req *fasthttp.Request, resp *fasthttp.R
 	// so the GC may reclaim these resources (e.g. response body).
 	resp.Reset()
 
-	cc, err := c.acquireConn(addr)
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return nil, false, false, fasthttp.ErrTimeout
+	}
+
+	cc, err := c.acquireConn(addr, tlsConfig, deadline)
 	if err != nil {
-		return false, err
+		return nil, false, false, err
 	}
 	conn := cc.c
 
 	// set write deadline
-	if c.conf.WriteTimeout > 0 {
+	if !deadline.IsZero() {
+		if err = conn.SetWriteDeadline(deadline); err != nil {
+			c.closeConn(cc)
+			return nil, false, true, err
+		}
+		// the next request must reset the deadline
+		cc.lastWriteDeadlineTime = time.Time{}
+	} else if c.conf.WriteTimeout > 0 {
 		// Optimization: update write deadline only if more than 25%
 		// of the last write deadline exceeded.
 		// See https://github.com/golang/go/issues/15133 for details.
@@ -110,7 +314,7 @@ func (c *FastHTTPClient) doNonNilReqResp(req *fasthttp.Request, resp *fasthttp.R
 		if currentTime.Sub(cc.lastWriteDeadlineTime) > (c.WriteTimeout >> 2) {
 			if err = conn.SetWriteDeadline(currentTime.Add(c.WriteTimeout)); err != nil {
 				c.closeConn(cc)
-				return true, err
+				return nil, false, true, err
 			}
 			cc.lastWriteDeadlineTime = currentTime
 		}
@@ -135,12 +339,19 @@ func (c *FastHTTPClient) doNonNilReqResp(req *fasthttp.Request, resp *fasthttp.R
 	if err != nil {
 		c.releaseWriter(bw)
 		c.closeConn(cc)
-		return true, err
+		return nil, false, true, err
 	}
 	c.releaseWriter(bw)
 
 	// set read readline
-	if c.conf.ReadTimeout > 0 {
+	if !deadline.IsZero() {
+		if err = conn.SetReadDeadline(deadline); err != nil {
+			c.closeConn(cc)
+			return nil, false, true, err
+		}
+		// the next request must reset the deadline
+		cc.lastReadDeadlineTime = time.Time{}
+	} else if c.conf.ReadTimeout > 0 {
 		// Optimization: update read deadline only if more than 25%
 		// of the last read deadline exceeded.
 		// See https://github.com/golang/go/issues/15133 for details.
@@ -148,91 +359,223 @@ func (c *FastHTTPClient) doNonNilReqResp(req *fasthttp.Request, resp *fasthttp.R
 		if currentTime.Sub(cc.lastReadDeadlineTime) > (c.ReadTimeout >> 2) {
 			if err = conn.SetReadDeadline(currentTime.Add(c.ReadTimeout)); err != nil {
 				c.closeConn(cc)
-				return true, err
+				return nil, false, true, err
 			}
 			cc.lastReadDeadlineTime = currentTime
 		}
 	}
 
-	if !req.Header.IsGet() && req.Header.IsHead() {
-		resp.SkipBody = true
+	return cc, resetConnection, false, nil
+}
+
+// streamBody the response body which is read from the conn of backend server,
+// the conn is released for reusing if the body is read completely, otherwise closed.
+type streamBody struct {
+	io.Reader
+
+	client         *FastHTTPClient
+	cc             *clientConn
+	br             *bufio.Reader
+	noBody         bool
+	chunked        bool
+	keepalive      bool
+	timeoutPerRead bool
+	eof            bool
+}
+
+// Read read the body, if streaming, every read must be finished in the ReadTimeout
+// instead of the deadline of the request
+func (b *streamBody) Read(p []byte) (int, error) {
+	if b.timeoutPerRead {
+		conn := b.cc.c
+		if b.client.conf.ReadTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(b.client.ReadTimeout))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+		// the next request must reset the deadline
+		b.cc.lastReadDeadlineTime = time.Time{}
 	}
 
-	br := c.acquireReader(conn)
-	if err = resp.ReadLimitBody(br, c.conf.MaxResponseBodySize); err != nil {
-		c.releaseReader(br)
-		c.closeConn(cc)
-		if err == io.EOF {
-			return true, err
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		b.eof = true
+		if b.chunked && nil != b.discardTrailer() {
+			b.keepalive = false
 		}
-		return false, err
 	}
-	c.releaseReader(br)
 
-	if resetConnection || req.ConnectionClose() || resp.ConnectionClose() {
-		c.closeConn(cc)
+	return n, err
+}
+
+// readTo read the whole body to resp, the body size must be less than maxBodySize
+func (b *streamBody) readTo(resp *fasthttp.Response, maxBodySize int) error {
+	if b.noBody {
+		return nil
+	}
+
+	if maxBodySize > 0 && resp.Header.ContentLength() > maxBodySize {
+		return fasthttp.ErrBodyTooLarge
+	}
+
+	var r io.Reader = b
+	if maxBodySize > 0 {
+		r = io.LimitReader(b, int64(maxBodySize)+1)
+	}
+
+	if _, err := io.Copy(resp.BodyWriter(), r); err != nil {
+		resp.ResetBody()
+		return err
+	}
+
+	if maxBodySize > 0 && len(resp.Body()) > maxBodySize {
+		resp.ResetBody()
+		return fasthttp.ErrBodyTooLarge
+	}
+
+	resp.Header.SetContentLength(len(resp.Body()))
+	return nil
+}
+
+// discardTrailer the chunked reader stop at the last chunk, the trailer must be read
+func (b *streamBody) discardTrailer() error {
+	for {
+		line, err := b.br.ReadSlice('\n')
+		if err != nil {
+			return err
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			return nil
+		}
+	}
+}
+
+// Close release the conn
+func (b *streamBody) Close() error {
+	if nil == b.cc {
+		return nil
+	}
+
+	b.client.releaseReader(b.br)
+	if b.eof && b.keepalive {
+		b.client.releaseConn(b.cc)
 	} else {
-		c.releaseConn(cc)
+		b.client.closeConn(b.cc)
 	}
 
-	return false, err
+	b.cc = nil
+	b.br = nil
+	return nil
 }
 
-func (c *FastHTTPClient) acquireConn(addr string) (*clientConn, error) {
+func hasResponseBody(code int) bool {
+	return code >= fasthttp.StatusOK && code != fasthttp.StatusNoContent && code != fasthttp.StatusNotModified
+}
+
+func (c *FastHTTPClient) getHostClient(addr string, tlsConfig *tls.Config) *hostClient {
+	c.hostsLock.Lock()
+	defer c.hostsLock.Unlock()
+
+	key := hostKey{addr: addr, tlsConfig: tlsConfig}
+	hc, ok := c.hosts[key]
+	if !ok {
+		hc = &hostClient{addr: addr, tlsConfig: tlsConfig}
+		c.hosts[key] = hc
+	}
+
+	return hc
+}
+
+// acquireConn returns a free conn of addr, or create a new one if MaxConnsPerHost is not reached,
+// otherwise wait for a free conn until MaxConnWaitTimeout or the deadline, ErrNoFreeConns is returned if timeout.
+func (c *FastHTTPClient) acquireConn(addr string, tlsConfig *tls.Config, deadline time.Time) (*clientConn, error) {
 	var cc *clientConn
 	createConn := false
 	startCleaner := false
 
-	var n int
-	c.connsLock.Lock()
-	n = len(c.conns)
-	if n == 0 {
-		maxConns := c.conf.MaxConns
-		if maxConns <= 0 {
-			maxConns = fasthttp.DefaultMaxConnsPerHost
+	hc := c.getHostClient(addr, tlsConfig)
+
+	var timer *time.Timer
+	for {
+		var wait chan struct{}
+
+		hc.connsLock.Lock()
+		n := len(hc.conns)
+		if n == 0 {
+			if hc.connsCount < c.MaxConnsPerHost {
+				hc.connsCount++
+				createConn = true
+			} else if c.MaxConnWaitTimeout > 0 {
+				wait = make(chan struct{})
+				hc.connsWait = append(hc.connsWait, wait)
+			}
+			if createConn && hc.connsCount == 1 {
+				startCleaner = true
+			}
+		} else {
+			n--
+			cc = hc.conns[n]
+			hc.conns = hc.conns[:n]
 		}
-		if c.connsCount < maxConns {
-			c.connsCount++
-			createConn = true
+		hc.connsLock.Unlock()
+
+		if cc != nil {
+			return cc, nil
 		}
-		if createConn && c.connsCount == 1 {
-			startCleaner = true
+		if createConn {
+			break
+		}
+		if nil == wait {
+			return nil, fasthttp.ErrNoFreeConns
 		}
-	} else {
-		n--
-		cc = c.conns[n]
-		c.conns = c.conns[:n]
-	}
-	c.connsLock.Unlock()
 
-	if cc != nil {
-		return cc, nil
-	}
-	if !createConn {
-		return nil, fasthttp.ErrNoFreeConns
+		if nil == timer {
+			timeout := c.MaxConnWaitTimeout
+			if !deadline.IsZero() && time.Until(deadline) < timeout {
+				timeout = time.Until(deadline)
+			}
+
+			timer = time.NewTimer(timeout)
+			defer timer.Stop()
+		}
+
+		select {
+		case <-wait:
+		case <-timer.C:
+			if !hc.removeWaiter(wait) {
+				// the notification is not used, pass it to the next waiter
+				hc.connsLock.Lock()
+				hc.notifyWaiter()
+				hc.connsLock.Unlock()
+			}
+			return nil, fasthttp.ErrNoFreeConns
+		}
 	}
 
-	conn, err := dialAddr(addr)
+	conn, err := dialAddr(addr, tlsConfig)
 	if err != nil {
-		c.decConnsCount()
+		c.decConnsCount(hc)
 		return nil, err
 	}
-	cc = acquireClientConn(conn)
+	cc = acquireClientConn(conn, hc)
 
 	if startCleaner {
-		go c.connsCleaner()
+		go c.connsCleaner(hc)
 	}
 	return cc, nil
 }
 
 func (c *FastHTTPClient) releaseConn(cc *clientConn) {
 	cc.lastUseTime = time.Now()
-	c.connsLock.Lock()
-	c.conns = append(c.conns, cc)
-	c.connsLock.Unlock()
+	hc := cc.hc
+	hc.connsLock.Lock()
+	hc.conns = append(hc.conns, cc)
+	hc.notifyWaiter()
+	hc.connsLock.Unlock()
 }
 
-func (c *FastHTTPClient) connsCleaner() {
+func (c *FastHTTPClient) connsCleaner(hc *hostClient) {
 	var (
 		scratch             []*clientConn
 		mustStop            bool
@@ -242,23 +585,23 @@ func (c *FastHTTPClient) connsCleaner() {
 	for {
 		currentTime := time.Now()
 
-		c.connsLock.Lock()
-		conns := c.conns
+		hc.connsLock.Lock()
+		conns := hc.conns
 		n := len(conns)
 		i := 0
 		for i < n && currentTime.Sub(conns[i].lastUseTime) > maxIdleConnDuration {
 			i++
 		}
-		mustStop = (c.connsCount == i)
+		mustStop = (hc.connsCount == i)
 		scratch = append(scratch[:0], conns[:i]...)
 		if i > 0 {
 			m := copy(conns, conns[i:])
 			for i = m; i < n; i++ {
 				conns[i] = nil
 			}
-			c.conns = conns[:m]
+			hc.conns = conns[:m]
 		}
-		c.connsLock.Unlock()
+		hc.connsLock.Unlock()
 
 		for i, cc := range scratch {
 			c.closeConn(cc)
@@ -271,7 +614,9 @@ func (c *FastHTTPClient) connsCleaner() {
 	}
 }
 
-func dialAddr(addr string) (net.Conn, error) {
+// dialAddr dial the addr, the conn is tls if the tlsConfig is not nil,
+// the host of addr is used as the server name if not set
+func dialAddr(addr string, tlsConfig *tls.Config) (net.Conn, error) {
 	conn, err := fasthttp.Dial(addr)
 	if err != nil {
 		return nil, err
@@ -280,11 +625,20 @@ func dialAddr(addr string) (net.Conn, error) {
 		panic("BUG: DialFunc returned (nil, nil)")
 	}
 
-	return conn, nil
+	if nil == tlsConfig {
+		return conn, nil
+	}
+
+	if "" == tlsConfig.ServerName {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+
+	return tls.Client(conn, tlsConfig), nil
 }
 
 func (c *FastHTTPClient) closeConn(cc *clientConn) {
-	c.decConnsCount()
+	c.decConnsCount(cc.hc)
 	cc.c.Close()
 	releaseClientConn(cc)
 }
@@ -317,28 +671,40 @@ func (c *FastHTTPClient) releaseReader(br *bufio.Reader) {
 	c.readerPool.Put(br)
 }
 
-func (c *FastHTTPClient) decConnsCount() {
-	c.connsLock.Lock()
-	c.connsCount--
-	c.connsLock.Unlock()
+func (c *FastHTTPClient) decConnsCount(hc *hostClient) {
+	hc.connsLock.Lock()
+	hc.connsCount--
+	hc.notifyWaiter()
+	hc.connsLock.Unlock()
+}
+
+func isTimeout(err error) bool {
+	if err == fasthttp.ErrTimeout || err == fasthttp.ErrDialTimeout {
+		return true
+	}
+
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
 }
 
 func isIdempotent(req *fasthttp.Request) bool {
-	return req.Header.IsGet() || req.Header.IsHead() || req.Header.IsPut()
+	return req.Header.IsGet() || req.Header.IsHead() || req.Header.IsPut() || req.Header.IsDelete()
 }
 
-func acquireClientConn(conn net.Conn) *clientConn {
+func acquireClientConn(conn net.Conn, hc *hostClient) *clientConn {
 	v := clientConnPool.Get()
 	if v == nil {
 		v = &clientConn{}
 	}
 	cc := v.(*clientConn)
 	cc.c = conn
+	cc.hc = hc
 	cc.createdTime = time.Now()
 	return cc
 }
 
 func releaseClientConn(cc *clientConn) {
 	cc.c = nil
+	cc.hc = nil
 	clientConnPool.Put(cc)
 }
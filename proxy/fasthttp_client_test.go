@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestMaxConnWaitTimeout(t *testing.T) {
+	received := make(chan struct{}, 2)
+	release := make(chan struct{})
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.MaxConnsPerHost = 1
+	cnf.MaxConnWaitTimeout = 100
+	client := NewFastHTTPClient(cnf)
+
+	newReq := func() *fasthttp.Request {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/api")
+		req.Header.SetHost(backend.addr())
+		return req
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := client.Do(newReq(), backend.addr())
+		errs <- err
+	}()
+	<-received
+
+	start := time.Now()
+	_, err := client.Do(newReq(), backend.addr())
+	if err != fasthttp.ErrNoFreeConns {
+		t.Errorf("expect:<%s>, acture:<%v>", fasthttp.ErrNoFreeConns, err)
+	}
+	if cost := time.Now().Sub(start); cost < 100*time.Millisecond {
+		t.Errorf("expect wait:<%s>, acture:<%s>", 100*time.Millisecond, cost)
+	}
+
+	hc := client.getHostClient(backend.addr(), nil)
+	hc.connsLock.Lock()
+	count := hc.connsCount
+	hc.connsLock.Unlock()
+	if count != 1 {
+		t.Errorf("expect:<%d>, acture:<%d>", 1, count)
+	}
+
+	// the waiter use the conn released
+	client.MaxConnWaitTimeout = 5 * time.Second
+	go func() {
+		_, err := client.Do(newReq(), backend.addr())
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; nil != err {
+			t.Errorf("expect:<nil>, acture:<%s>", err)
+		}
+	}
+}
+
+func TestHostClientPerServer(t *testing.T) {
+	backendA := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("A"))
+	})
+	defer backendA.Close()
+
+	backendB := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("B"))
+	})
+	defer backendB.Close()
+
+	client := NewFastHTTPClient(newTestConf())
+
+	// the idle conn to A is not reused by the request of B
+	for _, addr := range []string{backendA.addr(), backendB.addr(), backendA.addr()} {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/api")
+		req.Header.SetHost(addr)
+
+		if _, err := client.Do(req, addr); nil != err {
+			t.Fatalf("do err: %s", err)
+		}
+	}
+
+	if a, b := atomic.LoadInt32(&backendA.requests), atomic.LoadInt32(&backendB.requests); a != 2 || b != 1 {
+		t.Errorf("expect:<2,1>, acture:<%d,%d>", a, b)
+	}
+
+	if client.getHostClient(backendA.addr(), nil) == client.getHostClient(backendA.addr(), &tls.Config{}) {
+		t.Errorf("expect the conns of tls are not shared with http")
+	}
+}
+
+func TestDoStreamMaxBodySize(t *testing.T) {
+	body := strings.Repeat("a", 2048)
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// flush before write body, so response is chunked without Content-Length
+			w.(http.Flusher).Flush()
+		}
+
+		w.Write([]byte(body))
+	})
+	defer backend.Close()
+
+	client := NewFastHTTPClient(newTestConf())
+	streaming := func(*fasthttp.Response) bool { return true }
+	newReq := func(uri string) *fasthttp.Request {
+		req := &fasthttp.Request{}
+		req.SetRequestURI(uri)
+		req.Header.SetHost(backend.addr())
+		return req
+	}
+
+	_, stream, err := client.DoStream(newReq("/length"), backend.addr(), nil, time.Now().Add(time.Second), 1024, streaming)
+	if err != fasthttp.ErrBodyTooLarge || nil != stream {
+		t.Errorf("content-length expect:<%s>, acture:<%v>", fasthttp.ErrBodyTooLarge, err)
+	}
+
+	_, stream, err = client.DoStream(newReq("/chunked"), backend.addr(), nil, time.Now().Add(time.Second), 1024, streaming)
+	if nil != err {
+		t.Fatalf("chunked expect:<nil>, acture:<%s>", err)
+	}
+	data, err := ioutil.ReadAll(stream)
+	stream.Close()
+	if err != fasthttp.ErrBodyTooLarge || len(data) != 1024 {
+		t.Errorf("chunked expect:<%s, %d>, acture:<%v, %d>", fasthttp.ErrBodyTooLarge, 1024, err, len(data))
+	}
+
+	_, stream, err = client.DoStream(newReq("/chunked"), backend.addr(), nil, time.Now().Add(time.Second), len(body), streaming)
+	if nil != err {
+		t.Fatalf("chunked expect:<nil>, acture:<%s>", err)
+	}
+	data, err = ioutil.ReadAll(stream)
+	stream.Close()
+	if nil != err || string(data) != body {
+		t.Errorf("chunked expect:<%d>, acture:<%d>, err:<%v>", len(body), len(data), err)
+	}
+}
@@ -1,55 +1,248 @@
 package proxy
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/fagongzi/gateway/pkg/model"
 	"github.com/valyala/fasthttp"
 )
 
-type filterContext struct {
-	rw         http.ResponseWriter
-	ctx        *fasthttp.RequestCtx
-	outreq     *fasthttp.Request
-	result     *model.RouteResult
-	rb         *model.RouteTable
-	startAt    int64
-	endAt      int64
-	runtimeVar map[string]string
+// errResponded returned by the pre filter which has set the response to c.result.Res,
+// the request is not forward to the backend server.
+var errResponded = errors.New("responded by filter")
+
+// FilterContext the context of a request or a sub-request of merge passed through the filters
+type FilterContext struct {
+	rw          http.ResponseWriter
+	ctx         *fasthttp.RequestCtx
+	outreq      *fasthttp.Request
+	result      *model.RouteResult
+	rb          *model.RouteTable
+	startAt     int64
+	endAt       int64
+	retries     int
+	maxBodySize int
+	runtimeVar  map[string]string
+	doneFuncs   []func()
+	// timings the durations of the filters in the execution order, recorded if AccessLogFilterTimings
+	timings        []filterTiming
+	bodyBufferSize int
+	bodyBufferDir  string
+	// webSocket the request is the websocket handshake, it is set before the filters because the merge
+	// sub-requests can not read the headers of the shared client request concurrently
+	webSocket bool
+	// req the request of client read by the filters, the sub-request of merge has its own copy
+	// because the header of the shared client request can not be read concurrently, nil is ctx.Request
+	req *fasthttp.Request
+}
+
+// filterTiming the cumulative duration of the Pre, Post and PostErr of a filter
+type filterTiming struct {
+	name     string
+	duration time.Duration
+}
+
+// addTiming add the duration to the timing of the filter
+func (c *FilterContext) addTiming(name string, d time.Duration) {
+	for i := range c.timings {
+		if c.timings[i].name == name {
+			c.timings[i].duration += d
+			return
+		}
+	}
+
+	c.timings = append(c.timings, filterTiming{name: name, duration: d})
+}
+
+// OnDone register a func called when the proxy of request is done, whether success or not
+func (c *FilterContext) OnDone(fn func()) {
+	c.doneFuncs = append(c.doneFuncs, fn)
+}
+
+func (c *FilterContext) done() {
+	for _, fn := range c.doneFuncs {
+		fn()
+	}
+}
+
+// Ctx returns the request ctx of client
+func (c *FilterContext) Ctx() *fasthttp.RequestCtx {
+	return c.ctx
+}
+
+// Request returns the request of client, the filters read the headers and the query args of client by it
+// instead of Ctx().Request, it is safe in the concurrent sub-requests of merge
+func (c *FilterContext) Request() *fasthttp.Request {
+	if nil == c.req {
+		return &c.ctx.Request
+	}
+
+	return c.req
 }
 
-// Filter filter interface
+// Retries returns the count of the retries to the other servers, 0 if the request is not retried
+func (c *FilterContext) Retries() int {
+	return c.retries
+}
+
+// OutRequest returns the request forward to the backend server, the filters can change it in Pre
+func (c *FilterContext) OutRequest() *fasthttp.Request {
+	return c.outreq
+}
+
+// Result returns the route result, the Res is the response of the backend server in Post
+func (c *FilterContext) Result() *model.RouteResult {
+	return c.result
+}
+
+// RuntimeVar returns the runtime var, e.g. client.ip, jwt.<claim>
+func (c *FilterContext) RuntimeVar(name string) string {
+	return c.runtimeVar[name]
+}
+
+// SetRuntimeVar set the runtime var used by the following filters
+func (c *FilterContext) SetRuntimeVar(name, value string) {
+	c.runtimeVar[name] = value
+}
+
+// Respond set the response of the request in Pre, the returned values are returned by Pre,
+// the request is not forward to the backend server and the post filters are skipped
+func (c *FilterContext) Respond(res *fasthttp.Response) (statusCode int, err error) {
+	c.result.Res = res
+	return res.StatusCode(), errResponded
+}
+
+// Filter the filter of the requests, registered by the name to the proxy.
+// The custom filters are registered by RegisterFilterFactory.
 type Filter interface {
+	// Name returns the name of filter, it is unique
 	Name() string
 
-	Pre(c *filterContext) (statusCode int, err error)
-	Post(c *filterContext) (statusCode int, err error)
-	PostErr(c *filterContext)
+	// Pre execute before the request forward to the backend server in the registry order,
+	// the request is failed with the statusCode if returns an error
+	Pre(c *FilterContext) (statusCode int, err error)
+	// Post execute after the backend server responded in the reversed registry order,
+	// the request is failed with the statusCode if returns an error
+	Post(c *FilterContext) (statusCode int, err error)
+	// PostErr execute if the backend server fail in the reversed registry order
+	PostErr(c *FilterContext)
 }
 
-type baseFilter struct{}
+// requestFilter the filter check the request before the route selection
+type requestFilter interface {
+	Request(ctx *fasthttp.RequestCtx) (statusCode int, err error)
+}
+
+// responseFilter the filter respond the request with a complete response before the server selection,
+// e.g. the mock and the cache hit. Only the leading response filters of the filter plan are asked,
+// the request is passed to the next filter if the response is nil, the post filters are skipped if responded.
+type responseFilter interface {
+	Respond(c *FilterContext) (res *fasthttp.Response, statusCode int, err error)
+}
+
+// BaseFilter the filter does nothing, embedded by the filters implement a part of Filter
+type BaseFilter struct{}
 
 // Pre execute before proxy
-func (f baseFilter) Pre(c *filterContext) (statusCode int, err error) {
+func (f BaseFilter) Pre(c *FilterContext) (statusCode int, err error) {
 	return http.StatusOK, nil
 }
 
 // Post execute after proxy
-func (f baseFilter) Post(c *filterContext) (statusCode int, err error) {
+func (f BaseFilter) Post(c *FilterContext) (statusCode int, err error) {
 	return http.StatusOK, nil
 }
 
 // PostErr execute proxy has errors
-func (f baseFilter) PostErr(c *filterContext) {
+func (f BaseFilter) PostErr(c *FilterContext) {
 
 }
 
-func (f *Proxy) doPreFilters(c *filterContext) (filterName string, statusCode int, err error) {
+func (f *Proxy) doRequestFilters(ctx *fasthttp.RequestCtx) (filterName string, statusCode int, err error) {
 	for iter := f.filters.Front(); iter != nil; iter = iter.Next() {
-		f, _ := iter.Value.(Filter)
-		filterName = f.Name()
+		f, ok := iter.Value.(requestFilter)
+		if !ok {
+			continue
+		}
+
+		statusCode, err = f.Request(ctx)
+		if nil != err {
+			return iter.Value.(Filter).Name(), statusCode, err
+		}
+	}
+
+	return "", http.StatusOK, nil
+}
+
+// filterPlan returns the filters executed for the node in the order, the registered filters if the node has no plan.
+// The filters not registered are ignored.
+func (f *Proxy) filterPlan(node *model.Node) []Filter {
+	if nil == node || !node.HasFilterPlan() {
+		return f.chain
+	}
+
+	var plan []Filter
+	if len(node.Filters) == 0 {
+		for _, filter := range f.chain {
+			if node.FilterEnabled(filter.Name()) {
+				plan = append(plan, filter)
+			}
+		}
+
+		return plan
+	}
+
+	for _, name := range node.Filters {
+		for _, filter := range f.chain {
+			if strings.EqualFold(filter.Name(), name) && node.FilterEnabled(name) {
+				plan = append(plan, filter)
+				break
+			}
+		}
+	}
+
+	return plan
+}
+
+func (f *Proxy) doRespondFilters(c *FilterContext) (filterName string, statusCode int, err error) {
+	for _, filter := range f.filterPlan(c.result.Node) {
+		r, ok := filter.(responseFilter)
+		if !ok {
+			break
+		}
+
+		res, statusCode, err := r.Respond(c)
+		if nil != err {
+			return filter.Name(), statusCode, err
+		}
+
+		if nil != res {
+			c.result.Res = res
+			return filter.Name(), res.StatusCode(), errResponded
+		}
+	}
+
+	return "", http.StatusOK, nil
+}
+
+func (f *Proxy) doPreFilters(c *FilterContext) (filterName string, statusCode int, err error) {
+	timing := f.config.AccessLogFilterTimings
+	for _, filter := range f.filterPlan(c.result.Node) {
+		filterName = filter.Name()
+
+		var start time.Time
+		if timing {
+			start = time.Now()
+		}
+
+		statusCode, err = filter.Pre(c)
+		if timing {
+			c.addTiming(filterName, time.Since(start))
+		}
 
-		statusCode, err = f.Pre(c)
 		if nil != err {
 			return filterName, statusCode, err
 		}
@@ -58,11 +251,22 @@ func (f *Proxy) doPreFilters(c *filterContext) (filterName string, statusCode in
 	return "", http.StatusOK, nil
 }
 
-func (f *Proxy) doPostFilters(c *filterContext) (filterName string, statusCode int, err error) {
-	for iter := f.filters.Back(); iter != nil; iter = iter.Prev() {
-		f, _ := iter.Value.(Filter)
+func (f *Proxy) doPostFilters(c *FilterContext) (filterName string, statusCode int, err error) {
+	timing := f.config.AccessLogFilterTimings
+	plan := f.filterPlan(c.result.Node)
+	for i := len(plan) - 1; i >= 0; i-- {
+		filterName = plan[i].Name()
+
+		var start time.Time
+		if timing {
+			start = time.Now()
+		}
+
+		statusCode, err = plan[i].Post(c)
+		if timing {
+			c.addTiming(filterName, time.Since(start))
+		}
 
-		statusCode, err = f.Post(c)
 		if nil != err {
 			return filterName, statusCode, err
 		}
@@ -71,10 +275,18 @@ func (f *Proxy) doPostFilters(c *filterContext) (filterName string, statusCode i
 	return "", http.StatusOK, nil
 }
 
-func (f *Proxy) doPostErrFilters(c *filterContext) {
-	for iter := f.filters.Back(); iter != nil; iter = iter.Prev() {
-		f, _ := iter.Value.(Filter)
+func (f *Proxy) doPostErrFilters(c *FilterContext) {
+	timing := f.config.AccessLogFilterTimings
+	plan := f.filterPlan(c.result.Node)
+	for i := len(plan) - 1; i >= 0; i-- {
+		var start time.Time
+		if timing {
+			start = time.Now()
+		}
 
-		f.PostErr(c)
+		plan[i].PostErr(c)
+		if timing {
+			c.addTiming(plan[i].Name(), time.Since(start))
+		}
 	}
 }
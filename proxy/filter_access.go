@@ -10,7 +10,7 @@ import (
 // AccessFilter record the http access log
 // log format: $remoteip "$method $path" $code "$agent" $svr $cost
 type AccessFilter struct {
-	baseFilter
+	BaseFilter
 	config *conf.Conf
 	proxy  *Proxy
 }
@@ -28,11 +28,11 @@ func (f AccessFilter) Name() string {
 }
 
 // Post execute after proxy
-func (f AccessFilter) Post(c *filterContext) (statusCode int, err error) {
+func (f AccessFilter) Post(c *FilterContext) (statusCode int, err error) {
 	cost := (c.endAt - c.startAt)
 
 	log.Infof("%s %s \"%s\" %d \"%s\" %s %s",
-		c.ctx.RemoteIP().String(),
+		c.runtimeVar[clientIPRuntimeVar],
 		c.ctx.Method(),
 		c.outreq.RequestURI(),
 		c.result.Res.StatusCode(),
@@ -40,5 +40,5 @@ func (f AccessFilter) Post(c *filterContext) (statusCode int, err error) {
 		c.result.Svr.Addr,
 		time.Duration(cost))
 
-	return f.baseFilter.Post(c)
+	return f.BaseFilter.Post(c)
 }
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+)
+
+const (
+	// AccessLogFormatText text access log format
+	AccessLogFormatText = "text"
+	// AccessLogFormatJSON json line access log format
+	AccessLogFormatJSON = "json"
+)
+
+// AccessLogFilter record the sampled access log, the response body is logged on error if configured.
+// text format: $method $path $svr $status $latency $bytes [client=$ip] [group=$group] [retries=$retries] [filters=$name:$duration,...] [$body]
+type AccessLogFilter struct {
+	BaseFilter
+	config   *conf.Conf
+	proxy    *Proxy
+	logger   *log.Logger
+	requests *uint64
+}
+
+type accessLog struct {
+	Method   string  `json:"method"`
+	Path     string  `json:"path"`
+	Server   string  `json:"server"`
+	Status   int     `json:"status"`
+	Latency  float64 `json:"latency"`
+	Bytes    int     `json:"bytes"`
+	Group    string  `json:"group,omitempty"`
+	ClientIP string  `json:"clientIP,omitempty"`
+	Retries  int     `json:"retries,omitempty"`
+	Body     string  `json:"body,omitempty"`
+	// Filters the durations of the filters in milliseconds, the filters after the access-log filter in the post order are not included
+	Filters map[string]float64 `json:"filters,omitempty"`
+}
+
+func newAccessLogFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return AccessLogFilter{
+		config:   config,
+		proxy:    proxy,
+		logger:   log.StdLog,
+		requests: new(uint64),
+	}
+}
+
+// Name return name of this filter
+func (f AccessLogFilter) Name() string {
+	return FilterAccessLog
+}
+
+// Post execute after proxy
+func (f AccessLogFilter) Post(c *FilterContext) (statusCode int, err error) {
+	f.log(c, false)
+	return f.BaseFilter.Post(c)
+}
+
+// PostErr execute proxy has errors
+func (f AccessLogFilter) PostErr(c *FilterContext) {
+	f.log(c, true)
+}
+
+func (f AccessLogFilter) log(c *FilterContext, failure bool) {
+	if !f.sampled() {
+		return
+	}
+
+	// the retried request fail before the end
+	endAt := c.endAt
+	if 0 == endAt {
+		endAt = time.Now().UnixNano()
+	}
+
+	l := &accessLog{
+		Method:   string(c.outreq.Header.Method()),
+		Path:     string(c.outreq.URI().Path()),
+		Server:   c.result.Svr.Addr,
+		Latency:  float64(endAt-c.startAt) / float64(time.Millisecond),
+		Group:    c.runtimeVar[canaryRuntimeVar],
+		ClientIP: c.runtimeVar[clientIPRuntimeVar],
+		Retries:  c.Retries(),
+	}
+
+	if len(c.timings) > 0 {
+		l.Filters = make(map[string]float64, len(c.timings))
+		for _, timing := range c.timings {
+			l.Filters[timing.name] = float64(timing.duration) / float64(time.Millisecond)
+		}
+	}
+
+	if res := c.result.Res; nil != res {
+		l.Status = res.StatusCode()
+		l.Bytes = len(res.Body())
+
+		if failure && f.config.AccessLogBodyOnError {
+			l.Body = string(res.Body())
+		}
+	}
+
+	if AccessLogFormatJSON == f.config.AccessLogFormat {
+		data, _ := json.Marshal(l)
+		f.logger.Info(string(data))
+		return
+	}
+
+	line := fmt.Sprintf("%s %s %s %d %.3fms %d", l.Method, l.Path, l.Server, l.Status, l.Latency, l.Bytes)
+	if "" != l.ClientIP {
+		line = fmt.Sprintf("%s client=%s", line, l.ClientIP)
+	}
+	if "" != l.Group {
+		line = fmt.Sprintf("%s group=%s", line, l.Group)
+	}
+	if l.Retries > 0 {
+		line = fmt.Sprintf("%s retries=%d", line, l.Retries)
+	}
+	if len(c.timings) > 0 {
+		timings := make([]string, 0, len(c.timings))
+		for _, timing := range c.timings {
+			timings = append(timings, fmt.Sprintf("%s:%.3fms", timing.name, l.Filters[timing.name]))
+		}
+		line = fmt.Sprintf("%s filters=%s", line, strings.Join(timings, ","))
+	}
+	if "" != l.Body {
+		line = fmt.Sprintf("%s \"%s\"", line, l.Body)
+	}
+
+	f.logger.Info(line)
+}
+
+// sampled returns true if the request need to log, the count of logged requests
+// grows exactly at the sample rate.
+func (f AccessLogFilter) sampled() bool {
+	rate := f.config.AccessLogSampleRate
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+
+	n := atomic.AddUint64(f.requests, 1)
+	return uint64(float64(n)*rate) > uint64(float64(n-1)*rate)
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestAccessLogFilter(t *testing.T, rate float64, format string) (AccessLogFilter, *bytes.Buffer) {
+	cnf := newTestConf()
+	cnf.AccessLogSampleRate = rate
+	cnf.AccessLogFormat = format
+	cnf.AccessLogBodyOnError = true
+
+	buf := &bytes.Buffer{}
+	f := newAccessLogFilter(cnf, nil).(AccessLogFilter)
+	f.logger = log.New(buf, "")
+
+	return f, buf
+}
+
+func newTestAccessLogContext(code int, body string) *FilterContext {
+	outreq := &fasthttp.Request{}
+	outreq.SetRequestURI("/api")
+
+	res := &fasthttp.Response{}
+	res.SetStatusCode(code)
+	res.SetBodyString(body)
+
+	return &FilterContext{
+		outreq: outreq,
+		result: &model.RouteResult{
+			Svr: &model.Server{Addr: "127.0.0.1:8080"},
+			Res: res,
+		},
+		startAt: 1000000,
+		endAt:   3000000,
+	}
+}
+
+func accessLogLines(buf *bytes.Buffer) []string {
+	value := strings.TrimSpace(buf.String())
+	if "" == value {
+		return nil
+	}
+
+	return strings.Split(value, "\n")
+}
+
+func TestAccessLogFilterWithSample(t *testing.T) {
+	f, buf := newTestAccessLogFilter(t, 0.5, AccessLogFormatText)
+
+	for i := 0; i < 4; i++ {
+		f.Post(newTestAccessLogContext(200, "OK"))
+	}
+
+	lines := accessLogLines(buf)
+	if len(lines) != 2 {
+		t.Fatalf("expect:<2>, acture:<%d>", len(lines))
+	}
+
+	if !strings.HasSuffix(lines[0], "GET /api 127.0.0.1:8080 200 2.000ms 2") {
+		t.Errorf("expect:<GET /api 127.0.0.1:8080 200 2.000ms 2>, acture:<%s>", lines[0])
+	}
+
+	c := newTestAccessLogContext(200, "OK")
+	c.retries = 2
+	f, buf = newTestAccessLogFilter(t, 0, AccessLogFormatText)
+	f.Post(c)
+	if lines := accessLogLines(buf); len(lines) != 1 || !strings.HasSuffix(lines[0], "200 2.000ms 2 retries=2") {
+		t.Errorf("expect:<200 2.000ms 2 retries=2>, acture:<%v>", lines)
+	}
+
+	f, buf = newTestAccessLogFilter(t, 0.01, AccessLogFormatText)
+	f.Post(newTestAccessLogContext(200, "OK"))
+	if lines := accessLogLines(buf); len(lines) != 0 {
+		t.Errorf("expect sampled out, acture:<%v>", lines)
+	}
+}
+
+func TestAccessLogFilterWithJSON(t *testing.T) {
+	f, buf := newTestAccessLogFilter(t, 0, AccessLogFormatJSON)
+
+	f.Post(newTestAccessLogContext(200, "OK"))
+	c := newTestAccessLogContext(500, "failure")
+	c.retries = 1
+	f.PostErr(c)
+
+	lines := accessLogLines(buf)
+	if len(lines) != 2 {
+		t.Fatalf("expect:<2>, acture:<%d>", len(lines))
+	}
+
+	for i, expect := range []string{"", "failure"} {
+		l := &accessLog{}
+		if err := json.Unmarshal([]byte(lines[i][strings.Index(lines[i], "{"):]), l); nil != err {
+			t.Fatalf("unmarshal <%s> err: %s", lines[i], err)
+		}
+
+		if l.Body != expect {
+			t.Errorf("expect body:<%s>, acture:<%s>", expect, l.Body)
+		}
+
+		if l.Retries != i {
+			t.Errorf("expect retries:<%d>, acture:<%d>", i, l.Retries)
+		}
+	}
+}
+
+type testSlowFilter struct {
+	BaseFilter
+}
+
+func (f testSlowFilter) Name() string {
+	return "SLOW"
+}
+
+func (f testSlowFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	time.Sleep(time.Millisecond * 50)
+	return f.BaseFilter.Pre(c)
+}
+
+func TestAccessLogFilterTimings(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.AccessLogFormat = AccessLogFormatJSON
+	cnf.AccessLogFilterTimings = true
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterHeader)
+
+	buf := &bytes.Buffer{}
+	f := newAccessLogFilter(cnf, p).(AccessLogFilter)
+	f.logger = log.New(buf, "")
+	p.filters.PushBack(testSlowFilter{})
+	p.filters.PushBack(f)
+	p.updateChain()
+
+	ctx := doTestRequest(p, "GET", "/api")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	lines := accessLogLines(buf)
+	if len(lines) != 1 {
+		t.Fatalf("expect:<1>, acture:<%d>", len(lines))
+	}
+
+	l := &accessLog{}
+	if err := json.Unmarshal([]byte(lines[0][strings.Index(lines[0], "{"):]), l); nil != err {
+		t.Fatalf("unmarshal <%s> err: %s", lines[0], err)
+	}
+
+	if slow := l.Filters["SLOW"]; slow < 50 {
+		t.Errorf("expect:<>=50ms>, acture:<%.3fms>", slow)
+	}
+
+	if head, ok := l.Filters[FilterHeader]; !ok || head >= 50 {
+		t.Errorf("expect:<<50ms>, acture:<%v>", l.Filters)
+	}
+
+	// the filters are not timed if not set
+	cnf.AccessLogFilterTimings = false
+	buf.Reset()
+	doTestRequest(p, "GET", "/api")
+	if lines := accessLogLines(buf); len(lines) != 1 || strings.Contains(lines[0], "filters") {
+		t.Errorf("expect no timings, acture:<%v>", lines)
+	}
+}
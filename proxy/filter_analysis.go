@@ -6,7 +6,7 @@ import (
 
 // AnalysisFilter analysis filter
 type AnalysisFilter struct {
-	baseFilter
+	BaseFilter
 	proxy  *Proxy
 	config *conf.Conf
 }
@@ -24,18 +24,18 @@ func (f AnalysisFilter) Name() string {
 }
 
 // Pre execute before proxy
-func (f AnalysisFilter) Pre(c *filterContext) (statusCode int, err error) {
+func (f AnalysisFilter) Pre(c *FilterContext) (statusCode int, err error) {
 	c.rb.GetAnalysis().Request(c.result.Svr.Addr)
-	return f.baseFilter.Pre(c)
+	return f.BaseFilter.Pre(c)
 }
 
 // Post execute after proxy
-func (f AnalysisFilter) Post(c *filterContext) (statusCode int, err error) {
+func (f AnalysisFilter) Post(c *FilterContext) (statusCode int, err error) {
 	c.rb.GetAnalysis().Response(c.result.Svr.Addr, c.endAt-c.startAt)
-	return f.baseFilter.Post(c)
+	return f.BaseFilter.Post(c)
 }
 
 // PostErr execute proxy has errors
-func (f AnalysisFilter) PostErr(c *filterContext) {
+func (f AnalysisFilter) PostErr(c *FilterContext) {
 	c.rb.GetAnalysis().Failure(c.result.Svr.Addr)
 }
@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultAPIKeyHeader   = "X-Api-Key"
+	defaultAPIKeyCacheTTL = 60
+	apiKeyValidateTimeout = time.Second * 5
+	apiKeyRuntimeVar      = "apikey.account"
+)
+
+var (
+	// ErrAPIKeyMissing the request has no api key
+	ErrAPIKeyMissing = errors.New("missing api key")
+	// ErrAPIKeyInvalid the api key is unknown
+	ErrAPIKeyInvalid = errors.New("invalid api key")
+	// ErrAPIKeyValidateLimited the external validation calls exceeds the rate limit
+	ErrAPIKeyValidateLimited = errors.New("api key validation limit")
+)
+
+// APIKeyFilter authenticate the request by api key, the key is validated by the static keys first,
+// then the external validation endpoint. The account id of the key is set to the runtime vars.
+type APIKeyFilter struct {
+	BaseFilter
+	config  *conf.Conf
+	proxy   *Proxy
+	header  string
+	ttl     time.Duration
+	cache   *apiKeyCache
+	limiter *tokenBuckets
+}
+
+func newAPIKeyFilter(config *conf.Conf, proxy *Proxy) Filter {
+	f := APIKeyFilter{
+		config:  config,
+		proxy:   proxy,
+		header:  config.APIKeyHeader,
+		ttl:     time.Duration(config.APIKeyCacheTTL) * time.Second,
+		cache:   newAPIKeyCache(),
+		limiter: newTokenBuckets(),
+	}
+
+	if "" == f.header {
+		f.header = defaultAPIKeyHeader
+	}
+
+	if f.ttl <= 0 {
+		f.ttl = defaultAPIKeyCacheTTL * time.Second
+	}
+
+	go f.cache.startGC(f.ttl)
+
+	return f
+}
+
+// Name return name of this filter
+func (f APIKeyFilter) Name() string {
+	return FilterAPIKey
+}
+
+// Pre execute before proxy
+func (f APIKeyFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	key := f.getKey(c)
+	if "" == key {
+		return http.StatusUnauthorized, ErrAPIKeyMissing
+	}
+
+	accountID, ok := f.config.APIKeys[key]
+	if !ok && "" != f.config.APIKeyValidateURL {
+		accountID, ok, err = f.validate(key)
+		if nil != err {
+			log.WarnErrorf(err, "APIKey validate fail")
+			return http.StatusServiceUnavailable, err
+		}
+	}
+
+	if !ok {
+		return http.StatusUnauthorized, ErrAPIKeyInvalid
+	}
+
+	c.runtimeVar[apiKeyRuntimeVar] = accountID
+	return f.BaseFilter.Pre(c)
+}
+
+func (f APIKeyFilter) getKey(c *FilterContext) string {
+	req := c.Request()
+	if key := req.Header.Peek(f.header); len(key) > 0 {
+		return string(key)
+	}
+
+	if "" != f.config.APIKeyQuery {
+		return string(req.URI().QueryArgs().Peek(f.config.APIKeyQuery))
+	}
+
+	return ""
+}
+
+// validate validate the key by the external validation endpoint, the result is cached
+func (f APIKeyFilter) validate(key string) (string, bool, error) {
+	now := time.Now()
+	if value, ok := f.cache.get(key, now); ok {
+		return value.accountID, value.valid, nil
+	}
+
+	rate := f.config.APIKeyValidateRate
+	if rate > 0 {
+		if ok, _ := f.limiter.take(bucketKey{}, rate, rate, now); !ok {
+			return "", false, ErrAPIKeyValidateLimited
+		}
+	}
+
+	code, body, err := fasthttp.GetTimeout(nil, f.config.APIKeyValidateURL+"?key="+url.QueryEscape(key), apiKeyValidateTimeout)
+	if nil != err {
+		return "", false, err
+	}
+
+	value := apiKeyValue{
+		valid:    code == fasthttp.StatusOK,
+		expireAt: now.Add(f.ttl),
+	}
+
+	if value.valid {
+		account := struct {
+			AccountID string `json:"accountId"`
+		}{}
+
+		if err = json.Unmarshal(body, &account); nil != err {
+			return "", false, err
+		}
+
+		value.accountID = account.AccountID
+	}
+
+	f.cache.put(key, value)
+	return value.accountID, value.valid, nil
+}
+
+type apiKeyValue struct {
+	accountID string
+	valid     bool
+	expireAt  time.Time
+}
+
+// apiKeyCache the cache of external validation results
+type apiKeyCache struct {
+	sync.RWMutex
+	values map[string]apiKeyValue
+}
+
+func newAPIKeyCache() *apiKeyCache {
+	return &apiKeyCache{
+		values: make(map[string]apiKeyValue),
+	}
+}
+
+func (c *apiKeyCache) get(key string, now time.Time) (apiKeyValue, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	value, ok := c.values[key]
+	if !ok || now.After(value.expireAt) {
+		return value, false
+	}
+
+	return value, true
+}
+
+func (c *apiKeyCache) put(key string, value apiKeyValue) {
+	c.Lock()
+	c.values[key] = value
+	c.Unlock()
+}
+
+func (c *apiKeyCache) startGC(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		c.gc(now)
+	}
+}
+
+// gc remove the expired results
+func (c *apiKeyCache) gc(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	for key, value := range c.values {
+		if now.After(value.expireAt) {
+			delete(c.values, key)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func doTestAPIKeyFilter(f Filter, uri string, key string) (*FilterContext, int, error) {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI(uri)
+	if "" != key {
+		ctx.Request.Header.Set(defaultAPIKeyHeader, key)
+	}
+
+	c := &FilterContext{
+		ctx:        ctx,
+		result:     &model.RouteResult{},
+		runtimeVar: make(map[string]string),
+	}
+
+	code, err := f.Pre(c)
+	return c, code, err
+}
+
+func TestAPIKeyFilterWithStaticKeys(t *testing.T) {
+	cnf := newTestConf()
+	cnf.APIKeyQuery = "api_key"
+	cnf.APIKeys = map[string]string{"key1": "account1"}
+	f := newAPIKeyFilter(cnf, nil)
+
+	c, _, err := doTestAPIKeyFilter(f, "/api", "key1")
+	if nil != err || c.runtimeVar[apiKeyRuntimeVar] != "account1" {
+		t.Errorf("header expect:<account1>, acture:<%s>, err:<%v>", c.runtimeVar[apiKeyRuntimeVar], err)
+	}
+
+	c, _, err = doTestAPIKeyFilter(f, "/api?api_key=key1", "")
+	if nil != err || c.runtimeVar[apiKeyRuntimeVar] != "account1" {
+		t.Errorf("query expect:<account1>, acture:<%s>, err:<%v>", c.runtimeVar[apiKeyRuntimeVar], err)
+	}
+
+	if _, code, _ := doTestAPIKeyFilter(f, "/api", "unknown"); code != http.StatusUnauthorized {
+		t.Errorf("unknown expect:<%d>, acture:<%d>", http.StatusUnauthorized, code)
+	}
+
+	if _, code, _ := doTestAPIKeyFilter(f, "/api", ""); code != http.StatusUnauthorized {
+		t.Errorf("missing expect:<%d>, acture:<%d>", http.StatusUnauthorized, code)
+	}
+}
+
+func TestAPIKeyFilterWithValidator(t *testing.T) {
+	validator := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "key1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte(`{"accountId": "account1"}`))
+	})
+	defer validator.Close()
+
+	cnf := newTestConf()
+	cnf.APIKeyValidateURL = validator.URL + "/validate"
+	f := newAPIKeyFilter(cnf, nil)
+
+	for i := 0; i < 2; i++ {
+		c, _, err := doTestAPIKeyFilter(f, "/api", "key1")
+		if nil != err || c.runtimeVar[apiKeyRuntimeVar] != "account1" {
+			t.Errorf("expect:<account1>, acture:<%s>, err:<%v>", c.runtimeVar[apiKeyRuntimeVar], err)
+		}
+
+		if _, code, _ := doTestAPIKeyFilter(f, "/api", "unknown"); code != http.StatusUnauthorized {
+			t.Errorf("unknown expect:<%d>, acture:<%d>", http.StatusUnauthorized, code)
+		}
+	}
+
+	// the second round hit the cache
+	if requests := atomic.LoadInt32(&validator.requests); requests != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", requests)
+	}
+}
+
+func TestAPIKeyFilterWithValidateRate(t *testing.T) {
+	validator := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"accountId": "account"}`))
+	})
+	defer validator.Close()
+
+	cnf := newTestConf()
+	cnf.APIKeyValidateURL = validator.URL + "/validate"
+	cnf.APIKeyValidateRate = 1
+	f := newAPIKeyFilter(cnf, nil)
+
+	if _, _, err := doTestAPIKeyFilter(f, "/api", "key1"); nil != err {
+		t.Errorf("expect:<nil>, acture:<%v>", err)
+	}
+
+	if _, code, err := doTestAPIKeyFilter(f, "/api", "key2"); err != ErrAPIKeyValidateLimited {
+		t.Errorf("expect:<%v>, acture:<%d,%v>", ErrAPIKeyValidateLimited, code, err)
+	}
+
+	// the cached key is not limited
+	if _, _, err := doTestAPIKeyFilter(f, "/api", "key1"); nil != err {
+		t.Errorf("cached expect:<nil>, acture:<%v>", err)
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/fagongzi/gateway/conf"
+)
+
+var (
+	defaultAuthzScopeVars = []string{"oauth.scope", "jwt.scope", "jwt.scp", "jwt.roles"}
+)
+
+var (
+	// ErrAuthzForbidden the scopes of request are insufficient for the node
+	ErrAuthzForbidden = errors.New("insufficient scopes")
+)
+
+// AuthzFilter check the scopes and roles in the runtime vars set by the authentication filters against
+// the required scopes of node, it must be registered after the authentication filters.
+type AuthzFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+	vars   []string
+}
+
+func newAuthzFilter(config *conf.Conf, proxy *Proxy) Filter {
+	f := AuthzFilter{
+		config: config,
+		proxy:  proxy,
+		vars:   config.AuthzScopeVars,
+	}
+
+	if len(f.vars) == 0 {
+		f.vars = defaultAuthzScopeVars
+	}
+
+	return f
+}
+
+// Name return name of this filter
+func (f AuthzFilter) Name() string {
+	return FilterAuthz
+}
+
+// Pre execute before proxy
+func (f AuthzFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if nil == c.result.Node || "" == c.result.Node.RequiredScopes {
+		return f.BaseFilter.Pre(c)
+	}
+
+	scopes := make(map[string]bool)
+	for _, name := range f.vars {
+		for _, scope := range splitScopes(c.runtimeVar[name]) {
+			scopes[scope] = true
+		}
+	}
+
+	if !c.result.Node.AllowScopes(scopes) {
+		return http.StatusForbidden, ErrAuthzForbidden
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// splitScopes returns the scopes of the value separated by spaces or commas, or the json array
+func splitScopes(value string) []string {
+	if strings.HasPrefix(value, "[") {
+		var scopes []string
+		if err := json.Unmarshal([]byte(value), &scopes); nil == err {
+			return scopes
+		}
+	}
+
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return ' ' == r || ',' == r
+	})
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAuthzFilter(t *testing.T) {
+	node := &model.Node{ClusterName: testClusterName, RequiredScopes: "orders:read AND (orders:write OR admin)"}
+	if err := model.NewRouteTable(memStore{}).AddNewAggregation(model.NewAggregation("^/orders$", []*model.Node{node})); nil != err {
+		t.Fatalf("add aggregation err: %s", err)
+	}
+
+	f := newAuthzFilter(newTestConf(), nil)
+
+	cases := []struct {
+		vars map[string]string
+		code int
+	}{
+		{vars: map[string]string{"oauth.scope": "orders:read orders:write"}, code: http.StatusOK},
+		{vars: map[string]string{"jwt.scope": "orders:read", "jwt.roles": `["admin"]`}, code: http.StatusOK},
+		{vars: map[string]string{"jwt.scp": "orders:read,admin"}, code: http.StatusOK},
+		// insufficient scopes
+		{vars: map[string]string{"oauth.scope": "orders:read"}, code: http.StatusForbidden},
+		{vars: map[string]string{"oauth.scope": "orders:write admin"}, code: http.StatusForbidden},
+		// not authenticated
+		{vars: map[string]string{}, code: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.SetRequestURI("/orders")
+		fc := &FilterContext{
+			ctx:        ctx,
+			result:     &model.RouteResult{Node: node},
+			runtimeVar: c.vars,
+		}
+
+		code, err := f.Pre(fc)
+		if http.StatusForbidden == c.code && (code != c.code || ErrAuthzForbidden != err) {
+			t.Errorf("%v expect:<%d>, acture:<%d>, err:<%v>", c.vars, c.code, code, err)
+		}
+
+		if http.StatusOK == c.code && nil != err {
+			t.Errorf("%v expect pass, acture:<%d>, err:<%v>", c.vars, code, err)
+		}
+	}
+
+	// the node without required scopes
+	fc := &FilterContext{
+		ctx:        &fasthttp.RequestCtx{},
+		result:     &model.RouteResult{Node: &model.Node{}},
+		runtimeVar: make(map[string]string),
+	}
+	if _, err := f.Pre(fc); nil != err {
+		t.Errorf("expect pass, acture:<%v>", err)
+	}
+}
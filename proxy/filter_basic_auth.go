@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	headerWWWAuthenticate   = "WWW-Authenticate"
+	defaultBasicAuthRealm   = "gateway"
+	basicAuthUserRuntimeVar = "basicauth.user"
+)
+
+var (
+	basicPrefix = []byte("Basic ")
+)
+
+var (
+	// ErrBasicAuthMissing the request has no basic credentials
+	ErrBasicAuthMissing = errors.New("missing basic auth credentials")
+	// ErrBasicAuthInvalid the user is unknown or the password is wrong
+	ErrBasicAuthInvalid = errors.New("invalid basic auth credentials")
+)
+
+// BasicAuthFilter authenticate the requests of the nodes enabled basic auth by the configured users,
+// the authenticated user is set to the runtime vars.
+type BasicAuthFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+	realm  string
+	// dummyHash the password of the unknown user is compared with it, so the unknown and the known users
+	// take the same time, the users can not be found by the response time
+	dummyHash []byte
+}
+
+func newBasicAuthFilter(config *conf.Conf, proxy *Proxy) Filter {
+	f := BasicAuthFilter{
+		config: config,
+		proxy:  proxy,
+		realm:  config.BasicAuthRealm,
+	}
+
+	if "" == f.realm {
+		f.realm = defaultBasicAuthRealm
+	}
+
+	dummyCost := bcrypt.DefaultCost
+	for user, hash := range config.BasicAuthUsers {
+		cost, err := bcrypt.Cost([]byte(hash))
+		if nil != err {
+			log.ErrorErrorf(err, "BasicAuth the password of user <%s> is not a bcrypt hash, the user can not authenticate", user)
+			continue
+		}
+		dummyCost = cost
+	}
+
+	f.dummyHash, _ = bcrypt.GenerateFromPassword([]byte(defaultBasicAuthRealm), dummyCost)
+	return f
+}
+
+// Name return name of this filter
+func (f BasicAuthFilter) Name() string {
+	return FilterBasicAuth
+}
+
+// Pre execute before proxy
+func (f BasicAuthFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if f.skip(c) {
+		return f.BaseFilter.Pre(c)
+	}
+
+	user, password, ok := parseBasicAuth(c.Request().Header.Peek(headerAuthorization))
+	if !ok {
+		return f.unauthorized(c, ErrBasicAuthMissing)
+	}
+
+	if !f.verify(user, password) {
+		return f.unauthorized(c, ErrBasicAuthInvalid)
+	}
+
+	c.runtimeVar[basicAuthUserRuntimeVar] = user
+	return f.BaseFilter.Pre(c)
+}
+
+func (f BasicAuthFilter) skip(c *FilterContext) bool {
+	if nil == c.result.Node || !c.result.Node.BasicAuth {
+		return true
+	}
+
+	path := getRoutePath(c.ctx)
+	for _, prefix := range f.config.BasicAuthSkipPaths {
+		if hasPathPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// verify compare the password with the configured bcrypt hash of user
+func (f BasicAuthFilter) verify(user, password string) bool {
+	hash, ok := f.config.BasicAuthUsers[user]
+	if !ok {
+		bcrypt.CompareHashAndPassword(f.dummyHash, []byte(password))
+		return false
+	}
+
+	return nil == bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
+
+// unauthorized respond 401 with the WWW-Authenticate challenge
+func (f BasicAuthFilter) unauthorized(c *FilterContext, err error) (int, error) {
+	res := fasthttp.AcquireResponse()
+	res.SetStatusCode(http.StatusUnauthorized)
+	res.Header.Set(headerWWWAuthenticate, `Basic realm="`+f.realm+`", charset="UTF-8"`)
+	res.SetBodyString(err.Error())
+
+	c.result.Res = res
+	return http.StatusUnauthorized, errResponded
+}
+
+// parseBasicAuth returns the user and password of the Authorization header
+func parseBasicAuth(authorization []byte) (string, string, bool) {
+	if len(authorization) < len(basicPrefix) || !bytes.EqualFold(authorization[:len(basicPrefix)], basicPrefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(string(authorization[len(basicPrefix):]))
+	if nil != err {
+		return "", "", false
+	}
+
+	index := bytes.IndexByte(decoded, ':')
+	if index < 0 {
+		return "", "", false
+	}
+
+	return string(decoded[:index]), string(decoded[index+1:]), true
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func doTestBasicAuthRequest(p *Proxy, uri string, authorization string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.SetRequestURI(uri)
+	req.Header.SetHost("gateway")
+	if "" != authorization {
+		req.Header.Set(headerAuthorization, authorization)
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+	p.ReverseProxyHandler(ctx)
+
+	return ctx
+}
+
+func basicAuthorization(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func basicAuthHash(t *testing.T, password string) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if nil != err {
+		t.Fatalf("hash err: %s", err)
+	}
+
+	return string(hash)
+}
+
+func TestBasicAuthFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.BasicAuthUsers = map[string]string{"admin": basicAuthHash(t, "secret")}
+	cnf.BasicAuthRealm = "tools"
+	cnf.BasicAuthSkipPaths = []string{"/tools/health"}
+
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterBasicAuth)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/tools/", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/tools", BasicAuth: true},
+	}))
+
+	cases := []struct {
+		uri           string
+		authorization string
+		code          int
+	}{
+		{uri: "/tools/index", code: http.StatusUnauthorized},
+		{uri: "/tools/index", authorization: basicAuthorization("admin", "wrong"), code: http.StatusUnauthorized},
+		{uri: "/tools/index", authorization: basicAuthorization("guest", "secret"), code: http.StatusUnauthorized},
+		{uri: "/tools/index", authorization: "Basic !invalid", code: http.StatusUnauthorized},
+		{uri: "/tools/index", authorization: basicAuthorization("admin", "secret"), code: http.StatusOK},
+		// the allowed path
+		{uri: "/tools/health", code: http.StatusOK},
+		{uri: "/tools/healthz", code: http.StatusUnauthorized},
+		// the node not enabled
+		{uri: "/api", code: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		ctx := doTestBasicAuthRequest(p, c.uri, c.authorization)
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s <%s> expect:<%d>, acture:<%d>", c.uri, c.authorization, c.code, ctx.Response.StatusCode())
+		}
+
+		challenge := string(ctx.Response.Header.Peek(headerWWWAuthenticate))
+		if http.StatusUnauthorized == c.code && challenge != `Basic realm="tools", charset="UTF-8"` {
+			t.Errorf("%s <%s> expect challenge, acture:<%s>", c.uri, c.authorization, challenge)
+		}
+	}
+}
+
+func TestBasicAuthUserRuntimeVar(t *testing.T) {
+	cnf := newTestConf()
+	cnf.BasicAuthUsers = map[string]string{
+		"admin": basicAuthHash(t, "secret"),
+		// the unsalted SHA-256 of secret is not accepted
+		"legacy": "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b",
+	}
+	f := newBasicAuthFilter(cnf, nil)
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/tools")
+	ctx.Request.Header.Set(headerAuthorization, basicAuthorization("admin", "secret"))
+	c := &FilterContext{
+		ctx:        ctx,
+		result:     &model.RouteResult{Node: &model.Node{BasicAuth: true}},
+		runtimeVar: make(map[string]string),
+	}
+
+	if _, err := f.Pre(c); nil != err || c.runtimeVar[basicAuthUserRuntimeVar] != "admin" {
+		t.Errorf("expect:<admin>, acture:<%s>, err:<%v>", c.runtimeVar[basicAuthUserRuntimeVar], err)
+	}
+
+	c.runtimeVar = make(map[string]string)
+	ctx.Request.Header.Set(headerAuthorization, basicAuthorization("legacy", "secret"))
+	if code, _ := f.Pre(c); code != http.StatusUnauthorized {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusUnauthorized, code)
+	}
+}
+
+func TestBasicAuthDummyHash(t *testing.T) {
+	cnf := newTestConf()
+	cnf.BasicAuthUsers = map[string]string{"admin": basicAuthHash(t, "secret")}
+	f := newBasicAuthFilter(cnf, nil).(BasicAuthFilter)
+
+	// the unknown user is compared with the hash of the same cost as the configured users
+	if cost, err := bcrypt.Cost(f.dummyHash); nil != err || cost != bcrypt.MinCost {
+		t.Errorf("expect:<%d>, acture:<%d>, err:<%v>", bcrypt.MinCost, cost, err)
+	}
+
+	if f.verify("guest", "secret") || !f.verify("admin", "secret") {
+		t.Errorf("expect only the configured user verified")
+	}
+}
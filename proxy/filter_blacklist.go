@@ -1,24 +1,81 @@
 package proxy
 
 import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
 	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrPathDenied the request path is denied by blacklist filter
+	ErrPathDenied = errors.New("path denied")
+	// ErrPathNotAllowed the request path is not in the whitelist of blacklist filter
+	ErrPathNotAllowed = errors.New("path not allowed")
 )
 
-// BlackListFilter blacklist filter
+// BlackListFilter reject the request path by the regexp blacklist and whitelist before the route selection,
+// the denied path is responded 403, the path not in the whitelist is responded 404 if the whitelist is not empty.
 type BlackListFilter struct {
-	baseFilter
+	BaseFilter
 	proxy  *Proxy
 	config *conf.Conf
+	allow  []*regexp.Regexp
+	deny   []*regexp.Regexp
 }
 
 func newBlackListFilter(config *conf.Conf, proxy *Proxy) Filter {
 	return BlackListFilter{
 		config: config,
 		proxy:  proxy,
+		allow:  compilePathPatterns(config.PathWhiteList),
+		deny:   compilePathPatterns(config.PathBlackList),
+	}
+}
+
+func compilePathPatterns(patterns []string) []*regexp.Regexp {
+	values := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		value, err := regexp.Compile(pattern)
+		if nil != err {
+			log.PanicErrorf(err, "Proxy compile path pattern <%s> fail", pattern)
+		}
+
+		values = append(values, value)
 	}
+
+	return values
 }
 
 // Name return name of this filter
 func (f BlackListFilter) Name() string {
 	return FilterBlackList
 }
+
+// Request execute before the route selection
+func (f BlackListFilter) Request(ctx *fasthttp.RequestCtx) (statusCode int, err error) {
+	path := []byte(getRoutePath(ctx))
+
+	if matchPath(f.deny, path) {
+		return http.StatusForbidden, ErrPathDenied
+	}
+
+	if len(f.allow) > 0 && !matchPath(f.allow, path) {
+		return http.StatusNotFound, ErrPathNotAllowed
+	}
+
+	return http.StatusOK, nil
+}
+
+func matchPath(patterns []*regexp.Regexp, path []byte) bool {
+	for _, pattern := range patterns {
+		if pattern.Match(path) {
+			return true
+		}
+	}
+
+	return false
+}
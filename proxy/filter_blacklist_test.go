@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBlackListFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.PathBlackList = []string{"^/admin(/|$)", `\.git`}
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterBlackList)
+
+	cases := []struct {
+		uri    string
+		expect int
+	}{
+		{uri: "/admin", expect: http.StatusForbidden},
+		{uri: "/admin/users?id=1", expect: http.StatusForbidden},
+		{uri: "/api/../admin/users", expect: http.StatusForbidden},
+		{uri: "/static/.git/config", expect: http.StatusForbidden},
+		{uri: "/administrator", expect: http.StatusOK},
+		{uri: "/api/users", expect: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		if ctx := doTestRequest(p, "GET", c.uri); ctx.Response.StatusCode() != c.expect {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.uri, c.expect, ctx.Response.StatusCode())
+		}
+	}
+
+	if requests := int(backend.requests); requests != 2 {
+		t.Errorf("expect:<%d>, acture:<%d>", 2, requests)
+	}
+
+	cnf.PathWhiteList = []string{"^/api/"}
+	p = newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterBlackList)
+
+	cases = []struct {
+		uri    string
+		expect int
+	}{
+		{uri: "/api/users", expect: http.StatusOK},
+		{uri: "/other", expect: http.StatusNotFound},
+		{uri: "/admin", expect: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		if ctx := doTestRequest(p, "GET", c.uri); ctx.Response.StatusCode() != c.expect {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.uri, c.expect, ctx.Response.StatusCode())
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerCacheControl  = "Cache-Control"
+	headerSetCookie     = "Set-Cookie"
+	defaultCacheMaxSize = 64 * 1024 * 1024
+)
+
+var (
+	noStore = []byte("no-store")
+	private = []byte("private")
+
+	cacheableStatusCodes = map[int]bool{
+		http.StatusOK:                   true,
+		http.StatusNonAuthoritativeInfo: true,
+		http.StatusNoContent:            true,
+		http.StatusMultipleChoices:      true,
+		http.StatusMovedPermanently:     true,
+		http.StatusNotFound:             true,
+		http.StatusGone:                 true,
+	}
+)
+
+// CacheFilter cache the responses of GET and HEAD requests for the ttl of node,
+// the cache key is the cluster, method, uri and the configured headers.
+// The concurrent misses of the same key wait for the first one to the backend server.
+type CacheFilter struct {
+	BaseFilter
+	config  *conf.Conf
+	proxy   *Proxy
+	cache   *responseCache
+	flights *cacheFlights
+}
+
+func newCacheFilter(config *conf.Conf, proxy *Proxy) Filter {
+	maxSize := config.CacheMaxSize
+	if maxSize <= 0 {
+		maxSize = defaultCacheMaxSize
+	}
+
+	return CacheFilter{
+		config:  config,
+		proxy:   proxy,
+		cache:   newResponseCache(maxSize),
+		flights: newCacheFlights(),
+	}
+}
+
+// Name return name of this filter
+func (f CacheFilter) Name() string {
+	return FilterCache
+}
+
+// Pre execute before proxy
+func (f CacheFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if f.getTTL(c) <= 0 || !isCacheableRequest(c.Request()) {
+		return f.BaseFilter.Pre(c)
+	}
+
+	key := getRequestKey(c, f.config.CacheKeyHeaders)
+	if f.serve(c, key) {
+		return http.StatusOK, errResponded
+	}
+
+	done, leader := f.flights.join(key)
+	if leader {
+		c.OnDone(func() {
+			f.flights.leave(key)
+		})
+		return f.BaseFilter.Pre(c)
+	}
+
+	// wait for the first request of the key, proxy to backend server if it is not cached
+	timeout := time.NewTimer(getWaitTimeout(f.config, c))
+	defer timeout.Stop()
+
+	select {
+	case <-done:
+		if f.serve(c, key) {
+			return http.StatusOK, errResponded
+		}
+	case <-timeout.C:
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// Respond returns the cached response, the cache filter respond before the server selection if it is leading in the filter plan
+func (f CacheFilter) Respond(c *FilterContext) (res *fasthttp.Response, statusCode int, err error) {
+	if f.getTTL(c) <= 0 || !isCacheableRequest(c.Request()) {
+		return nil, http.StatusOK, nil
+	}
+
+	res = f.cache.get(getRequestKey(c, f.config.CacheKeyHeaders), time.Now())
+	return res, http.StatusOK, nil
+}
+
+// Post execute after proxy
+func (f CacheFilter) Post(c *FilterContext) (statusCode int, err error) {
+	ttl := f.getTTL(c)
+	if ttl <= 0 || !isCacheableRequest(c.Request()) || !isCacheableResponse(c) {
+		return f.BaseFilter.Post(c)
+	}
+
+	f.cache.put(getRequestKey(c, f.config.CacheKeyHeaders), c.result.Res, time.Now().Add(ttl))
+	return f.BaseFilter.Post(c)
+}
+
+func (f CacheFilter) serve(c *FilterContext, key string) bool {
+	res := f.cache.get(key, time.Now())
+	if nil == res {
+		return false
+	}
+
+	c.result.Res = res
+	return true
+}
+
+func (f CacheFilter) getTTL(c *FilterContext) time.Duration {
+	if nil != c.result.Node && c.result.Node.CacheTTL > 0 {
+		return c.result.Node.CacheTTL
+	}
+
+	return time.Duration(f.config.CacheTTL) * time.Second
+}
+
+// getWaitTimeout returns the max duration to wait for the request of the same key
+func getWaitTimeout(config *conf.Conf, c *FilterContext) time.Duration {
+	if nil != c.result.Node && c.result.Node.Timeout > 0 {
+		return c.result.Node.Timeout
+	}
+
+	if config.ReadTimeout > 0 {
+		return time.Duration(config.ReadTimeout) * time.Second
+	}
+
+	return time.Minute
+}
+
+// getRequestKey returns the key of the cluster, method, uri and the headers of request
+func getRequestKey(c *FilterContext, headers []string) string {
+	buf := bytes.Buffer{}
+
+	if nil != c.result.Cluster {
+		buf.WriteString(c.result.Cluster.Name)
+	}
+	buf.WriteByte('\n')
+	buf.Write(c.outreq.Header.Method())
+	buf.WriteByte('\n')
+	buf.Write(c.outreq.URI().RequestURI())
+
+	for _, header := range headers {
+		buf.WriteByte('\n')
+		buf.Write(c.Request().Header.Peek(header))
+	}
+
+	return buf.String()
+}
+
+func isCacheableRequest(req *fasthttp.Request) bool {
+	if !req.Header.IsGet() && !req.Header.IsHead() {
+		return false
+	}
+
+	return !bytes.Contains(req.Header.Peek(headerCacheControl), noStore)
+}
+
+func isCacheableResponse(c *FilterContext) bool {
+	res := c.result.Res
+	if nil != c.result.Stream || !cacheableStatusCodes[res.StatusCode()] {
+		return false
+	}
+
+	if len(res.Header.Peek(headerSetCookie)) > 0 {
+		return false
+	}
+
+	cacheControl := res.Header.Peek(headerCacheControl)
+	return !bytes.Contains(cacheControl, noStore) && !bytes.Contains(cacheControl, private)
+}
+
+type cacheEntry struct {
+	key      string
+	res      *fasthttp.Response
+	size     int
+	expireAt time.Time
+}
+
+// responseCache LRU cache of responses, the total body size is limited by maxSize
+type responseCache struct {
+	sync.Mutex
+	maxSize int
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+func newResponseCache(maxSize int) *responseCache {
+	return &responseCache{
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns a copy of the cached response, the caller owns it
+func (rc *responseCache) get(key string, now time.Time) *fasthttp.Response {
+	rc.Lock()
+	defer rc.Unlock()
+
+	elem, ok := rc.entries[key]
+	if !ok {
+		return nil
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if now.After(entry.expireAt) {
+		rc.remove(elem)
+		return nil
+	}
+
+	rc.lru.MoveToFront(elem)
+
+	res := fasthttp.AcquireResponse()
+	entry.res.CopyTo(res)
+	return res
+}
+
+func (rc *responseCache) put(key string, res *fasthttp.Response, expireAt time.Time) {
+	entry := &cacheEntry{
+		key:      key,
+		res:      &fasthttp.Response{},
+		expireAt: expireAt,
+	}
+	res.CopyTo(entry.res)
+	entry.size = len(entry.res.Body()) + len(entry.res.Header.Header())
+
+	rc.Lock()
+	defer rc.Unlock()
+
+	if elem, ok := rc.entries[key]; ok {
+		rc.remove(elem)
+	}
+
+	if entry.size > rc.maxSize {
+		return
+	}
+
+	for rc.size+entry.size > rc.maxSize {
+		rc.remove(rc.lru.Back())
+	}
+
+	rc.entries[key] = rc.lru.PushFront(entry)
+	rc.size += entry.size
+}
+
+func (rc *responseCache) remove(elem *list.Element) {
+	entry := rc.lru.Remove(elem).(*cacheEntry)
+	delete(rc.entries, entry.key)
+	rc.size -= entry.size
+}
+
+// cacheFlights the requests of keys to backend servers
+type cacheFlights struct {
+	sync.Mutex
+	flights map[string]chan struct{}
+}
+
+func newCacheFlights() *cacheFlights {
+	return &cacheFlights{
+		flights: make(map[string]chan struct{}),
+	}
+}
+
+// join returns the chan closed when the request of key is done,
+// the first one of key is the leader, it must leave when done
+func (cf *cacheFlights) join(key string) (<-chan struct{}, bool) {
+	cf.Lock()
+	defer cf.Unlock()
+
+	if done, ok := cf.flights[key]; ok {
+		return done, false
+	}
+
+	done := make(chan struct{})
+	cf.flights[key] = done
+	return done, true
+}
+
+func (cf *cacheFlights) leave(key string) {
+	cf.Lock()
+	defer cf.Unlock()
+
+	if done, ok := cf.flights[key]; ok {
+		close(done)
+		delete(cf.flights, key)
+	}
+}
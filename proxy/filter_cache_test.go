@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestCacheProxy(t *testing.T, ttl time.Duration, backend *testBackend) *Proxy {
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterCache)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/cached", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/cached",
+			CacheTTL:    ttl,
+		},
+	}))
+
+	return p
+}
+
+func TestCacheFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "1")
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestCacheProxy(t, time.Minute, backend)
+
+	for i := 0; i < 3; i++ {
+		ctx := doTestRequest(p, "GET", "/cached")
+		if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != "OK" {
+			t.Errorf("expect:<%d,OK>, acture:<%d,%s>", http.StatusOK, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+
+		if value := string(ctx.Response.Header.Peek("X-Backend")); value != "1" {
+			t.Errorf("expect:<1>, acture:<%s>", value)
+		}
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+
+	// not cached methods and nodes
+	doTestRequest(p, "POST", "/cached")
+	doTestRequest(p, "GET", "/api")
+	doTestRequest(p, "GET", "/api")
+	if requests := atomic.LoadInt32(&backend.requests); requests != 4 {
+		t.Errorf("expect:<4>, acture:<%d>", requests)
+	}
+}
+
+func TestCacheFilterExpire(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestCacheProxy(t, time.Millisecond*100, backend)
+
+	doTestRequest(p, "GET", "/cached")
+	doTestRequest(p, "GET", "/cached")
+	time.Sleep(time.Millisecond * 150)
+	doTestRequest(p, "GET", "/cached")
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", requests)
+	}
+}
+
+func TestCacheFilterNoStore(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("upstream") != "" {
+			w.Header().Set(headerCacheControl, "no-store")
+		}
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestCacheProxy(t, time.Minute, backend)
+
+	// no-store of upstream
+	doTestRequest(p, "GET", "/cached?upstream=1")
+	doTestRequest(p, "GET", "/cached?upstream=1")
+	if requests := atomic.LoadInt32(&backend.requests); requests != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", requests)
+	}
+
+	// no-store of client
+	for i := 0; i < 2; i++ {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/cached")
+		req.Header.SetHost("gateway")
+		req.Header.Set(headerCacheControl, "no-store")
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, nil, nil)
+		p.ReverseProxyHandler(ctx)
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 4 {
+		t.Errorf("expect:<4>, acture:<%d>", requests)
+	}
+}
+
+func TestCacheFilterCoalesce(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 200)
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestCacheProxy(t, time.Minute, backend)
+
+	n := 5
+	wg := &sync.WaitGroup{}
+	wg.Add(n)
+	codes := make([]int, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = doTestRequest(p, "GET", "/cached").Response.StatusCode()
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, code)
+		}
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+}
+
+func TestResponseCacheEvict(t *testing.T) {
+	res := &fasthttp.Response{}
+	res.SetBody(make([]byte, 30))
+	size := len(res.Body()) + len(res.Header.Header())
+
+	// only 2 entries can be cached
+	rc := newResponseCache(size*2 + size/2)
+	expireAt := time.Now().Add(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		rc.put(strconv.Itoa(i), res, expireAt)
+		rc.get("0", time.Now())
+	}
+
+	if nil == rc.get("0", time.Now()) {
+		t.Errorf("expect the recently used entry")
+	}
+
+	if nil != rc.get("1", time.Now()) {
+		t.Errorf("expect the least recently used entry evicted")
+	}
+
+	if rc.size > rc.maxSize {
+		t.Errorf("expect:<%d>, acture:<%d>", rc.maxSize, rc.size)
+	}
+
+	res.SetBody(make([]byte, size*3))
+	rc.put("large", res, expireAt)
+	if nil != rc.get("large", time.Now()) {
+		t.Errorf("expect the entry larger than max size not cached")
+	}
+}
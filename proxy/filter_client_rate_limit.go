@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+const (
+	headerRetryAfter    = "Retry-After"
+	headerXForwardedFor = "X-Forwarded-For"
+	rateLimitGCInterval = time.Minute
+)
+
+var (
+	// ErrClientRateLimited the requests of client ip exceeds the rate limit
+	ErrClientRateLimited = errors.New("client rate limit")
+)
+
+// ClientRateLimitFilter limit the requests of every client ip by token bucket, the client over the limit
+// is rejected with 429. The rate and burst of node override the global config.
+// Use RateLimitingFilter to protect a backend server by its MaxQPS of all clients.
+type ClientRateLimitFilter struct {
+	BaseFilter
+	config  *conf.Conf
+	proxy   *Proxy
+	buckets *tokenBuckets
+}
+
+func newClientRateLimitFilter(config *conf.Conf, proxy *Proxy) Filter {
+	buckets := newTokenBuckets()
+	go buckets.startGC(rateLimitGCInterval)
+
+	return ClientRateLimitFilter{
+		config:  config,
+		proxy:   proxy,
+		buckets: buckets,
+	}
+}
+
+// Name return name of this filter
+func (f ClientRateLimitFilter) Name() string {
+	return FilterClientRateLimit
+}
+
+// Pre execute before proxy
+func (f ClientRateLimitFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	rate, burst := f.getLimit(c.result.Node)
+	if rate <= 0 {
+		return f.BaseFilter.Pre(c)
+	}
+
+	key := bucketKey{
+		node: c.result.Node,
+		ip:   c.runtimeVar[clientIPRuntimeVar],
+	}
+
+	ok, wait := f.buckets.take(key, rate, burst, time.Now())
+	if !ok {
+		// the sub-requests of merge can not write the shared client response concurrently
+		if !c.result.Merge {
+			c.ctx.Response.Header.Set(headerRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		}
+		return http.StatusTooManyRequests, ErrClientRateLimited
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+func (f ClientRateLimitFilter) getLimit(node *model.Node) (int, int) {
+	rate, burst := f.config.RateLimit, f.config.RateLimitBurst
+
+	if nil != node && node.RateLimit > 0 {
+		rate, burst = node.RateLimit, node.RateLimitBurst
+	}
+
+	if burst <= 0 {
+		burst = rate
+	}
+
+	return rate, burst
+}
+
+type bucketKey struct {
+	node *model.Node
+	ip   string
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Duration
+}
+
+// tokenBuckets the token buckets of client ips
+type tokenBuckets struct {
+	sync.Mutex
+	buckets map[bucketKey]*tokenBucket
+}
+
+func newTokenBuckets() *tokenBuckets {
+	return &tokenBuckets{
+		buckets: make(map[bucketKey]*tokenBucket),
+	}
+}
+
+// take take a token from the bucket of key, returns the duration to wait for next token if the bucket is empty
+func (b *tokenBuckets) take(key bucketKey, rate, burst int, now time.Time) (bool, time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{
+			tokens: float64(burst),
+			last:   now,
+		}
+		b.buckets[key] = bucket
+	}
+
+	bucket.full = time.Duration(float64(burst) / float64(rate) * float64(time.Second))
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.last).Seconds()*float64(rate))
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / float64(rate) * float64(time.Second))
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+func (b *tokenBuckets) startGC(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		b.gc(now)
+	}
+}
+
+// gc remove the buckets which are full, a full bucket is the same as a new one
+func (b *tokenBuckets) gc(now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+
+	for key, bucket := range b.buckets {
+		if now.Sub(bucket.last) >= bucket.full {
+			delete(b.buckets, key)
+		}
+	}
+}
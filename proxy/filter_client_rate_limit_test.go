@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func doTestRateLimitRequest(p *Proxy, uri string, ip string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.SetRequestURI(uri)
+	req.Header.SetHost("gateway")
+	req.Header.Set(headerXForwardedFor, ip+", 10.0.0.1")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+
+	p.ReverseProxyHandler(ctx)
+
+	return ctx
+}
+
+func TestClientRateLimitFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.RateLimit = 10
+	cnf.RateLimitBurst = 2
+	cnf.TrustXForwardedFor = true
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterClientRateLimit)
+
+	for i := 0; i < 2; i++ {
+		ctx := doTestRateLimitRequest(p, "/api", "192.168.1.1")
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+		}
+	}
+
+	ctx := doTestRateLimitRequest(p, "/api", "192.168.1.1")
+	if ctx.Response.StatusCode() != http.StatusTooManyRequests {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusTooManyRequests, ctx.Response.StatusCode())
+	}
+
+	if retryAfter := string(ctx.Response.Header.Peek(headerRetryAfter)); retryAfter != "1" {
+		t.Errorf("expect:<1>, acture:<%s>", retryAfter)
+	}
+
+	// other client has its own bucket
+	ctx = doTestRateLimitRequest(p, "/api", "192.168.1.2")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("other client expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	// refill a token after 100ms
+	time.Sleep(time.Millisecond * 150)
+	ctx = doTestRateLimitRequest(p, "/api", "192.168.1.1")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("refill expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+}
+
+func TestClientRateLimitFilterWithNode(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.RateLimit = 100
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterClientRateLimit)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/limited$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/api",
+			RateLimit:   1,
+		},
+	}))
+
+	ctx := doTestRateLimitRequest(p, "/limited", "192.168.1.1")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	ctx = doTestRateLimitRequest(p, "/limited", "192.168.1.1")
+	if ctx.Response.StatusCode() != http.StatusTooManyRequests {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusTooManyRequests, ctx.Response.StatusCode())
+	}
+
+	ctx = doTestRateLimitRequest(p, "/api", "192.168.1.1")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("global expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+}
+
+func TestTokenBucketsGC(t *testing.T) {
+	b := newTokenBuckets()
+	now := time.Now()
+	key := bucketKey{ip: "192.168.1.1"}
+
+	b.take(key, 10, 10, now)
+
+	b.gc(now.Add(time.Millisecond * 500))
+	if len(b.buckets) != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", len(b.buckets))
+	}
+
+	b.gc(now.Add(time.Second))
+	if len(b.buckets) != 0 {
+		t.Errorf("expect:<0>, acture:<%d>", len(b.buckets))
+	}
+}
@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerOrigin                        = "Origin"
+	headerAccessControlRequestMethod    = "Access-Control-Request-Method"
+	headerAccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	headerAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	headerAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	headerAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	headerAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	headerAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	headerAccessControlMaxAge           = "Access-Control-Max-Age"
+)
+
+var (
+	defaultCORSAllowMethods = []string{"GET", "HEAD", "POST"}
+)
+
+var (
+	// ErrCORSNotAllowed the origin or method of preflight request is not allowed
+	ErrCORSNotAllowed = errors.New("cors not allowed")
+)
+
+// CORSFilter answer the preflight requests directly, and add the cors headers to the responses
+// of allowed origins.
+type CORSFilter struct {
+	BaseFilter
+	config  *conf.Conf
+	proxy   *Proxy
+	methods []string
+}
+
+func newCORSFilter(config *conf.Conf, proxy *Proxy) Filter {
+	methods := config.CORSAllowMethods
+	if len(methods) == 0 {
+		methods = defaultCORSAllowMethods
+	}
+
+	return CORSFilter{
+		config:  config,
+		proxy:   proxy,
+		methods: methods,
+	}
+}
+
+// Name return name of this filter
+func (f CORSFilter) Name() string {
+	return FilterCORS
+}
+
+// Pre execute before proxy
+func (f CORSFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	req := c.Request()
+	if !isPreflight(req) {
+		return f.BaseFilter.Pre(c)
+	}
+
+	origin := string(req.Header.Peek(headerOrigin))
+	method := string(req.Header.Peek(headerAccessControlRequestMethod))
+	if !f.isAllowedOrigin(origin) || !f.isAllowedMethod(method) {
+		return http.StatusForbidden, ErrCORSNotAllowed
+	}
+
+	res := fasthttp.AcquireResponse()
+	res.SetStatusCode(http.StatusNoContent)
+	f.setAllowOrigin(&res.Header, origin)
+	res.Header.Set(headerAccessControlAllowMethods, strings.Join(f.methods, ", "))
+
+	if len(f.config.CORSAllowHeaders) > 0 {
+		res.Header.Set(headerAccessControlAllowHeaders, strings.Join(f.config.CORSAllowHeaders, ", "))
+	} else if headers := req.Header.Peek(headerAccessControlRequestHeaders); len(headers) > 0 {
+		res.Header.SetBytesV(headerAccessControlAllowHeaders, headers)
+	}
+
+	if f.config.CORSMaxAge > 0 {
+		res.Header.Set(headerAccessControlMaxAge, strconv.Itoa(f.config.CORSMaxAge))
+	}
+
+	c.result.Res = res
+	return http.StatusNoContent, errResponded
+}
+
+// Post execute after proxy
+func (f CORSFilter) Post(c *FilterContext) (statusCode int, err error) {
+	origin := string(c.Request().Header.Peek(headerOrigin))
+	if "" == origin || !f.isAllowedOrigin(origin) {
+		return f.BaseFilter.Post(c)
+	}
+
+	// the response headers may be copied to the client response already by head filter,
+	// the merge response headers are copied by the handler
+	headers := []*fasthttp.ResponseHeader{&c.result.Res.Header}
+	if !c.result.Merge {
+		headers = append(headers, &c.ctx.Response.Header)
+	}
+
+	for _, header := range headers {
+		f.setAllowOrigin(header, origin)
+
+		if len(f.config.CORSExposeHeaders) > 0 {
+			header.Set(headerAccessControlExposeHeaders, strings.Join(f.config.CORSExposeHeaders, ", "))
+		}
+	}
+
+	return f.BaseFilter.Post(c)
+}
+
+func (f CORSFilter) setAllowOrigin(header *fasthttp.ResponseHeader, origin string) {
+	if f.config.CORSAllowCredentials {
+		header.Set(headerAccessControlAllowCredentials, "true")
+	} else if f.isAllowAll() {
+		header.Set(headerAccessControlAllowOrigin, "*")
+		return
+	}
+
+	// the credentials mode need the exact origin
+	header.Set(headerAccessControlAllowOrigin, origin)
+	header.Add(headerVary, headerOrigin)
+}
+
+func (f CORSFilter) isAllowAll() bool {
+	for _, allowed := range f.config.CORSAllowOrigins {
+		if "*" == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f CORSFilter) isAllowedOrigin(origin string) bool {
+	if "" == origin {
+		return false
+	}
+
+	for _, allowed := range f.config.CORSAllowOrigins {
+		switch {
+		case "*" == allowed:
+			return true
+		case strings.HasPrefix(allowed, "*."):
+			// *.example.com matches http://a.example.com
+			if strings.HasSuffix(origin, allowed[1:]) {
+				return true
+			}
+		case strings.EqualFold(allowed, origin):
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f CORSFilter) isAllowedMethod(method string) bool {
+	for _, allowed := range f.methods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPreflight(req *fasthttp.Request) bool {
+	return string(req.Header.Method()) == "OPTIONS" &&
+		len(req.Header.Peek(headerOrigin)) > 0 &&
+		len(req.Header.Peek(headerAccessControlRequestMethod)) > 0
+}
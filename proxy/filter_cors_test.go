@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func doTestCORSRequest(p *Proxy, method string, origin string, requestMethod string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.Header.SetMethod(method)
+	req.SetRequestURI("/api")
+	req.Header.SetHost("gateway")
+	req.Header.Set(headerOrigin, origin)
+	if "" != requestMethod {
+		req.Header.Set(headerAccessControlRequestMethod, requestMethod)
+		req.Header.Set(headerAccessControlRequestHeaders, "X-Custom")
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+
+	p.ReverseProxyHandler(ctx)
+
+	return ctx
+}
+
+func newTestCORSProxy(t *testing.T, backend *testBackend) *Proxy {
+	cnf := newTestConf()
+	cnf.CORSAllowOrigins = []string{"http://app.com", "*.example.com"}
+	cnf.CORSAllowMethods = []string{"GET", "PUT"}
+	cnf.CORSExposeHeaders = []string{"X-Total"}
+	cnf.CORSAllowCredentials = true
+	cnf.CORSMaxAge = 600
+
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterCORS)
+	return p
+}
+
+func TestCORSPreflight(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestCORSProxy(t, backend)
+
+	ctx := doTestCORSRequest(p, "OPTIONS", "http://a.example.com", "PUT")
+	if ctx.Response.StatusCode() != http.StatusNoContent {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusNoContent, ctx.Response.StatusCode())
+	}
+
+	header := &ctx.Response.Header
+	expects := map[string]string{
+		headerAccessControlAllowOrigin:      "http://a.example.com",
+		headerAccessControlAllowMethods:     "GET, PUT",
+		headerAccessControlAllowHeaders:     "X-Custom",
+		headerAccessControlAllowCredentials: "true",
+		headerAccessControlMaxAge:           "600",
+	}
+	for name, expect := range expects {
+		if value := string(header.Peek(name)); value != expect {
+			t.Errorf("%s expect:<%s>, acture:<%s>", name, expect, value)
+		}
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 0 {
+		t.Errorf("expect:<0>, acture:<%d>", requests)
+	}
+
+	// method not allowed
+	ctx = doTestCORSRequest(p, "OPTIONS", "http://app.com", "DELETE")
+	if ctx.Response.StatusCode() != http.StatusForbidden {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusForbidden, ctx.Response.StatusCode())
+	}
+
+	// origin not allowed
+	ctx = doTestCORSRequest(p, "OPTIONS", "http://evil.com", "GET")
+	if ctx.Response.StatusCode() != http.StatusForbidden {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusForbidden, ctx.Response.StatusCode())
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 0 {
+		t.Errorf("expect:<0>, acture:<%d>", requests)
+	}
+}
+
+func TestCORSSimpleRequest(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestCORSProxy(t, backend)
+
+	ctx := doTestCORSRequest(p, "GET", "http://app.com", "")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	header := &ctx.Response.Header
+	if value := string(header.Peek(headerAccessControlAllowOrigin)); value != "http://app.com" {
+		t.Errorf("expect:<http://app.com>, acture:<%s>", value)
+	}
+
+	if value := string(header.Peek(headerAccessControlExposeHeaders)); value != "X-Total" {
+		t.Errorf("expect:<X-Total>, acture:<%s>", value)
+	}
+
+	// the disallowed origin is forwarded without cors headers
+	ctx = doTestCORSRequest(p, "GET", "http://evil.com", "")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	if value := string(ctx.Response.Header.Peek(headerAccessControlAllowOrigin)); value != "" {
+		t.Errorf("expect:<>, acture:<%s>", value)
+	}
+}
+
+func TestCORSAllowAll(t *testing.T) {
+	cnf := newTestConf()
+	cnf.CORSAllowOrigins = []string{"*"}
+	f := newCORSFilter(cnf, nil).(CORSFilter)
+
+	header := &fasthttp.ResponseHeader{}
+	f.setAllowOrigin(header, "http://any.com")
+	if value := string(header.Peek(headerAccessControlAllowOrigin)); value != "*" {
+		t.Errorf("expect:<*>, acture:<%s>", value)
+	}
+}
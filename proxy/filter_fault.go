@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+)
+
+var (
+	// ErrFaultAborted the request is aborted by fault filter
+	ErrFaultAborted = errors.New("fault aborted")
+)
+
+// FaultFilter delay or abort the requests of node by the fault injection with the percent,
+// the node without enabled fault is not affected.
+type FaultFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newFaultFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return FaultFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f FaultFilter) Name() string {
+	return FilterFault
+}
+
+// Pre execute before proxy
+func (f FaultFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if nil == c.result.Node || nil == c.result.Node.Fault || !c.result.Node.Fault.Enabled {
+		return f.BaseFilter.Pre(c)
+	}
+
+	fault := c.result.Node.Fault
+
+	if fault.Delay > 0 && hitPercent(fault.DelayPercent) {
+		time.Sleep(fault.Delay)
+	}
+
+	if hitPercent(fault.AbortPercent) {
+		if 0 == fault.AbortStatusCode {
+			return http.StatusServiceUnavailable, ErrFaultAborted
+		}
+
+		return fault.AbortStatusCode, ErrFaultAborted
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+func hitPercent(percent int) bool {
+	return percent > 0 && rand.Intn(100) < percent
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestFaultFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterFault)
+
+	abort := &model.FaultInjection{Enabled: true, AbortPercent: 30, AbortStatusCode: http.StatusInternalServerError}
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/abort$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/abort", Fault: abort},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/delay$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/delay",
+			Fault:       &model.FaultInjection{Enabled: true, Delay: 50 * time.Millisecond, DelayPercent: 100},
+		},
+	}))
+
+	total, aborted := 2000, 0
+	for i := 0; i < total; i++ {
+		ctx := doTestRequest(p, "GET", "/abort")
+		switch ctx.Response.StatusCode() {
+		case http.StatusInternalServerError:
+			aborted++
+		case http.StatusOK:
+		default:
+			t.Fatalf("expect:<%d or %d>, acture:<%d>", http.StatusOK, http.StatusInternalServerError, ctx.Response.StatusCode())
+		}
+	}
+
+	if rate := float64(aborted) / float64(total); rate < 0.25 || rate > 0.35 {
+		t.Errorf("expect:<%.2f>, acture:<%.4f>", 0.3, rate)
+	}
+
+	if requests := int(backend.requests); requests != total-aborted {
+		t.Errorf("expect:<%d>, acture:<%d>", total-aborted, requests)
+	}
+
+	start := time.Now()
+	ctx := doTestRequest(p, "GET", "/delay")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expect delay:<%s>, acture:<%s>", 50*time.Millisecond, elapsed)
+	}
+
+	// the disabled fault is not injected
+	abort.Enabled = false
+	for i := 0; i < 100; i++ {
+		if ctx := doTestRequest(p, "GET", "/abort"); ctx.Response.StatusCode() != http.StatusOK {
+			t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+		}
+	}
+}
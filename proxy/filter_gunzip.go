@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/fagongzi/gateway/conf"
+)
+
+var (
+	// ErrMalformedGzip response body of backend server is not a valid gzip data
+	ErrMalformedGzip = errors.New("malformed gzip response body")
+)
+
+// GunzipFilter decompress the gzip response of backend server, so the other post filters
+// and the merge get the plain body. It's always the first post filter, the gzip filter
+// compress the body again if the client accept it, otherwise the client get the plain body.
+type GunzipFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newGunzipFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return GunzipFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f GunzipFilter) Name() string {
+	return FilterGunzip
+}
+
+// Post execute after proxy
+func (f GunzipFilter) Post(c *FilterContext) (statusCode int, err error) {
+	res := c.result.Res
+	if nil != c.result.Stream || !bytes.EqualFold(res.Header.Peek(headerContentEncoding), []byte(encodingGzip)) {
+		return f.BaseFilter.Post(c)
+	}
+
+	if len(res.Body()) > 0 {
+		body, err := res.BodyGunzip()
+		if nil != err {
+			return http.StatusBadGateway, ErrMalformedGzip
+		}
+
+		res.SetBody(body)
+	}
+
+	res.Header.Del(headerContentEncoding)
+	res.Header.SetContentLength(len(res.Body()))
+
+	return f.BaseFilter.Post(c)
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func newGzipTestBackend() *testBackend {
+	return newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+
+		switch r.URL.Path {
+		case "/empty":
+		case "/malformed":
+			w.Write([]byte("not gzip"))
+		default:
+			w.Write(fasthttp.AppendGzipBytes(nil, []byte(`"`+r.URL.Path+`"`)))
+		}
+	})
+}
+
+func TestGunzipFilter(t *testing.T) {
+	backend := newGzipTestBackend()
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterGunzip)
+	p.RegistryFilter(FilterHeader)
+
+	if name := p.filters.Back().Value.(Filter).Name(); name != FilterGunzip {
+		t.Errorf("expect:<%s>, acture:<%s>", FilterGunzip, name)
+	}
+
+	ctx := doTestGzipRequest(p, "/json", "")
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != `"/json"` {
+		t.Errorf("expect:<%d,%s>, acture:<%d,%s>", http.StatusOK, `"/json"`, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	if encoding := ctx.Response.Header.Peek(headerContentEncoding); len(encoding) > 0 {
+		t.Errorf("expect content-encoding removed, acture:<%s>", encoding)
+	}
+
+	ctx = doTestGzipRequest(p, "/empty", "")
+	if ctx.Response.StatusCode() != http.StatusOK || len(ctx.Response.Body()) != 0 {
+		t.Errorf("empty expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	ctx = doTestGzipRequest(p, "/malformed", "")
+	if ctx.Response.StatusCode() != http.StatusBadGateway {
+		t.Errorf("malformed expect:<%d>, acture:<%d>", http.StatusBadGateway, ctx.Response.StatusCode())
+	}
+}
+
+func TestGunzipFilterWithGzip(t *testing.T) {
+	backend := newGzipTestBackend()
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterGunzip)
+	p.RegistryFilter(FilterGzip)
+
+	ctx := doTestGzipRequest(p, "/json", "gzip")
+	if encoding := string(ctx.Response.Header.Peek(headerContentEncoding)); encoding != encodingGzip {
+		t.Errorf("expect:<%s>, acture:<%s>", encodingGzip, encoding)
+	}
+
+	body, err := ctx.Response.BodyGunzip()
+	if nil != err || string(body) != `"/json"` {
+		t.Errorf("expect:<%s>, acture:<%s>, err:<%v>", `"/json"`, body, err)
+	}
+}
+
+func TestGunzipFilterWithMerge(t *testing.T) {
+	backend := newGzipTestBackend()
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterGunzip)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/merge$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/a",
+			AttrName:    "a",
+		},
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/b",
+			AttrName:    "b",
+		},
+	}))
+
+	ctx := doTestGzipRequest(p, "/merge", "")
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != `{"a":"/a","b":"/b"}` {
+		t.Errorf("expect:<%s>, acture:<%s>", `{"a":"/a","b":"/b"}`, ctx.Response.Body())
+	}
+
+	if encoding := ctx.Response.Header.Peek(headerContentEncoding); len(encoding) > 0 {
+		t.Errorf("expect content-encoding removed, acture:<%s>", encoding)
+	}
+}
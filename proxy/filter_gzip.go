@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bytes"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerAcceptEncoding  = "Accept-Encoding"
+	headerContentEncoding = "Content-Encoding"
+	headerVary            = "Vary"
+	encodingGzip          = "gzip"
+)
+
+var (
+	defaultGzipContentTypes = []string{
+		"text/",
+		"application/json",
+		"application/javascript",
+		"application/xml",
+	}
+)
+
+// GzipFilter compress the response body by gzip if the client accept it.
+// The merge and streaming responses are not compressed.
+type GzipFilter struct {
+	BaseFilter
+	config       *conf.Conf
+	proxy        *Proxy
+	contentTypes [][]byte
+}
+
+func newGzipFilter(config *conf.Conf, proxy *Proxy) Filter {
+	contentTypes := config.GzipContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = defaultGzipContentTypes
+	}
+
+	f := GzipFilter{
+		config: config,
+		proxy:  proxy,
+	}
+
+	for _, contentType := range contentTypes {
+		f.contentTypes = append(f.contentTypes, []byte(contentType))
+	}
+
+	return f
+}
+
+// Name return name of this filter
+func (f GzipFilter) Name() string {
+	return FilterGzip
+}
+
+// Post execute after proxy
+func (f GzipFilter) Post(c *FilterContext) (statusCode int, err error) {
+	if !f.needCompress(c) {
+		return f.BaseFilter.Post(c)
+	}
+
+	res := c.result.Res
+	res.SetBody(fasthttp.AppendGzipBytes(nil, res.Body()))
+	res.Header.SetContentLength(len(res.Body()))
+	res.Header.Set(headerContentEncoding, encodingGzip)
+	res.Header.Add(headerVary, headerAcceptEncoding)
+
+	c.ctx.Response.Header.Set(headerContentEncoding, encodingGzip)
+	c.ctx.Response.Header.Add(headerVary, headerAcceptEncoding)
+
+	return f.BaseFilter.Post(c)
+}
+
+func (f GzipFilter) needCompress(c *FilterContext) bool {
+	if c.result.Merge || nil != c.result.Stream {
+		return false
+	}
+
+	if !c.ctx.Request.Header.HasAcceptEncoding(encodingGzip) {
+		return false
+	}
+
+	res := c.result.Res
+	// already encoded
+	if len(res.Header.Peek(headerContentEncoding)) > 0 {
+		return false
+	}
+
+	size := len(res.Body())
+	if size == 0 || size < f.config.GzipMinSize {
+		return false
+	}
+
+	return f.isCompressible(res.Header.ContentType())
+}
+
+func (f GzipFilter) isCompressible(contentType []byte) bool {
+	for _, prefix := range f.contentTypes {
+		if bytes.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func doTestGzipRequest(p *Proxy, uri string, acceptEncoding string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.SetRequestURI(uri)
+	req.Header.SetHost("gateway")
+	if "" != acceptEncoding {
+		req.Header.Set(headerAcceptEncoding, acceptEncoding)
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+
+	p.ReverseProxyHandler(ctx)
+
+	return ctx
+}
+
+func TestGzipFilter(t *testing.T) {
+	body := strings.Repeat("{\"a\":1}", 100)
+
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+		case "/png":
+			w.Header().Set("Content-Type", "image/png")
+		case "/encoded":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Encoding", "br")
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{}"))
+			return
+		}
+
+		w.Write([]byte(body))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.GzipMinSize = 64
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterGzip)
+
+	ctx := doTestGzipRequest(p, "/json", "gzip, deflate")
+	if encoding := string(ctx.Response.Header.Peek(headerContentEncoding)); encoding != encodingGzip {
+		t.Errorf("expect:<%s>, acture:<%s>", encodingGzip, encoding)
+	}
+
+	if len(ctx.Response.Body()) >= len(body) {
+		t.Errorf("expect compressed size less than:<%d>, acture:<%d>", len(body), len(ctx.Response.Body()))
+	}
+
+	unzip, err := ctx.Response.BodyGunzip()
+	if nil != err || string(unzip) != body {
+		t.Errorf("expect:<%s>, acture:<%s>, err:<%v>", body, unzip, err)
+	}
+
+	cases := []struct {
+		uri            string
+		acceptEncoding string
+		size           int
+	}{
+		{uri: "/json", acceptEncoding: "", size: len(body)},
+		{uri: "/png", acceptEncoding: "gzip", size: len(body)},
+		{uri: "/encoded", acceptEncoding: "gzip", size: len(body)},
+		{uri: "/small", acceptEncoding: "gzip", size: 2},
+	}
+
+	for _, c := range cases {
+		ctx = doTestGzipRequest(p, c.uri, c.acceptEncoding)
+		if encoding := ctx.Response.Header.Peek(headerContentEncoding); len(encoding) > 0 {
+			t.Errorf("%s expect not compressed, acture:<%s>", c.uri, encoding)
+		}
+
+		if len(ctx.Response.Body()) != c.size {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.uri, c.size, len(ctx.Response.Body()))
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+const (
+	varClientIP = "client_ip"
+	varHost     = "host"
+	varMethod   = "method"
+	varPath     = "path"
+)
+
+type headerSetter interface {
+	Peek(key string) []byte
+	Set(key, value string)
+	Del(key string)
+}
+
+// HeaderRulesFilter change the request headers in pre filters and the response headers in post filters
+// by the header rules of node.
+type HeaderRulesFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newHeaderRulesFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return HeaderRulesFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f HeaderRulesFilter) Name() string {
+	return FilterHeaderRules
+}
+
+// Pre execute before proxy
+func (f HeaderRulesFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if nil != c.result.Node && nil != c.result.Node.RequestHeaders {
+		applyHeaderRules(c, c.result.Node.RequestHeaders, &c.outreq.Header)
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// Post execute after proxy
+func (f HeaderRulesFilter) Post(c *FilterContext) (statusCode int, err error) {
+	if nil != c.result.Node && nil != c.result.Node.ResponseHeaders {
+		// the response headers may be copied to the client response already by head filter,
+		// the merge response headers are copied by the handler
+		applyHeaderRules(c, c.result.Node.ResponseHeaders, &c.result.Res.Header)
+		if !c.result.Merge {
+			applyHeaderRules(c, c.result.Node.ResponseHeaders, &c.ctx.Response.Header)
+		}
+	}
+
+	return f.BaseFilter.Post(c)
+}
+
+func applyHeaderRules(c *FilterContext, rules *model.HeaderRules, header headerSetter) {
+	for _, name := range rules.Remove {
+		header.Del(name)
+	}
+
+	for from, to := range rules.Rename {
+		if value := header.Peek(from); len(value) > 0 {
+			v := string(value)
+			header.Del(from)
+			header.Set(to, v)
+		}
+	}
+
+	for name, value := range rules.Add {
+		header.Set(name, expandVars(c, value))
+	}
+
+	for name, value := range rules.AddIfAbsent {
+		if len(header.Peek(name)) == 0 {
+			header.Set(name, expandVars(c, value))
+		}
+	}
+}
+
+// expandVars replace ${var} in value by the built-in vars and the runtime vars
+func expandVars(c *FilterContext, value string) string {
+	if !strings.Contains(value, "${") {
+		return value
+	}
+
+	buf := bytes.Buffer{}
+	for {
+		start := strings.Index(value, "${")
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			break
+		}
+
+		buf.WriteString(value[:start])
+		buf.WriteString(getVar(c, value[start+2:start+end]))
+		value = value[start+end+1:]
+	}
+
+	buf.WriteString(value)
+	return buf.String()
+}
+
+func getVar(c *FilterContext, name string) string {
+	switch name {
+	case varClientIP:
+		return c.runtimeVar[clientIPRuntimeVar]
+	case varHost:
+		return string(c.Request().Host())
+	case varMethod:
+		return string(c.Request().Header.Method())
+	case varPath:
+		return string(c.Request().URI().Path())
+	default:
+		return c.runtimeVar[name]
+	}
+}
@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func TestHeaderRulesFilter(t *testing.T) {
+	var received http.Header
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Header().Set("X-Internal", "secret")
+		w.Header().Set("X-Backend-Version", "v1")
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterHeaderRules)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/api",
+			RequestHeaders: &model.HeaderRules{
+				Add: map[string]string{
+					"X-Client-Ip": "${client_ip}",
+					"X-Trace":     "id-${request.id}",
+				},
+				Remove: []string{"X-Debug"},
+				Rename: map[string]string{"X-Token": "X-Upstream-Token"},
+			},
+			ResponseHeaders: &model.HeaderRules{
+				Add:    map[string]string{"X-Served-By": "gateway"},
+				Remove: []string{"X-Internal"},
+				Rename: map[string]string{"X-Backend-Version": "X-Version"},
+			},
+		},
+	}))
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/api")
+	req.Header.SetHost("gateway")
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("X-Token", "token")
+	req.Header.Set(headerXRequestID, "abc")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+	p.ReverseProxyHandler(ctx)
+
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	if value := received.Get("X-Client-Ip"); value != ctx.RemoteIP().String() {
+		t.Errorf("expect:<%s>, acture:<%s>", ctx.RemoteIP().String(), value)
+	}
+
+	if value := received.Get("X-Trace"); value != "id-abc" {
+		t.Errorf("expect:<id-abc>, acture:<%s>", value)
+	}
+
+	if value := received.Get("X-Debug"); value != "" {
+		t.Errorf("expect:<>, acture:<%s>", value)
+	}
+
+	if value := received.Get("X-Token"); value != "" {
+		t.Errorf("expect:<>, acture:<%s>", value)
+	}
+
+	if value := received.Get("X-Upstream-Token"); value != "token" {
+		t.Errorf("expect:<token>, acture:<%s>", value)
+	}
+
+	header := &ctx.Response.Header
+	if value := string(header.Peek("X-Served-By")); value != "gateway" {
+		t.Errorf("expect:<gateway>, acture:<%s>", value)
+	}
+
+	if value := string(header.Peek("X-Internal")); value != "" {
+		t.Errorf("expect:<>, acture:<%s>", value)
+	}
+
+	if value := string(header.Peek("X-Backend-Version")); value != "" {
+		t.Errorf("expect:<>, acture:<%s>", value)
+	}
+
+	if value := string(header.Peek("X-Version")); value != "v1" {
+		t.Errorf("expect:<v1>, acture:<%s>", value)
+	}
+}
+
+func TestExpandVars(t *testing.T) {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&fasthttp.Request{}, nil, nil)
+
+	c := &FilterContext{
+		ctx:        ctx,
+		runtimeVar: map[string]string{"jwt.sub": "user"},
+	}
+
+	cases := map[string]string{
+		"static":            "static",
+		"${jwt.sub}":        "user",
+		"a-${jwt.sub}-b":    "a-user-b",
+		"${unknown}":        "",
+		"${jwt.sub}${path}": "user/",
+		"${unclosed":        "${unclosed",
+		"$5":                "$5",
+	}
+
+	for value, expect := range cases {
+		if acture := expandVars(c, value); acture != expect {
+			t.Errorf("expect:<%s>, acture:<%s>", expect, acture)
+		}
+	}
+}
+
+func TestHeaderRulesAddIfAbsent(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cache") != "" {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Surrogate-Control", "max-age=10")
+		}
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterHeaderRules)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/static", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			ResponseHeaders: &model.HeaderRules{
+				Add:         map[string]string{"Cache-Control": "public, max-age=60"},
+				AddIfAbsent: map[string]string{"Surrogate-Control": "max-age=3600"},
+			},
+		},
+	}))
+
+	cases := []struct {
+		uri       string
+		surrogate string
+	}{
+		// the upstream header is kept
+		{uri: "/static/app.js?cache=1", surrogate: "max-age=10"},
+		// the absent header is filled
+		{uri: "/static/app.js", surrogate: "max-age=3600"},
+	}
+
+	for _, c := range cases {
+		ctx := doTestRequest(p, "GET", c.uri)
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Fatalf("%s expect:<%d>, acture:<%d>", c.uri, http.StatusOK, ctx.Response.StatusCode())
+		}
+
+		// the upstream header is overridden
+		if value := string(ctx.Response.Header.Peek("Cache-Control")); value != "public, max-age=60" {
+			t.Errorf("%s expect:<public, max-age=60>, acture:<%s>", c.uri, value)
+		}
+
+		if value := string(ctx.Response.Header.Peek("Surrogate-Control")); value != c.surrogate {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.uri, c.surrogate, value)
+		}
+	}
+}
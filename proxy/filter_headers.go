@@ -1,25 +1,34 @@
 package proxy
 
 import (
+	"net/http"
+	"strings"
+
 	"github.com/fagongzi/gateway/conf"
 )
 
-// Hop-by-hop headers. These are removed when sent to the backend.
-// http://www.w3.org/Protocols/rfc2616/rfc2616-sec13.html
+// Hop-by-hop headers. These are removed when sent to the backend and the client.
+// https://tools.ietf.org/html/rfc7230#section-6.1
 var hopHeaders = []string{
 	"Connection",
 	"Keep-Alive",
 	"Proxy-Authenticate",
 	"Proxy-Authorization",
 	"Te", // canonicalized version of "TE"
-	"Trailers",
+	"Trailer",
 	"Transfer-Encoding",
 	"Upgrade",
 }
 
+// the websocket handshake need these hop-by-hop headers
+var upgradeHeaders = map[string]bool{
+	"Connection": true,
+	"Upgrade":    true,
+}
+
 // HeadersFilter HeadersFilter
 type HeadersFilter struct {
-	baseFilter
+	BaseFilter
 	config *conf.Conf
 	proxy  *Proxy
 }
@@ -37,19 +46,14 @@ func (f HeadersFilter) Name() string {
 }
 
 // Pre execute before proxy
-func (f HeadersFilter) Pre(c *filterContext) (statusCode int, err error) {
-	for _, h := range hopHeaders {
-		c.outreq.Header.Del(h)
-	}
-
-	return f.baseFilter.Pre(c)
+func (f HeadersFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	f.removeHopHeaders(&c.outreq.Header, c.webSocket)
+	return f.BaseFilter.Pre(c)
 }
 
 // Post execute after proxy
-func (f HeadersFilter) Post(c *filterContext) (statusCode int, err error) {
-	for _, h := range hopHeaders {
-		c.result.Res.Header.Del(h)
-	}
+func (f HeadersFilter) Post(c *FilterContext) (statusCode int, err error) {
+	f.removeHopHeaders(&c.result.Res.Header, c.webSocket)
 
 	// 需要合并处理的，不做header的复制，由proxy做合并
 	if !c.result.Merge {
@@ -57,5 +61,37 @@ func (f HeadersFilter) Post(c *filterContext) (statusCode int, err error) {
 		c.result.Res.Header.CopyTo(&c.ctx.Response.Header)
 	}
 
-	return f.baseFilter.Post(c)
+	return f.BaseFilter.Post(c)
+}
+
+type hopHeaderRemover interface {
+	Del(key string)
+	VisitAll(f func(key, value []byte))
+}
+
+// removeHopHeaders remove the hop-by-hop headers, the configured headers and the headers listed in the Connection header,
+// the Connection and Upgrade headers of websocket are kept for the handshake
+func (f HeadersFilter) removeHopHeaders(header hopHeaderRemover, websocket bool) {
+	var names []string
+	header.VisitAll(func(key, value []byte) {
+		if "Connection" != string(key) {
+			return
+		}
+
+		for _, name := range strings.Split(string(value), ",") {
+			if name = strings.TrimSpace(name); "" != name {
+				names = append(names, name)
+			}
+		}
+	})
+
+	names = append(names, f.config.HopHeaders...)
+	names = append(names, hopHeaders...)
+	for _, name := range names {
+		if websocket && upgradeHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+
+		header.Del(name)
+	}
 }
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestHeadersFilterRemoveHopHeaders(t *testing.T) {
+	var received http.Header
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Header().Set("Connection", "X-Backend-Hop")
+		w.Header().Set("X-Backend-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("Proxy-Authenticate", "Basic")
+		w.Header().Set("X-Backend-Extra", "1")
+		w.Header().Set("X-Backend-Version", "v1")
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.HopHeaders = []string{"X-Client-Extra", "X-Backend-Extra"}
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterHeader)
+
+	req := &fasthttp.Request{}
+	req.Header.SetMethod("GET")
+	req.SetRequestURI("/")
+	req.Header.SetHost("gateway")
+	req.Header.Set("Connection", "X-Client-Hop, keep-alive")
+	req.Header.Set("X-Client-Hop", "1")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("Trailer", "X-Checksum")
+	req.Header.Set("Proxy-Authorization", "Basic")
+	req.Header.Set("X-Client-Extra", "1")
+	req.Header.Set("X-Client-Version", "v1")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+	p.ReverseProxyHandler(ctx)
+
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	for _, h := range []string{"X-Client-Hop", "Keep-Alive", "Te", "Trailer", "Proxy-Authorization", "X-Client-Extra"} {
+		if value := received.Get(h); value != "" {
+			t.Errorf("%s expect removed from request, acture:<%s>", h, value)
+		}
+	}
+
+	if value := received.Get("X-Client-Version"); value != "v1" {
+		t.Errorf("expect:<v1>, acture:<%s>", value)
+	}
+
+	for _, h := range []string{"Connection", "X-Backend-Hop", "Keep-Alive", "Proxy-Authenticate", "X-Backend-Extra"} {
+		if value := ctx.Response.Header.Peek(h); len(value) > 0 {
+			t.Errorf("%s expect removed from response, acture:<%s>", h, value)
+		}
+	}
+
+	if value := string(ctx.Response.Header.Peek("X-Backend-Version")); value != "v1" {
+		t.Errorf("expect:<v1>, acture:<%s>", value)
+	}
+}
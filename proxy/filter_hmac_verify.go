@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+)
+
+const (
+	defaultHMACSignatureHeader = "X-Signature"
+	defaultHMACTimestampHeader = "X-Timestamp"
+	defaultHMACTolerance       = 300
+)
+
+var (
+	hmacSignaturePrefix = []byte("sha256=")
+)
+
+var (
+	// ErrHMACMissing the request has no signature or timestamp
+	ErrHMACMissing = errors.New("missing hmac signature")
+	// ErrHMACInvalid the signature is not matched
+	ErrHMACInvalid = errors.New("invalid hmac signature")
+	// ErrHMACStale the timestamp is out of the tolerance
+	ErrHMACStale = errors.New("stale hmac timestamp")
+)
+
+// HMACVerifyFilter verify the HMAC-SHA256 signature of the request method, uri, timestamp and body,
+// the request out of the timestamp tolerance is rejected to prevent the replay attacks.
+type HMACVerifyFilter struct {
+	BaseFilter
+	config          *conf.Conf
+	proxy           *Proxy
+	secret          []byte
+	signatureHeader string
+	timestampHeader string
+	tolerance       time.Duration
+}
+
+func newHMACVerifyFilter(config *conf.Conf, proxy *Proxy) Filter {
+	f := HMACVerifyFilter{
+		config:          config,
+		proxy:           proxy,
+		secret:          []byte(config.HMACSecret),
+		signatureHeader: config.HMACSignatureHeader,
+		timestampHeader: config.HMACTimestampHeader,
+		tolerance:       time.Duration(config.HMACTolerance) * time.Second,
+	}
+
+	if "" == f.signatureHeader {
+		f.signatureHeader = defaultHMACSignatureHeader
+	}
+
+	if "" == f.timestampHeader {
+		f.timestampHeader = defaultHMACTimestampHeader
+	}
+
+	if f.tolerance <= 0 {
+		f.tolerance = defaultHMACTolerance * time.Second
+	}
+
+	return f
+}
+
+// Name return name of this filter
+func (f HMACVerifyFilter) Name() string {
+	return FilterHMACVerify
+}
+
+// Pre execute before proxy
+func (f HMACVerifyFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	req := c.Request()
+	signature := bytes.TrimPrefix(req.Header.Peek(f.signatureHeader), hmacSignaturePrefix)
+	timestamp := req.Header.Peek(f.timestampHeader)
+	if len(signature) == 0 || len(timestamp) == 0 {
+		return http.StatusUnauthorized, ErrHMACMissing
+	}
+
+	sec, err := strconv.ParseInt(string(timestamp), 10, 64)
+	if nil != err {
+		return http.StatusUnauthorized, ErrHMACInvalid
+	}
+
+	if diff := time.Since(time.Unix(sec, 0)); diff > f.tolerance || diff < -f.tolerance {
+		return http.StatusUnauthorized, ErrHMACStale
+	}
+
+	expect, err := hex.DecodeString(string(signature))
+	if nil != err || !hmac.Equal(expect, f.sign(req.Header.Method(), req.Header.RequestURI(), timestamp, req.Body())) {
+		return http.StatusUnauthorized, ErrHMACInvalid
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// sign returns the HMAC-SHA256 of "<method>\n<request uri>\n<timestamp>\n<body>", the request uri is the path
+// and the query string sent by client, so the signature of a request is not valid for another one.
+// The body is read without consuming.
+func (f HMACVerifyFilter) sign(method, requestURI, timestamp, body []byte) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	for _, value := range [][]byte{method, requestURI, timestamp} {
+		mac.Write(value)
+		mac.Write([]byte("\n"))
+	}
+	mac.Write(body)
+	return mac.Sum(nil)
+}
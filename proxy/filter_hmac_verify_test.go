@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func testHMACSignature(secret, timestamp, body string) string {
+	return testHMACRequestSignature(secret, "POST", "/webhook", timestamp, body)
+}
+
+func testHMACRequestSignature(secret, method, uri, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + uri + "\n" + timestamp + "\n" + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHMACVerifyFilter(t *testing.T) {
+	var received string
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.HMACSecret = "webhook-secret"
+	cnf.HMACTolerance = 60
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterHMACVerify)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	body := `{"event":"paid"}`
+
+	cases := []struct {
+		uri       string
+		timestamp string
+		signature string
+		body      string
+		code      int
+	}{
+		{timestamp: now, signature: testHMACSignature("webhook-secret", now, body), body: body, code: http.StatusOK},
+		{timestamp: now, signature: "sha256=" + testHMACSignature("webhook-secret", now, body), body: body, code: http.StatusOK},
+		// the tampered body
+		{timestamp: now, signature: testHMACSignature("webhook-secret", now, body), body: `{"event":"refund"}`, code: http.StatusUnauthorized},
+		// the wrong secret
+		{timestamp: now, signature: testHMACSignature("other", now, body), body: body, code: http.StatusUnauthorized},
+		// the replayed request
+		{timestamp: stale, signature: testHMACSignature("webhook-secret", stale, body), body: body, code: http.StatusUnauthorized},
+		{timestamp: now, body: body, code: http.StatusUnauthorized},
+		{uri: "/webhook?id=1", timestamp: now, signature: testHMACRequestSignature("webhook-secret", "POST", "/webhook?id=1", now, body), body: body, code: http.StatusOK},
+		// the signature of another path or query
+		{uri: "/admin", timestamp: now, signature: testHMACSignature("webhook-secret", now, body), body: body, code: http.StatusUnauthorized},
+		{uri: "/webhook?id=2", timestamp: now, signature: testHMACRequestSignature("webhook-secret", "POST", "/webhook?id=1", now, body), body: body, code: http.StatusUnauthorized},
+	}
+
+	for i, c := range cases {
+		received = ""
+
+		uri := c.uri
+		if "" == uri {
+			uri = "/webhook"
+		}
+
+		req := &fasthttp.Request{}
+		req.Header.SetMethod("POST")
+		req.SetRequestURI(uri)
+		req.Header.SetHost("gateway")
+		req.Header.Set(defaultHMACTimestampHeader, c.timestamp)
+		if "" != c.signature {
+			req.Header.Set(defaultHMACSignatureHeader, c.signature)
+		}
+		req.SetBodyString(c.body)
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, nil, nil)
+		p.ReverseProxyHandler(ctx)
+
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%d expect:<%d>, acture:<%d>", i, c.code, ctx.Response.StatusCode())
+		}
+
+		// the verified body is forwarded
+		if http.StatusOK == c.code && received != c.body {
+			t.Errorf("%d expect:<%s>, acture:<%s>", i, c.body, received)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerIdempotencyKey      = "Idempotency-Key"
+	headerIdempotentReplayed  = "Idempotent-Replayed"
+	defaultIdempotencyTTL     = 3600
+	defaultIdempotencyMaxSize = 64 * 1024 * 1024
+)
+
+var (
+	defaultIdempotencyMethods = []string{"POST", "PATCH"}
+)
+
+// IdempotencyFilter replay the first response of the Idempotency-Key for the ttl, the key is scoped by the cluster,
+// method and uri. The concurrent duplicates wait for the in-flight request of the key.
+// The failed responses are not stored, so the client can retry them.
+type IdempotencyFilter struct {
+	BaseFilter
+	config  *conf.Conf
+	proxy   *Proxy
+	ttl     time.Duration
+	methods map[string]bool
+	cache   *responseCache
+	flights *responseFlights
+}
+
+func newIdempotencyFilter(config *conf.Conf, proxy *Proxy) Filter {
+	f := IdempotencyFilter{
+		config:  config,
+		proxy:   proxy,
+		ttl:     time.Duration(config.IdempotencyTTL) * time.Second,
+		methods: make(map[string]bool),
+		flights: newResponseFlights(),
+	}
+
+	if f.ttl <= 0 {
+		f.ttl = defaultIdempotencyTTL * time.Second
+	}
+
+	methods := config.IdempotencyMethods
+	if len(methods) == 0 {
+		methods = defaultIdempotencyMethods
+	}
+	for _, method := range methods {
+		f.methods[strings.ToUpper(method)] = true
+	}
+
+	maxSize := config.IdempotencyMaxSize
+	if maxSize <= 0 {
+		maxSize = defaultIdempotencyMaxSize
+	}
+	f.cache = newResponseCache(maxSize)
+
+	return f
+}
+
+// Name return name of this filter
+func (f IdempotencyFilter) Name() string {
+	return FilterIdempotency
+}
+
+// Pre execute before proxy
+func (f IdempotencyFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	req := c.Request()
+	if !f.methods[string(req.Header.Method())] || len(req.Header.Peek(headerIdempotencyKey)) == 0 {
+		return f.BaseFilter.Pre(c)
+	}
+
+	key := getRequestKey(c, []string{headerIdempotencyKey})
+	if f.replay(c, f.cache.get(key, time.Now())) {
+		return http.StatusOK, errResponded
+	}
+
+	flight, leader := f.flights.join(key)
+	if leader {
+		c.OnDone(func() {
+			res := getIdempotentResponse(c.result)
+			if nil != res {
+				f.cache.put(key, res, time.Now().Add(f.ttl))
+			}
+			f.flights.leave(key, res)
+		})
+		return f.BaseFilter.Pre(c)
+	}
+
+	timeout := time.NewTimer(getWaitTimeout(f.config, c))
+	defer timeout.Stop()
+
+	select {
+	case <-flight.done:
+		if nil != flight.res {
+			res := fasthttp.AcquireResponse()
+			flight.res.CopyTo(res)
+			f.replay(c, res)
+			return http.StatusOK, errResponded
+		}
+	case <-timeout.C:
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// replay set the stored response to the result, returns false if there is no response
+func (f IdempotencyFilter) replay(c *FilterContext, res *fasthttp.Response) bool {
+	if nil == res {
+		return false
+	}
+
+	res.Header.Set(headerIdempotentReplayed, "true")
+	c.result.Res = res
+	return true
+}
+
+// getIdempotentResponse returns the response of result to store, nil if the result is failed, streaming or 5xx
+func getIdempotentResponse(result *model.RouteResult) *fasthttp.Response {
+	res := getSharedResponse(result)
+	if nil == res || res.StatusCode() >= fasthttp.StatusInternalServerError {
+		return nil
+	}
+
+	return res
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func doTestIdempotencyRequest(p *Proxy, method, uri, key string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.Header.SetMethod(method)
+	req.SetRequestURI(uri)
+	req.Header.SetHost("gateway")
+	if "" != key {
+		req.Header.Set(headerIdempotencyKey, key)
+	}
+	req.SetBodyString(`{"amount":100}`)
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+	p.ReverseProxyHandler(ctx)
+
+	return ctx
+}
+
+func TestIdempotencyFilterReplay(t *testing.T) {
+	var orders int32
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "order-%d", atomic.AddInt32(&orders, 1))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterIdempotency)
+
+	cases := []struct {
+		method   string
+		uri      string
+		key      string
+		body     string
+		replayed bool
+	}{
+		{method: "POST", uri: "/orders", key: "k1", body: "order-1"},
+		// the replayed response of the same key
+		{method: "POST", uri: "/orders", key: "k1", body: "order-1", replayed: true},
+		{method: "POST", uri: "/orders", key: "k2", body: "order-2"},
+		// the same key of the other route
+		{method: "POST", uri: "/payments", key: "k1", body: "order-3"},
+		// the request without key and the method not configured
+		{method: "POST", uri: "/orders", body: "order-4"},
+		{method: "PUT", uri: "/orders", key: "k1", body: "order-5"},
+	}
+
+	for _, c := range cases {
+		ctx := doTestIdempotencyRequest(p, c.method, c.uri, c.key)
+		if ctx.Response.StatusCode() != http.StatusCreated || string(ctx.Response.Body()) != c.body {
+			t.Errorf("%s %s <%s> expect:<%d %s>, acture:<%d %s>", c.method, c.uri, c.key,
+				http.StatusCreated, c.body, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+
+		if replayed := len(ctx.Response.Header.Peek(headerIdempotentReplayed)) > 0; replayed != c.replayed {
+			t.Errorf("%s %s <%s> expect replayed:<%v>, acture:<%v>", c.method, c.uri, c.key, c.replayed, replayed)
+		}
+	}
+
+	// the failed responses are not stored
+	doTestIdempotencyRequest(p, "POST", "/fail", "k3")
+	doTestIdempotencyRequest(p, "POST", "/fail", "k3")
+	if requests := atomic.LoadInt32(&backend.requests); requests != 7 {
+		t.Errorf("expect:<7>, acture:<%d>", requests)
+	}
+}
+
+func TestIdempotencyFilterConcurrent(t *testing.T) {
+	var orders int32
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(w, "order-%d", atomic.AddInt32(&orders, 1))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterIdempotency)
+
+	n := 20
+	ctxs := make([]*fasthttp.RequestCtx, n)
+	wg := &sync.WaitGroup{}
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			ctxs[i] = doTestIdempotencyRequest(p, "POST", "/orders", "k1")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, ctx := range ctxs {
+		if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != "order-1" {
+			t.Errorf("expect:<%d order-1>, acture:<%d %s>", http.StatusOK, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+)
+
+var (
+	// ErrIPBlocked the client ip is denied by ip filter
+	ErrIPBlocked = errors.New("client ip blocked")
+)
+
+// IPFilterFilter reject the clients by the CIDR allowlist and denylist of node before proxy
+type IPFilterFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newIPFilterFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return IPFilterFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f IPFilterFilter) Name() string {
+	return FilterIPFilter
+}
+
+// Pre execute before proxy
+func (f IPFilterFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if nil == c.result.Node || nil == c.result.Node.IPFilter {
+		return f.BaseFilter.Pre(c)
+	}
+
+	ip := c.runtimeVar[clientIPRuntimeVar]
+	if c.result.Node.IPFilter.TrustXForwardedFor {
+		if forwarded := firstForwardedIP(c.Request().Header.Peek(headerXForwardedFor)); "" != forwarded {
+			ip = forwarded
+		}
+	}
+
+	if !c.result.Node.IPFilter.Allowed(ip) {
+		log.Infof("[%s] Client ip <%s> blocked by node <%s>", c.runtimeVar[requestIDRuntimeVar], ip, c.result.Node.URL)
+		return http.StatusForbidden, ErrIPBlocked
+	}
+
+	return f.BaseFilter.Pre(c)
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func doTestIPFilterRequest(p *Proxy, uri string, remoteIP string, xff string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.SetRequestURI(uri)
+	req.Header.SetHost("gateway")
+	if "" != xff {
+		req.Header.Set(headerXForwardedFor, xff)
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, &net.TCPAddr{IP: net.ParseIP(remoteIP), Port: 10000}, nil)
+
+	p.ReverseProxyHandler(ctx)
+
+	return ctx
+}
+
+func TestIPFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterIPFilter)
+
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/admin$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/admin", IPFilter: &model.IPFilter{
+			Allow: []string{"10.0.0.0/8", "fd00::/8"},
+			Deny:  []string{"10.0.0.1", "fd00::1"},
+		}},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/xff$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/xff", IPFilter: &model.IPFilter{
+			Deny:               []string{"192.168.0.0/16"},
+			TrustXForwardedFor: true,
+		}},
+	}))
+
+	cases := []struct {
+		uri    string
+		ip     string
+		xff    string
+		expect int
+	}{
+		{uri: "/admin", ip: "10.1.2.3", expect: http.StatusOK},
+		{uri: "/admin", ip: "fd00::2", expect: http.StatusOK},
+		{uri: "/admin", ip: "10.0.0.1", expect: http.StatusForbidden},
+		{uri: "/admin", ip: "fd00::1", expect: http.StatusForbidden},
+		{uri: "/admin", ip: "172.16.0.1", expect: http.StatusForbidden},
+		{uri: "/admin", ip: "2001:db8::1", expect: http.StatusForbidden},
+		// the X-Forwarded-For is not trusted
+		{uri: "/admin", ip: "172.16.0.1", xff: "10.1.2.3", expect: http.StatusForbidden},
+		{uri: "/xff", ip: "10.1.2.3", xff: "192.168.1.1, 10.1.2.3", expect: http.StatusForbidden},
+		{uri: "/xff", ip: "192.168.1.1", xff: "10.1.2.3", expect: http.StatusOK},
+		{uri: "/xff", ip: "192.168.1.1", expect: http.StatusForbidden},
+	}
+
+	for _, c := range cases {
+		ctx := doTestIPFilterRequest(p, c.uri, c.ip, c.xff)
+		if ctx.Response.StatusCode() != c.expect {
+			t.Errorf("%s %s %s expect:<%d>, acture:<%d>", c.uri, c.ip, c.xff, c.expect, ctx.Response.StatusCode())
+		}
+	}
+
+	if requests := int(backend.requests); requests != 3 {
+		t.Errorf("expect:<%d>, acture:<%d>", 3, requests)
+	}
+
+	err := p.routeTable.AddNewAggregation(model.NewAggregation("^/invalid$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, IPFilter: &model.IPFilter{Allow: []string{"10.0.0.0/33"}}},
+	}))
+	if model.ErrInvalidCIDR != err {
+		t.Errorf("expect:<%s>, acture:<%v>", model.ErrInvalidCIDR, err)
+	}
+}
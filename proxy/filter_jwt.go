@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/fagongzi/gateway/conf"
+)
+
+const (
+	headerAuthorization = "Authorization"
+	jwtRuntimeVarPrefix = "jwt."
+)
+
+var (
+	bearerPrefix = []byte("Bearer ")
+)
+
+var (
+	// ErrJWTMissing the request has no bearer token
+	ErrJWTMissing = errors.New("missing jwt")
+	// ErrJWTInvalid the bearer token is invalid
+	ErrJWTInvalid = errors.New("invalid jwt")
+	// ErrJWTUnsupportedMethod the signing method of token is not configured
+	ErrJWTUnsupportedMethod = errors.New("unsupported jwt signing method")
+)
+
+// JWTFilter validate the bearer token by the HMAC secret or RSA public key,
+// the claims configured are copied to the runtime vars.
+type JWTFilter struct {
+	BaseFilter
+	config    *conf.Conf
+	proxy     *Proxy
+	secret    []byte
+	publicKey *rsa.PublicKey
+}
+
+func newJWTFilter(config *conf.Conf, proxy *Proxy) Filter {
+	f := JWTFilter{
+		config: config,
+		proxy:  proxy,
+	}
+
+	if "" != config.JWTSecret {
+		f.secret = []byte(config.JWTSecret)
+	}
+
+	if "" != config.JWTPublicKeyFile {
+		data, err := ioutil.ReadFile(config.JWTPublicKeyFile)
+		if nil != err {
+			log.PanicErrorf(err, "JWT read public key <%s> fail", config.JWTPublicKeyFile)
+		}
+
+		f.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+		if nil != err {
+			log.PanicErrorf(err, "JWT parse public key <%s> fail", config.JWTPublicKeyFile)
+		}
+	}
+
+	return f
+}
+
+// Name return name of this filter
+func (f JWTFilter) Name() string {
+	return FilterJWT
+}
+
+// Pre execute before proxy
+func (f JWTFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	// the claim headers supplied by client are untrusted
+	f.removeClaimHeaders(c)
+
+	if f.skip(c) {
+		return f.BaseFilter.Pre(c)
+	}
+
+	authorization := c.Request().Header.Peek(headerAuthorization)
+	if !bytes.HasPrefix(authorization, bearerPrefix) {
+		return http.StatusUnauthorized, ErrJWTMissing
+	}
+
+	token, err := jwt.Parse(string(authorization[len(bearerPrefix):]), f.getKey)
+	if nil != err || !token.Valid {
+		log.InfoErrorf(err, "JWT validate fail")
+		return http.StatusUnauthorized, ErrJWTInvalid
+	}
+
+	for _, name := range f.config.JWTClaims {
+		if value, ok := token.Claims[name]; ok {
+			c.runtimeVar[jwtRuntimeVarPrefix+name] = claimString(value)
+		}
+	}
+
+	if nil != c.result.Node {
+		for name, header := range c.result.Node.ClaimHeaders {
+			if value, ok := token.Claims[name]; ok {
+				c.runtimeVar[jwtRuntimeVarPrefix+name] = claimString(value)
+			}
+
+			if value, ok := c.runtimeVar[jwtRuntimeVarPrefix+name]; ok {
+				c.outreq.Header.Set(header, value)
+			}
+		}
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+func (f JWTFilter) removeClaimHeaders(c *FilterContext) {
+	if nil == c.result.Node {
+		return
+	}
+
+	for _, header := range c.result.Node.ClaimHeaders {
+		c.outreq.Header.Del(header)
+	}
+}
+
+func (f JWTFilter) skip(c *FilterContext) bool {
+	path := getRoutePath(c.ctx)
+	for _, prefix := range f.config.JWTSkipPaths {
+		if hasPathPrefix(path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasPathPrefix returns true if the path is the prefix or under it, the prefix is matched on the segment boundary,
+// e.g. /public matches /public and /public/index.html but not /publicity
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func (f JWTFilter) getKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if nil != f.secret {
+			return f.secret, nil
+		}
+	case *jwt.SigningMethodRSA:
+		if nil != f.publicKey {
+			return f.publicKey, nil
+		}
+	}
+
+	return nil, ErrJWTUnsupportedMethod
+}
+
+func claimString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	testJWTSecret = "secret"
+)
+
+func newTestToken(t *testing.T, method jwt.SigningMethod, key interface{}, claims map[string]interface{}) string {
+	token := jwt.New(method)
+	for k, v := range claims {
+		token.Claims[k] = v
+	}
+
+	value, err := token.SignedString(key)
+	if nil != err {
+		t.Fatalf("sign token err: %s", err)
+	}
+
+	return value
+}
+
+func doTestJWTRequest(p *Proxy, uri string, token string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.SetRequestURI(uri)
+	req.Header.SetHost("gateway")
+	if "" != token {
+		req.Header.Set(headerAuthorization, "Bearer "+token)
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+
+	p.ReverseProxyHandler(ctx)
+
+	return ctx
+}
+
+func TestJWTFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.JWTSecret = testJWTSecret
+	cnf.JWTSkipPaths = []string{"/public/"}
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterJWT)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/open$", []*model.Node{
+		&model.Node{
+			ClusterName:     testClusterName,
+			URL:             "/open",
+			DisabledFilters: []string{FilterJWT},
+		},
+	}))
+
+	now := time.Now().Unix()
+	cases := []struct {
+		name  string
+		uri   string
+		token string
+		code  int
+	}{
+		{name: "valid", uri: "/api", code: http.StatusOK,
+			token: newTestToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), map[string]interface{}{"exp": now + 60})},
+		{name: "expired", uri: "/api", code: http.StatusUnauthorized,
+			token: newTestToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), map[string]interface{}{"exp": now - 60})},
+		{name: "not before", uri: "/api", code: http.StatusUnauthorized,
+			token: newTestToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), map[string]interface{}{"nbf": now + 60})},
+		{name: "wrong secret", uri: "/api", code: http.StatusUnauthorized,
+			token: newTestToken(t, jwt.SigningMethodHS256, []byte("wrong"), nil)},
+		{name: "malformed", uri: "/api", code: http.StatusUnauthorized, token: "malformed.token"},
+		{name: "missing", uri: "/api", code: http.StatusUnauthorized},
+		{name: "skip path", uri: "/public/index.html", code: http.StatusOK},
+		{name: "skip path boundary", uri: "/publicity", code: http.StatusUnauthorized},
+		{name: "disabled node", uri: "/open", code: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		ctx := doTestJWTRequest(p, c.uri, c.token)
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.name, c.code, ctx.Response.StatusCode())
+		}
+	}
+}
+
+func TestJWTFilterWithRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if nil != err {
+		t.Fatalf("generate key err: %s", err)
+	}
+
+	data, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if nil != err {
+		t.Fatalf("marshal public key err: %s", err)
+	}
+
+	file, err := ioutil.TempFile("", "jwt")
+	if nil != err {
+		t.Fatalf("create file err: %s", err)
+	}
+	defer os.Remove(file.Name())
+
+	pem.Encode(file, &pem.Block{Type: "PUBLIC KEY", Bytes: data})
+	file.Close()
+
+	cnf := newTestConf()
+	cnf.JWTPublicKeyFile = file.Name()
+	cnf.JWTClaims = []string{"sub", "uid"}
+	f := newJWTFilter(cnf, nil)
+
+	token := newTestToken(t, jwt.SigningMethodRS256, key, map[string]interface{}{"sub": "user", "uid": 10})
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.Header.Set(headerAuthorization, "Bearer "+token)
+	c := &FilterContext{
+		ctx:        ctx,
+		result:     &model.RouteResult{},
+		runtimeVar: make(map[string]string),
+	}
+
+	if code, err := f.Pre(c); nil != err {
+		t.Fatalf("expect:<%d>, acture:<%d>, err:<%s>", http.StatusOK, code, err)
+	}
+
+	if c.runtimeVar["jwt.sub"] != "user" || c.runtimeVar["jwt.uid"] != "10" {
+		t.Errorf("expect:<user,10>, acture:<%s,%s>", c.runtimeVar["jwt.sub"], c.runtimeVar["jwt.uid"])
+	}
+
+	// the HMAC secret is not configured
+	ctx.Request.Header.Set(headerAuthorization, "Bearer "+newTestToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), nil))
+	if code, _ := f.Pre(c); code != http.StatusUnauthorized {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusUnauthorized, code)
+	}
+}
+
+func TestJWTFilterWithClaimHeaders(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-User-Id")))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.JWTSecret = testJWTSecret
+	cnf.JWTSkipPaths = []string{"/public"}
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterJWT)
+
+	for _, uri := range []string{"/api", "/public"} {
+		p.routeTable.AddNewAggregation(model.NewAggregation("^"+uri+"$", []*model.Node{
+			&model.Node{
+				ClusterName:  testClusterName,
+				URL:          uri,
+				ClaimHeaders: map[string]string{"sub": "X-User-Id"},
+			},
+		}))
+	}
+
+	token := newTestToken(t, jwt.SigningMethodHS256, []byte(testJWTSecret), map[string]interface{}{"sub": "user"})
+	cases := []struct {
+		uri   string
+		token string
+		value string
+	}{
+		{uri: "/api", token: token, value: "user"},
+		{uri: "/public", value: ""},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		req.SetRequestURI(c.uri)
+		req.Header.SetHost("gateway")
+		req.Header.Set("X-User-Id", "spoofed")
+		if "" != c.token {
+			req.Header.Set(headerAuthorization, "Bearer "+c.token)
+		}
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, nil, nil)
+		p.ReverseProxyHandler(ctx)
+
+		if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != c.value {
+			t.Errorf("%s expect:<%s>, acture:<%d,%s>", c.uri, c.value, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fagongzi/gateway/conf"
+)
+
+var (
+	// ErrResponseBodyTooLarge response body of backend server is too large
+	ErrResponseBodyTooLarge = errors.New("response body too large")
+)
+
+// MaxBodyFilter abort the request if the response body of backend server is too large.
+// The limit works on reading the response, so the large body is never buffered.
+type MaxBodyFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newMaxBodyFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return MaxBodyFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f MaxBodyFilter) Name() string {
+	return FilterMaxBody
+}
+
+// Pre execute before proxy
+func (f MaxBodyFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	c.maxBodySize = f.config.MaxBodySize
+
+	if nil != c.result.Node && c.result.Node.MaxBodySize > 0 {
+		c.maxBodySize = c.result.Node.MaxBodySize
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// Post execute after proxy
+func (f MaxBodyFilter) Post(c *FilterContext) (statusCode int, err error) {
+	if c.maxBodySize > 0 &&
+		(c.result.Res.Header.ContentLength() > c.maxBodySize || len(c.result.Res.Body()) > c.maxBodySize) {
+		return http.StatusBadGateway, ErrResponseBodyTooLarge
+	}
+
+	return f.BaseFilter.Post(c)
+}
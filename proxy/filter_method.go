@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerAllow = "Allow"
+)
+
+// MethodFilter respond the OPTIONS requests of node with the allowed methods,
+// and send the HEAD requests as GET if the backend servers not support HEAD.
+// It must be registered after the head filter, so the stripped response is copied to the client.
+type MethodFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newMethodFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return MethodFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f MethodFilter) Name() string {
+	return FilterMethod
+}
+
+// Pre execute before proxy
+func (f MethodFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if nil == c.result.Node || nil == c.result.Node.Methods {
+		return f.BaseFilter.Pre(c)
+	}
+
+	rules := c.result.Node.Methods
+	req := c.Request()
+
+	if string(req.Header.Method()) == http.MethodOptions && len(rules.Allow) > 0 && !isPreflight(req) {
+		res := fasthttp.AcquireResponse()
+		res.SetStatusCode(http.StatusNoContent)
+		res.Header.Set(headerAllow, rules.AllowHeader())
+
+		c.result.Res = res
+		return http.StatusNoContent, errResponded
+	}
+
+	if req.Header.IsHead() && rules.HeadAsGet {
+		// SetMethod of fasthttp appends to the current method
+		c.outreq.Header.SetMethodBytes([]byte(http.MethodGet))
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// Post execute after proxy
+func (f MethodFilter) Post(c *FilterContext) (statusCode int, err error) {
+	if nil == c.result.Node || nil == c.result.Node.Methods || !c.result.Node.Methods.HeadAsGet || !c.ctx.IsHead() {
+		return f.BaseFilter.Post(c)
+	}
+
+	// the Content-Length is the length of the whole body of GET response
+	res := c.result.Res
+	length := res.Header.ContentLength()
+	if nil == c.result.Stream {
+		length = len(res.Body())
+	}
+
+	c.result.CloseStream()
+	res.ResetBody()
+	res.Header.SetContentLength(length)
+	c.ctx.Response.SkipBody = true
+
+	return f.BaseFilter.Post(c)
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestMethodFilter(t *testing.T) {
+	var methods []string
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Write([]byte("hello"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterMethod)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			Methods:     &model.MethodRules{Allow: []string{"get", "HEAD", "post"}, HeadAsGet: true},
+		},
+	}))
+
+	ctx := doTestRequest(p, "OPTIONS", "/api")
+	if ctx.Response.StatusCode() != http.StatusNoContent {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusNoContent, ctx.Response.StatusCode())
+	}
+	if allow := string(ctx.Response.Header.Peek(headerAllow)); allow != "GET, HEAD, POST" {
+		t.Errorf("expect:<GET, HEAD, POST>, acture:<%s>", allow)
+	}
+
+	ctx = doTestRequest(p, "HEAD", "/api")
+	if ctx.Response.StatusCode() != http.StatusOK || len(ctx.Response.Body()) != 0 || !ctx.Response.SkipBody {
+		t.Errorf("expect:<200, empty>, acture:<%d, %s>", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+	if length := ctx.Response.Header.ContentLength(); length != len("hello") {
+		t.Errorf("expect:<%d>, acture:<%d>", len("hello"), length)
+	}
+
+	// the node without method rules
+	doTestRequest(p, "OPTIONS", "/other")
+	doTestRequest(p, "HEAD", "/other")
+
+	expect := []string{"GET", "OPTIONS", "HEAD"}
+	if len(methods) != len(expect) {
+		t.Fatalf("expect:<%v>, acture:<%v>", expect, methods)
+	}
+	for i, method := range expect {
+		if methods[i] != method {
+			t.Errorf("expect:<%v>, acture:<%v>", expect, methods)
+		}
+	}
+}
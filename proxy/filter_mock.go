@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+// MockFilter respond the requests of mocked node by the canned response, the backend servers are skipped.
+// It is always the first filter.
+type MockFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newMockFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return MockFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f MockFilter) Name() string {
+	return FilterMock
+}
+
+// Pre execute before proxy, the mocked node is responded here if the mock filter is not leading in the filter plan of node
+func (f MockFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	res, statusCode, err := f.Respond(c)
+	if nil != err {
+		return statusCode, err
+	}
+
+	if nil == res {
+		return f.BaseFilter.Pre(c)
+	}
+
+	c.result.Res = res
+	return res.StatusCode(), errResponded
+}
+
+// Respond returns the canned response of the mocked node
+func (f MockFilter) Respond(c *FilterContext) (res *fasthttp.Response, statusCode int, err error) {
+	if nil == c.result.Node || !c.result.Node.IsMocked() {
+		return nil, http.StatusOK, nil
+	}
+
+	mock := c.result.Node.Mock
+
+	body := []byte(mock.Body)
+	if "" == mock.Body && "" != mock.BodyFile {
+		body, err = ioutil.ReadFile(mock.BodyFile)
+		if nil != err {
+			log.WarnErrorf(err, "Mock read body file <%s> fail", mock.BodyFile)
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	res = fasthttp.AcquireResponse()
+	res.SetStatusCode(mock.StatusCode)
+	if 0 == mock.StatusCode {
+		res.SetStatusCode(http.StatusOK)
+	}
+
+	for name, value := range mock.Headers {
+		res.Header.Set(name, value)
+	}
+	res.SetBody(body)
+
+	return res, res.StatusCode(), nil
+}
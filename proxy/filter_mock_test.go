@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestMockFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	file, err := ioutil.TempFile("", "mock")
+	if nil != err {
+		t.Fatalf("create file err: %s", err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"from":"file"}`)
+	file.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterMock)
+
+	mocked := &model.Node{
+		ClusterName: testClusterName,
+		URL:         "/maintenance",
+		Mock: &model.MockResponse{
+			Enabled:    true,
+			StatusCode: http.StatusServiceUnavailable,
+			Headers:    map[string]string{"Retry-After": "60"},
+			Body:       "maintenance",
+		},
+	}
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/maintenance$", []*model.Node{mocked}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/contract$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/contract",
+			Mock: &model.MockResponse{
+				Enabled:  true,
+				BodyFile: file.Name(),
+			},
+		},
+	}))
+
+	ctx := doTestRequest(p, "GET", "/maintenance")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable || string(ctx.Response.Body()) != "maintenance" {
+		t.Errorf("expect:<%d,maintenance>, acture:<%d,%s>", http.StatusServiceUnavailable, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	if value := string(ctx.Response.Header.Peek("Retry-After")); value != "60" {
+		t.Errorf("expect:<60>, acture:<%s>", value)
+	}
+
+	ctx = doTestRequest(p, "GET", "/contract")
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != `{"from":"file"}` {
+		t.Errorf("expect:<%d,{\"from\":\"file\"}>, acture:<%d,%s>", http.StatusOK, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 0 {
+		t.Errorf("expect:<0>, acture:<%d>", requests)
+	}
+
+	// disable the mock
+	mocked.Mock.Enabled = false
+	ctx = doTestRequest(p, "GET", "/maintenance")
+	if ctx.Response.StatusCode() != http.StatusOK || atomic.LoadInt32(&backend.requests) != 1 {
+		t.Errorf("expect:<%d,1>, acture:<%d,%d>", http.StatusOK, ctx.Response.StatusCode(), backend.requests)
+	}
+}
+
+func TestMockFilterWithoutServer(t *testing.T) {
+	p := newTestProxy(t, newTestConf(), "")
+	p.RegistryFilter(FilterAnalysis)
+	p.RegistryFilter(FilterMock)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/mock$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/mock",
+			Mock: &model.MockResponse{
+				Enabled: true,
+				Body:    "mock",
+			},
+		},
+	}))
+
+	ctx := doTestRequest(p, "GET", "/mock")
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != "mock" {
+		t.Errorf("expect:<%d,mock>, acture:<%d,%s>", http.StatusOK, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
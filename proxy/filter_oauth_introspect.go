@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	defaultOAuthIntrospectCacheTTL = 30
+	oauthIntrospectTimeout         = time.Second * 5
+	oauthRuntimeVarPrefix          = "oauth."
+)
+
+var (
+	// oauthStandardClaims the members of introspection response always copied to the runtime vars
+	oauthStandardClaims = []string{"scope", "client_id", "username", "sub"}
+)
+
+var (
+	// ErrOAuthTokenMissing the request has no bearer token
+	ErrOAuthTokenMissing = errors.New("missing oauth token")
+	// ErrOAuthTokenInactive the bearer token is not active
+	ErrOAuthTokenInactive = errors.New("inactive oauth token")
+)
+
+// OAuthIntrospectFilter validate the opaque bearer token by the RFC 7662 introspection endpoint,
+// the results are cached, the claims of the active token are set to the runtime vars.
+// If the endpoint fail, the requests are passed without claims by OAuthIntrospectFailOpen, otherwise responsed 503.
+type OAuthIntrospectFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+	ttl    time.Duration
+	cache  *introspectCache
+}
+
+func newOAuthIntrospectFilter(config *conf.Conf, proxy *Proxy) Filter {
+	f := OAuthIntrospectFilter{
+		config: config,
+		proxy:  proxy,
+		ttl:    time.Duration(config.OAuthIntrospectCacheTTL) * time.Second,
+		cache:  newIntrospectCache(),
+	}
+
+	if f.ttl <= 0 {
+		f.ttl = defaultOAuthIntrospectCacheTTL * time.Second
+	}
+
+	go f.cache.startGC(f.ttl)
+
+	return f
+}
+
+// Name return name of this filter
+func (f OAuthIntrospectFilter) Name() string {
+	return FilterOAuthIntrospect
+}
+
+// Pre execute before proxy
+func (f OAuthIntrospectFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	authorization := c.Request().Header.Peek(headerAuthorization)
+	if !bytes.HasPrefix(authorization, bearerPrefix) || len(authorization) == len(bearerPrefix) {
+		return http.StatusUnauthorized, ErrOAuthTokenMissing
+	}
+
+	value, err := f.introspect(string(authorization[len(bearerPrefix):]))
+	if nil != err {
+		if f.config.OAuthIntrospectFailOpen {
+			log.WarnErrorf(err, "OAuth introspect fail, pass the request")
+			return f.BaseFilter.Pre(c)
+		}
+
+		log.WarnErrorf(err, "OAuth introspect fail")
+		return http.StatusServiceUnavailable, err
+	}
+
+	if !value.active {
+		return http.StatusUnauthorized, ErrOAuthTokenInactive
+	}
+
+	for name, claim := range value.claims {
+		c.runtimeVar[oauthRuntimeVarPrefix+name] = claim
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// introspect returns the introspection result of token, the result is cached until the ttl or the token expired
+func (f OAuthIntrospectFilter) introspect(token string) (introspectValue, error) {
+	now := time.Now()
+	if value, ok := f.cache.get(token, now); ok {
+		return value, nil
+	}
+
+	req := fasthttp.AcquireRequest()
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(res)
+
+	req.SetRequestURI(f.config.OAuthIntrospectURL)
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if "" != f.config.OAuthClientID {
+		// the client credentials are form encoded, see RFC 6749 section 2.3.1
+		credentials := url.QueryEscape(f.config.OAuthClientID) + ":" + url.QueryEscape(f.config.OAuthClientSecret)
+		req.Header.Set(headerAuthorization, "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+	req.SetBodyString("token=" + url.QueryEscape(token) + "&token_type_hint=access_token")
+
+	if err := fasthttp.DoTimeout(req, res, oauthIntrospectTimeout); nil != err {
+		return introspectValue{}, err
+	}
+
+	if res.StatusCode() != fasthttp.StatusOK {
+		return introspectValue{}, fmt.Errorf("oauth introspect responsed %d", res.StatusCode())
+	}
+
+	members := make(map[string]interface{})
+	if err := json.Unmarshal(res.Body(), &members); nil != err {
+		return introspectValue{}, err
+	}
+
+	value := introspectValue{
+		expireAt: now.Add(f.ttl),
+	}
+	value.active, _ = members["active"].(bool)
+
+	if value.active {
+		if exp, ok := members["exp"].(float64); ok {
+			if expireAt := time.Unix(int64(exp), 0); expireAt.Before(value.expireAt) {
+				value.expireAt = expireAt
+			}
+		}
+
+		value.claims = make(map[string]string)
+		for _, names := range [][]string{oauthStandardClaims, f.config.OAuthClaims} {
+			for _, name := range names {
+				if claim, ok := members[name]; ok {
+					value.claims[name] = claimString(claim)
+				}
+			}
+		}
+	}
+
+	f.cache.put(token, value)
+	return value, nil
+}
+
+type introspectValue struct {
+	active   bool
+	claims   map[string]string
+	expireAt time.Time
+}
+
+// introspectCache the cache of introspection results
+type introspectCache struct {
+	sync.RWMutex
+	values map[string]introspectValue
+}
+
+func newIntrospectCache() *introspectCache {
+	return &introspectCache{
+		values: make(map[string]introspectValue),
+	}
+}
+
+func (c *introspectCache) get(token string, now time.Time) (introspectValue, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	value, ok := c.values[token]
+	if !ok || now.After(value.expireAt) {
+		return value, false
+	}
+
+	return value, true
+}
+
+func (c *introspectCache) put(token string, value introspectValue) {
+	c.Lock()
+	c.values[token] = value
+	c.Unlock()
+}
+
+func (c *introspectCache) startGC(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		c.gc(now)
+	}
+}
+
+// gc remove the expired results
+func (c *introspectCache) gc(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+
+	for token, value := range c.values {
+		if now.After(value.expireAt) {
+			delete(c.values, token)
+		}
+	}
+}
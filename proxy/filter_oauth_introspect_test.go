@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func doTestOAuthIntrospectFilter(f Filter, token string) (*FilterContext, int, error) {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/api")
+	if "" != token {
+		ctx.Request.Header.Set(headerAuthorization, "Bearer "+token)
+	}
+
+	c := &FilterContext{
+		ctx:        ctx,
+		result:     &model.RouteResult{},
+		runtimeVar: make(map[string]string),
+	}
+
+	code, err := f.Pre(c)
+	return c, code, err
+}
+
+func TestOAuthIntrospectFilter(t *testing.T) {
+	var calls int32
+	introspector := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+
+		if id, secret, ok := r.BasicAuth(); !ok || id != "gateway" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.PostFormValue("token") {
+		case "active":
+			fmt.Fprintf(w, `{"active":true,"scope":"read write","sub":"u1","tenant":"t1","exp":%d}`, time.Now().Add(time.Hour).Unix())
+		default:
+			w.Write([]byte(`{"active":false}`))
+		}
+	})
+	defer introspector.Close()
+
+	cnf := newTestConf()
+	cnf.OAuthIntrospectURL = introspector.URL
+	cnf.OAuthClientID = "gateway"
+	cnf.OAuthClientSecret = "s3cret"
+	cnf.OAuthClaims = []string{"tenant"}
+	f := newOAuthIntrospectFilter(cnf, nil)
+
+	c, _, err := doTestOAuthIntrospectFilter(f, "active")
+	if nil != err {
+		t.Fatalf("active expect pass, acture:<%v>", err)
+	}
+
+	expects := map[string]string{"oauth.scope": "read write", "oauth.sub": "u1", "oauth.tenant": "t1"}
+	for name, expect := range expects {
+		if c.runtimeVar[name] != expect {
+			t.Errorf("%s expect:<%s>, acture:<%s>", name, expect, c.runtimeVar[name])
+		}
+	}
+
+	if _, code, _ := doTestOAuthIntrospectFilter(f, "revoked"); code != http.StatusUnauthorized {
+		t.Errorf("inactive expect:<%d>, acture:<%d>", http.StatusUnauthorized, code)
+	}
+
+	if _, code, _ := doTestOAuthIntrospectFilter(f, ""); code != http.StatusUnauthorized {
+		t.Errorf("missing expect:<%d>, acture:<%d>", http.StatusUnauthorized, code)
+	}
+
+	// the active and inactive results are cached
+	doTestOAuthIntrospectFilter(f, "active")
+	doTestOAuthIntrospectFilter(f, "revoked")
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", n)
+	}
+}
+
+func TestOAuthIntrospectFilterWithEndpointDown(t *testing.T) {
+	introspector := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active":true}`))
+	})
+	url := introspector.URL
+	introspector.Close()
+
+	cnf := newTestConf()
+	cnf.OAuthIntrospectURL = url
+	f := newOAuthIntrospectFilter(cnf, nil)
+
+	if _, code, err := doTestOAuthIntrospectFilter(f, "active"); code != http.StatusServiceUnavailable || nil == err {
+		t.Errorf("fail-closed expect:<%d>, acture:<%d>", http.StatusServiceUnavailable, code)
+	}
+
+	cnf.OAuthIntrospectFailOpen = true
+	f = newOAuthIntrospectFilter(cnf, nil)
+	if c, _, err := doTestOAuthIntrospectFilter(f, "active"); nil != err || len(c.runtimeVar) != 0 {
+		t.Errorf("fail-open expect pass without claims, acture:<%v>, <%v>", err, c.runtimeVar)
+	}
+
+	// the invalid responses of endpoint
+	broken := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer broken.Close()
+
+	cnf.OAuthIntrospectURL = broken.URL
+	cnf.OAuthIntrospectFailOpen = false
+	f = newOAuthIntrospectFilter(cnf, nil)
+	if _, code, _ := doTestOAuthIntrospectFilter(f, "active"); code != http.StatusServiceUnavailable {
+		t.Errorf("broken expect:<%d>, acture:<%d>", http.StatusServiceUnavailable, code)
+	}
+}
@@ -13,9 +13,10 @@ var (
 	ErrTraffixLimited = errors.New("traffic limit")
 )
 
-// RateLimitingFilter RateLimitingFilter
+// RateLimitingFilter reject the requests with 503 if the server reach its MaxQPS in the last second.
+// Use ClientRateLimitFilter to limit the requests of every client ip.
 type RateLimitingFilter struct {
-	baseFilter
+	BaseFilter
 	config *conf.Conf
 	proxy  *Proxy
 }
@@ -33,7 +34,7 @@ func (f RateLimitingFilter) Name() string {
 }
 
 // Pre execute before proxy
-func (f RateLimitingFilter) Pre(c *filterContext) (statusCode int, err error) {
+func (f RateLimitingFilter) Pre(c *FilterContext) (statusCode int, err error) {
 	requestCounts := c.rb.GetAnalysis().GetRecentlyRequestCount(c.result.Svr.Addr, 1)
 
 	if requestCounts >= c.result.Svr.MaxQPS {
@@ -42,5 +43,5 @@ func (f RateLimitingFilter) Pre(c *filterContext) (statusCode int, err error) {
 		return http.StatusServiceUnavailable, ErrTraffixLimited
 	}
 
-	return f.baseFilter.Pre(c)
+	return f.BaseFilter.Pre(c)
 }
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+// SingleFlightFilter share the response of the in-flight GET or HEAD request to the concurrent identical requests,
+// the key is the cluster, method, uri and the configured headers.
+// The waiters proxy to the backend server themselves if the first one is failed or streaming.
+type SingleFlightFilter struct {
+	BaseFilter
+	config  *conf.Conf
+	proxy   *Proxy
+	flights *responseFlights
+}
+
+func newSingleFlightFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return SingleFlightFilter{
+		config:  config,
+		proxy:   proxy,
+		flights: newResponseFlights(),
+	}
+}
+
+// Name return name of this filter
+func (f SingleFlightFilter) Name() string {
+	return FilterSingleFlight
+}
+
+// Pre execute before proxy
+func (f SingleFlightFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	// IsGet of fasthttp caches the result in the header, so the shared client request is not read in merge
+	if req := c.Request(); !req.Header.IsGet() && !req.Header.IsHead() {
+		return f.BaseFilter.Pre(c)
+	}
+
+	key := getRequestKey(c, f.config.SingleFlightKeyHeaders)
+	flight, leader := f.flights.join(key)
+	if leader {
+		c.OnDone(func() {
+			f.flights.leave(key, getSharedResponse(c.result))
+		})
+		return f.BaseFilter.Pre(c)
+	}
+
+	timeout := time.NewTimer(getWaitTimeout(f.config, c))
+	defer timeout.Stop()
+
+	select {
+	case <-flight.done:
+		if nil != flight.res {
+			c.result.Res = fasthttp.AcquireResponse()
+			flight.res.CopyTo(c.result.Res)
+			return http.StatusOK, errResponded
+		}
+	case <-timeout.C:
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+type responseFlight struct {
+	done chan struct{}
+	res  *fasthttp.Response
+}
+
+// responseFlights the in-flight requests of keys, the response of leader is shared with the waiters
+type responseFlights struct {
+	sync.Mutex
+	flights map[string]*responseFlight
+}
+
+func newResponseFlights() *responseFlights {
+	return &responseFlights{
+		flights: make(map[string]*responseFlight),
+	}
+}
+
+// join returns the flight of key, the first one of key is the leader, it must leave when done
+func (rf *responseFlights) join(key string) (*responseFlight, bool) {
+	rf.Lock()
+	defer rf.Unlock()
+
+	if flight, ok := rf.flights[key]; ok {
+		return flight, false
+	}
+
+	flight := &responseFlight{done: make(chan struct{})}
+	rf.flights[key] = flight
+	return flight, true
+}
+
+// leave share a copy of the response with the waiters, nil if the leader has no response to share
+func (rf *responseFlights) leave(key string, res *fasthttp.Response) {
+	rf.Lock()
+	flight, ok := rf.flights[key]
+	delete(rf.flights, key)
+	rf.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if nil != res {
+		flight.res = &fasthttp.Response{}
+		res.CopyTo(flight.res)
+	}
+	close(flight.done)
+}
+
+// getSharedResponse returns the response of result to share, nil if the result is failed or streaming
+func getSharedResponse(result *model.RouteResult) *fasthttp.Response {
+	if nil == result.Err && nil == result.Stream {
+		return result.Res
+	}
+
+	return nil
+}
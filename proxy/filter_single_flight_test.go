@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func doTestSingleFlightRequests(p *Proxy, n int, method string, user func(int) string) []*fasthttp.RequestCtx {
+	ctxs := make([]*fasthttp.RequestCtx, n)
+	start := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(n)
+
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+
+			req := &fasthttp.Request{}
+			req.Header.SetMethod(method)
+			req.SetRequestURI("/api/users?id=1")
+			req.Header.SetHost("gateway")
+			req.Header.Set("X-User", user(i))
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Init(req, nil, nil)
+			ctxs[i] = ctx
+
+			<-start
+			p.ReverseProxyHandler(ctx)
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+	return ctxs
+}
+
+func TestSingleFlightFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("X-User", r.Header.Get("X-User"))
+		w.Write([]byte("user-" + r.Header.Get("X-User")))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.SingleFlightKeyHeaders = []string{"X-User"}
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterSingleFlight)
+
+	ctxs := doTestSingleFlightRequests(p, 50, "GET", func(int) string { return "a" })
+	for _, ctx := range ctxs {
+		if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != "user-a" {
+			t.Fatalf("expect:<%d user-a>, acture:<%d %s>", http.StatusOK, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+
+	// the key headers are different
+	atomic.StoreInt32(&backend.requests, 0)
+	ctxs = doTestSingleFlightRequests(p, 10, "GET", func(i int) string { return []string{"a", "b"}[i%2] })
+	for i, ctx := range ctxs {
+		if expect := "user-" + []string{"a", "b"}[i%2]; string(ctx.Response.Body()) != expect {
+			t.Errorf("expect:<%s>, acture:<%s>", expect, ctx.Response.Body())
+		}
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", requests)
+	}
+
+	// the unsafe methods are not shared
+	atomic.StoreInt32(&backend.requests, 0)
+	doTestSingleFlightRequests(p, 5, "POST", func(int) string { return "a" })
+	if requests := atomic.LoadInt32(&backend.requests); requests != 5 {
+		t.Errorf("expect:<5>, acture:<%d>", requests)
+	}
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func TestNodeFilterPlan(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Test")))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterHeaderRules)
+
+	nodes := map[string]*model.Node{
+		"/all":      &model.Node{},
+		"/disabled": &model.Node{DisabledFilters: []string{"headers"}},
+		"/excluded": &model.Node{Filters: []string{FilterHeader}},
+		"/ordered":  &model.Node{Filters: []string{FilterHeaderRules, FilterHeader, "UNKNOWN"}},
+	}
+
+	for url, node := range nodes {
+		node.ClusterName = testClusterName
+		node.URL = "/api"
+		node.RequestHeaders = &model.HeaderRules{Add: map[string]string{"X-Test": "added"}}
+		p.routeTable.AddNewAggregation(model.NewAggregation("^"+url+"$", []*model.Node{node}))
+	}
+
+	cases := []struct {
+		url     string
+		filters []string
+		body    string
+	}{
+		{url: "/all", filters: []string{FilterHeader, FilterHeaderRules}, body: "added"},
+		{url: "/disabled", filters: []string{FilterHeader}, body: ""},
+		{url: "/excluded", filters: []string{FilterHeader}, body: ""},
+		{url: "/ordered", filters: []string{FilterHeaderRules, FilterHeader}, body: "added"},
+	}
+
+	for _, c := range cases {
+		var names []string
+		for _, filter := range p.filterPlan(nodes[c.url]) {
+			names = append(names, filter.Name())
+		}
+
+		if len(names) != len(c.filters) {
+			t.Errorf("%s expect:<%v>, acture:<%v>", c.url, c.filters, names)
+		} else {
+			for i := range names {
+				if names[i] != c.filters[i] {
+					t.Errorf("%s expect:<%v>, acture:<%v>", c.url, c.filters, names)
+					break
+				}
+			}
+		}
+
+		ctx := doTestRequest(p, "GET", c.url)
+		if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != c.body {
+			t.Errorf("%s expect:<%d %s>, acture:<%d %s>", c.url, http.StatusOK, c.body, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+}
+
+type testResponseFilter struct {
+	BaseFilter
+}
+
+func (f testResponseFilter) Name() string {
+	return "TEST-RESPONSE"
+}
+
+func (f testResponseFilter) Respond(c *FilterContext) (*fasthttp.Response, int, error) {
+	if string(c.ctx.Path()) != "/served" {
+		return nil, http.StatusOK, nil
+	}
+
+	res := fasthttp.AcquireResponse()
+	res.Header.Set("X-Served", "1")
+	res.SetBodyString("served")
+	return res, http.StatusOK, nil
+}
+
+func TestRespondFilters(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterCache)
+	p.RegistryFilter(FilterHeader)
+	p.filters.PushFront(testResponseFilter{})
+	p.updateChain()
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/cached$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/cached", CacheTTL: time.Minute},
+	}))
+
+	expect := func(uri string, code int, body string) {
+		ctx := doTestRequest(p, "GET", uri)
+		if ctx.Response.StatusCode() != code || (code == http.StatusOK && string(ctx.Response.Body()) != body) {
+			t.Errorf("%s expect:<%d %s>, acture:<%d %s>", uri, code, body, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+
+	// the response filter serve the body, the backend server is never called
+	ctx := doTestRequest(p, "GET", "/served")
+	if string(ctx.Response.Body()) != "served" || string(ctx.Response.Header.Peek("X-Served")) != "1" {
+		t.Errorf("expect:<served>, acture:<%s %s>", ctx.Response.Body(), ctx.Response.Header.Peek("X-Served"))
+	}
+	if requests := atomic.LoadInt32(&backend.requests); requests != 0 {
+		t.Errorf("expect:<0>, acture:<%d>", requests)
+	}
+
+	// the cache hit is served without the server selection
+	expect("/cached", http.StatusOK, "OK")
+	p.routeTable.DrainServer(backend.addr(), true)
+	expect("/cached", http.StatusOK, "OK")
+	expect("/api", http.StatusServiceUnavailable, "")
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+}
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+// TransformFilter rewrite the request body in pre filters and the response body in post filters
+// by the body transforms of node. The malformed request body is responded 400,
+// and the malformed response body of backend server is responded 502.
+type TransformFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newTransformFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return TransformFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f TransformFilter) Name() string {
+	return FilterTransform
+}
+
+// Pre execute before proxy
+func (f TransformFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if nil == c.result.Node || nil == c.result.Node.RequestTransform {
+		return f.BaseFilter.Pre(c)
+	}
+
+	transform := c.result.Node.RequestTransform
+	if !transform.Matches(c.outreq.Header.ContentType()) {
+		return f.BaseFilter.Pre(c)
+	}
+
+	body, err := transform.Transform(c.outreq.Body())
+	if nil != err {
+		log.InfoErrorf(err, "[%s] Transform request body of <%s> fail", c.runtimeVar[requestIDRuntimeVar], c.result.Node.URL)
+		return http.StatusBadRequest, err
+	}
+
+	c.outreq.SetBody(body)
+	return f.BaseFilter.Pre(c)
+}
+
+// Post execute after proxy
+func (f TransformFilter) Post(c *FilterContext) (statusCode int, err error) {
+	if nil == c.result.Node || nil == c.result.Node.ResponseTransform {
+		return f.BaseFilter.Post(c)
+	}
+
+	if isStreamTransformable(c, c.result.Node.ResponseTransform) {
+		return f.postStream(c)
+	}
+
+	if !isTransformable(c, c.result.Node.ResponseTransform) {
+		return f.BaseFilter.Post(c)
+	}
+
+	return f.transformResponse(c, c.result.Res.Body())
+}
+
+// postStream buffer the streaming response, the body beyond the body buffer size spill to a temp file
+// and is streamed to client without transform
+func (f TransformFilter) postStream(c *FilterContext) (statusCode int, err error) {
+	buffer, err := c.BufferBody(c.result.Stream)
+	c.result.CloseStream()
+	if nil != err {
+		log.InfoErrorf(err, "[%s] Buffer response body of <%s> fail", c.runtimeVar[requestIDRuntimeVar], c.result.Node.URL)
+		return http.StatusBadGateway, err
+	}
+
+	if buffer.Spilled() {
+		log.Warnf("[%s] Response body of <%s> is too large to transform, size <%d>", c.runtimeVar[requestIDRuntimeVar], c.result.Node.URL, buffer.Size())
+		c.result.Stream, err = buffer.Stream()
+		if nil != err {
+			buffer.Close()
+			return http.StatusBadGateway, err
+		}
+
+		return f.BaseFilter.Post(c)
+	}
+
+	body, _ := buffer.Bytes()
+	return f.transformResponse(c, body)
+}
+
+func (f TransformFilter) transformResponse(c *FilterContext, body []byte) (statusCode int, err error) {
+	body, err = c.result.Node.ResponseTransform.Transform(body)
+	if nil != err {
+		log.InfoErrorf(err, "[%s] Transform response body of <%s> fail", c.runtimeVar[requestIDRuntimeVar], c.result.Node.URL)
+		return http.StatusBadGateway, err
+	}
+
+	c.result.Res.SetBody(body)
+	c.result.Res.Header.SetContentLength(len(body))
+	return f.BaseFilter.Post(c)
+}
+
+// isTransformable returns true if the whole response body is read and not encoded
+func isTransformable(c *FilterContext, transform *model.BodyTransform) bool {
+	res := c.result.Res
+	return nil == c.result.Stream &&
+		len(res.Header.Peek(headerContentEncoding)) == 0 &&
+		transform.Matches(res.Header.ContentType())
+}
+
+// isStreamTransformable returns true if the streaming response is not encoded and not the server-sent events
+func isStreamTransformable(c *FilterContext, transform *model.BodyTransform) bool {
+	res := c.result.Res
+	return nil != c.result.Stream &&
+		!isEventStream(res) &&
+		len(res.Header.Peek(headerContentEncoding)) == 0 &&
+		transform.Matches(res.Header.ContentType())
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func doTestTransformRequest(p *Proxy, uri string, body string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.Header.SetMethod("POST")
+	req.SetRequestURI(uri)
+	req.Header.SetHost("gateway")
+	req.Header.SetContentType("application/json")
+	req.SetBodyString(body)
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+
+	p.ReverseProxyHandler(ctx)
+
+	return ctx
+}
+
+func TestTransformFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, "application/json")
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterTransform)
+
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/request$", []*model.Node{
+		&model.Node{
+			ClusterName:      testClusterName,
+			URL:              "/request",
+			RequestTransform: &model.BodyTransform{Template: `{"id":{{json .user.id}},"name":{{json .user.name}}}`},
+		},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/response$", []*model.Node{
+		&model.Node{
+			ClusterName:       testClusterName,
+			URL:               "/response",
+			ResponseTransform: &model.BodyTransform{Template: `{"user":{"id":{{json .id}}}}`},
+		},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/merge$", []*model.Node{
+		&model.Node{
+			ClusterName:       testClusterName,
+			URL:               "/response",
+			AttrName:          "transformed",
+			ResponseTransform: &model.BodyTransform{Template: `{{json .id}}`},
+		},
+		&model.Node{ClusterName: testClusterName, URL: "/response", AttrName: "origin"},
+	}))
+
+	ctx := doTestTransformRequest(p, "/request", `{"user":{"id":12345678901234567890,"name":"zhangsan","age":18}}`)
+	expect := `{"id":12345678901234567890,"name":"zhangsan"}`
+	if body := string(ctx.Response.Body()); body != expect {
+		t.Errorf("expect:<%s>, acture:<%s>", expect, body)
+	}
+
+	ctx = doTestTransformRequest(p, "/response", `{"id":1}`)
+	expect = `{"user":{"id":1}}`
+	if body := string(ctx.Response.Body()); body != expect {
+		t.Errorf("expect:<%s>, acture:<%s>", expect, body)
+	}
+
+	if length := ctx.Response.Header.ContentLength(); length != len(expect) {
+		t.Errorf("expect:<%d>, acture:<%d>", len(expect), length)
+	}
+
+	ctx = doTestTransformRequest(p, "/merge", `{"id":1}`)
+	expect = `{"transformed":1,"origin":{"id":1}}`
+	if body := string(ctx.Response.Body()); body != expect {
+		t.Errorf("expect:<%s>, acture:<%s>", expect, body)
+	}
+
+	ctx = doTestTransformRequest(p, "/request", `{"user":`)
+	if ctx.Response.StatusCode() != http.StatusBadRequest {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusBadRequest, ctx.Response.StatusCode())
+	}
+
+	requests := atomic.LoadInt32(&backend.requests)
+	ctx = doTestTransformRequest(p, "/response", `not json`)
+	if ctx.Response.StatusCode() != http.StatusBadGateway {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusBadGateway, ctx.Response.StatusCode())
+	}
+
+	if atomic.LoadInt32(&backend.requests) != requests+1 {
+		t.Errorf("expect:<%d>, acture:<%d>", requests+1, backend.requests)
+	}
+}
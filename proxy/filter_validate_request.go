@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+// ValidateRequestFilter validate the required query params, the required headers and the json body
+// of the client requests by the request validation of node. The invalid request is responded 400
+// with the violation, without calling the backend server.
+type ValidateRequestFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newValidateRequestFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return ValidateRequestFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f ValidateRequestFilter) Name() string {
+	return FilterValidateRequest
+}
+
+// Pre execute before proxy
+func (f ValidateRequestFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if nil == c.result.Node || nil == c.result.Node.RequestValidation {
+		return f.BaseFilter.Pre(c)
+	}
+
+	err = c.result.Node.RequestValidation.ValidateRequest(c.Request())
+	if nil == err {
+		return f.BaseFilter.Pre(c)
+	}
+
+	log.Infof("[%s] Request of <%s> is invalid: %s", c.runtimeVar[requestIDRuntimeVar], c.result.Node.URL, err)
+
+	res := fasthttp.AcquireResponse()
+	res.SetStatusCode(http.StatusBadRequest)
+	res.SetBodyString(err.Error())
+	return c.Respond(res)
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func TestValidateRequestFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	dir, _ := ioutil.TempDir("", "schema")
+	defer os.RemoveAll(dir)
+	schema := filepath.Join(dir, "order.json")
+	ioutil.WriteFile(schema, []byte(`{"type":"object","required":["id"],"properties":{"id":{"type":"integer"}}}`), 0644)
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterValidateRequest)
+
+	err := p.routeTable.AddNewAggregation(model.NewAggregation("^/orders", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/orders",
+			RequestValidation: &model.RequestValidation{
+				RequiredParams:   []string{"tenant"},
+				RequiredHeaders:  []string{"X-Client"},
+				SchemaValidation: model.SchemaValidation{SchemaFile: schema, RejectNonJSON: true},
+			},
+		},
+	}))
+	if nil != err {
+		t.Fatalf("add aggregation err: %s", err)
+	}
+
+	cases := []struct {
+		name        string
+		uri         string
+		client      string
+		contentType string
+		body        string
+		code        int
+		reason      string
+	}{
+		{name: "valid", uri: "/orders?tenant=a", client: "web", contentType: "application/json", body: `{"id":1}`, code: http.StatusOK},
+		{name: "missing param", uri: "/orders", client: "web", contentType: "application/json", body: `{"id":1}`, code: http.StatusBadRequest, reason: "tenant"},
+		{name: "missing header", uri: "/orders?tenant=a", contentType: "application/json", body: `{"id":1}`, code: http.StatusBadRequest, reason: "X-Client"},
+		{name: "bad body", uri: "/orders?tenant=a", client: "web", contentType: "application/json", body: `{"id":"1"}`, code: http.StatusBadRequest, reason: "$.id"},
+		{name: "malformed body", uri: "/orders?tenant=a", client: "web", contentType: "application/json", body: `{"id":`, code: http.StatusBadRequest, reason: model.ErrMalformedJSON.Error()},
+		{name: "non json", uri: "/orders?tenant=a", client: "web", contentType: "text/plain", body: "id=1", code: http.StatusBadRequest, reason: model.ErrNonJSONRequest.Error()},
+	}
+
+	for _, c := range cases {
+		requests := atomic.LoadInt32(&backend.requests)
+
+		req := &fasthttp.Request{}
+		req.Header.SetMethod("POST")
+		req.SetRequestURI(c.uri)
+		req.Header.SetHost("gateway")
+		req.Header.SetContentType(c.contentType)
+		if "" != c.client {
+			req.Header.Set("X-Client", c.client)
+		}
+		req.SetBodyString(c.body)
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, nil, nil)
+		p.ReverseProxyHandler(ctx)
+
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.name, c.code, ctx.Response.StatusCode())
+		}
+
+		if body := string(ctx.Response.Body()); !strings.Contains(body, c.reason) {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.name, c.reason, body)
+		}
+
+		forwarded := atomic.LoadInt32(&backend.requests) - requests
+		if expect := c.code == http.StatusOK; (forwarded == 1) != expect {
+			t.Errorf("%s expect forwarded:<%v>, acture:<%d>", c.name, expect, forwarded)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+// ValidateResponseFilter validate the json responses of backend server by the json schema of node,
+// the response violates the schema is responded 502. The responses not json or encoded are skipped,
+// or responded 502 if the node rejects them.
+type ValidateResponseFilter struct {
+	BaseFilter
+	config *conf.Conf
+	proxy  *Proxy
+}
+
+func newValidateResponseFilter(config *conf.Conf, proxy *Proxy) Filter {
+	return ValidateResponseFilter{
+		config: config,
+		proxy:  proxy,
+	}
+}
+
+// Name return name of this filter
+func (f ValidateResponseFilter) Name() string {
+	return FilterValidateResponse
+}
+
+// Post execute after proxy
+func (f ValidateResponseFilter) Post(c *FilterContext) (statusCode int, err error) {
+	if nil == c.result.Node || nil == c.result.Node.ResponseValidation {
+		return f.BaseFilter.Post(c)
+	}
+
+	validation := c.result.Node.ResponseValidation
+	res := c.result.Res
+	if !validation.IsJSON(res.Header.ContentType()) || len(res.Header.Peek(headerContentEncoding)) > 0 {
+		if !validation.RejectNonJSON {
+			return f.BaseFilter.Post(c)
+		}
+
+		log.Warnf("[%s] Response of <%s> is not json, content type <%s>",
+			c.runtimeVar[requestIDRuntimeVar], c.result.Node.URL, res.Header.ContentType())
+		c.result.CloseStream()
+		return http.StatusBadGateway, model.ErrNonJSONResponse
+	}
+
+	body := res.Body()
+	if nil != c.result.Stream {
+		buffer, err := c.BufferBody(c.result.Stream)
+		c.result.CloseStream()
+		if nil != err {
+			log.InfoErrorf(err, "[%s] Buffer response body of <%s> fail", c.runtimeVar[requestIDRuntimeVar], c.result.Node.URL)
+			return http.StatusBadGateway, err
+		}
+
+		body, err = buffer.Bytes()
+		if nil != err {
+			return http.StatusBadGateway, err
+		}
+
+		// the validated body is still streamed to client
+		c.result.Stream, err = buffer.Stream()
+		if nil != err {
+			buffer.Close()
+			return http.StatusBadGateway, err
+		}
+	}
+
+	if err := validation.Validate(body); nil != err {
+		log.Warnf("[%s] Response of <%s> violate the schema <%s>: %s",
+			c.runtimeVar[requestIDRuntimeVar], c.result.Node.URL, validation.SchemaFile, err)
+		c.result.CloseStream()
+		return http.StatusBadGateway, err
+	}
+
+	return f.BaseFilter.Post(c)
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestValidateResponseFilter(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/valid":
+			w.Header().Set(HeaderContentType, "application/json")
+			w.Write([]byte(`{"id":1,"name":"zhangsan"}`))
+		case "/invalid":
+			w.Header().Set(HeaderContentType, "application/json")
+			w.Write([]byte(`{"id":"1"}`))
+		default:
+			w.Header().Set(HeaderContentType, "text/plain")
+			w.Write([]byte("OK"))
+		}
+	})
+	defer backend.Close()
+
+	dir, _ := ioutil.TempDir("", "schema")
+	defer os.RemoveAll(dir)
+	schema := filepath.Join(dir, "user.json")
+	ioutil.WriteFile(schema, []byte(`{"type":"object","required":["id","name"],"properties":{"id":{"type":"integer"}}}`), 0644)
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterValidateResponse)
+
+	for _, uri := range []string{"/valid", "/invalid", "/text"} {
+		err := p.routeTable.AddNewAggregation(model.NewAggregation("^"+uri+"$", []*model.Node{
+			&model.Node{
+				ClusterName:        testClusterName,
+				URL:                uri,
+				ResponseValidation: &model.SchemaValidation{SchemaFile: schema},
+			},
+		}))
+		if nil != err {
+			t.Fatalf("add aggregation err: %s", err)
+		}
+	}
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/text/reject$", []*model.Node{
+		&model.Node{
+			ClusterName:        testClusterName,
+			URL:                "/text",
+			ResponseValidation: &model.SchemaValidation{SchemaFile: schema, RejectNonJSON: true},
+		},
+	}))
+
+	cases := []struct {
+		uri  string
+		code int
+		body string
+	}{
+		{uri: "/valid", code: http.StatusOK, body: `{"id":1,"name":"zhangsan"}`},
+		{uri: "/invalid", code: http.StatusBadGateway},
+		// the non json response is skipped
+		{uri: "/text", code: http.StatusOK, body: "OK"},
+		{uri: "/text/reject", code: http.StatusBadGateway},
+	}
+
+	for _, c := range cases {
+		ctx := doTestRequest(p, "GET", c.uri)
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.uri, c.code, ctx.Response.StatusCode())
+		}
+
+		if "" != c.body && string(ctx.Response.Body()) != c.body {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.uri, c.body, ctx.Response.Body())
+		}
+	}
+}
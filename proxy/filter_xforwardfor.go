@@ -2,9 +2,10 @@ package proxy
 
 import "github.com/fagongzi/gateway/conf"
 
-// XForwardForFilter XForwardForFilter
+// XForwardForFilter XForwardForFilter, the X-Forwarded headers are set by the proxy for all requests,
+// the filter is kept for the compatibility of the configured filters
 type XForwardForFilter struct {
-	baseFilter
+	BaseFilter
 	config *conf.Conf
 	proxy  *Proxy
 }
@@ -20,9 +21,3 @@ func newXForwardForFilter(config *conf.Conf, proxy *Proxy) Filter {
 func (f XForwardForFilter) Name() string {
 	return FilterXForward
 }
-
-// Pre execute before proxy
-func (f XForwardForFilter) Pre(c *filterContext) (statusCode int, err error) {
-	c.outreq.Header.Add("X-Forwarded-For", c.ctx.RemoteIP().String())
-	return f.baseFilter.Pre(c)
-}
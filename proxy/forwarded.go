@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// ForwardedFormatXForwarded the X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host headers
+	ForwardedFormatXForwarded = "x-forwarded"
+	// ForwardedFormatRFC7239 the Forwarded header of RFC 7239
+	ForwardedFormatRFC7239 = "forwarded"
+	// ForwardedFormatBoth both the X-Forwarded headers and the Forwarded header
+	ForwardedFormatBoth = "both"
+
+	headerForwarded       = "Forwarded"
+	headerXForwardedProto = "X-Forwarded-Proto"
+	headerXForwardedHost  = "X-Forwarded-Host"
+)
+
+// forwardedElement the forwarded pairs of one proxy in the Forwarded header
+type forwardedElement struct {
+	by      string
+	forNode string
+	host    string
+	proto   string
+}
+
+// setForwardedHeaders set the forwarded headers of outreq in the configured format.
+// If the remote ip is a trusted proxy, the forwarded headers of the proxy are kept and the hop of the gateway
+// is appended, otherwise the headers sent by the client are overwritten. The prior headers are read from
+// outreq copied from the client request, the merge sub-requests can not read the shared client request concurrently.
+func (p *Proxy) setForwardedHeaders(ctx *fasthttp.RequestCtx, outreq *fasthttp.Request) {
+	trusted := p.isTrustedProxy(ctx.RemoteIP())
+
+	switch p.config.ForwardedFormat {
+	case ForwardedFormatRFC7239:
+		setForwarded(ctx, outreq, trusted)
+	case ForwardedFormatBoth:
+		setXForwarded(ctx, outreq, trusted)
+		setForwarded(ctx, outreq, trusted)
+	default:
+		setXForwarded(ctx, outreq, trusted)
+	}
+}
+
+// setXForwarded append the remote ip to the X-Forwarded-For, the proto and host forwarded by the trusted proxy are kept
+func setXForwarded(ctx *fasthttp.RequestCtx, outreq *fasthttp.Request, trusted bool) {
+	xff := ctx.RemoteIP().String()
+	if prior := outreq.Header.Peek(headerXForwardedFor); trusted && len(prior) > 0 {
+		xff = string(prior) + ", " + xff
+	}
+	outreq.Header.Set(headerXForwardedFor, xff)
+
+	if !trusted || len(outreq.Header.Peek(headerXForwardedProto)) == 0 {
+		outreq.Header.Set(headerXForwardedProto, getProto(ctx))
+	}
+
+	if !trusted || len(outreq.Header.Peek(headerXForwardedHost)) == 0 {
+		outreq.Header.SetBytesV(headerXForwardedHost, ctx.Request.Header.Host())
+	}
+}
+
+// setForwarded append the element of the gateway hop to the Forwarded header
+func setForwarded(ctx *fasthttp.RequestCtx, outreq *fasthttp.Request, trusted bool) {
+	element := &forwardedElement{
+		forNode: formatForwardedNode(ctx.RemoteIP()),
+		host:    string(ctx.Request.Header.Host()),
+		proto:   getProto(ctx),
+	}
+
+	if addr, ok := ctx.LocalAddr().(*net.TCPAddr); ok && !addr.IP.IsUnspecified() {
+		element.by = formatForwardedNode(addr.IP)
+	}
+
+	value := element.String()
+	if prior := outreq.Header.Peek(headerForwarded); trusted && len(prior) > 0 {
+		value = string(prior) + ", " + value
+	}
+	outreq.Header.Set(headerForwarded, value)
+}
+
+func getProto(ctx *fasthttp.RequestCtx) string {
+	if ctx.IsTLS() {
+		return "https"
+	}
+
+	return "http"
+}
+
+func (e *forwardedElement) String() string {
+	var pairs []string
+	if "" != e.by {
+		pairs = append(pairs, "by="+quoteForwarded(e.by))
+	}
+	if "" != e.forNode {
+		pairs = append(pairs, "for="+quoteForwarded(e.forNode))
+	}
+	if "" != e.host {
+		pairs = append(pairs, "host="+quoteForwarded(e.host))
+	}
+	if "" != e.proto {
+		pairs = append(pairs, "proto="+quoteForwarded(e.proto))
+	}
+
+	return strings.Join(pairs, ";")
+}
+
+// formatForwardedNode returns the node of ip, the ipv6 is enclosed in square brackets
+func formatForwardedNode(ip net.IP) string {
+	if nil == ip.To4() {
+		return "[" + ip.String() + "]"
+	}
+
+	return ip.String()
+}
+
+// quoteForwarded returns the value as a token, or a quoted-string if the value has the non token chars
+func quoteForwarded(value string) string {
+	for i := 0; i < len(value); i++ {
+		if !isForwardedTokenChar(value[i]) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+	}
+
+	return value
+}
+
+func isForwardedTokenChar(c byte) bool {
+	switch {
+	case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	}
+
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// parseForwarded returns the elements of the Forwarded header in order,
+// the unknown parameters and the malformed pairs are ignored
+func parseForwarded(value []byte) []*forwardedElement {
+	var elements []*forwardedElement
+	element := &forwardedElement{}
+	for len(value) > 0 {
+		var pair string
+		pair, value = nextForwardedPair(value)
+
+		if index := strings.IndexByte(pair, '='); index > 0 {
+			v := unquoteForwarded(strings.TrimSpace(pair[index+1:]))
+			switch strings.ToLower(strings.TrimSpace(pair[:index])) {
+			case "by":
+				element.by = v
+			case "for":
+				element.forNode = v
+			case "host":
+				element.host = v
+			case "proto":
+				element.proto = v
+			}
+		}
+
+		if len(value) == 0 || ',' == value[0] {
+			elements = append(elements, element)
+			element = &forwardedElement{}
+		}
+
+		if len(value) > 0 {
+			value = value[1:]
+		}
+	}
+
+	return elements
+}
+
+// nextForwardedPair returns the pair before the next ';' or ',' out of the quoted-string, and the rest value
+func nextForwardedPair(value []byte) (string, []byte) {
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ';', ',':
+			if !quoted {
+				return string(value[:i]), value[i:]
+			}
+		}
+	}
+
+	return string(value), nil
+}
+
+func unquoteForwarded(value string) string {
+	if len(value) < 2 || '"' != value[0] || '"' != value[len(value)-1] {
+		return value
+	}
+
+	var buf bytes.Buffer
+	for i := 1; i < len(value)-1; i++ {
+		if '\\' == value[i] && i+1 < len(value)-1 {
+			i++
+		}
+		buf.WriteByte(value[i])
+	}
+
+	return buf.String()
+}
+
+// forwardedFor returns the for nodes of the Forwarded header in the X-Forwarded-For format,
+// the ports and the brackets of ipv6 are removed, the obfuscated nodes are kept as the invalid hops
+func forwardedFor(value []byte) []byte {
+	var nodes []string
+	for _, element := range parseForwarded(value) {
+		if "" != element.forNode {
+			nodes = append(nodes, forwardedNodeIP(element.forNode))
+		}
+	}
+
+	return []byte(strings.Join(nodes, ", "))
+}
+
+// forwardedNodeIP returns the ip of node, e.g. 192.0.2.43:47011 or [2001:db8:cafe::17]:4711
+func forwardedNodeIP(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if index := strings.IndexByte(node, ']'); index > 0 {
+			return node[1:index]
+		}
+		return node
+	}
+
+	if host, _, err := net.SplitHostPort(node); nil == err {
+		return host
+	}
+
+	return node
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseForwarded(t *testing.T) {
+	elements := parseForwarded([]byte(`for=192.0.2.60;proto=http;by=203.0.113.43, For="[2001:db8:cafe::17]:4711";host="example.com:8080", for=unknown;ext="a,b"`))
+	expects := []forwardedElement{
+		{forNode: "192.0.2.60", proto: "http", by: "203.0.113.43"},
+		{forNode: "[2001:db8:cafe::17]:4711", host: "example.com:8080"},
+		{forNode: "unknown"},
+	}
+
+	if len(elements) != len(expects) {
+		t.Fatalf("expect:<%d>, acture:<%d>", len(expects), len(elements))
+	}
+
+	for i, expect := range expects {
+		if *elements[i] != expect {
+			t.Errorf("%d expect:<%+v>, acture:<%+v>", i, expect, *elements[i])
+		}
+	}
+
+	if value := string(forwardedFor([]byte(`for=192.0.2.43:47011, for="[2001:db8:cafe::17]:4711", for=_hidden`))); value != "192.0.2.43, 2001:db8:cafe::17, _hidden" {
+		t.Errorf("expect:<192.0.2.43, 2001:db8:cafe::17, _hidden>, acture:<%s>", value)
+	}
+}
+
+func TestFormatForwarded(t *testing.T) {
+	element := &forwardedElement{
+		forNode: formatForwardedNode(net.ParseIP("2001:db8::1")),
+		host:    "example.com:8080",
+		proto:   "https",
+	}
+
+	if value := element.String(); value != `for="[2001:db8::1]";host="example.com:8080";proto=https` {
+		t.Errorf("expect:<%s>, acture:<%s>", `for="[2001:db8::1]";host="example.com:8080";proto=https`, value)
+	}
+
+	// the formatted element is parsed back
+	if elements := parseForwarded([]byte(element.String())); len(elements) != 1 || elements[0].host != element.host || elements[0].forNode != element.forNode {
+		t.Errorf("expect:<%+v>, acture:<%+v>", element, elements)
+	}
+}
+
+func TestForwardedFormat(t *testing.T) {
+	var received http.Header
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	// the local addr of the test request context is the remote addr
+	cases := []struct {
+		format    string
+		remote    string
+		header    map[string]string
+		forwarded string
+		xff       string
+	}{
+		{format: "", remote: "1.2.3.4", xff: "1.2.3.4"},
+		{format: ForwardedFormatRFC7239, remote: "1.2.3.4", forwarded: "by=1.2.3.4;for=1.2.3.4;host=gateway;proto=http"},
+		{format: ForwardedFormatBoth, remote: "1.2.3.4", forwarded: "by=1.2.3.4;for=1.2.3.4;host=gateway;proto=http", xff: "1.2.3.4"},
+		// the spoofed Forwarded of the untrusted client is overwritten
+		{
+			format: ForwardedFormatRFC7239, remote: "1.2.3.4",
+			header:    map[string]string{"Forwarded": "for=5.6.7.8"},
+			forwarded: "by=1.2.3.4;for=1.2.3.4;host=gateway;proto=http",
+		},
+		// the Forwarded of the trusted load balancer is appended
+		{
+			format: ForwardedFormatRFC7239, remote: "10.0.0.1",
+			header:    map[string]string{"Forwarded": "for=5.6.7.8;proto=https"},
+			forwarded: "for=5.6.7.8;proto=https, by=10.0.0.1;for=10.0.0.1;host=gateway;proto=http",
+		},
+	}
+
+	for _, c := range cases {
+		cnf := newTestConf()
+		cnf.TrustedProxies = []string{"10.0.0.0/8"}
+		cnf.ForwardedFormat = c.format
+		p := newTestProxy(t, cnf, "", backend)
+
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/")
+		req.Header.SetHost("gateway")
+		for key, value := range c.header {
+			req.Header.Set(key, value)
+		}
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, &net.TCPAddr{IP: net.ParseIP(c.remote), Port: 10000}, nil)
+		p.ReverseProxyHandler(ctx)
+
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+		}
+
+		if value := received.Get("Forwarded"); value != c.forwarded {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.format, c.forwarded, value)
+		}
+
+		if value := received.Get("X-Forwarded-For"); value != c.xff {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.format, c.xff, value)
+		}
+	}
+}
+
+func TestClientIPByForwarded(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.TrustedProxies = []string{"10.0.0.0/8", "fd00::/8"}
+	p := newTestProxy(t, cnf, "", backend)
+
+	cases := []struct {
+		remote    string
+		forwarded string
+		xff       string
+		expect    string
+	}{
+		{remote: "10.0.0.1", forwarded: `for=1.2.3.4, for="10.0.0.2:8080"`, expect: "1.2.3.4"},
+		{remote: "10.0.0.1", forwarded: `for="[2001:db8::1]:4711";proto=https, for="[fd00::2]"`, expect: "2001:db8::1"},
+		// the obfuscated node stop the walk
+		{remote: "10.0.0.1", forwarded: `for=1.2.3.4, for=_hidden, for=10.0.0.2`, expect: "10.0.0.2"},
+		// the spoofed Forwarded from the untrusted client
+		{remote: "1.2.3.4", forwarded: `for=5.6.7.8`, expect: "1.2.3.4"},
+		// the X-Forwarded-For is preferred
+		{remote: "10.0.0.1", forwarded: `for=5.6.7.8`, xff: "1.2.3.4", expect: "1.2.3.4"},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/")
+		req.Header.Set(headerForwarded, c.forwarded)
+		if "" != c.xff {
+			req.Header.Set(headerXForwardedFor, c.xff)
+		}
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, &net.TCPAddr{IP: net.ParseIP(c.remote), Port: 10000}, nil)
+
+		if ip := p.getClientIP(ctx); ip != c.expect {
+			t.Errorf("%s <%s> expect:<%s>, acture:<%s>", c.remote, c.forwarded, c.expect, ip)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerGRPCStatus  = "Grpc-Status"
+	headerGRPCMessage = "Grpc-Message"
+	grpcContentType   = "application/grpc"
+
+	// the gRPC status codes of the proxy failures
+	grpcUnimplemented = 12
+	grpcUnavailable   = 14
+)
+
+// startGRPCServer listen at the gRPC addr, the fasthttp server only support HTTP/1.x,
+// so the gRPC calls are accepted by net/http with h2c
+func (p *Proxy) startGRPCServer() {
+	ln, err := net.Listen("tcp4", p.config.GRPCAddr)
+	if nil != err {
+		log.PanicErrorf(err, "Proxy listen gRPC at <%s> fail.", p.config.GRPCAddr)
+	}
+
+	log.Infof("Proxy gRPC listen at %s.", p.config.GRPCAddr)
+	err = p.serveGRPC(ln)
+	if p.isStopping() {
+		log.Infof("Proxy gRPC stopped at %s", p.config.GRPCAddr)
+		return
+	}
+
+	log.ErrorErrorf(err, "Proxy gRPC exit at %s", p.config.GRPCAddr)
+}
+
+func (p *Proxy) serveGRPC(ln net.Listener) error {
+	server := &http.Server{
+		Handler:   http.HandlerFunc(p.GRPCHandler),
+		Protocols: &http.Protocols{},
+	}
+	server.Protocols.SetUnencryptedHTTP2(true)
+
+	p.stopLock.Lock()
+	p.grpcServer = server
+	p.stopLock.Unlock()
+
+	if p.isStopping() {
+		ln.Close()
+	}
+
+	return server.Serve(ln)
+}
+
+// GRPCHandler proxy the gRPC calls to the gRPC nodes by the path /service/method,
+// the server is selected for every call, the HTTP/2 connections to the servers are multiplexed.
+// The filters are not applied to the gRPC calls, the maintenance, the circuit breaker and the stats
+// of servers and nodes are same as the http requests, the failures are responsed with gRPC status.
+func (p *Proxy) GRPCHandler(w http.ResponseWriter, r *http.Request) {
+	if p.isStopping() {
+		// the HTTP/2 connection is closed by GOAWAY after the call
+		w.Header().Set("Connection", "close")
+	}
+
+	if m := p.getMaintenance(); nil != m {
+		p.writeGRPCMaintenance(w, m)
+		return
+	}
+
+	req := newRouteRequest(r)
+	clientIP := p.getGRPCClientIP(r)
+	results := p.routeTable.SelectByClient(req, clientIP)
+	if len(results) == 0 || nil == results[0].Node || !results[0].Node.GRPC {
+		writeGRPCError(w, grpcUnimplemented, "no gRPC node of "+r.URL.Path)
+		return
+	}
+
+	result := results[0]
+	result.ClientIP = clientIP
+	defer p.metrics.begin(result)()
+
+	done := result.Node.Stats().Begin()
+	defer func() {
+		done(nil == result.Err && result.Code < http.StatusInternalServerError)
+	}()
+
+	if nil != result.Node.Maintenance {
+		result.Code = http.StatusServiceUnavailable
+		p.writeGRPCMaintenance(w, result.Node.Maintenance)
+		return
+	}
+
+	tlsConfig, err := result.Node.TLSConfig()
+	if nil != err {
+		result.Err = err
+		result.Code = http.StatusServiceUnavailable
+		writeGRPCError(w, grpcUnavailable, err.Error())
+		return
+	}
+
+	svr, err := p.selectGRPCServer(req, result)
+	if nil != err {
+		result.Err = err
+		result.Code = http.StatusServiceUnavailable
+		writeGRPCError(w, grpcUnavailable, err.Error())
+		return
+	}
+
+	outreq := r.Clone(r.Context())
+	outreq.RequestURI = ""
+	outreq.URL.Scheme = "http"
+	if nil != tlsConfig {
+		outreq.URL.Scheme = "https"
+	}
+	outreq.URL.Host = svr.Addr
+	if "" != result.Node.HostHeader {
+		outreq.Host = result.Node.HostHeader
+	}
+
+	svr.IncrActiveConns()
+	defer svr.DecrActiveConns()
+
+	start := time.Now()
+	res, err := p.http2Client.getTransport(tlsConfig).RoundTrip(outreq)
+	recordGRPCCall(svr, time.Since(start), res, err)
+	if nil != err {
+		log.InfoErrorf(err, "Proxy gRPC fail <%s>", svr.Addr)
+		p.metrics.incUpstreamErrors(result)
+		result.Err = err
+		result.Code = http.StatusBadGateway
+		writeGRPCError(w, grpcUnavailable, err.Error())
+		return
+	}
+	defer res.Body.Close()
+
+	for key, values := range res.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(res.StatusCode)
+
+	result.Code = res.StatusCode
+
+	// the streaming messages are flushed immediately
+	_, err = io.Copy(flushWriter{w}, res.Body)
+	if nil != err {
+		log.InfoErrorf(err, "Proxy gRPC stream stopped <%s>", svr.Addr)
+	}
+
+	// the trailers are not declared before the body, they are sent by the prefix
+	for key, values := range res.Trailer {
+		w.Header()[http.TrailerPrefix+key] = values
+	}
+}
+
+// selectGRPCServer returns the server of result allowed by its circuit, the servers not allowed are skipped as doRequest
+func (p *Proxy) selectGRPCServer(req *fasthttp.Request, result *model.RouteResult) (*model.Server, error) {
+	svr := result.Svr
+	if nil == svr {
+		return nil, ErrNoServer
+	}
+
+	tried := make(map[string]bool)
+	for !svr.CircuitAllow() {
+		tried[svr.Addr] = true
+		next := p.routeTable.SelectServerExclude(req, result.ClientIP, result, tried)
+		if nil == next {
+			return nil, getCircuitErr(svr)
+		}
+
+		log.Infof("Proxy gRPC skip circuit <%s> to <%s>", svr.Addr, next.Addr)
+		svr = next
+		result.Svr = next
+	}
+
+	return svr, nil
+}
+
+// recordGRPCCall record the gRPC call to the stats and the circuit of server, the call canceled by client is not counted
+func recordGRPCCall(svr *model.Server, latency time.Duration, res *http.Response, err error) {
+	success := nil == err && res.StatusCode < http.StatusInternalServerError
+	svr.RecordRequest(latency, success)
+
+	switch {
+	case nil != err && errors.Is(err, context.Canceled):
+		svr.CircuitCancel()
+	case success:
+		svr.CircuitSucceed()
+	default:
+		svr.CircuitFailure()
+	}
+}
+
+// writeGRPCMaintenance write the unavailable status of maintenance, the message is the maintenance body
+func (p *Proxy) writeGRPCMaintenance(w http.ResponseWriter, m *model.Maintenance) {
+	res := p.newMaintenanceResponse(m)
+	defer fasthttp.ReleaseResponse(res)
+
+	if retryAfter := res.Header.Peek(headerRetryAfter); len(retryAfter) > 0 {
+		w.Header().Set(headerRetryAfter, string(retryAfter))
+	}
+	writeGRPCError(w, grpcUnavailable, string(res.Body()))
+}
+
+func (p *Proxy) getGRPCClientIP(r *http.Request) string {
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	xff := []byte(strings.Join(r.Header.Values(headerXForwardedFor), ","))
+	if len(xff) == 0 {
+		xff = forwardedFor([]byte(strings.Join(r.Header.Values(headerForwarded), ",")))
+	}
+
+	return p.resolveClientIP(net.ParseIP(host), xff)
+}
+
+// newRouteRequest the fasthttp request only used to select the route result
+func newRouteRequest(r *http.Request) *fasthttp.Request {
+	req := &fasthttp.Request{}
+	req.Header.SetMethod(r.Method)
+	req.SetRequestURI(r.URL.RequestURI())
+	req.Header.SetHost(r.Host)
+
+	for key, values := range r.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	return req
+}
+
+// writeGRPCError write the trailers-only response of the gRPC status
+func writeGRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set(HeaderContentType, grpcContentType)
+	w.Header().Set(headerGRPCStatus, strconv.Itoa(code))
+	w.Header().Set(headerGRPCMessage, message)
+	w.WriteHeader(http.StatusOK)
+}
+
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return n, err
+}
@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+// newTestGRPCEcho a tiny gRPC echo service, the messages of /echo.Echo/Echo are responsed as received,
+// the other methods are responsed with grpc-status 12
+func newTestGRPCEcho() *testBackend {
+	return newTestH2CBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, grpcContentType)
+
+		if r.URL.Path != "/echo.Echo/Echo" || r.Header.Get("Te") != "trailers" {
+			w.Header().Set(headerGRPCStatus, "12")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		w.Header().Set("Trailer", headerGRPCStatus)
+		w.WriteHeader(http.StatusOK)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+		w.Header().Set(headerGRPCStatus, "0")
+	})
+}
+
+func newGRPCFrame(message string) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+func doTestGRPCCall(t *testing.T, addr string, method string, message string) (*http.Response, []byte) {
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	req, _ := http.NewRequest("POST", "http://"+addr+method, bytes.NewReader(newGRPCFrame(message)))
+	req.Header.Set(HeaderContentType, grpcContentType)
+	req.Header.Set("Te", "trailers")
+
+	res, err := client.Do(req)
+	if nil != err {
+		t.Fatalf("call %s err: %s", method, err)
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if nil != err {
+		t.Fatalf("read %s err: %s", method, err)
+	}
+
+	return res, body
+}
+
+func getGRPCStatus(res *http.Response) string {
+	if status := res.Trailer.Get(headerGRPCStatus); "" != status {
+		return status
+	}
+
+	return res.Header.Get(headerGRPCStatus)
+}
+
+func TestGRPC(t *testing.T) {
+	echo := newTestGRPCEcho()
+	defer echo.Close()
+
+	p := newTestProxy(t, newTestConf(), "", echo)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/echo\\.Echo/", []*model.Node{
+		&model.Node{ClusterName: testClusterName, GRPC: true},
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("listen err: %s", err)
+	}
+	go p.serveGRPC(ln)
+	defer ln.Close()
+
+	res, body := doTestGRPCCall(t, ln.Addr().String(), "/echo.Echo/Echo", "hello")
+	if !bytes.Equal(body, newGRPCFrame("hello")) {
+		t.Errorf("expect:<%v>, acture:<%v>", newGRPCFrame("hello"), body)
+	}
+
+	if status := res.Trailer.Get(headerGRPCStatus); "0" != status {
+		t.Errorf("expect trailer:<0>, acture:<%s>", status)
+	}
+
+	res, _ = doTestGRPCCall(t, ln.Addr().String(), "/echo.Echo/Unknown", "hello")
+	if status := getGRPCStatus(res); "12" != status {
+		t.Errorf("expect:<12>, acture:<%s>", status)
+	}
+
+	// the path without gRPC node
+	res, _ = doTestGRPCCall(t, ln.Addr().String(), "/other.Service/Call", "hello")
+	if status := getGRPCStatus(res); "12" != status {
+		t.Errorf("expect:<12>, acture:<%s>", status)
+	}
+
+	// the calls are recorded to the stats of server
+	svr := p.routeTable.GetServer(echo.addr())
+	if stats := svr.Stats().Snapshot(); stats.Requests != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", stats.Requests)
+	}
+
+	// the server of circuit close is not called
+	svr.CloseCount = 1
+	svr.HalfToOpen = 10
+	svr.CircuitFailure()
+	res, _ = doTestGRPCCall(t, ln.Addr().String(), "/echo.Echo/Echo", "hello")
+	if status := getGRPCStatus(res); "14" != status {
+		t.Errorf("expect:<14>, acture:<%s>", status)
+	}
+	svr.OpenCircuit()
+
+	// the gateway and the node in maintenance
+	p.SetMaintenance(&model.Maintenance{Body: "gateway"})
+	res, _ = doTestGRPCCall(t, ln.Addr().String(), "/echo.Echo/Echo", "hello")
+	if status, message := getGRPCStatus(res), res.Header.Get(headerGRPCMessage); "14" != status || "gateway" != message {
+		t.Errorf("expect:<14 gateway>, acture:<%s %s>", status, message)
+	}
+	p.SetMaintenance(nil)
+
+	p.routeTable.UpdateAggregation(model.NewAggregation("^/echo\\.Echo/", []*model.Node{
+		&model.Node{ClusterName: testClusterName, GRPC: true, Maintenance: &model.Maintenance{Body: "node"}},
+	}))
+	res, _ = doTestGRPCCall(t, ln.Addr().String(), "/echo.Echo/Echo", "hello")
+	if status, message := getGRPCStatus(res), res.Header.Get(headerGRPCMessage); "14" != status || "node" != message {
+		t.Errorf("expect:<14 node>, acture:<%s %s>", status, message)
+	}
+
+	if stats := svr.Stats().Snapshot(); stats.Requests != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", stats.Requests)
+	}
+
+	// the echo service is down
+	p.routeTable.UnBind(echo.addr(), testClusterName)
+	res, _ = doTestGRPCCall(t, ln.Addr().String(), "/echo.Echo/Echo", "hello")
+	if status := getGRPCStatus(res); "14" != status {
+		t.Errorf("expect:<14>, acture:<%s>", status)
+	}
+}
@@ -0,0 +1,221 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// the headers managed by the transports, the HTTP/2 connection management headers are forbidden
+	http2SkipHeaders = map[string]bool{
+		"Connection":        true,
+		"Keep-Alive":        true,
+		"Proxy-Connection":  true,
+		"Transfer-Encoding": true,
+		"Upgrade":           true,
+		"Te":                true,
+		"Host":              true,
+		"Content-Length":    true,
+		"Date":              true,
+	}
+)
+
+// upstreamClient the client of backend servers
+type upstreamClient interface {
+	DoWithLimit(req *fasthttp.Request, addr string, tlsConfig *tls.Config, deadline time.Time, maxBodySize int) (*fasthttp.Response, error)
+	DoStream(req *fasthttp.Request, addr string, tlsConfig *tls.Config, deadline time.Time, maxBodySize int, streaming func(*fasthttp.Response) bool) (*fasthttp.Response, io.ReadCloser, error)
+}
+
+// HTTP2Client the client of HTTP/2 only backend servers based on net/http,
+// the plain http backend servers are connected by h2c with prior knowledge.
+// The transports are kept by the tls config, the nodes of the same tls options share the config.
+type HTTP2Client struct {
+	sync.Mutex
+	conf       *conf.Conf
+	transports map[*tls.Config]*http.Transport
+}
+
+// NewHTTP2Client create HTTP2Client instance
+func NewHTTP2Client(conf *conf.Conf) *HTTP2Client {
+	return &HTTP2Client{
+		conf:       conf,
+		transports: make(map[*tls.Config]*http.Transport),
+	}
+}
+
+// DoWithLimit send the request to the addr and read the whole response body, the body size must be less than maxBodySize
+func (c *HTTP2Client) DoWithLimit(req *fasthttp.Request, addr string, tlsConfig *tls.Config, deadline time.Time, maxBodySize int) (*fasthttp.Response, error) {
+	res, _, err := c.DoStream(req, addr, tlsConfig, deadline, maxBodySize, func(*fasthttp.Response) bool { return false })
+	return res, err
+}
+
+// DoStream send the request to the addr, the body of streaming response is returned as the stream
+func (c *HTTP2Client) DoStream(req *fasthttp.Request, addr string, tlsConfig *tls.Config, deadline time.Time, maxBodySize int, streaming func(*fasthttp.Response) bool) (*fasthttp.Response, io.ReadCloser, error) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if !deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+
+	res := fasthttp.AcquireResponse()
+
+	hreq, err := newHTTPRequest(ctx, req, addr, tlsConfig)
+	if nil != err {
+		cancel()
+		return res, nil, err
+	}
+
+	hres, err := c.getTransport(tlsConfig).RoundTrip(hreq)
+	if nil != err {
+		cancel()
+		return res, nil, toFastHTTPError(err)
+	}
+
+	copyHTTPHeader(&res.Header, hres.Header)
+	res.SetStatusCode(hres.StatusCode)
+	if hres.ContentLength >= 0 {
+		res.Header.SetContentLength(int(hres.ContentLength))
+	} else {
+		res.Header.SetContentLength(-1)
+	}
+
+	body := &cancelBody{ReadCloser: hres.Body, cancel: cancel}
+	if maxBodySize > 0 && hres.ContentLength > int64(maxBodySize) {
+		body.Close()
+		return res, nil, fasthttp.ErrBodyTooLarge
+	}
+
+	if streaming(res) {
+		// the server-sent events are endless, they are not limited
+		if isEventStream(res) {
+			return res, body, nil
+		}
+		return res, newLimitBody(body, maxBodySize), nil
+	}
+	defer body.Close()
+
+	var r io.Reader = body
+	if maxBodySize > 0 {
+		r = io.LimitReader(body, int64(maxBodySize)+1)
+	}
+
+	if _, err := io.Copy(res.BodyWriter(), r); nil != err {
+		res.ResetBody()
+		return res, nil, toFastHTTPError(err)
+	}
+
+	if maxBodySize > 0 && len(res.Body()) > maxBodySize {
+		res.ResetBody()
+		return res, nil, fasthttp.ErrBodyTooLarge
+	}
+
+	// the trailers are known after the body is read
+	copyHTTPHeader(&res.Header, hres.Trailer)
+	res.Header.SetContentLength(len(res.Body()))
+	return res, nil, nil
+}
+
+func (c *HTTP2Client) getTransport(tlsConfig *tls.Config) *http.Transport {
+	c.Lock()
+	defer c.Unlock()
+
+	if t, ok := c.transports[tlsConfig]; ok {
+		return t
+	}
+
+	protocols := &http.Protocols{}
+	if nil == tlsConfig {
+		protocols.SetUnencryptedHTTP2(true)
+	} else {
+		protocols.SetHTTP2(true)
+	}
+
+	// the idle conns are closed by the same default of fasthttp, they are never closed by net/http if 0
+	idleTimeout := time.Duration(c.conf.MaxIdleConnDuration) * time.Second
+	if idleTimeout <= 0 {
+		idleTimeout = fasthttp.DefaultMaxIdleConnDuration
+	}
+
+	t := &http.Transport{
+		TLSClientConfig:       tlsConfig,
+		Protocols:             protocols,
+		IdleConnTimeout:       idleTimeout,
+		ResponseHeaderTimeout: time.Duration(c.conf.ReadTimeout) * time.Second,
+	}
+	c.transports[tlsConfig] = t
+	return t
+}
+
+func newHTTPRequest(ctx context.Context, req *fasthttp.Request, addr string, tlsConfig *tls.Config) (*http.Request, error) {
+	scheme := "http://"
+	if nil != tlsConfig {
+		scheme = "https://"
+	}
+
+	body := req.Body()
+	hreq, err := http.NewRequestWithContext(ctx, string(req.Header.Method()), scheme+addr+string(req.URI().RequestURI()), bytes.NewReader(body))
+	if nil != err {
+		return nil, err
+	}
+
+	req.Header.VisitAll(func(key, value []byte) {
+		if k := string(key); !http2SkipHeaders[k] {
+			hreq.Header.Add(k, string(value))
+		}
+	})
+
+	hreq.Host = string(req.Host())
+	hreq.ContentLength = int64(len(body))
+	if len(body) == 0 {
+		hreq.Body = http.NoBody
+	}
+
+	return hreq, nil
+}
+
+func copyHTTPHeader(dst *fasthttp.ResponseHeader, src http.Header) {
+	for key, values := range src {
+		if http2SkipHeaders[key] {
+			continue
+		}
+
+		for _, value := range values {
+			switch key {
+			case "Content-Type", "Server", "Set-Cookie":
+				// the special headers of fasthttp are not added by Add
+				dst.Set(key, value)
+			default:
+				dst.Add(key, value)
+			}
+		}
+	}
+}
+
+func toFastHTTPError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) || isTimeout(err) {
+		return fasthttp.ErrTimeout
+	}
+
+	return err
+}
+
+// cancelBody cancel the context of request when the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.cancel)
+	return err
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestH2CBackend(handler http.HandlerFunc) *testBackend {
+	b := &testBackend{}
+	b.Server = httptest.NewUnstartedServer(handler)
+
+	// h2c only, the HTTP/1.1 requests are rejected
+	b.Server.Config.Protocols = &http.Protocols{}
+	b.Server.Config.Protocols.SetUnencryptedHTTP2(true)
+	b.Server.Start()
+
+	return b
+}
+
+func TestHTTP2Upstream(t *testing.T) {
+	backend := newTestH2CBackend(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Proto", r.Proto)
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte(r.Host + ":" + string(body)))
+		w.Header().Set("X-Checksum", "abc")
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/h2$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/h2",
+			HostHeader:  "h2.example.com",
+			Transport:   model.TransportHTTP2,
+		},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/h2-merge$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/a", AttrName: "a", Transport: model.TransportHTTP2},
+		&model.Node{ClusterName: testClusterName, URL: "/b", AttrName: "b", Transport: model.TransportHTTP2},
+	}))
+
+	ctx := doTestRequest(p, "GET", "/h2")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	if expect := "h2.example.com:"; string(ctx.Response.Body()) != expect {
+		t.Errorf("expect:<%s>, acture:<%s>", expect, ctx.Response.Body())
+	}
+
+	if proto := string(ctx.Response.Header.Peek("X-Proto")); proto != "HTTP/2.0" {
+		t.Errorf("expect:<HTTP/2.0>, acture:<%s>", proto)
+	}
+
+	if checksum := string(ctx.Response.Header.Peek("X-Checksum")); checksum != "abc" {
+		t.Errorf("expect:<abc>, acture:<%s>", checksum)
+	}
+
+	if contentType := string(ctx.Response.Header.ContentType()); contentType != "text/plain" {
+		t.Errorf("expect:<text/plain>, acture:<%s>", contentType)
+	}
+
+	ctx = doTestRequest(p, "GET", "/h2-merge")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	// the fasthttp transport can not talk to the h2c only backend
+	ctx = doTestRequest(p, "GET", "/h1")
+	if ctx.Response.StatusCode() == http.StatusOK {
+		t.Errorf("expect fail, acture:<%d>", ctx.Response.StatusCode())
+	}
+}
+
+func TestHTTP2ClientTransport(t *testing.T) {
+	cnf := newTestConf()
+	cnf.MaxIdleConnDuration = 0
+	client := NewHTTP2Client(cnf)
+
+	if timeout := client.getTransport(nil).IdleConnTimeout; timeout != fasthttp.DefaultMaxIdleConnDuration {
+		t.Errorf("expect:<%s>, acture:<%s>", fasthttp.DefaultMaxIdleConnDuration, timeout)
+	}
+
+	// the reloaded nodes of the same tls options share the transport
+	for i := 0; i < 3; i++ {
+		node := &model.Node{Scheme: model.SchemeHTTPS, ServerName: "h2.example.com"}
+		tlsConfig, err := node.TLSConfig()
+		if nil != err {
+			t.Fatalf("tls config err: %s", err)
+		}
+		client.getTransport(tlsConfig)
+	}
+
+	if count := len(client.transports); count != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", count)
+	}
+}
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	// "github.com/CodisLabs/codis/pkg/utils/log"
+	"bufio"
 	"io"
 	"net/http"
 	"sync"
@@ -15,6 +16,26 @@ type writeFlusher interface {
 	http.Flusher
 }
 
+// bufioFlusher adapt the bufio.Writer of the body stream writer to writeFlusher
+type bufioFlusher struct {
+	*bufio.Writer
+}
+
+func (w bufioFlusher) Flush() {
+	w.Writer.Flush()
+}
+
+// immediateFlushWriter flush after every write
+type immediateFlushWriter struct {
+	dst writeFlusher
+}
+
+func (w immediateFlushWriter) Write(p []byte) (int, error) {
+	n, err := w.dst.Write(p)
+	w.dst.Flush()
+	return n, err
+}
+
 type maxLatencyWriter struct {
 	dst     writeFlusher
 	latency time.Duration
@@ -79,21 +100,63 @@ func (c *runOnFirstRead) Read(bs []byte) (int, error) {
 	return c.Reader.Read(bs)
 }
 
-func (p *Proxy) copyResponse(dst io.Writer, src io.Reader) {
-	if p.flushInterval != 0 {
+// copyResponse copy src to dst, flush the dst every flushInterval,
+// the negative flushInterval means flush after every write.
+func (p *Proxy) copyResponse(dst io.Writer, src io.Reader, flushInterval time.Duration) error {
+	if flushInterval != 0 {
 		if wf, ok := dst.(writeFlusher); ok {
-			mlw := &maxLatencyWriter{
-				dst:     wf,
-				latency: p.flushInterval,
-				done:    make(chan bool),
+			if flushInterval < 0 {
+				dst = immediateFlushWriter{wf}
+			} else {
+				mlw := &maxLatencyWriter{
+					dst:     wf,
+					latency: flushInterval,
+					done:    make(chan bool),
+				}
+				go mlw.flushLoop()
+				defer mlw.stop()
+				dst = mlw
 			}
-			go mlw.flushLoop()
-			defer mlw.stop()
-			dst = mlw
 		}
 	}
 
-	io.Copy(dst, src)
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+// limitBody the streaming response body limited by the max body size, the read fails with
+// fasthttp.ErrBodyTooLarge once the body exceeds the limit, and the bytes over the limit are dropped.
+type limitBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+// newLimitBody returns the body limited by maxBodySize, the body is not limited if maxBodySize <= 0
+func newLimitBody(body io.ReadCloser, maxBodySize int) io.ReadCloser {
+	if maxBodySize <= 0 {
+		return body
+	}
+
+	return &limitBody{ReadCloser: body, remaining: int64(maxBodySize)}
+}
+
+func (b *limitBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, fasthttp.ErrBodyTooLarge
+	}
+
+	// read one more byte to know the body exceeds the limit
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n + int(b.remaining), fasthttp.ErrBodyTooLarge
+	}
+
+	return n, err
 }
 
 func copyRequest(req *fasthttp.Request) *fasthttp.Request {
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerLocation = "Location"
+)
+
+// rewriteLocation rewrite the Location header of the redirect response pointing to the backend server,
+// the host is changed to the gateway host and the prefix rewrite of node is reversed,
+// the Location pointing to the other hosts is not changed
+func rewriteLocation(ctx *fasthttp.RequestCtx, result *model.RouteResult) {
+	if nil == result.Node || !result.Node.RewriteLocation || nil == result.Svr || nil == result.Res {
+		return
+	}
+
+	if code := result.Res.StatusCode(); code < fasthttp.StatusMultipleChoices || code >= fasthttp.StatusBadRequest {
+		return
+	}
+
+	location := result.Res.Header.Peek(headerLocation)
+	if len(location) == 0 {
+		return
+	}
+
+	u, err := url.Parse(string(location))
+	if nil != err {
+		return
+	}
+
+	if u.IsAbs() {
+		if !isServerHost(u, result) {
+			return
+		}
+
+		u.Scheme = getProto(ctx)
+		u.Host = string(ctx.Request.Header.Host())
+	} else if "" != u.Host || "" == u.Path || '/' != u.Path[0] {
+		// the network-path and relative-path references are kept
+		return
+	}
+
+	if result.Node.HasPrefixRewrite() {
+		u.Path = result.Node.ReversePrefixPath(u.Path)
+		u.RawPath = ""
+	}
+
+	result.Res.Header.Set(headerLocation, u.String())
+}
+
+// isServerHost returns the host of url is the backend server of result, or the host header of node
+func isServerHost(u *url.URL, result *model.RouteResult) bool {
+	if u.Host == result.Svr.Addr || ("" != result.Node.HostHeader && u.Host == result.Node.HostHeader) {
+		return true
+	}
+
+	// the default port is omitted
+	if "" == u.Port() {
+		port := "80"
+		if "https" == u.Scheme {
+			port = "443"
+		}
+
+		return net.JoinHostPort(u.Hostname(), port) == result.Svr.Addr
+	}
+
+	return false
+}
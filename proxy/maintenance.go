@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"strconv"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+// SetMaintenance put the whole gateway into maintenance, or take it out if m is nil
+func (p *Proxy) SetMaintenance(m *model.Maintenance) {
+	p.maintenance.Store(m)
+}
+
+func (p *Proxy) getMaintenance() *model.Maintenance {
+	m, _ := p.maintenance.Load().(*model.Maintenance)
+	return m
+}
+
+// newMaintenanceResponse returns the 503 response of maintenance, the empty fields use the configured defaults
+func (p *Proxy) newMaintenanceResponse(m *model.Maintenance) *fasthttp.Response {
+	res := fasthttp.AcquireResponse()
+	res.SetStatusCode(fasthttp.StatusServiceUnavailable)
+
+	retryAfter := m.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = p.config.MaintenanceRetryAfter
+	}
+	if retryAfter > 0 {
+		res.Header.Set(headerRetryAfter, strconv.Itoa(retryAfter))
+	}
+
+	contentType, body := m.ContentType, m.Body
+	if "" == body {
+		contentType, body = p.config.MaintenanceContentType, p.config.MaintenanceBody
+	}
+	if "" != contentType {
+		res.Header.SetContentType(contentType)
+	}
+	res.SetBodyString(body)
+
+	return res
+}
+
+// writeMaintenance write the 503 response of maintenance to the client
+func (p *Proxy) writeMaintenance(ctx *fasthttp.RequestCtx, m *model.Maintenance) {
+	res := p.newMaintenanceResponse(m)
+	defer fasthttp.ReleaseResponse(res)
+
+	res.Header.CopyTo(&ctx.Response.Header)
+	ctx.SetStatusCode(res.StatusCode())
+	ctx.SetBody(res.Body())
+}
@@ -1,6 +1,10 @@
 package proxy
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"net"
 	"net/rpc"
 
@@ -9,17 +13,74 @@ import (
 	"github.com/fagongzi/gateway/pkg/util"
 )
 
-// Manager support runtime remote interface
+var (
+	// ErrMgrUnauthorized the token of manager request is invalid
+	ErrMgrUnauthorized = errors.New("manager unauthorized")
+	// ErrMgrTLSCertRequired the client CA of manager is set without the certificate of manager
+	ErrMgrTLSCertRequired = errors.New("manager tls certificate required")
+	// ErrCanaryNotFound the node has no canary split
+	ErrCanaryNotFound = errors.New("canary not found")
+	// ErrNodeNotFound the aggregation has no node of the index
+	ErrNodeNotFound = errors.New("node not found")
+)
+
+// Manager support runtime remote interface, the net/rpc methods on MgrAddr:
+//
+//	Manager.List          list the clusters, servers, binds, aggregations, routings and the server status
+//	Manager.AddServer     add a server and bind it to the clusters
+//	Manager.RemoveServer  remove a server and its binds
+//	Manager.DrainServer   stop or resume sending new requests to a server
+//	Manager.Stats         the request stats of the servers and the nodes
+//	Manager.SetCanary     change the percent of the canary split of a node
+//	Manager.SetMaintenance put the whole gateway or a node into maintenance, or take it out
+//	Manager.RouteTest     report the route decision of a request without forwarding it
+//	Manager.Reload        replace the whole routing config
+//	Manager.SetLogLevel, Manager.AddAnalysisPoint, Manager.GetAnalysisPoint
+//
+// The requests must carry the MgrToken if it is configured, the clients must present a certificate
+// verified by MgrTLSClientCAFile if it is configured, otherwise only the local clients are authorized.
+// The manager listen at localhost if the host of MgrAddr is empty, unless MgrAllowRemote.
+// The routing changes are validated and applied atomically by the route table.
 type Manager struct {
 	proxy *Proxy
+	// remote the addr of the rpc client, nil if the manager is called in process
+	remote net.Addr
 }
 
 func newManager(proxy *Proxy) *Manager {
 	return &Manager{proxy: proxy}
 }
 
+func (m *Manager) auth(token string) error {
+	expect := m.proxy.config.MgrToken
+	if "" != expect {
+		if subtle.ConstantTimeCompare([]byte(expect), []byte(token)) == 1 {
+			return nil
+		}
+	} else if "" != m.proxy.config.MgrTLSClientCAFile || m.isLocal() {
+		// the client certificate is verified by the tls handshake
+		return nil
+	}
+
+	log.Warnf("Mgr request from <%s> unauthorized.", m.remote)
+	return ErrMgrUnauthorized
+}
+
+func (m *Manager) isLocal() bool {
+	if nil == m.remote {
+		return true
+	}
+
+	addr, ok := m.remote.(*net.TCPAddr)
+	return ok && addr.IP.IsLoopback()
+}
+
 // SetLogLevel set log level
 func (m *Manager) SetLogLevel(req model.SetLogReq, rsp *model.SetLogRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
 	level := util.SetLogLevel(req.Level)
 	m.proxy.config.LogLevel = level
 
@@ -27,8 +88,236 @@ func (m *Manager) SetLogLevel(req model.SetLogReq, rsp *model.SetLogRsp) error {
 	return nil
 }
 
+// List return the routing config and the status of servers
+func (m *Manager) List(req model.ListReq, rsp *model.ListRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
+	data, err := json.Marshal(m.proxy.routeTable.Config())
+	if nil != err {
+		return err
+	}
+
+	rsp.Code = 0
+	rsp.Config = data
+	rsp.Servers = m.proxy.routeTable.ServerStatuses()
+	return nil
+}
+
+// AddServer add a server and bind it to the clusters
+func (m *Manager) AddServer(req model.AddServerReq, rsp *model.AddServerRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
+	if nil == req.Server {
+		return model.ErrServerNotFound
+	}
+
+	err := m.proxy.routeTable.Update(func(cfg *model.RouteConfig) error {
+		cfg.Servers = append(cfg.Servers, req.Server)
+		for _, name := range req.Clusters {
+			cfg.Binds = append(cfg.Binds, &model.Bind{ServerAddr: req.Server.Addr, ClusterName: name})
+		}
+
+		return nil
+	})
+	if nil != err {
+		log.ErrorErrorf(err, "Mgr add server <%s> fail.", req.Server.Addr)
+		return err
+	}
+
+	rsp.Code = 0
+	return nil
+}
+
+// RemoveServer remove a server and its binds
+func (m *Manager) RemoveServer(req model.RemoveServerReq, rsp *model.RemoveServerRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
+	err := m.proxy.routeTable.Update(func(cfg *model.RouteConfig) error {
+		found := false
+		servers := cfg.Servers[:0]
+		for _, svr := range cfg.Servers {
+			if svr.Addr == req.Addr {
+				found = true
+			} else {
+				servers = append(servers, svr)
+			}
+		}
+
+		if !found {
+			return model.ErrServerNotFound
+		}
+
+		binds := cfg.Binds[:0]
+		for _, b := range cfg.Binds {
+			if b.ServerAddr != req.Addr {
+				binds = append(binds, b)
+			}
+		}
+
+		cfg.Servers, cfg.Binds = servers, binds
+		return nil
+	})
+	if nil != err {
+		log.ErrorErrorf(err, "Mgr remove server <%s> fail.", req.Addr)
+		return err
+	}
+
+	rsp.Code = 0
+	return nil
+}
+
+// DrainServer stop or resume sending new requests to a server
+func (m *Manager) DrainServer(req model.DrainServerReq, rsp *model.DrainServerRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
+	err := m.proxy.routeTable.DrainServer(req.Addr, req.Draining)
+	if nil != err {
+		return err
+	}
+
+	rsp.Code = 0
+	return nil
+}
+
+// Stats returns the request stats of the servers and the nodes
+func (m *Manager) Stats(req model.StatsReq, rsp *model.StatsRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
+	rsp.Code = 0
+	rsp.Servers, rsp.Nodes = m.proxy.routeTable.Stats()
+	return nil
+}
+
+// SetCanary change the percent of the canary split of a node
+func (m *Manager) SetCanary(req model.SetCanaryReq, rsp *model.SetCanaryRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
+	err := m.proxy.routeTable.Update(func(cfg *model.RouteConfig) error {
+		for _, ang := range cfg.Aggregations {
+			if ang.URL != req.URL {
+				continue
+			}
+
+			if req.Node < 0 || req.Node >= len(ang.Nodes) || nil == ang.Nodes[req.Node].Canary {
+				return ErrCanaryNotFound
+			}
+
+			ang.Nodes[req.Node].Canary.Percent = req.Percent
+			return nil
+		}
+
+		return model.ErrAggregationNotFound
+	})
+	if nil != err {
+		log.ErrorErrorf(err, "Mgr set canary <%s, %d> fail.", req.URL, req.Node)
+		return err
+	}
+
+	rsp.Code = 0
+	return nil
+}
+
+// RouteTest report the selected nodes and servers, the rewritten uri and the filters of a request,
+// the request is not forwarded to the server
+func (m *Manager) RouteTest(req model.RouteTestReq, rsp *model.RouteTestRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
+	*rsp = *m.proxy.dryRunRoute(req)
+	rsp.Code = 0
+	return nil
+}
+
+// SetMaintenance put the whole gateway or a node into maintenance, or take it out.
+// The maintenance of node is changed in the routing config, the maintenance of the whole gateway is not persisted.
+func (m *Manager) SetMaintenance(req model.SetMaintenanceReq, rsp *model.SetMaintenanceRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
+	var maintenance *model.Maintenance
+	if req.Enabled {
+		maintenance = req.Maintenance
+		if nil == maintenance {
+			maintenance = &model.Maintenance{}
+		}
+	}
+
+	if "" == req.URL {
+		m.proxy.SetMaintenance(maintenance)
+		log.Infof("Mgr set maintenance <%v>.", req.Enabled)
+
+		rsp.Code = 0
+		return nil
+	}
+
+	err := m.proxy.routeTable.Update(func(cfg *model.RouteConfig) error {
+		for _, ang := range cfg.Aggregations {
+			if ang.URL != req.URL {
+				continue
+			}
+
+			if req.Node < 0 || req.Node >= len(ang.Nodes) {
+				return ErrNodeNotFound
+			}
+
+			ang.Nodes[req.Node].Maintenance = maintenance
+			return nil
+		}
+
+		return model.ErrAggregationNotFound
+	})
+	if nil != err {
+		log.ErrorErrorf(err, "Mgr set maintenance <%s, %d> fail.", req.URL, req.Node)
+		return err
+	}
+
+	log.Infof("Mgr set maintenance <%s, %d, %v>.", req.URL, req.Node, req.Enabled)
+
+	rsp.Code = 0
+	return nil
+}
+
+// Reload replace the routing config of route table, the route table is not changed if the config is invalid
+func (m *Manager) Reload(req model.ReloadReq, rsp *model.ReloadRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
+	cfg := &model.RouteConfig{}
+	err := json.Unmarshal(req.Config, cfg)
+	if nil == err {
+		err = m.proxy.routeTable.Reload(cfg)
+	}
+
+	if nil != err {
+		log.ErrorErrorf(err, "Mgr reload fail.")
+		return err
+	}
+
+	rsp.Code = 0
+	return nil
+}
+
 // AddAnalysisPoint add a point to analysis
 func (m *Manager) AddAnalysisPoint(req model.AddAnalysisPointReq, rsp *model.AddAnalysisPointRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
 	m.proxy.routeTable.GetAnalysis().AddRecentCount(req.Addr, req.Secs)
 
 	rsp.Code = 0
@@ -37,6 +326,10 @@ func (m *Manager) AddAnalysisPoint(req model.AddAnalysisPointReq, rsp *model.Add
 
 // GetAnalysisPoint return analysis point data
 func (m *Manager) GetAnalysisPoint(req model.GetAnalysisPointReq, rsp *model.GetAnalysisPointRsp) error {
+	if err := m.auth(req.Token); nil != err {
+		return err
+	}
+
 	analysisor := m.proxy.routeTable.GetAnalysis()
 
 	rsp.Code = 0
@@ -56,35 +349,78 @@ func (m *Manager) GetAnalysisPoint(req model.GetAnalysisPointReq, rsp *model.Get
 }
 
 func (p *Proxy) startRPCServer() error {
-	tcpAddr, err := net.ResolveTCPAddr("tcp", p.config.MgrAddr)
-
-	if err != nil {
-		return err
-	}
-
-	listener, err := net.ListenTCP("tcp", tcpAddr)
+	listener, err := p.newMgrListener()
 	if err != nil {
 		return err
 	}
 
-	log.Infof("Mgr listen at %s.", p.config.MgrAddr)
+	log.Infof("Mgr listen at %s.", listener.Addr())
 
-	server := rpc.NewServer()
+	if "" == p.config.MgrToken && "" == p.config.MgrTLSClientCAFile {
+		log.Warnf("Mgr has no token or client CA, only the local clients are authorized.")
+	}
 
-	mgrService := newManager(p)
-	server.Register(mgrService)
+	p.stopLock.Lock()
+	p.rpcListener = listener
+	p.stopLock.Unlock()
 
 	go func() {
 		for {
 			conn, err := listener.Accept()
 			if err != nil {
+				if p.isStopping() {
+					log.Infof("Mgr stopped at %s.", p.config.MgrAddr)
+					return
+				}
+
 				log.ErrorError(err, "Mgr error.")
 				continue
 			}
 
+			// the manager of each conn knows the remote addr of client
+			server := rpc.NewServer()
+			server.Register(&Manager{proxy: p, remote: conn.RemoteAddr()})
 			go server.ServeConn(conn)
 		}
 	}()
 
 	return nil
 }
+
+// newMgrListener listen at the MgrAddr, the tls is terminated if the certificate of manager is configured
+func (p *Proxy) newMgrListener() (net.Listener, error) {
+	host, port, err := net.SplitHostPort(p.config.MgrAddr)
+	if nil != err {
+		return nil, err
+	}
+
+	if "" == host && !p.config.MgrAllowRemote {
+		host = "127.0.0.1"
+	}
+
+	if "" == p.config.MgrTLSCertFile {
+		if "" != p.config.MgrTLSClientCAFile {
+			return nil, ErrMgrTLSCertRequired
+		}
+
+		return net.Listen("tcp", net.JoinHostPort(host, port))
+	}
+
+	cert, err := tls.LoadX509KeyPair(p.config.MgrTLSCertFile, p.config.MgrTLSKeyFile)
+	if nil != err {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if "" != p.config.MgrTLSClientCAFile {
+		if err := setClientCAs(tlsConfig, p.config.MgrTLSClientCAFile); nil != err {
+			return nil, err
+		}
+	}
+
+	return tls.Listen("tcp", net.JoinHostPort(host, port), tlsConfig)
+}
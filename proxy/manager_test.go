@@ -0,0 +1,492 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func TestManager(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.MgrAddr = "127.0.0.1:0"
+	cnf.MgrToken = "secret"
+	p := newTestProxy(t, cnf, "")
+
+	if err := p.startRPCServer(); nil != err {
+		t.Fatalf("start rpc err: %s", err)
+	}
+	defer p.Stop(context.Background())
+
+	client, err := rpc.Dial("tcp", p.rpcListener.Addr().String())
+	if nil != err {
+		t.Fatalf("dial err: %s", err)
+	}
+	defer client.Close()
+
+	expectCode := func(code int) {
+		ctx := doTestRequest(p, "GET", "/api")
+		if ctx.Response.StatusCode() != code {
+			t.Errorf("expect:<%d>, acture:<%d>", code, ctx.Response.StatusCode())
+		}
+	}
+
+	// unauthorized
+	err = client.Call("Manager.List", model.ListReq{Token: "invalid"}, &model.ListRsp{})
+	if nil == err || err.Error() != ErrMgrUnauthorized.Error() {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrMgrUnauthorized, err)
+	}
+
+	// add
+	err = client.Call("Manager.AddServer", model.AddServerReq{
+		Token:    "secret",
+		Server:   &model.Server{Schema: "http", Addr: backend.addr()},
+		Clusters: []string{testClusterName},
+	}, &model.AddServerRsp{})
+	if nil != err {
+		t.Fatalf("add server err: %s", err)
+	}
+	expectCode(http.StatusOK)
+
+	err = client.Call("Manager.AddServer", model.AddServerReq{
+		Token:    "secret",
+		Server:   &model.Server{Schema: "http", Addr: "127.0.0.1:1"},
+		Clusters: []string{"unknown"},
+	}, &model.AddServerRsp{})
+	if nil == err || err.Error() != model.ErrClusterNotFound.Error() {
+		t.Errorf("expect:<%s>, acture:<%v>", model.ErrClusterNotFound, err)
+	}
+
+	// list
+	rsp := &model.ListRsp{}
+	if err = client.Call("Manager.List", model.ListReq{Token: "secret"}, rsp); nil != err {
+		t.Fatalf("list err: %s", err)
+	}
+
+	cfg := &model.RouteConfig{}
+	json.Unmarshal(rsp.Config, cfg)
+	if len(cfg.Clusters) != 1 || len(cfg.Servers) != 1 || len(cfg.Binds) != 1 || cfg.Servers[0].Addr != backend.addr() {
+		t.Errorf("expect the added server, acture:<%s>", rsp.Config)
+	}
+	if len(rsp.Servers) != 1 || rsp.Servers[0].Status != model.Up || rsp.Servers[0].Draining {
+		t.Errorf("expect the up server, acture:<%+v>", rsp.Servers)
+	}
+
+	// drain
+	drain := func(draining bool) {
+		err := client.Call("Manager.DrainServer", model.DrainServerReq{
+			Token:    "secret",
+			Addr:     backend.addr(),
+			Draining: draining,
+		}, &model.DrainServerRsp{})
+		if nil != err {
+			t.Fatalf("drain server err: %s", err)
+		}
+	}
+
+	drain(true)
+	expectCode(http.StatusServiceUnavailable)
+
+	rsp = &model.ListRsp{}
+	client.Call("Manager.List", model.ListReq{Token: "secret"}, rsp)
+	if len(rsp.Servers) != 1 || !rsp.Servers[0].Draining {
+		t.Errorf("expect the draining server, acture:<%+v>", rsp.Servers)
+	}
+
+	drain(false)
+	expectCode(http.StatusOK)
+
+	// remove
+	err = client.Call("Manager.RemoveServer", model.RemoveServerReq{Token: "secret", Addr: backend.addr()}, &model.RemoveServerRsp{})
+	if nil != err {
+		t.Fatalf("remove server err: %s", err)
+	}
+	expectCode(http.StatusServiceUnavailable)
+}
+
+func TestManagerDrainServerInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	slow := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("slow"))
+	})
+	defer slow.Close()
+
+	fast := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	})
+	defer fast.Close()
+
+	cnf := newTestConf()
+	cnf.MgrAddr = "127.0.0.1:0"
+	cnf.MgrToken = "secret"
+	p := newTestProxy(t, cnf, "", slow, fast)
+
+	if err := p.startRPCServer(); nil != err {
+		t.Fatalf("start rpc err: %s", err)
+	}
+	defer p.Stop(context.Background())
+
+	client, err := rpc.Dial("tcp", p.rpcListener.Addr().String())
+	if nil != err {
+		t.Fatalf("dial err: %s", err)
+	}
+	defer client.Close()
+
+	drain := func(addr string, draining bool) {
+		err := client.Call("Manager.DrainServer", model.DrainServerReq{
+			Token:    "secret",
+			Addr:     addr,
+			Draining: draining,
+		}, &model.DrainServerRsp{})
+		if nil != err {
+			t.Fatalf("drain server err: %s", err)
+		}
+	}
+
+	// the in-flight request is sent to the slow server
+	drain(fast.addr(), true)
+	done := make(chan *fasthttp.RequestCtx)
+	go func() {
+		done <- doTestRequest(p, "GET", "/api")
+	}()
+	<-started
+	drain(fast.addr(), false)
+
+	drain(slow.addr(), true)
+	for i := 0; i < 4; i++ {
+		ctx := doTestRequest(p, "GET", "/api")
+		if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != "fast" {
+			t.Errorf("expect:<fast>, acture:<%d %s>", ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+
+	if requests := atomic.LoadInt32(&slow.requests); requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+	if conns := p.routeTable.GetServer(slow.addr()).GetActiveConns(); conns != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", conns)
+	}
+
+	close(release)
+	ctx := <-done
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != "slow" {
+		t.Errorf("expect:<slow>, acture:<%d %s>", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	// the drained server has no in-flight request, it can be removed safely
+	if conns := p.routeTable.GetServer(slow.addr()).GetActiveConns(); conns != 0 {
+		t.Errorf("expect:<0>, acture:<%d>", conns)
+	}
+}
+
+func TestManagerSetCanary(t *testing.T) {
+	stable := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stable"))
+	})
+	defer stable.Close()
+
+	canary := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("canary"))
+	})
+	defer canary.Close()
+
+	p := newTestProxy(t, newTestConf(), "", stable)
+
+	cluster, _ := model.NewCluster("canary", "^/", "")
+	p.routeTable.AddNewCluster(cluster)
+	p.routeTable.AddNewServer(&model.Server{Schema: "http", Addr: canary.addr()})
+	p.routeTable.Bind(canary.addr(), "canary")
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/api",
+			Canary:      &model.CanarySplit{ClusterName: "canary", Percent: 10},
+		},
+	}))
+
+	ratio := func() float64 {
+		canaries := 0
+		for i := 0; i < 2000; i++ {
+			if ctx := doTestRequest(p, "GET", "/api"); string(ctx.Response.Body()) == "canary" {
+				canaries++
+			}
+		}
+
+		return float64(canaries) / 2000
+	}
+
+	if r := ratio(); r < 0.07 || r > 0.13 {
+		t.Errorf("expect:<%.2f>, acture:<%.4f>", 0.1, r)
+	}
+
+	m := newManager(p)
+	err := m.SetCanary(model.SetCanaryReq{URL: "^/api$", Node: 0, Percent: 50}, &model.SetCanaryRsp{})
+	if nil != err {
+		t.Fatalf("set canary err: %s", err)
+	}
+
+	if r := ratio(); r < 0.45 || r > 0.55 {
+		t.Errorf("expect:<%.2f>, acture:<%.4f>", 0.5, r)
+	}
+
+	err = m.SetCanary(model.SetCanaryReq{URL: "^/api$", Node: 0, Percent: 200}, &model.SetCanaryRsp{})
+	if err != model.ErrInvalidCanaryPercent {
+		t.Errorf("expect:<%s>, acture:<%v>", model.ErrInvalidCanaryPercent, err)
+	}
+}
+
+func TestManagerSetMaintenance(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.MaintenanceBody = "under maintenance"
+	cnf.MaintenanceRetryAfter = 120
+	p := newTestProxy(t, cnf, "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/orders$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/orders"},
+	}))
+
+	expect := func(uri string, code int, body string, retryAfter string) {
+		ctx := doTestRequest(p, "GET", uri)
+		if ctx.Response.StatusCode() != code || string(ctx.Response.Body()) != body {
+			t.Errorf("%s expect:<%d %s>, acture:<%d %s>", uri, code, body, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+
+		if value := string(ctx.Response.Header.Peek(headerRetryAfter)); value != retryAfter {
+			t.Errorf("%s expect:<%s>, acture:<%s>", uri, retryAfter, value)
+		}
+	}
+
+	m := newManager(p)
+
+	// the node in maintenance with the configured defaults
+	err := m.SetMaintenance(model.SetMaintenanceReq{URL: "^/orders$", Node: 0, Enabled: true}, &model.SetMaintenanceRsp{})
+	if nil != err {
+		t.Fatalf("set maintenance err: %s", err)
+	}
+	expect("/orders", http.StatusServiceUnavailable, "under maintenance", "120")
+	expect("/api", http.StatusOK, "OK", "")
+	if requests := atomic.LoadInt32(&backend.requests); requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+
+	// the whole gateway in maintenance with the custom response
+	err = m.SetMaintenance(model.SetMaintenanceReq{
+		Enabled:     true,
+		Maintenance: &model.Maintenance{ContentType: "application/json", Body: `{"code":"maintenance"}`, RetryAfter: 30},
+	}, &model.SetMaintenanceRsp{})
+	if nil != err {
+		t.Fatalf("set maintenance err: %s", err)
+	}
+	expect("/api", http.StatusServiceUnavailable, `{"code":"maintenance"}`, "30")
+
+	// disabled
+	m.SetMaintenance(model.SetMaintenanceReq{Enabled: false}, &model.SetMaintenanceRsp{})
+	m.SetMaintenance(model.SetMaintenanceReq{URL: "^/orders$", Node: 0, Enabled: false}, &model.SetMaintenanceRsp{})
+	expect("/api", http.StatusOK, "OK", "")
+	expect("/orders", http.StatusOK, "OK", "")
+
+	err = m.SetMaintenance(model.SetMaintenanceReq{URL: "^/orders$", Node: 1, Enabled: true}, &model.SetMaintenanceRsp{})
+	if ErrNodeNotFound != err {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrNodeNotFound, err)
+	}
+}
+
+func TestManagerStats(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.MgrAddr = "127.0.0.1:0"
+	p := newTestProxy(t, cnf, "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api/", []*model.Node{
+		&model.Node{ClusterName: testClusterName},
+	}))
+
+	if err := p.startRPCServer(); nil != err {
+		t.Fatalf("start rpc err: %s", err)
+	}
+	defer p.Stop(context.Background())
+
+	client, err := rpc.Dial("tcp", p.rpcListener.Addr().String())
+	if nil != err {
+		t.Fatalf("dial err: %s", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 8; i++ {
+		doTestRequest(p, "GET", "/api/stats")
+	}
+	for i := 0; i < 2; i++ {
+		doTestRequest(p, "GET", "/api/stats?fail=1")
+	}
+
+	rsp := &model.StatsRsp{}
+	if err = client.Call("Manager.Stats", model.StatsReq{}, rsp); nil != err {
+		t.Fatalf("stats err: %s", err)
+	}
+
+	if len(rsp.Servers) != 1 || len(rsp.Nodes) != 1 {
+		t.Fatalf("expect:<1, 1>, acture:<%d, %d>", len(rsp.Servers), len(rsp.Nodes))
+	}
+
+	for _, stats := range []model.RequestStatsSnapshot{rsp.Servers[0].RequestStatsSnapshot, rsp.Nodes[0].RequestStatsSnapshot} {
+		if stats.Requests != 10 || stats.Successes != 8 || stats.Errors != 2 || stats.InFlight != 0 {
+			t.Errorf("expect:<10, 8, 2, 0>, acture:<%+v>", stats)
+		}
+
+		if stats.P50 <= 0 || stats.P99 < stats.P50 {
+			t.Errorf("expect the latencies, acture:<%+v>", stats)
+		}
+	}
+
+	if rsp.Servers[0].Addr != backend.addr() || rsp.Servers[0].Circuit != model.CircuitOpen {
+		t.Errorf("expect:<%s, open>, acture:<%+v>", backend.addr(), rsp.Servers[0])
+	}
+
+	if rsp.Nodes[0].AggregationURL != "^/api/" || rsp.Nodes[0].ClusterName != testClusterName {
+		t.Errorf("expect:<^/api/, %s>, acture:<%+v>", testClusterName, rsp.Nodes[0])
+	}
+}
+
+func TestManagerAuth(t *testing.T) {
+	local := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1234}
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}
+
+	cases := []struct {
+		token    string
+		clientCA string
+		remote   net.Addr
+		reqToken string
+		err      error
+	}{
+		{remote: local},
+		{remote: nil},
+		{remote: remote, err: ErrMgrUnauthorized},
+		{remote: remote, clientCA: "ca.crt"},
+		{token: "secret", remote: remote, reqToken: "secret"},
+		{token: "secret", remote: local, reqToken: "invalid", err: ErrMgrUnauthorized},
+		{token: "secret", clientCA: "ca.crt", remote: remote, err: ErrMgrUnauthorized},
+	}
+
+	for i, c := range cases {
+		cnf := newTestConf()
+		cnf.MgrToken = c.token
+		cnf.MgrTLSClientCAFile = c.clientCA
+		m := &Manager{proxy: newTestProxy(t, cnf, ""), remote: c.remote}
+
+		if err := m.auth(c.reqToken); err != c.err {
+			t.Errorf("case %d expect:<%v>, acture:<%v>", i, c.err, err)
+		}
+	}
+}
+
+func TestManagerListenLocal(t *testing.T) {
+	cases := []struct {
+		allowRemote bool
+		loopback    bool
+	}{
+		{allowRemote: false, loopback: true},
+		{allowRemote: true, loopback: false},
+	}
+
+	for _, c := range cases {
+		cnf := newTestConf()
+		cnf.MgrAddr = ":0"
+		cnf.MgrAllowRemote = c.allowRemote
+		p := newTestProxy(t, cnf, "")
+
+		ln, err := p.newMgrListener()
+		if nil != err {
+			t.Fatalf("listen err: %s", err)
+		}
+
+		if loopback := ln.Addr().(*net.TCPAddr).IP.IsLoopback(); loopback != c.loopback {
+			t.Errorf("expect:<%t>, acture:<%t>", c.loopback, loopback)
+		}
+		ln.Close()
+	}
+}
+
+func TestManagerMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mgr")
+	if nil != err {
+		t.Fatalf("create dir err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, dir, "ca", nil)
+	cert := newTestCert(t, dir, "gateway", ca, "127.0.0.1")
+	client := newTestCert(t, dir, "client", ca, "client.test")
+
+	cnf := newTestConf()
+	cnf.MgrAddr = "127.0.0.1:0"
+	cnf.MgrTLSClientCAFile = ca.certFile
+	p := newTestProxy(t, cnf, "")
+
+	if err := p.startRPCServer(); err != ErrMgrTLSCertRequired {
+		t.Errorf("expect:<%s>, acture:<%v>", ErrMgrTLSCertRequired, err)
+	}
+
+	cnf.MgrTLSCertFile = cert.certFile
+	cnf.MgrTLSKeyFile = cert.keyFile
+	if err := p.startRPCServer(); nil != err {
+		t.Fatalf("start rpc err: %s", err)
+	}
+	defer p.Stop(context.Background())
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	call := func(certs ...tls.Certificate) error {
+		conn, err := tls.Dial("tcp", p.rpcListener.Addr().String(), &tls.Config{RootCAs: pool, Certificates: certs})
+		if nil != err {
+			return err
+		}
+
+		rpcClient := rpc.NewClient(conn)
+		defer rpcClient.Close()
+		return rpcClient.Call("Manager.List", model.ListReq{}, &model.ListRsp{})
+	}
+
+	pair, err := tls.LoadX509KeyPair(client.certFile, client.keyFile)
+	if nil != err {
+		t.Fatalf("load cert err: %s", err)
+	}
+
+	if err := call(pair); nil != err {
+		t.Errorf("expect the verified client is authorized, acture:<%s>", err)
+	}
+
+	if err := call(); nil == err {
+		t.Errorf("expect the client without certificate is rejected")
+	}
+}
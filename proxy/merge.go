@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrNonJSONResponse the sub-response of merge is not a valid json
+	ErrNonJSONResponse = errors.New("non-JSON response")
+)
+
+// checkMergeBody returns ErrNonJSONResponse if the body of sub-response is not a valid json
+// and the merge policy of non-JSON is error
+func checkMergeBody(result *model.RouteResult) error {
+	if model.MergeNonJSONError != result.Aggregation.GetMerge().NonJSON || json.Valid(result.Res.Body()) {
+		return nil
+	}
+
+	result.Code = http.StatusBadGateway
+	return ErrNonJSONResponse
+}
+
+// getSubRequestKey returns the key of the sub-request of merge after the pre filters,
+// the identical sub-requests have the same cluster, request line, headers and body
+func getSubRequestKey(result *model.RouteResult, outreq *fasthttp.Request) string {
+	// the request line of header is not updated by the uri changed
+	return result.Cluster.Name + "\n" + string(outreq.URI().FullURI()) + "\n" + string(outreq.Header.Header()) + string(outreq.Body())
+}
+
+// doSharedRequest send the identical sub-requests of merge to backend server once, the others share a copy of the response
+// and execute the post filters of their nodes. The others send themselves if the first one is failed.
+func (p *Proxy) doSharedRequest(c *FilterContext, outreq *fasthttp.Request, flights *responseFlights, key string) (*fasthttp.Response, error) {
+	if nil == flights {
+		return p.doRequest(c, outreq)
+	}
+
+	flight, leader := flights.join(key)
+	if leader {
+		res, err := p.doRequest(c, outreq)
+
+		var shared *fasthttp.Response
+		if nil == err && nil == c.result.Stream && res.StatusCode() < fasthttp.StatusInternalServerError {
+			shared = res
+		}
+		flights.leave(key, shared)
+
+		return res, err
+	}
+
+	<-flight.done
+	if nil == flight.res {
+		return p.doRequest(c, outreq)
+	}
+
+	res := fasthttp.AcquireResponse()
+	flight.res.CopyTo(res)
+	return res, nil
+}
+
+// writeMerge write the sub-responses of nodes as a json object by the merge config of aggregation,
+// the failed sub-responses are merged as null or the error object, see copyMergeHeaders for the headers
+func (p *Proxy) writeMerge(ctx *fasthttp.RequestCtx, results []*model.RouteResult) {
+	merge := results[0].Aggregation.GetMerge()
+
+	copyMergeHeaders(&ctx.Response.Header, results)
+
+	ctx.Response.Header.Add(HeaderContentType, MergeContentType)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	if hasFailedResult(results) {
+		ctx.SetStatusCode(merge.GetPartialStatusCode())
+	}
+
+	buf := &bytes.Buffer{}
+	if "" != merge.Envelope {
+		buf.WriteString("{")
+		writeJSONString(buf, merge.Envelope)
+		buf.WriteString(":")
+	}
+
+	buf.WriteString("{")
+	for index, result := range results {
+		if index > 0 {
+			buf.WriteString(",")
+		}
+
+		writeJSONString(buf, result.Node.AttrName)
+		buf.WriteString(":")
+		writeMergeValue(buf, merge, result)
+
+		result.Release()
+	}
+	buf.WriteString("}")
+
+	if "" != merge.Envelope {
+		buf.WriteString("}")
+	}
+
+	ctx.Write(buf.Bytes())
+}
+
+// copyMergeHeaders copy the headers of the succeeded sub-responses to the merged response in the order of nodes:
+// the hop-by-hop headers and MergeRemoveHeaders are dropped,
+// the cookies are set by the first sub-response of the cookie name,
+// the Cache-Control is kept if all sub-responses have the same value, otherwise no-store,
+// the other headers are set by the first sub-response of the header.
+func copyMergeHeaders(dst *fasthttp.ResponseHeader, results []*model.RouteResult) {
+	skip := make(map[string]bool, len(hopHeaders)+len(MergeRemoveHeaders))
+	for _, h := range hopHeaders {
+		skip[h] = true
+	}
+	for _, h := range MergeRemoveHeaders {
+		skip[h] = true
+	}
+
+	cookies := make(map[string]bool)
+	owners := make(map[string]int)
+	cacheControl, first := "", true
+
+	for index, result := range results {
+		if nil != result.Err || nil == result.Res {
+			continue
+		}
+
+		value := string(result.Res.Header.Peek(headerCacheControl))
+		if first {
+			cacheControl, first = value, false
+		} else if value != cacheControl {
+			cacheControl = string(noStore)
+		}
+
+		result.Res.Header.VisitAllCookie(func(key, value []byte) {
+			if name := string(key); !cookies[name] {
+				cookies[name] = true
+
+				cookie := fasthttp.AcquireCookie()
+				cookie.ParseBytes(value)
+				dst.SetCookie(cookie)
+				fasthttp.ReleaseCookie(cookie)
+			}
+		})
+
+		result.Res.Header.VisitAll(func(key, value []byte) {
+			name := string(key)
+			if skip[name] || headerCacheControl == name || headerSetCookie == name {
+				return
+			}
+
+			owner, ok := owners[name]
+			switch {
+			case !ok:
+				owners[name] = index
+				dst.SetBytesV(name, value)
+			case owner == index:
+				dst.AddBytesV(name, value)
+			}
+		})
+	}
+
+	if "" != cacheControl {
+		dst.Set(headerCacheControl, cacheControl)
+	}
+}
+
+func hasFailedResult(results []*model.RouteResult) bool {
+	for _, result := range results {
+		if nil != result.Err {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeMergeValue(buf *bytes.Buffer, merge *model.MergeConfig, result *model.RouteResult) {
+	if nil != result.Err {
+		if model.MergeFailureError != merge.Failure {
+			buf.WriteString("null")
+			return
+		}
+
+		value, _ := json.Marshal(map[string]interface{}{
+			"code":  result.Code,
+			"error": result.Err.Error(),
+		})
+		buf.Write(value)
+		return
+	}
+
+	body := result.Res.Body()
+	if model.MergeNonJSONBase64 == merge.NonJSON && !json.Valid(body) {
+		writeJSONString(buf, base64.StdEncoding.EncodeToString(body))
+		return
+	}
+
+	buf.Write(body)
+}
+
+func writeJSONString(buf *bytes.Buffer, value string) {
+	data, _ := json.Marshal(value)
+	buf.Write(data)
+}
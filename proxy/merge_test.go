@@ -0,0 +1,386 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestMergeProxy(t *testing.T, merge *model.MergeConfig) (*Proxy, *testBackend) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Write([]byte(`{"id":1}`))
+		case "/text":
+			w.Write([]byte("hello"))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(&model.Aggregation{
+		URL: "^/merge$",
+		Nodes: []*model.Node{
+			&model.Node{ClusterName: testClusterName, URL: "/json", AttrName: "json"},
+			&model.Node{ClusterName: testClusterName, URL: "/fail", AttrName: "fail"},
+		},
+		Merge: merge,
+	})
+	p.routeTable.AddNewAggregation(&model.Aggregation{
+		URL: "^/text$",
+		Nodes: []*model.Node{
+			&model.Node{ClusterName: testClusterName, URL: "/json", AttrName: "json"},
+			&model.Node{ClusterName: testClusterName, URL: "/text", AttrName: "text"},
+		},
+		Merge: merge,
+	})
+
+	return p, backend
+}
+
+func TestMergePartialFailure(t *testing.T) {
+	cases := []struct {
+		merge  *model.MergeConfig
+		code   int
+		expect string
+	}{
+		{merge: nil, code: http.StatusInternalServerError, expect: ""},
+		{merge: &model.MergeConfig{Failure: model.MergeFailureFail}, code: http.StatusInternalServerError, expect: ""},
+		{merge: &model.MergeConfig{Failure: model.MergeFailureNull}, code: http.StatusOK, expect: `{"json":{"id":1},"fail":null}`},
+		{merge: &model.MergeConfig{Failure: model.MergeFailureError, Envelope: "data"}, code: http.StatusOK,
+			expect: `{"data":{"json":{"id":1},"fail":{"code":500,"error":"backend server failure"}}}`},
+	}
+
+	for _, c := range cases {
+		p, backend := newTestMergeProxy(t, c.merge)
+
+		ctx := doTestRequest(p, "GET", "/merge")
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("expect:<%d>, acture:<%d>", c.code, ctx.Response.StatusCode())
+		}
+
+		if body := string(ctx.Response.Body()); body != c.expect {
+			t.Errorf("expect:<%s>, acture:<%s>", c.expect, body)
+		}
+
+		backend.Close()
+	}
+}
+
+func TestMergeNonJSON(t *testing.T) {
+	cases := []struct {
+		merge  *model.MergeConfig
+		code   int
+		expect string
+	}{
+		{merge: nil, code: http.StatusOK, expect: `{"json":{"id":1},"text":hello}`},
+		{merge: &model.MergeConfig{NonJSON: model.MergeNonJSONBase64}, code: http.StatusOK, expect: `{"json":{"id":1},"text":"aGVsbG8="}`},
+		{merge: &model.MergeConfig{NonJSON: model.MergeNonJSONError}, code: http.StatusBadGateway, expect: ""},
+		{merge: &model.MergeConfig{NonJSON: model.MergeNonJSONError, Failure: model.MergeFailureNull}, code: http.StatusOK,
+			expect: `{"json":{"id":1},"text":null}`},
+	}
+
+	for _, c := range cases {
+		p, backend := newTestMergeProxy(t, c.merge)
+
+		ctx := doTestRequest(p, "GET", "/text")
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("expect:<%d>, acture:<%d>", c.code, ctx.Response.StatusCode())
+		}
+
+		if body := string(ctx.Response.Body()); body != c.expect {
+			t.Errorf("expect:<%s>, acture:<%s>", c.expect, body)
+		}
+
+		backend.Close()
+	}
+}
+
+func TestMergeBestEffort(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte(`"` + r.URL.Path + `"`))
+	})
+	defer backend.Close()
+
+	cases := []struct {
+		merge  *model.MergeConfig
+		code   int
+		expect string
+	}{
+		{merge: &model.MergeConfig{Failure: model.MergeFailureFail, PartialStatusCode: http.StatusMultiStatus}, code: http.StatusServiceUnavailable, expect: ""},
+		{merge: &model.MergeConfig{Failure: model.MergeFailureError}, code: http.StatusOK,
+			expect: `{"a":"/a","fail":{"code":503,"error":"backend server failure"},"b":"/b"}`},
+		{merge: &model.MergeConfig{Failure: model.MergeFailureError, PartialStatusCode: http.StatusMultiStatus}, code: http.StatusMultiStatus,
+			expect: `{"a":"/a","fail":{"code":503,"error":"backend server failure"},"b":"/b"}`},
+	}
+
+	for _, c := range cases {
+		p := newTestProxy(t, newTestConf(), "", backend)
+		p.routeTable.AddNewAggregation(&model.Aggregation{
+			URL: "^/dashboard$",
+			Nodes: []*model.Node{
+				&model.Node{ClusterName: testClusterName, URL: "/a", AttrName: "a"},
+				&model.Node{ClusterName: testClusterName, URL: "/fail", AttrName: "fail"},
+				&model.Node{ClusterName: testClusterName, URL: "/b", AttrName: "b"},
+			},
+			Merge: c.merge,
+		})
+
+		ctx := doTestRequest(p, "GET", "/dashboard")
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("expect:<%d>, acture:<%d>", c.code, ctx.Response.StatusCode())
+		}
+
+		if body := string(ctx.Response.Body()); body != c.expect {
+			t.Errorf("expect:<%s>, acture:<%s>", c.expect, body)
+		}
+	}
+
+	// all sub-responses succeed
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(&model.Aggregation{
+		URL: "^/dashboard$",
+		Nodes: []*model.Node{
+			&model.Node{ClusterName: testClusterName, URL: "/a", AttrName: "a"},
+			&model.Node{ClusterName: testClusterName, URL: "/b", AttrName: "b"},
+		},
+		Merge: &model.MergeConfig{Failure: model.MergeFailureError, PartialStatusCode: http.StatusMultiStatus},
+	})
+
+	if ctx := doTestRequest(p, "GET", "/dashboard"); ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+}
+
+func TestMergeTimeout(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		w.Write([]byte(`"` + r.URL.Path + `"`))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(&model.Aggregation{
+		URL: "^/dashboard$",
+		Nodes: []*model.Node{
+			&model.Node{ClusterName: testClusterName, URL: "/a", AttrName: "a"},
+			&model.Node{ClusterName: testClusterName, URL: "/slow", AttrName: "slow"},
+		},
+		Merge: &model.MergeConfig{Failure: model.MergeFailureNull, Timeout: 100 * time.Millisecond},
+	})
+
+	start := time.Now()
+	ctx := doTestRequest(p, "GET", "/dashboard")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("expect:<%s>, acture:<%s>", 100*time.Millisecond, elapsed)
+	}
+
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	expect := `{"a":"/a","slow":null}`
+	if body := string(ctx.Response.Body()); body != expect {
+		t.Errorf("expect:<%s>, acture:<%s>", expect, body)
+	}
+
+	// the canceled sub-request release the server
+	if conns := p.routeTable.GetServer(backend.addr()).GetActiveConns(); conns != 0 {
+		t.Errorf("expect:<0>, acture:<%d>", conns)
+	}
+}
+
+func TestMergeHeaders(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path[1:]
+		switch name {
+		case "a":
+			w.Header().Set(headerCacheControl, "max-age=60")
+		case "b":
+			w.Header().Set(headerCacheControl, "private, no-cache")
+		}
+
+		w.Header().Add("Set-Cookie", "session="+name)
+		w.Header().Add("Set-Cookie", "user-"+name+"=1")
+		w.Header().Set("X-Backend", name)
+		w.Header().Add("Vary", "Origin-"+name)
+		w.Header().Add("Vary", "Accept-"+name)
+		w.Header().Set("Proxy-Authenticate", "Basic")
+		w.Write([]byte(`"` + name + `"`))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/merge$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/a", AttrName: "a"},
+		&model.Node{ClusterName: testClusterName, URL: "/b", AttrName: "b"},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/same$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/a", AttrName: "a"},
+		&model.Node{ClusterName: testClusterName, URL: "/a", AttrName: "b"},
+	}))
+
+	ctx := doTestRequest(p, "GET", "/merge")
+	header := &ctx.Response.Header
+
+	if value := string(header.Peek(headerCacheControl)); value != string(noStore) {
+		t.Errorf("expect:<%s>, acture:<%s>", noStore, value)
+	}
+
+	cookies := make(map[string]string)
+	header.VisitAllCookie(func(key, value []byte) {
+		cookie := fasthttp.AcquireCookie()
+		cookie.ParseBytes(value)
+		cookies[string(key)] = string(cookie.Value())
+		fasthttp.ReleaseCookie(cookie)
+	})
+
+	if len(cookies) != 3 || cookies["session"] != "a" || cookies["user-a"] != "1" || cookies["user-b"] != "1" {
+		t.Errorf("expect:<session=a, user-a=1, user-b=1>, acture:<%v>", cookies)
+	}
+
+	if value := string(header.Peek("X-Backend")); value != "a" {
+		t.Errorf("expect:<a>, acture:<%s>", value)
+	}
+
+	var vary []string
+	header.VisitAll(func(key, value []byte) {
+		if string(key) == "Vary" {
+			vary = append(vary, string(value))
+		}
+	})
+	if len(vary) != 2 || vary[0] != "Origin-a" || vary[1] != "Accept-a" {
+		t.Errorf("expect:<[Origin-a Accept-a]>, acture:<%v>", vary)
+	}
+
+	if value := header.Peek("Proxy-Authenticate"); len(value) > 0 {
+		t.Errorf("expect:<>, acture:<%s>", value)
+	}
+
+	ctx = doTestRequest(p, "GET", "/same")
+	if value := string(ctx.Response.Header.Peek(headerCacheControl)); value != "max-age=60" {
+		t.Errorf("expect:<max-age=60>, acture:<%s>", value)
+	}
+}
+
+func TestMergeDuplicateSubRequests(t *testing.T) {
+	var calls int32
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(`{"path":"` + r.URL.Path + `"}`))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(&model.Aggregation{
+		URL: "^/dashboard$",
+		Nodes: []*model.Node{
+			&model.Node{ClusterName: testClusterName, URL: "/fragment", AttrName: "a"},
+			&model.Node{ClusterName: testClusterName, URL: "/fragment", AttrName: "b"},
+			&model.Node{ClusterName: testClusterName, URL: "/other", AttrName: "c"},
+		},
+	})
+
+	ctx := doTestRequest(p, "GET", "/dashboard")
+	expect := `{"a":{"path":"/fragment"},"b":{"path":"/fragment"},"c":{"path":"/other"}}`
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != expect {
+		t.Errorf("expect:<%s>, acture:<%d, %s>", expect, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("expect the duplicate sub-request proxied once, calls:<%d>", n)
+	}
+}
+
+func TestMergeFilterHeaders(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id":1}`))
+	})
+	defer backend.Close()
+
+	introspect := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"active":true}`))
+	})
+	defer introspect.Close()
+
+	cnf := newTestConf()
+	cnf.EnableTracing = true
+	cnf.JWTSecret = "secret"
+	cnf.APIKeys = map[string]string{"key": "account"}
+	cnf.BasicAuthUsers = map[string]string{"user": basicAuthHash(t, "password")}
+	cnf.OAuthIntrospectURL = introspect.URL
+	cnf.HMACSecret = "secret"
+	cnf.CORSAllowOrigins = []string{"*"}
+	cnf.CacheTTL = 1
+	cnf.CacheKeyHeaders = []string{"Accept"}
+	cnf.IdempotencyMethods = []string{"GET"}
+	cnf.RateLimit = 1000
+
+	newNode := func(url string) *model.Node {
+		return &model.Node{
+			ClusterName:       testClusterName,
+			URL:               url,
+			AttrName:          url[1:],
+			BasicAuth:         true,
+			IPFilter:          &model.IPFilter{TrustXForwardedFor: true},
+			RequestValidation: &model.RequestValidation{RequiredHeaders: []string{"Accept"}},
+			Methods:           &model.MethodRules{Allow: []string{"GET"}},
+			RequestHeaders:    &model.HeaderRules{Add: map[string]string{"X-Host": "${host}"}},
+			ResponseHeaders:   &model.HeaderRules{Add: map[string]string{"X-Path": "${path}"}},
+			Affinity:          &model.SessionAffinity{},
+		}
+	}
+
+	filters := []string{FilterAPIKey, FilterJWT, FilterCORS, FilterCache, FilterIPFilter, FilterBasicAuth,
+		FilterOAuthIntrospect, FilterHMACVerify, FilterIdempotency, FilterSingleFlight, FilterValidateRequest,
+		FilterMethod, FilterHeaderRules, FilterClientRateLimit}
+	for _, name := range filters {
+		p := newTestProxy(t, cnf, "", backend)
+		p.RegistryFilter(name)
+		p.routeTable.AddNewAggregation(&model.Aggregation{
+			URL:   "^/merge$",
+			Nodes: []*model.Node{newNode("/a"), newNode("/b"), newNode("/c")},
+		})
+
+		// the sub-requests of merge read the headers of client concurrently, it is checked by -race
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/merge")
+		req.Header.SetHost("gateway")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer token")
+		req.Header.Set("X-Api-Key", "key")
+		req.Header.Set("Origin", "http://example.com")
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		req.Header.Set("X-Signature", "sha256=00")
+		req.Header.Set("X-Timestamp", "0")
+		req.Header.Set("Idempotency-Key", "1")
+		req.Header.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		req.Header.SetCookie("GATEWAY_AFFINITY", "token")
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, nil, nil)
+		p.ReverseProxyHandler(ctx)
+
+		if ctx.Response.StatusCode() == http.StatusInternalServerError {
+			t.Errorf("%s expect not:<%d>, acture:<%d>", name, http.StatusInternalServerError, ctx.Response.StatusCode())
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/pkg/metrics"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+const (
+	metricsPath = "/metrics"
+)
+
+// proxyMetrics the metrics of proxy, the labels are the cluster name, node url and server addr,
+// all of them come from the route table, so the cardinality is bounded.
+type proxyMetrics struct {
+	registry       *metrics.Registry
+	requests       *metrics.CounterVec
+	latency        *metrics.HistogramVec
+	inFlight       *metrics.GaugeVec
+	upstreamErrors *metrics.CounterVec
+	retries        *metrics.CounterVec
+	mirrors        *metrics.CounterVec
+	panics         *metrics.CounterVec
+}
+
+func newProxyMetrics() *proxyMetrics {
+	registry := metrics.NewRegistry()
+
+	return &proxyMetrics{
+		registry:       registry,
+		requests:       registry.NewCounterVec("gateway_requests_total", "Total number of proxied requests.", "cluster", "node", "code"),
+		latency:        registry.NewHistogramVec("gateway_request_duration_seconds", "Round trip latency of backend servers.", nil, "cluster", "node"),
+		inFlight:       registry.NewGaugeVec("gateway_requests_in_flight", "Number of requests being proxied.", "cluster", "node"),
+		upstreamErrors: registry.NewCounterVec("gateway_upstream_errors_total", "Total number of backend server failures.", "cluster", "node", "server"),
+		retries:        registry.NewCounterVec("gateway_retries_total", "Total number of retries to the other servers.", "cluster", "node"),
+		mirrors:        registry.NewCounterVec("gateway_mirror_requests_total", "Total number of mirrored requests.", "cluster", "node", "code"),
+		panics:         registry.NewCounterVec("gateway_panics_total", "Total number of recovered panics.", "cluster", "node"),
+	}
+}
+
+// begin record a request start to proxy, returns the func to call when the request is done
+func (m *proxyMetrics) begin(result *model.RouteResult) func() {
+	cluster, node := metricsLabels(result)
+
+	inFlight := m.inFlight.With(cluster, node)
+	inFlight.Inc()
+
+	return func() {
+		inFlight.Dec()
+
+		code := result.Code
+		if nil == result.Err && nil != result.Res {
+			code = result.Res.StatusCode()
+		}
+
+		m.requests.With(cluster, node, strconv.Itoa(code)).Inc()
+	}
+}
+
+func (m *proxyMetrics) observeLatency(result *model.RouteResult, startAt, endAt int64) {
+	cluster, node := metricsLabels(result)
+	m.latency.With(cluster, node).Observe(float64(endAt-startAt) / float64(time.Second))
+}
+
+func (m *proxyMetrics) incUpstreamErrors(result *model.RouteResult) {
+	cluster, node := metricsLabels(result)
+	m.upstreamErrors.With(cluster, node, result.Svr.Addr).Inc()
+}
+
+func (m *proxyMetrics) incRetries(result *model.RouteResult) {
+	cluster, node := metricsLabels(result)
+	m.retries.With(cluster, node).Inc()
+}
+
+func (m *proxyMetrics) incMirrors(cluster string, node string, code int) {
+	m.mirrors.With(cluster, node, strconv.Itoa(code)).Inc()
+}
+
+// incPanics record a recovered panic, the labels are empty if the panic is not in the proxy of a result
+func (m *proxyMetrics) incPanics(result *model.RouteResult) {
+	var cluster, node string
+	if nil != result {
+		cluster, node = metricsLabels(result)
+	}
+
+	m.panics.With(cluster, node).Inc()
+}
+
+func metricsLabels(result *model.RouteResult) (cluster string, node string) {
+	if nil != result.Cluster {
+		cluster = result.Cluster.Name
+	}
+
+	if nil != result.Node {
+		node = result.Node.URL
+	}
+
+	return cluster, node
+}
+
+func (p *Proxy) startMetricsServer() {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, p.metrics.registry)
+
+	log.Infof("Metrics listen at %s.", p.config.MetricsAddr)
+	log.ErrorErrorf(http.ListenAndServe(p.config.MetricsAddr, mux), "Metrics exit at %s", p.config.MetricsAddr)
+}
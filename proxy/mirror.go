@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/valyala/fasthttp"
+)
+
+// mirror send the copy of outreq to the shadow cluster of node asynchronously,
+// the shadow response and error are only logged and metered
+func (p *Proxy) mirror(c *FilterContext, outreq *fasthttp.Request) {
+	node := c.result.Node
+	if nil == node || !node.ShouldMirror() {
+		return
+	}
+
+	requestID := c.runtimeVar[requestIDRuntimeVar]
+	clusterName := node.Mirror.ClusterName
+
+	svr := p.routeTable.SelectClusterServer(c.Request(), c.runtimeVar[clientIPRuntimeVar], clusterName)
+	if nil == svr {
+		log.Warnf("[%s] Proxy mirror <%s> fail, no server", requestID, clusterName)
+		p.metrics.incMirrors(clusterName, node.URL, p.getFailureStatusCode(ErrNoServer, nil))
+		return
+	}
+
+	tlsConfig, err := getTLSConfig(c.result)
+	if nil != err {
+		log.WarnErrorf(err, "[%s] Proxy mirror <%s> fail", requestID, svr.Addr)
+		return
+	}
+
+	req := copyRequest(outreq)
+	if c.result.NeedRewrite() && "" == node.HostHeader {
+		req.SetHost(svr.Addr)
+	}
+
+	client := p.getClient(c.result)
+	deadline := p.getDeadline(c.result)
+
+	go func() {
+		defer fasthttp.ReleaseRequest(req)
+
+		res, err := client.DoWithLimit(req, svr.Addr, tlsConfig, deadline, p.config.MaxResponseBodySize)
+		if nil != res {
+			defer fasthttp.ReleaseResponse(res)
+		}
+
+		if nil != err {
+			log.InfoErrorf(err, "[%s] Proxy mirror fail <%s>", requestID, svr.Addr)
+			p.metrics.incMirrors(clusterName, node.URL, p.getFailureStatusCode(err, nil))
+			return
+		}
+
+		log.Debugf("[%s] Proxy mirror <%s>, Code <%d>", requestID, svr.Addr, res.StatusCode())
+		p.metrics.incMirrors(clusterName, node.URL, res.StatusCode())
+	}()
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestMirror(t *testing.T) {
+	primary := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	})
+	defer primary.Close()
+
+	mirrored := make(chan string, 1)
+	release := make(chan struct{})
+	shadow := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mirrored <- r.URL.Path + ":" + string(body)
+
+		// the slow shadow server never block the primary response
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("shadow"))
+	})
+	defer shadow.Close()
+	defer close(release)
+
+	p := newTestProxy(t, newTestConf(), "", primary)
+
+	cluster, _ := model.NewCluster("shadow", "^/", "")
+	p.routeTable.AddNewCluster(cluster)
+	p.routeTable.AddNewServer(&model.Server{Schema: "http", Addr: shadow.addr()})
+	p.routeTable.Bind(shadow.addr(), "shadow")
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/api",
+			Mirror:      &model.MirrorConfig{ClusterName: "shadow", Percent: 100},
+		},
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ctx := doTestRequest(p, "GET", "/api")
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+		}
+
+		if string(ctx.Response.Body()) != "primary" {
+			t.Errorf("expect:<primary>, acture:<%s>", ctx.Response.Body())
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("the primary response is blocked by the shadow server")
+	}
+
+	select {
+	case req := <-mirrored:
+		if req != "/api:" {
+			t.Errorf("expect:<%s>, acture:<%s>", "/api:", req)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the shadow server expect the request")
+	}
+
+	if requests := primary.requests; requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// lowercasePath lowercase the request path before matching by LowercasePath, only the paths with
+// the LowercasePathPrefixes are lowercased if they are set. The query string is not changed.
+func (p *Proxy) lowercasePath(ctx *fasthttp.RequestCtx) {
+	if !p.config.LowercasePath {
+		return
+	}
+
+	path := string(ctx.URI().Path())
+	lower := strings.ToLower(path)
+	if lower == path || !hasLowercasePrefix(lower, p.config.LowercasePathPrefixes) {
+		return
+	}
+
+	ctx.URI().SetPath(lower)
+}
+
+func hasLowercasePrefix(path string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, strings.ToLower(prefix)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestLowercasePath(t *testing.T) {
+	var received atomic.Value
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.URL.RequestURI())
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cases := []struct {
+		enabled  bool
+		prefixes []string
+		uri      string
+		expect   string
+	}{
+		// the matched node strip the prefix
+		{enabled: true, uri: "/Users/ZhangSan?Name=ZhangSan", expect: "/zhangsan?Name=ZhangSan"},
+		{enabled: true, uri: "/users/zhangsan", expect: "/zhangsan"},
+		{enabled: false, uri: "/Users/ZhangSan?Name=ZhangSan", expect: "/Users/ZhangSan?Name=ZhangSan"},
+		{enabled: true, prefixes: []string{"/API"}, uri: "/Api/Items?Q=A", expect: "/api/items?Q=A"},
+		{enabled: true, prefixes: []string{"/API"}, uri: "/Other/Items", expect: "/Other/Items"},
+	}
+
+	for _, c := range cases {
+		cnf := newTestConf()
+		cnf.LowercasePath = c.enabled
+		cnf.LowercasePathPrefixes = c.prefixes
+		p := newTestProxy(t, cnf, "", backend)
+		p.routeTable.AddNewAggregation(model.NewAggregation("^/users/", []*model.Node{
+			&model.Node{ClusterName: testClusterName, StripPrefix: "/users"},
+		}))
+
+		ctx := doTestRequest(p, "GET", c.uri)
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.uri, http.StatusOK, ctx.Response.StatusCode())
+		}
+
+		if value := received.Load(); value != c.expect {
+			t.Errorf("%s expect:<%s>, acture:<%v>", c.uri, c.expect, value)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// maxPathDecodeRounds the path encoded more times is matched by the path decoded by these rounds
+	maxPathDecodeRounds = 8
+	// routePathUserValue the path matched by the request filters and the route selection
+	routePathUserValue = "gateway.routePath"
+)
+
+// prepareRouteRequest returns the request to select the route result, its path is kept in the user value,
+// so the request filters match the same normalized path as the route selection.
+func (p *Proxy) prepareRouteRequest(ctx *fasthttp.RequestCtx) *fasthttp.Request {
+	req := p.routeRequest(ctx)
+	ctx.SetUserValue(routePathUserValue, string(req.URI().Path()))
+	return req
+}
+
+// getRoutePath returns the path prepared by prepareRouteRequest, the path of client if not prepared
+func getRoutePath(ctx *fasthttp.RequestCtx) string {
+	if path, ok := ctx.UserValue(routePathUserValue).(string); ok {
+		return path
+	}
+
+	return string(ctx.Path())
+}
+
+// routeRequest returns the request to select the route result. The path of client is decoded once by fasthttp,
+// it is decoded until no percent-encoding remains if NormalizePathEncoding, so the equivalent encoded paths
+// are matched by the same routes. The request of client is forwarded with its own encoding.
+func (p *Proxy) routeRequest(ctx *fasthttp.RequestCtx) *fasthttp.Request {
+	if !p.config.NormalizePathEncoding {
+		return &ctx.Request
+	}
+
+	path := string(ctx.URI().Path())
+	normalized := decodePath(path)
+	if normalized == path {
+		return &ctx.Request
+	}
+
+	// the body is not used by the route selection
+	req := &fasthttp.Request{}
+	ctx.Request.Header.CopyTo(&req.Header)
+	req.URI().SetPath(normalized)
+	return req
+}
+
+// decodePath decode the path until it is not changed, the dot segments are removed after every decoding
+func decodePath(path string) string {
+	uri := &fasthttp.URI{}
+	for i := 0; i < maxPathDecodeRounds && strings.IndexByte(path, '%') >= 0; i++ {
+		uri.SetPath(path)
+		decoded := string(uri.Path())
+		if decoded == path {
+			break
+		}
+		path = decoded
+	}
+
+	return path
+}
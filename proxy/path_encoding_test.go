@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestDecodePath(t *testing.T) {
+	cases := []struct {
+		path   string
+		expect string
+	}{
+		{path: "/users", expect: "/users"},
+		{path: "/%61dmin", expect: "/admin"},
+		{path: "/api%2Fusers", expect: "/api/users"},
+		{path: "/public/..%2Fadmin", expect: "/admin"},
+		{path: "/public/%2E%2E%252Fadmin", expect: "/admin"},
+		{path: "/a%2520b", expect: "/a b"},
+		{path: "/100%", expect: "/100%"},
+		{path: "/%zz", expect: "/%zz"},
+	}
+
+	for _, c := range cases {
+		if value := decodePath(c.path); value != c.expect {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.path, c.expect, value)
+		}
+	}
+}
+
+func TestNormalizePathEncoding(t *testing.T) {
+	var received atomic.Value
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.RequestURI)
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cases := []struct {
+		enabled bool
+		uri     string
+		code    int
+		expect  string
+	}{
+		{enabled: true, uri: "/%61dmin/users", code: http.StatusServiceUnavailable},
+		{enabled: true, uri: "/public/..%252Fadmin", code: http.StatusServiceUnavailable},
+		{enabled: true, uri: "/public/%252E%252E%252Fadmin", code: http.StatusServiceUnavailable},
+		{enabled: true, uri: "/public/a%2520b", code: http.StatusOK, expect: "/public/a%2520b"},
+		{enabled: true, uri: "/public/users", code: http.StatusOK, expect: "/public/users"},
+		// the double-encoded path bypass the admin route
+		{enabled: false, uri: "/public/..%252Fadmin", code: http.StatusOK, expect: "/public/..%252Fadmin"},
+	}
+
+	for _, c := range cases {
+		cnf := newTestConf()
+		cnf.NormalizePathEncoding = c.enabled
+		p := newTestProxy(t, cnf, "", backend)
+		p.routeTable.AddNewAggregation(model.NewAggregation("^/admin", []*model.Node{
+			&model.Node{ClusterName: testClusterName, Maintenance: &model.Maintenance{Body: "admin"}},
+		}))
+		received.Store("")
+
+		ctx := doTestRequest(p, "GET", c.uri)
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.uri, c.code, ctx.Response.StatusCode())
+		}
+
+		if value := received.Load(); value != c.expect {
+			t.Errorf("%s expect:<%s>, acture:<%v>", c.uri, c.expect, value)
+		}
+	}
+}
+
+func TestNormalizePathEncodingFilters(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cases := []struct {
+		enabled bool
+		uri     string
+		code    int
+	}{
+		{enabled: true, uri: "/admin", code: http.StatusForbidden},
+		{enabled: true, uri: "/%61dmin", code: http.StatusForbidden},
+		{enabled: true, uri: "/%2561dmin", code: http.StatusForbidden},
+		{enabled: true, uri: "/public/..%252Fadmin", code: http.StatusForbidden},
+		{enabled: true, uri: "/public/users", code: http.StatusOK},
+		// the double-encoded path is matched by the filters as the route selection
+		{enabled: false, uri: "/%2561dmin", code: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		cnf := newTestConf()
+		cnf.NormalizePathEncoding = c.enabled
+		cnf.PathBlackList = []string{"^/admin"}
+		p := newTestProxy(t, cnf, "", backend)
+		p.RegistryFilter(FilterBlackList)
+
+		if ctx := doTestRequest(p, "GET", c.uri); ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.uri, c.code, ctx.Response.StatusCode())
+		}
+	}
+}
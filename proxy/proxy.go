@@ -1,11 +1,16 @@
 package proxy
 
 import (
+	"bufio"
 	"container/list"
+	"crypto/tls"
 	"errors"
+	"net"
 	"net/http"
+	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/CodisLabs/codis/pkg/utils/log"
@@ -17,11 +22,24 @@ import (
 const (
 	// ErrPrefixRequestCancel user cancel request error
 	ErrPrefixRequestCancel = "request canceled"
+
+	canaryRuntimeVar = "canary.group"
+	canaryGroup      = "canary"
+	stableGroup      = "stable"
+
+	// the params of the path template are the runtime vars path.{name}
+	pathParamRuntimeVarPrefix = "path."
 )
 
 var (
 	// ErrNoServer no server
 	ErrNoServer = errors.New("has no server")
+	// ErrBackendFailure backend server response with 5xx status code
+	ErrBackendFailure = errors.New("backend server failure")
+	// ErrNodeConcurrencyLimited the node reach the max concurrency
+	ErrNodeConcurrencyLimited = errors.New("node concurrency limit")
+	// ErrRequestBodyTooLarge request body exceeds the max request body size
+	ErrRequestBodyTooLarge = errors.New("request body too large")
 )
 
 var (
@@ -29,6 +47,8 @@ var (
 	HeaderContentType = "Content-Type"
 	// MergeContentType merge operation using content-type
 	MergeContentType = "application/json; charset=utf-8"
+	// EventStreamContentType server-sent events content-type
+	EventStreamContentType = "text/event-stream"
 	// MergeRemoveHeaders merge operation need to remove headers
 	MergeRemoveHeaders = []string{
 		"Content-Length",
@@ -39,20 +59,66 @@ var (
 
 // Proxy Proxy
 type Proxy struct {
-	fastHTTPClient *FastHTTPClient
-	config         *conf.Conf
-	routeTable     *model.RouteTable
-	flushInterval  time.Duration
-	filters        *list.List
+	fastHTTPClient   *FastHTTPClient
+	http2Client      *HTTP2Client
+	config           *conf.Conf
+	routeTable       *model.RouteTable
+	flushInterval    time.Duration
+	filters          *list.List
+	chain            []Filter
+	metrics          *proxyMetrics
+	tracer           Tracer
+	clientConns      *clientConns
+	affinitySecret   []byte
+	trustedProxies   []*net.IPNet
+	requestIDPattern *regexp.Regexp
+	mock             bool
+	// slowLogger the logger of the slow requests, the std logger by default
+	slowLogger *log.Logger
+	// maintenance the *model.Maintenance of the whole gateway, nil if not in maintenance
+	maintenance atomic.Value
+
+	stopLock    sync.Mutex
+	stopping    int32
+	inFlight    int64
+	ln          *drainListener
+	rpcListener net.Listener
+	grpcServer  *http.Server
 }
 
 // NewProxy create a new proxy
 func NewProxy(config *conf.Conf, routeTable *model.RouteTable) *Proxy {
 	p := &Proxy{
 		fastHTTPClient: NewFastHTTPClient(config),
+		http2Client:    NewHTTP2Client(config),
 		config:         config,
 		routeTable:     routeTable,
+		flushInterval:  time.Duration(config.FlushInterval) * time.Millisecond,
 		filters:        list.New(),
+		metrics:        newProxyMetrics(),
+		affinitySecret: newAffinitySecret(config),
+		trustedProxies: newTrustedProxies(config),
+		slowLogger:     log.StdLog,
+	}
+
+	if "" != config.DefaultCluster {
+		routeTable.SetDefaultCluster(config.DefaultCluster)
+	}
+
+	if config.EnableTracing {
+		p.tracer = propagationTracer{}
+	}
+
+	if "" != config.RequestIDPattern {
+		pattern, err := regexp.Compile(config.RequestIDPattern)
+		if nil != err {
+			log.PanicErrorf(err, "Proxy compile request id pattern <%s> fail", config.RequestIDPattern)
+		}
+		p.requestIDPattern = pattern
+	}
+
+	if !model.IsValidTrailingSlash(config.TrailingSlash) {
+		log.PanicErrorf(model.ErrInvalidTrailingSlash, "Proxy trailing slash <%s> is invalid", config.TrailingSlash)
 	}
 
 	return p
@@ -62,12 +128,35 @@ func NewProxy(config *conf.Conf, routeTable *model.RouteTable) *Proxy {
 func (p *Proxy) RegistryFilter(name string) {
 	f, err := newFilter(name, p.config, p)
 	if nil != err {
-		log.Panicf("Proxy unknow filter <%s>.", name)
+		log.PanicErrorf(err, "Proxy create filter <%s> fail.", name)
+	}
+
+	defer p.updateChain()
+
+	// the mocked node has no server, the mock filter must be executed before the others
+	if FilterMock == f.Name() {
+		p.mock = true
+		p.filters.PushFront(f)
+		return
+	}
+
+	// the post filters are executed from the back, the gunzip filter must be the first
+	if back := p.filters.Back(); nil != back && back.Value.(Filter).Name() == FilterGunzip {
+		p.filters.InsertBefore(f, back)
+		return
 	}
 
 	p.filters.PushBack(f)
 }
 
+// updateChain update the chain of the registered filters in the execution order
+func (p *Proxy) updateChain() {
+	p.chain = p.chain[:0]
+	for iter := p.filters.Front(); iter != nil; iter = iter.Next() {
+		p.chain = append(p.chain, iter.Value.(Filter))
+	}
+}
+
 // Start start proxy
 func (p *Proxy) Start() {
 	err := p.startRPCServer()
@@ -76,15 +165,108 @@ func (p *Proxy) Start() {
 		log.PanicErrorf(err, "Proxy start rpc at <%s> fail.", p.config.MgrAddr)
 	}
 
-	log.ErrorErrorf(fasthttp.ListenAndServe(p.config.Addr, p.ReverseProxyHandler), "Proxy exit at %s", p.config.Addr)
+	if "" != p.config.MetricsAddr {
+		go p.startMetricsServer()
+	}
+
+	if "" != p.config.GRPCAddr {
+		go p.startGRPCServer()
+	}
+
+	ln, err := p.newListener()
+	if nil != err {
+		log.PanicErrorf(err, "Proxy listen at <%s> fail.", p.config.Addr)
+	}
+
+	p.stopLock.Lock()
+	p.ln = newDrainListener(ln)
+	p.stopLock.Unlock()
+
+	if p.isStopping() {
+		p.ln.Close()
+	}
+
+	err = p.newServer().Serve(p.ln)
+	if p.isStopping() {
+		log.Infof("Proxy stopped at %s", p.config.Addr)
+		return
+	}
+
+	log.ErrorErrorf(err, "Proxy exit at %s", p.config.Addr)
+}
+
+// newServer create the server of client requests, the zero configs are the fasthttp defaults
+func (p *Proxy) newServer() *fasthttp.Server {
+	readTimeout := p.config.ServerReadTimeout
+	// the idle keep-alive connections are limited by the read timeout
+	if p.config.ServerIdleTimeout > readTimeout {
+		readTimeout = p.config.ServerIdleTimeout
+	}
+
+	return &fasthttp.Server{
+		Handler:              p.ReverseProxyHandler,
+		Concurrency:          p.config.ServerConcurrency,
+		ReadTimeout:          time.Duration(readTimeout) * time.Second,
+		WriteTimeout:         time.Duration(p.config.ServerWriteTimeout) * time.Second,
+		MaxKeepaliveDuration: time.Duration(p.config.ServerMaxKeepaliveDuration) * time.Second,
+		MaxRequestBodySize:   p.config.ServerMaxRequestBodySize,
+	}
 }
 
 // ReverseProxyHandler http reverse handler
 func (p *Proxy) ReverseProxyHandler(ctx *fasthttp.RequestCtx) {
-	results := p.routeTable.Select(&ctx.Request)
+	atomic.AddInt64(&p.inFlight, 1)
+	defer atomic.AddInt64(&p.inFlight, -1)
+
+	if p.isStopping() {
+		// the keep-alive connections are closed after the in-flight requests
+		ctx.SetConnectionClose()
+	}
+
+	requestID := p.prepareRequestID(ctx)
+	// the response headers may be replaced by the backend server response
+	defer ctx.Response.Header.Set(headerXRequestID, requestID)
+	defer p.recoverHandler(ctx)
+
+	if m := p.getMaintenance(); nil != m {
+		p.writeMaintenance(ctx, m)
+		return
+	}
+
+	p.lowercasePath(ctx)
+	if p.normalizeTrailingSlash(ctx) {
+		return
+	}
+
+	// the request filters match the normalized path used by the route selection
+	routeReq := p.prepareRouteRequest(ctx)
+	if filterName, code, err := p.doRequestFilters(ctx); nil != err {
+		log.InfoErrorf(err, "[%s] Proxy Filter-Request<%s> fail", requestID, filterName)
+		p.writeError(ctx, nil, code, err)
+		return
+	}
+
+	clientIP := p.getClientIP(ctx)
+	results := p.routeTable.SelectByClient(routeReq, clientIP)
 
 	if nil == results || len(results) == 0 {
-		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		p.writeError(ctx, nil, p.getFailureStatusCode(ErrNoServer, nil), ErrNoServer)
+		return
+	}
+
+	// the route table fails the request, e.g. no node produces the content type acceptable by client
+	if err := results[0].Err; nil != err {
+		p.writeError(ctx, results[0].Node, results[0].Code, err)
+		return
+	}
+
+	for _, result := range results {
+		result.RequestID = requestID
+		result.ClientIP = clientIP
+	}
+
+	if isWebSocket(&ctx.Request) {
+		p.doWebSocket(ctx, results[0])
 		return
 	}
 
@@ -95,140 +277,236 @@ func (p *Proxy) ReverseProxyHandler(ctx *fasthttp.RequestCtx) {
 		wg := &sync.WaitGroup{}
 		wg.Add(count)
 
+		var deadline time.Time
+		if timeout := results[0].Aggregation.GetMerge().Timeout; timeout > 0 {
+			deadline = time.Now().Add(timeout)
+		}
+
+		// the identical sub-requests share the response
+		flights := newResponseFlights()
 		for _, result := range results {
 			result.Merge = merge
+			result.Deadline = deadline
 
 			go func(result *model.RouteResult) {
-				p.doProxy(ctx, wg, result)
+				p.doProxy(ctx, wg, result, flights)
 			}(result)
 		}
 
 		wg.Wait()
 	} else {
-		p.doProxy(ctx, nil, results[0])
+		p.doProxy(ctx, nil, results[0], nil)
 	}
 
 	for _, result := range results {
+		if nil == result.Err && merge {
+			result.Err = checkMergeBody(result)
+		}
+
 		if result.Err != nil {
-			ctx.SetStatusCode(result.Code)
-			result.Release()
+			// the failed sub-response is merged if the merge not fail
+			if merge && !result.Aggregation.GetMerge().FailAll() {
+				continue
+			}
+
+			// the backend server failure status code pass through if not merge
+			if !merge && result.Err == ErrBackendFailure && result.Code == result.Res.StatusCode() {
+				p.writeResult(ctx, result)
+			} else {
+				p.writeError(ctx, result.Node, result.Code, result.Err)
+			}
+
+			for _, result := range results {
+				result.Release()
+			}
 			return
 		}
 
 		if !merge {
-			p.writeResult(ctx, result.Res)
+			p.writeResult(ctx, result)
 			result.Release()
 			return
 		}
 	}
 
-	for _, result := range results {
-		for _, h := range MergeRemoveHeaders {
-			result.Res.Header.Del(h)
-		}
-		result.Res.Header.CopyTo(&ctx.Response.Header)
+	p.writeMerge(ctx, results)
+}
+
+// doProxy proxy the request of result, the sub-requests of merge with the same key in flights are proxied once
+func (p *Proxy) doProxy(ctx *fasthttp.RequestCtx, wg *sync.WaitGroup, result *model.RouteResult, flights *responseFlights) {
+	if nil != wg {
+		defer wg.Done()
 	}
 
-	ctx.Response.Header.Add(HeaderContentType, MergeContentType)
-	ctx.SetStatusCode(fasthttp.StatusOK)
+	defer p.metrics.begin(result)()
 
-	ctx.WriteString("{")
+	if nil != result.Node {
+		done := result.Node.Stats().Begin()
+		defer func() {
+			done(nil == result.Err && result.Code < http.StatusInternalServerError)
+		}()
+	}
 
-	for index, result := range results {
-		ctx.WriteString("\"")
-		ctx.WriteString(result.Node.AttrName)
-		ctx.WriteString("\":")
-		ctx.Write(result.Res.Body())
-		if index < count-1 {
-			ctx.WriteString(",")
+	// the sub-request of merge run in its own goroutine, the panic is recovered here
+	defer p.recoverProxy(result)
+
+	if nil != result.Node && nil != result.Node.Maintenance {
+		result.Res = p.newMaintenanceResponse(result.Node.Maintenance)
+		// the merge response headers are copied by the handler
+		if !result.Merge {
+			result.Res.Header.CopyTo(&ctx.Response.Header)
 		}
+		return
+	}
 
-		result.Release()
+	// the sub-requests of merge read the headers of their own copies of the client request
+	req := &ctx.Request
+	if result.Merge {
+		req = copyRequest(&ctx.Request)
+		defer fasthttp.ReleaseRequest(req)
 	}
 
-	ctx.WriteString("}")
-}
+	affinity := p.selectAffinityServer(req, result)
 
-func (p *Proxy) doProxy(ctx *fasthttp.RequestCtx, wg *sync.WaitGroup, result *model.RouteResult) {
-	if nil != wg {
-		defer wg.Done()
+	outreq, err := p.newOutRequest(ctx, result)
+	if nil != err {
+		log.WarnErrorf(err, "[%s] Proxy rewrite <%s> fail", result.RequestID, string(ctx.URI().RequestURI()))
+		result.Err = err
+		result.Code = http.StatusBadRequest
+		return
+	}
+
+	beginAt := time.Now()
+	c := &FilterContext{
+		ctx:            ctx,
+		req:            req,
+		outreq:         outreq,
+		result:         result,
+		rb:             p.routeTable,
+		runtimeVar:     make(map[string]string),
+		bodyBufferSize: p.config.BodyBufferSize,
+		bodyBufferDir:  p.config.BodyBufferDir,
+	}
+	defer c.done()
+	defer p.logSlowRequest(c, beginAt)
+	p.setClientCertVars(c)
+	setCanaryVars(c)
+	setPathParamVars(c)
+
+	requestID := result.RequestID
+	c.runtimeVar[requestIDRuntimeVar] = requestID
+	c.runtimeVar[clientIPRuntimeVar] = result.ClientIP
+
+	// the leading response filters respond without the backend server
+	filterName, code, err := p.doRespondFilters(c)
+	if errResponded == err {
+		// the merge response headers are copied by the handler
+		if !result.Merge {
+			result.Res.Header.CopyTo(&ctx.Response.Header)
+		}
+		return
+	}
+
+	if nil != err {
+		log.WarnErrorf(err, "[%s] Proxy Filter-Respond<%s> fail", requestID, filterName)
+		result.Err = err
+		result.Code = code
+		return
 	}
 
 	svr := result.Svr
 
-	if nil == svr {
+	if nil == svr && !p.isMocked(result) {
 		result.Err = ErrNoServer
-		result.Code = http.StatusServiceUnavailable
+		result.Code = p.getFailureStatusCode(ErrNoServer, nil)
 		return
 	}
 
-	outreq := copyRequest(&ctx.Request)
+	// check the request body before any filters
+	if p.isRequestBodyTooLarge(ctx, result) {
+		result.Err = ErrRequestBodyTooLarge
+		result.Code = http.StatusRequestEntityTooLarge
+		return
+	}
 
-	// change url
-	if result.NeedRewrite() {
-		// if not use rewrite, it only change uri path and query string
-		realPath := result.GetRealPath(&ctx.Request)
-		if "" != realPath {
-			log.Infof("URL Rewrite from <%s> to <%s>", string(ctx.URI().FullURI()), realPath)
-			outreq.SetRequestURI(realPath)
-			outreq.SetHost(svr.Addr)
-		}
-	} else {
-		// if not use rewrite, it only change uri path, the query string will use origin.
-		if result.Node != nil {
-			outreq.URI().SetPath(result.Node.URL)
+	if nil != result.Node {
+		if !result.Node.AcquireConcurrency() {
+			log.Warnf("[%s] Proxy node <%s> reach max concurrency <%d>", requestID, result.Node.URL, result.Node.MaxConcurrency)
+			result.Err = ErrNodeConcurrencyLimited
+			result.Code = http.StatusServiceUnavailable
+			return
 		}
+		defer result.Node.ReleaseConcurrency()
 	}
 
-	c := &filterContext{
-		ctx:        ctx,
-		outreq:     outreq,
-		result:     result,
-		rb:         p.routeTable,
-		runtimeVar: make(map[string]string),
-	}
+	p.setForwardedHeaders(ctx, outreq)
 
 	// pre filters
-	filterName, code, err := p.doPreFilters(c)
+	filterName, code, err = p.doPreFilters(c)
+	if errResponded == err {
+		// the merge response headers are copied by the handler
+		if !result.Merge {
+			result.Res.Header.CopyTo(&ctx.Response.Header)
+		}
+		return
+	}
+
 	if nil != err {
-		log.WarnErrorf(err, "Proxy Filter-Pre<%s> fail", filterName)
+		log.WarnErrorf(err, "[%s] Proxy Filter-Pre<%s> fail", requestID, filterName)
 		result.Err = err
 		result.Code = code
 		return
 	}
 
+	p.mirror(c, outreq)
+
+	// the key of the identical sub-requests is computed before the trace context is injected
+	var key string
+	if nil != flights {
+		key = getSubRequestKey(result, outreq)
+	}
+
+	span := p.startSpan(c)
 	c.startAt = time.Now().UnixNano()
-	res, err := p.fastHTTPClient.Do(outreq, svr.Addr)
+	res, err := p.doSharedRequest(c, outreq, flights, key)
 	c.endAt = time.Now().UnixNano()
+	p.finishSpan(span, c, res, err)
+
+	svr = result.Svr
 
 	result.Res = res
+	p.metrics.observeLatency(result, c.startAt, c.endAt)
 
 	if err != nil || res.StatusCode() >= fasthttp.StatusInternalServerError {
-		resCode := http.StatusServiceUnavailable
+		p.metrics.incUpstreamErrors(result)
 
 		if nil != err {
-			log.InfoErrorf(err, "Proxy Fail <%s>", svr.Addr)
+			log.InfoErrorf(err, "[%s] Proxy Fail <%s>", requestID, svr.Addr)
 		} else {
-			resCode = res.StatusCode()
-			log.InfoErrorf(err, "Proxy Fail <%s>, Code <%d>", svr.Addr, res.StatusCode())
+			log.Infof("[%s] Proxy Fail <%s>, Code <%d>", requestID, svr.Addr, res.StatusCode())
 		}
 
-		// 用户取消，不计算为错误
-		if nil == err || !strings.HasPrefix(err.Error(), ErrPrefixRequestCancel) {
+		// 用户取消，不计算为错误，熔断的请求没有发送
+		if nil == err || !(strings.HasPrefix(err.Error(), ErrPrefixRequestCancel) || isCircuitErr(err)) {
 			p.doPostErrFilters(c)
 		}
 
+		result.Code = p.getFailureStatusCode(err, res)
 		result.Err = err
-		result.Code = resCode
+		if nil == err {
+			result.Err = ErrBackendFailure
+		}
 		return
 	}
 
-	log.Infof("Backend server[%s] responsed, code <%d>, body<%s>", svr.Addr, res.StatusCode(), res.Body())
+	p.setAffinityCookie(result, affinity)
+	rewriteLocation(ctx, result)
+	rewriteCookies(result)
 
 	// post filters
 	filterName, code, err = p.doPostFilters(c)
 	if nil != err {
-		log.InfoErrorf(err, "Proxy Filter-Post<%s> fail: %s ", filterName, err.Error())
+		log.InfoErrorf(err, "[%s] Proxy Filter-Post<%s> fail: %s ", requestID, filterName, err.Error())
 
 		result.Err = err
 		result.Code = code
@@ -236,7 +514,338 @@ func (p *Proxy) doProxy(ctx *fasthttp.RequestCtx, wg *sync.WaitGroup, result *mo
 	}
 }
 
-func (p *Proxy) writeResult(ctx *fasthttp.RequestCtx, res *fasthttp.Response) {
-	ctx.SetStatusCode(res.StatusCode())
-	ctx.Write(res.Body())
+// newOutRequest copy the request to send to the result server, and change the url,
+// the request rewritten to a malicious path is rejected
+func (p *Proxy) newOutRequest(ctx *fasthttp.RequestCtx, result *model.RouteResult) (*fasthttp.Request, error) {
+	outreq := copyRequest(&ctx.Request)
+	if err := p.changeURL(ctx, outreq, result); nil != err {
+		fasthttp.ReleaseRequest(outreq)
+		return nil, err
+	}
+	normalizeNodeTrailingSlash(ctx, outreq, result.Node)
+
+	// the host of node is used for the virtual-hosted server, the connection is still to the server addr
+	if nil != result.Node && "" != result.Node.HostHeader {
+		outreq.SetHost(result.Node.HostHeader)
+	}
+
+	return outreq, nil
+}
+
+// changeURL change the url of outreq by the rewrite rules of node, the rewritten paths are cleaned
+// because the captured values of client may have the traversal sequences
+func (p *Proxy) changeURL(ctx *fasthttp.RequestCtx, outreq *fasthttp.Request, result *model.RouteResult) error {
+	// the regexp rewrite of node, pass through if not match
+	if nil != result.Node {
+		if uri, ok := result.Node.RewriteURI(&ctx.Request); ok {
+			uri, err := model.CleanRewritePath(uri)
+			if nil != err {
+				return err
+			}
+
+			log.Infof("[%s] URL Rewrite from <%s> to <%s>", result.RequestID, string(ctx.URI().RequestURI()), uri)
+			setRequestURI(outreq, uri)
+			return nil
+		}
+	}
+
+	// the prefix rewrite of node, the query string is preserved
+	if nil != result.Node && result.Node.HasPrefixRewrite() {
+		path, err := model.CleanRewritePath(result.Node.PrefixPath(string(ctx.URI().Path())))
+		if nil != err {
+			return err
+		}
+
+		outreq.URI().SetPath(path)
+		return nil
+	}
+
+	// change url
+	if result.NeedRewrite() {
+		// if not use rewrite, it only change uri path and query string
+		realPath, err := model.CleanRewritePath(result.GetRealPath(&ctx.Request))
+		if nil != err {
+			return err
+		}
+
+		if "" != realPath {
+			log.Infof("[%s] URL Rewrite from <%s> to <%s>", result.RequestID, string(ctx.URI().FullURI()), realPath)
+			outreq.SetRequestURI(realPath)
+			if nil != result.Svr {
+				outreq.SetHost(result.Svr.Addr)
+			}
+		}
+	} else {
+		// if not use rewrite, it only change uri path, the query string will use origin.
+		if result.Node != nil {
+			outreq.URI().SetPath(result.Node.URL)
+		}
+	}
+
+	return nil
+}
+
+// setRequestURI set the path and query string of request, the host is not changed
+func setRequestURI(req *fasthttp.Request, uri string) {
+	path, query := uri, ""
+	if index := strings.IndexByte(uri, '?'); index >= 0 {
+		path, query = uri[:index], uri[index+1:]
+	}
+
+	req.URI().SetPath(path)
+	req.URI().SetQueryString(query)
+}
+
+// doRequest send request to the result server, and retry to other servers when fail
+// the retries share the timeout of the request
+func (p *Proxy) doRequest(c *FilterContext, outreq *fasthttp.Request) (*fasthttp.Response, error) {
+	deadline := p.getDeadline(c.result)
+	tried := make(map[string]bool)
+
+	tlsConfig, err := getTLSConfig(c.result)
+	if nil != err {
+		return nil, err
+	}
+
+	client := p.getClient(c.result)
+	maxBodySize := p.config.MaxResponseBodySize
+	if c.maxBodySize > 0 && (maxBodySize <= 0 || c.maxBodySize < maxBodySize) {
+		maxBodySize = c.maxBodySize
+	}
+
+	for {
+		svr := c.result.Svr
+
+		// the server not allowed by its circuit is skipped, it's not a retry
+		if !svr.CircuitAllow() {
+			tried[svr.Addr] = true
+			next := p.routeTable.SelectServerExclude(c.Request(), c.runtimeVar[clientIPRuntimeVar], c.result, tried)
+			if nil == next {
+				return nil, getCircuitErr(svr)
+			}
+
+			p.setRetryServer(c, outreq, next)
+			log.Infof("[%s] Proxy skip circuit <%s> to <%s>", c.runtimeVar[requestIDRuntimeVar], svr.Addr, next.Addr)
+			continue
+		}
+
+		svr.IncrActiveConns()
+		start := time.Now()
+		var res *fasthttp.Response
+		var err error
+		if c.result.Merge {
+			// merge need the whole body of response
+			res, err = client.DoWithLimit(outreq, svr.Addr, tlsConfig, deadline, maxBodySize)
+		} else {
+			res, c.result.Stream, err = client.DoStream(outreq, svr.Addr, tlsConfig, deadline, maxBodySize, p.isStreaming)
+		}
+		svr.DecrActiveConns()
+		svr.RecordRequest(time.Since(start), nil == err && res.StatusCode() < http.StatusInternalServerError)
+		p.cooldown(svr, res)
+		recordCircuit(svr, res, err)
+
+		if !p.needRetry(c, outreq, res, err) {
+			return res, err
+		}
+
+		tried[svr.Addr] = true
+		next := p.routeTable.SelectServerExclude(c.Request(), c.runtimeVar[clientIPRuntimeVar], c.result, tried)
+		if nil == next {
+			return res, err
+		}
+
+		backoff := time.Duration(p.config.RetryBackoff<<uint(c.retries)) * time.Millisecond
+		if !deadline.IsZero() && time.Now().Add(backoff).After(deadline) {
+			return res, err
+		}
+
+		// the failure of this server need to be recorded before retry
+		p.metrics.incUpstreamErrors(c.result)
+		p.doPostErrFilters(c)
+		c.result.CloseStream()
+		fasthttp.ReleaseResponse(res)
+
+		time.Sleep(backoff)
+
+		c.retries++
+		p.metrics.incRetries(c.result)
+		p.setRetryServer(c, outreq, next)
+
+		log.Infof("[%s] Proxy retry <%s> to <%s>, retries <%d>", c.runtimeVar[requestIDRuntimeVar], svr.Addr, next.Addr, c.Retries())
+	}
+}
+
+// setRetryServer change the server of the request to the next server
+func (p *Proxy) setRetryServer(c *FilterContext, outreq *fasthttp.Request, next *model.Server) {
+	c.result.Svr = next
+	if c.result.NeedRewrite() && "" == c.result.Node.HostHeader {
+		outreq.SetHost(next.Addr)
+	}
+}
+
+// getClient returns the client of the node transport
+func (p *Proxy) getClient(result *model.RouteResult) upstreamClient {
+	if nil != result.Node && result.Node.IsHTTP2() {
+		return p.http2Client
+	}
+
+	return p.fastHTTPClient
+}
+
+// getTLSConfig returns the tls config to connect the result server, nil is plain http
+func getTLSConfig(result *model.RouteResult) (*tls.Config, error) {
+	if nil == result.Node {
+		return nil, nil
+	}
+
+	return result.Node.TLSConfig()
+}
+
+// setCanaryVars set the traffic group of the canary node to the runtime vars
+func setPathParamVars(c *FilterContext) {
+	for name, value := range c.result.Params {
+		c.runtimeVar[pathParamRuntimeVarPrefix+name] = value
+	}
+}
+
+func setCanaryVars(c *FilterContext) {
+	if nil == c.result.Node || nil == c.result.Node.Canary {
+		return
+	}
+
+	if c.result.Canary {
+		c.runtimeVar[canaryRuntimeVar] = canaryGroup
+	} else {
+		c.runtimeVar[canaryRuntimeVar] = stableGroup
+	}
+}
+
+// isMocked returns true if the result is responded by the mock filter
+func (p *Proxy) isMocked(result *model.RouteResult) bool {
+	return p.mock && nil != result.Node && result.Node.IsMocked()
+}
+
+// isRequestBodyTooLarge check the Content-Length, and the size of the chunked body
+// which has been read by the server, using the node limit first.
+func (p *Proxy) isRequestBodyTooLarge(ctx *fasthttp.RequestCtx, result *model.RouteResult) bool {
+	limit := p.config.MaxRequestBodySize
+	if nil != result.Node && result.Node.MaxRequestBodySize > 0 {
+		limit = result.Node.MaxRequestBodySize
+	}
+
+	if limit <= 0 {
+		return false
+	}
+
+	return ctx.Request.Header.ContentLength() > limit || len(ctx.Request.Body()) > limit
+}
+
+// getDeadline return the deadline of the request, using the node timeout first,
+// the earlier merge deadline is used if set, the zero deadline means has no timeout
+func (p *Proxy) getDeadline(result *model.RouteResult) time.Time {
+	var deadline time.Time
+	if nil != result.Node && result.Node.Timeout > 0 {
+		deadline = time.Now().Add(result.Node.Timeout)
+	} else if p.config.ReadTimeout > 0 {
+		deadline = time.Now().Add(time.Duration(p.config.ReadTimeout) * time.Second)
+	}
+
+	if !result.Deadline.IsZero() && (deadline.IsZero() || result.Deadline.Before(deadline)) {
+		return result.Deadline
+	}
+
+	return deadline
+}
+
+func (p *Proxy) needRetry(c *FilterContext, req *fasthttp.Request, res *fasthttp.Response, err error) bool {
+	if c.retries >= p.config.MaxRetries {
+		return false
+	}
+
+	if nil != err {
+		if strings.HasPrefix(err.Error(), ErrPrefixRequestCancel) ||
+			err == fasthttp.ErrTimeout ||
+			err == fasthttp.ErrBodyTooLarge {
+			return false
+		}
+	} else if !isRetryableStatusCode(res.StatusCode()) {
+		return false
+	}
+
+	return isIdempotent(req) || (nil != c.result.Cluster && c.result.Cluster.RetryNonIdempotent)
+}
+
+// getFailureStatusCode return the status code to client when proxy fail:
+// no server or circuit close 503, timeout 504, transport error 502,
+// backend server 5xx pass through if no retry configured, otherwise 502.
+func (p *Proxy) getFailureStatusCode(err error, res *fasthttp.Response) int {
+	switch {
+	case err == ErrNoServer || err == fasthttp.ErrNoFreeConns || isCircuitErr(err):
+		return http.StatusServiceUnavailable
+	case err == fasthttp.ErrTimeout:
+		return http.StatusGatewayTimeout
+	case nil != err:
+		return http.StatusBadGateway
+	case nil == res:
+		return http.StatusServiceUnavailable
+	case p.config.MaxRetries > 0:
+		return http.StatusBadGateway
+	default:
+		return res.StatusCode()
+	}
+}
+
+// isStreaming returns true if the response body need to copy to client incrementally,
+// the server-sent events is always streaming.
+func (p *Proxy) isStreaming(res *fasthttp.Response) bool {
+	return p.config.Streaming || isEventStream(res)
+}
+
+// getFlushInterval returns the flush interval of the streaming response,
+// the server-sent events is flushed immediately if no flushInterval configured.
+func (p *Proxy) getFlushInterval(res *fasthttp.Response) time.Duration {
+	if isEventStream(res) && p.flushInterval <= 0 {
+		return -1
+	}
+
+	return p.flushInterval
+}
+
+func isEventStream(res *fasthttp.Response) bool {
+	return strings.HasPrefix(string(res.Header.ContentType()), EventStreamContentType)
+}
+
+func isRetryableStatusCode(code int) bool {
+	return code == fasthttp.StatusBadGateway ||
+		code == fasthttp.StatusServiceUnavailable ||
+		code == fasthttp.StatusGatewayTimeout
+}
+
+func (p *Proxy) writeResult(ctx *fasthttp.RequestCtx, result *model.RouteResult) {
+	ctx.SetStatusCode(result.Res.StatusCode())
+
+	if p.writeErrorPage(ctx, result) {
+		return
+	}
+
+	if nil == result.Stream {
+		ctx.Write(result.Res.Body())
+		return
+	}
+
+	// the stream writer is called after the handler returned, so it owns the stream
+	stream := result.Stream
+	result.Stream = nil
+	flushInterval := p.getFlushInterval(result.Res)
+
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		// the stream is closed immediately if the client is disconnected,
+		// because the copy is stopped by the write error.
+		defer stream.Close()
+
+		err := p.copyResponse(bufioFlusher{w}, stream, flushInterval)
+		if nil != err {
+			log.InfoErrorf(err, "Proxy streaming stopped")
+		}
+	})
 }
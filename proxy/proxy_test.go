@@ -0,0 +1,1263 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	testClusterName = "app"
+)
+
+// memStore a empty store only for test
+type memStore struct{}
+
+func (s memStore) SaveBind(bind *model.Bind) error                        { return nil }
+func (s memStore) UnBind(bind *model.Bind) error                          { return nil }
+func (s memStore) GetBinds() ([]*model.Bind, error)                       { return nil, nil }
+func (s memStore) SaveCluster(cluster *model.Cluster) error               { return nil }
+func (s memStore) UpdateCluster(cluster *model.Cluster) error             { return nil }
+func (s memStore) DeleteCluster(name string) error                        { return nil }
+func (s memStore) GetClusters() ([]*model.Cluster, error)                 { return nil, nil }
+func (s memStore) GetCluster(name string, b bool) (*model.Cluster, error) { return nil, nil }
+func (s memStore) GetBindedClusters(serverAddr string) ([]string, error)  { return nil, nil }
+func (s memStore) SaveServer(svr *model.Server) error                     { return nil }
+func (s memStore) UpdateServer(svr *model.Server) error                   { return nil }
+func (s memStore) DeleteServer(addr string) error                         { return nil }
+func (s memStore) GetServers() ([]*model.Server, error)                   { return nil, nil }
+func (s memStore) GetServer(addr string, b bool) (*model.Server, error)   { return nil, nil }
+func (s memStore) GetBindedServers(clusterName string) ([]string, error)  { return nil, nil }
+func (s memStore) SaveAggregation(agn *model.Aggregation) error           { return nil }
+func (s memStore) UpdateAggregation(agn *model.Aggregation) error         { return nil }
+func (s memStore) DeleteAggregation(url string) error                     { return nil }
+func (s memStore) GetAggregations() ([]*model.Aggregation, error)         { return nil, nil }
+func (s memStore) SaveRouting(routing *model.Routing) error               { return nil }
+func (s memStore) GetRoutings() ([]*model.Routing, error)                 { return nil, nil }
+func (s memStore) Clean() error                                           { return nil }
+func (s memStore) GC() error                                              { return nil }
+
+func (s memStore) Watch(evtCh chan *model.Evt, stopCh chan bool) error {
+	<-stopCh
+	return nil
+}
+
+type testBackend struct {
+	*httptest.Server
+	requests int32
+}
+
+func newTestBackend(handler http.HandlerFunc) *testBackend {
+	b := &testBackend{}
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&b.requests, 1)
+		handler(w, r)
+	}))
+
+	return b
+}
+
+func newTestTLSBackend(handler http.HandlerFunc) *testBackend {
+	b := &testBackend{}
+	b.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&b.requests, 1)
+		handler(w, r)
+	}))
+
+	return b
+}
+
+func (b *testBackend) addr() string {
+	return strings.TrimPrefix(strings.TrimPrefix(b.URL, "http://"), "https://")
+}
+
+func newTestConf() *conf.Conf {
+	return &conf.Conf{
+		MaxConns:            8,
+		MaxConnDuration:     10,
+		MaxIdleConnDuration: 10,
+		ReadBufferSize:      4096,
+		WriteBufferSize:     4096,
+		ReadTimeout:         5,
+		WriteTimeout:        5,
+		MaxResponseBodySize: 1024 * 1024,
+	}
+}
+
+func newTestProxy(t *testing.T, cnf *conf.Conf, lbName string, backends ...*testBackend) *Proxy {
+	rt := model.NewRouteTable(memStore{})
+
+	cluster, err := model.NewCluster(testClusterName, "^/", lbName)
+	if nil != err {
+		t.Fatalf("create cluster err: %s", err)
+	}
+
+	rt.AddNewCluster(cluster)
+
+	for _, b := range backends {
+		rt.AddNewServer(&model.Server{
+			Schema: "http",
+			Addr:   b.addr(),
+		})
+
+		err = rt.Bind(b.addr(), testClusterName)
+		if nil != err {
+			t.Fatalf("bind err: %s", err)
+		}
+	}
+
+	return NewProxy(cnf, rt)
+}
+
+func doTestRequest(p *Proxy, method string, uri string) *fasthttp.RequestCtx {
+	req := &fasthttp.Request{}
+	req.Header.SetMethod(method)
+	req.SetRequestURI(uri)
+	req.Header.SetHost("gateway")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+
+	p.ReverseProxyHandler(ctx)
+
+	return ctx
+}
+
+func startTestProxy(t *testing.T, p *Proxy) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("listen err: %s", err)
+	}
+
+	go fasthttp.Serve(ln, p.ReverseProxyHandler)
+	return ln
+}
+
+func TestRetryToOtherServer(t *testing.T) {
+	bad := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer bad.Close()
+
+	good := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer good.Close()
+
+	cnf := newTestConf()
+	cnf.MaxRetries = 1
+	p := newTestProxy(t, cnf, "", bad, good)
+
+	for i := 0; i < 2; i++ {
+		ctx := doTestRequest(p, "GET", "/api")
+
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+		}
+	}
+
+	if atomic.LoadInt32(&bad.requests) != 1 || atomic.LoadInt32(&good.requests) != 2 {
+		t.Errorf("expect:<1,2>, acture:<%d,%d>", bad.requests, good.requests)
+	}
+
+	if value := p.metrics.retries.With(testClusterName, "").Value(); value != 1 {
+		t.Errorf("expect:<1>, acture:<%v>", value)
+	}
+}
+
+func TestRetryWithNonIdempotent(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	bad1 := newTestBackend(handler)
+	defer bad1.Close()
+
+	bad2 := newTestBackend(handler)
+	defer bad2.Close()
+
+	cnf := newTestConf()
+	cnf.MaxRetries = 1
+	p := newTestProxy(t, cnf, "", bad1, bad2)
+
+	ctx := doTestRequest(p, "POST", "/api")
+
+	if ctx.Response.StatusCode() != http.StatusBadGateway {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusBadGateway, ctx.Response.StatusCode())
+	}
+
+	requests := atomic.LoadInt32(&bad1.requests) + atomic.LoadInt32(&bad2.requests)
+	if requests != 1 {
+		t.Errorf("expect:<1>, acture:<%d>", requests)
+	}
+}
+
+func TestNodeTimeout(t *testing.T) {
+	slow := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 500)
+		w.Write([]byte("OK"))
+	})
+	defer slow.Close()
+
+	p := newTestProxy(t, newTestConf(), "", slow)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/slow$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/slow",
+			Timeout:     time.Millisecond * 100,
+		},
+	}))
+
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/slow-enough$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/slow",
+			Timeout:     time.Second,
+		},
+	}))
+
+	ctx := doTestRequest(p, "GET", "/slow")
+	if ctx.Response.StatusCode() != http.StatusGatewayTimeout {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusGatewayTimeout, ctx.Response.StatusCode())
+	}
+
+	ctx = doTestRequest(p, "GET", "/slow-enough")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+}
+
+func TestFailureStatusCode(t *testing.T) {
+	down := newTestBackend(func(w http.ResponseWriter, r *http.Request) {})
+	down.Close()
+
+	failure := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("failure"))
+	})
+	defer failure.Close()
+
+	ctx := doTestRequest(newTestProxy(t, newTestConf(), ""), "GET", "/api")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable {
+		t.Errorf("no server expect:<%d>, acture:<%d>", http.StatusServiceUnavailable, ctx.Response.StatusCode())
+	}
+
+	ctx = doTestRequest(newTestProxy(t, newTestConf(), "", down), "GET", "/api")
+	if ctx.Response.StatusCode() != http.StatusBadGateway {
+		t.Errorf("dial failure expect:<%d>, acture:<%d>", http.StatusBadGateway, ctx.Response.StatusCode())
+	}
+
+	ctx = doTestRequest(newTestProxy(t, newTestConf(), "", failure), "GET", "/api")
+	if ctx.Response.StatusCode() != http.StatusInternalServerError || string(ctx.Response.Body()) != "failure" {
+		t.Errorf("backend failure expect:<%d>, acture:<%d>", http.StatusInternalServerError, ctx.Response.StatusCode())
+	}
+
+	cnf := newTestConf()
+	cnf.MaxRetries = 1
+	ctx = doTestRequest(newTestProxy(t, cnf, "", failure), "GET", "/api")
+	if ctx.Response.StatusCode() != http.StatusBadGateway {
+		t.Errorf("backend failure with retry expect:<%d>, acture:<%d>", http.StatusBadGateway, ctx.Response.StatusCode())
+	}
+}
+
+func TestMaxBodyFilter(t *testing.T) {
+	body := strings.Repeat("a", 2048)
+
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// flush before write body, so response is chunked without Content-Length
+			w.(http.Flusher).Flush()
+		}
+
+		w.Write([]byte(body))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.MaxBodySize = 1024
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterMaxBody)
+
+	ctx := doTestRequest(p, "GET", "/length")
+	if ctx.Response.StatusCode() != http.StatusBadGateway {
+		t.Errorf("content-length expect:<%d>, acture:<%d>", http.StatusBadGateway, ctx.Response.StatusCode())
+	}
+
+	ctx = doTestRequest(p, "GET", "/chunked")
+	if ctx.Response.StatusCode() != http.StatusBadGateway {
+		t.Errorf("chunked expect:<%d>, acture:<%d>", http.StatusBadGateway, ctx.Response.StatusCode())
+	}
+
+	cnf.MaxBodySize = len(body)
+	ctx = doTestRequest(p, "GET", "/chunked")
+	if ctx.Response.StatusCode() != http.StatusOK || len(ctx.Response.Body()) != len(body) {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+}
+
+func TestStreamingMaxBodySize(t *testing.T) {
+	body := strings.Repeat("a", 2048)
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			// flush before write body, so response is chunked without Content-Length
+			w.(http.Flusher).Flush()
+		}
+
+		w.Write([]byte(body))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.Streaming = true
+	cnf.MaxResponseBodySize = 1024
+	p := newTestProxy(t, cnf, "", backend)
+	ln := startTestProxy(t, p)
+	defer ln.Close()
+
+	res, err := http.Get("http://" + ln.Addr().String() + "/length")
+	if nil != err {
+		t.Fatalf("request err: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway {
+		t.Errorf("content-length expect:<%d>, acture:<%d>", http.StatusBadGateway, res.StatusCode)
+	}
+
+	// the headers of the chunked response are sent, the body is stopped at the limit
+	res, err = http.Get("http://" + ln.Addr().String() + "/chunked")
+	if nil != err {
+		t.Fatalf("request err: %s", err)
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if len(data) > cnf.MaxResponseBodySize {
+		t.Errorf("chunked expect at most:<%d>, acture:<%d>", cnf.MaxResponseBodySize, len(data))
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		w.(http.Flusher).Flush()
+
+		time.Sleep(time.Millisecond * 500)
+		w.Write([]byte("second"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.Streaming = true
+	cnf.FlushInterval = 10
+	p := newTestProxy(t, cnf, "", backend)
+	ln := startTestProxy(t, p)
+	defer ln.Close()
+
+	for i := 0; i < 2; i++ {
+		startAt := time.Now()
+		res, err := http.Get("http://" + ln.Addr().String() + "/stream")
+		if nil != err {
+			t.Fatalf("request err: %s", err)
+		}
+
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(res.Body, buf)
+		if nil != err || string(buf) != "first" {
+			t.Errorf("expect:<first>, acture:<%s>, err:<%v>", buf, err)
+		}
+
+		if cost := time.Since(startAt); cost >= time.Millisecond*500 {
+			t.Errorf("expect first flush before:<500ms>, acture:<%s>", cost)
+		}
+
+		rest, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if nil != err || string(rest) != "second" {
+			t.Errorf("expect:<second>, acture:<%s>, err:<%v>", rest, err)
+		}
+	}
+
+	if atomic.LoadInt32(&backend.requests) != 2 {
+		t.Errorf("expect:<2>, acture:<%d>", backend.requests)
+	}
+}
+
+func TestStreamingWithMerge(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`"` + r.URL.Path + `"`))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.Streaming = true
+	p := newTestProxy(t, cnf, "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/merge$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/a",
+			AttrName:    "a",
+		},
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/b",
+			AttrName:    "b",
+		},
+	}))
+
+	ctx := doTestRequest(p, "GET", "/merge")
+	if ctx.Response.StatusCode() != http.StatusOK || len(ctx.Response.Body()) != len(`{"a":"/a","b":"/b"}`) {
+		t.Errorf("expect:<%d>, acture:<%d>, body:<%s>", http.StatusOK, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	interval := time.Millisecond * 200
+
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				time.Sleep(interval)
+			}
+
+			w.Write([]byte("data: event\n\n"))
+			w.(http.Flusher).Flush()
+		}
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	ln := startTestProxy(t, p)
+	defer ln.Close()
+
+	startAt := time.Now()
+	res, err := http.Get("http://" + ln.Addr().String() + "/events")
+	if nil != err {
+		t.Fatalf("request err: %s", err)
+	}
+	defer res.Body.Close()
+
+	r := bufio.NewReader(res.Body)
+	for i := 0; i < 3; i++ {
+		line, err := r.ReadString('\n')
+		if nil != err || line != "data: event\n" {
+			t.Fatalf("expect:<data: event>, acture:<%s>, err:<%v>", line, err)
+		}
+		r.ReadString('\n')
+
+		if cost := time.Since(startAt); cost >= interval*time.Duration(i+1) {
+			t.Errorf("expect event %d before:<%s>, acture:<%s>", i, interval*time.Duration(i+1), cost)
+		}
+	}
+
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("expect:<%v>, acture:<%v>", io.EOF, err)
+	}
+}
+
+func TestEventStreamWithClientDisconnect(t *testing.T) {
+	done := make(chan struct{})
+
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		for {
+			if _, err := w.Write([]byte("data: event\n\n")); nil != err {
+				return
+			}
+			w.(http.Flusher).Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(time.Millisecond * 20):
+			}
+		}
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	ln := startTestProxy(t, p)
+	defer ln.Close()
+
+	res, err := http.Get("http://" + ln.Addr().String() + "/events")
+	if nil != err {
+		t.Fatalf("request err: %s", err)
+	}
+
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	if nil != err || line != "data: event\n" {
+		t.Errorf("expect:<data: event>, acture:<%s>, err:<%v>", line, err)
+	}
+	res.Body.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 2):
+		t.Errorf("expect backend stream closed after client disconnect")
+	}
+}
+
+func TestNodeMaxConcurrency(t *testing.T) {
+	entered := make(chan struct{}, 4)
+	release := make(chan struct{})
+
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/limited$", []*model.Node{
+		&model.Node{
+			ClusterName:    testClusterName,
+			URL:            "/api",
+			MaxConcurrency: 2,
+		},
+	}))
+
+	codes := make(chan int, 4)
+	for i := 0; i < 2; i++ {
+		go func() {
+			codes <- doTestRequest(p, "GET", "/limited").Response.StatusCode()
+		}()
+	}
+
+	<-entered
+	<-entered
+
+	for i := 0; i < 2; i++ {
+		ctx := doTestRequest(p, "GET", "/limited")
+		if ctx.Response.StatusCode() != http.StatusServiceUnavailable {
+			t.Errorf("expect:<%d>, acture:<%d>", http.StatusServiceUnavailable, ctx.Response.StatusCode())
+		}
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, code)
+		}
+	}
+
+	// the concurrency is released
+	ctx := doTestRequest(p, "GET", "/limited")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+}
+
+func TestNodeMaxConcurrencyWithQueue(t *testing.T) {
+	entered := make(chan struct{}, 4)
+
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		time.Sleep(time.Millisecond * 200)
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/limited$", []*model.Node{
+		&model.Node{
+			ClusterName:         testClusterName,
+			URL:                 "/api",
+			MaxConcurrency:      1,
+			MaxConcurrencyQueue: 1,
+			MaxConcurrencyWait:  time.Second,
+		},
+	}))
+
+	codes := make(chan int, 3)
+	go func() {
+		codes <- doTestRequest(p, "GET", "/limited").Response.StatusCode()
+	}()
+	<-entered
+
+	// waiting in the queue
+	go func() {
+		codes <- doTestRequest(p, "GET", "/limited").Response.StatusCode()
+	}()
+	time.Sleep(time.Millisecond * 50)
+
+	// the queue is full
+	ctx := doTestRequest(p, "GET", "/limited")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusServiceUnavailable, ctx.Response.StatusCode())
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, code)
+		}
+	}
+}
+
+func TestMaxRequestBodySize(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.MaxRequestBodySize = 1024
+	p := newTestProxy(t, cnf, "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/upload$", []*model.Node{
+		&model.Node{
+			ClusterName:        testClusterName,
+			URL:                "/upload",
+			MaxRequestBodySize: 4096,
+		},
+	}))
+
+	ln := startTestProxy(t, p)
+	defer ln.Close()
+
+	url := "http://" + ln.Addr().String()
+	body := strings.Repeat("a", 2048)
+
+	res, err := http.Post(url+"/api", "text/plain", strings.NewReader(body))
+	if nil != err || res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("content-length expect:<%d>, acture:<%v>, err:<%v>", http.StatusRequestEntityTooLarge, res, err)
+	}
+
+	// the unknown size body is sent by chunked
+	res, err = http.Post(url+"/api", "text/plain", ioutil.NopCloser(strings.NewReader(body)))
+	if nil != err || res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked expect:<%d>, acture:<%v>, err:<%v>", http.StatusRequestEntityTooLarge, res, err)
+	}
+
+	if requests := atomic.LoadInt32(&backend.requests); requests != 0 {
+		t.Errorf("expect:<0>, acture:<%d>", requests)
+	}
+
+	res, err = http.Post(url+"/upload", "text/plain", ioutil.NopCloser(strings.NewReader(body)))
+	if nil != err || res.StatusCode != http.StatusOK {
+		t.Errorf("node limit expect:<%d>, acture:<%v>, err:<%v>", http.StatusOK, res, err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+
+	for i := 0; i < 3; i++ {
+		doTestRequest(p, "GET", "/api")
+	}
+	doTestRequest(p, "GET", "/fail")
+
+	if value := p.metrics.requests.With(testClusterName, "", "200").Value(); value != 3 {
+		t.Errorf("expect:<3>, acture:<%v>", value)
+	}
+
+	if value := p.metrics.requests.With(testClusterName, "", "500").Value(); value != 1 {
+		t.Errorf("expect:<1>, acture:<%v>", value)
+	}
+
+	if value := p.metrics.upstreamErrors.With(testClusterName, "", backend.addr()).Value(); value != 1 {
+		t.Errorf("expect:<1>, acture:<%v>", value)
+	}
+
+	if count := p.metrics.latency.With(testClusterName, "").Count(); count != 4 {
+		t.Errorf("expect:<4>, acture:<%d>", count)
+	}
+
+	if value := p.metrics.inFlight.With(testClusterName, "").Value(); value != 0 {
+		t.Errorf("expect:<0>, acture:<%v>", value)
+	}
+
+	rec := httptest.NewRecorder()
+	p.metrics.registry.ServeHTTP(rec, httptest.NewRequest("GET", metricsPath, nil))
+	if !strings.Contains(rec.Body.String(), `gateway_requests_total{cluster="app",node="",code="200"} 3`) {
+		t.Errorf("expect requests total, acture:<%s>", rec.Body.String())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var received string
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(headerXRequestID)
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.RequestIDPattern = "^[a-z0-9-]+$"
+	p := newTestProxy(t, cnf, "", backend)
+
+	doRequestWithID := func(id string) *fasthttp.RequestCtx {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/api")
+		req.Header.SetHost("gateway")
+		if "" != id {
+			req.Header.Set(headerXRequestID, id)
+		}
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, nil, nil)
+		p.ReverseProxyHandler(ctx)
+		return ctx
+	}
+
+	// generate
+	ctx := doRequestWithID("")
+	id := string(ctx.Response.Header.Peek(headerXRequestID))
+	if "" == id || id != received {
+		t.Errorf("expect:<%s>, acture:<%s>", received, id)
+	}
+
+	ctx = doRequestWithID("")
+	if next := string(ctx.Response.Header.Peek(headerXRequestID)); next == id {
+		t.Errorf("expect unique request id, acture:<%s>", next)
+	}
+
+	// preserve
+	ctx = doRequestWithID("abc-123")
+	if id = string(ctx.Response.Header.Peek(headerXRequestID)); id != "abc-123" || received != "abc-123" {
+		t.Errorf("expect:<abc-123>, acture:<%s,%s>", id, received)
+	}
+
+	// not match the pattern
+	ctx = doRequestWithID("ABC 123")
+	if id = string(ctx.Response.Header.Peek(headerXRequestID)); "ABC 123" == id || id != received {
+		t.Errorf("expect:<%s>, acture:<%s>", received, id)
+	}
+}
+
+func TestNodeRewritePattern(t *testing.T) {
+	var received string
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.RequestURI()
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api/v1/", []*model.Node{
+		&model.Node{
+			ClusterName:    testClusterName,
+			URL:            "/node",
+			RewritePattern: "^/api/v1/(.*)$",
+			RewriteTo:      "/$1",
+		},
+	}))
+
+	doTestRequest(p, "GET", "/api/v1/users?id=1")
+	if received != "/users?id=1" {
+		t.Errorf("expect:</users?id=1>, acture:<%s>", received)
+	}
+}
+
+func TestNodePrefix(t *testing.T) {
+	var received string
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.RequestURI()
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/svc-a/", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/node",
+			StripPrefix: "/svc-a",
+			AddPrefix:   "/v2",
+		},
+	}))
+
+	doTestRequest(p, "GET", "/svc-a/users?id=1")
+	if received != "/v2/users?id=1" {
+		t.Errorf("expect:</v2/users?id=1>, acture:<%s>", received)
+	}
+}
+
+func TestNodeRewriteTraversal(t *testing.T) {
+	var received atomic.Value
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.URL.RequestURI())
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api/v1/", []*model.Node{
+		&model.Node{
+			ClusterName:    testClusterName,
+			RewritePattern: "^/api/v1/(.*)$",
+			RewriteTo:      "/public/$1",
+		},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/svc-a/", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			StripPrefix: "/svc-a",
+			AddPrefix:   "/public",
+		},
+	}))
+	p.routeTable.AddNewAggregation(&model.Aggregation{
+		Path: "/users/{id}",
+		Nodes: []*model.Node{
+			&model.Node{ClusterName: testClusterName, Rewrite: "/profiles/{id}"},
+		},
+	})
+
+	cases := []struct {
+		uri    string
+		code   int
+		expect string
+	}{
+		{uri: "/api/v1/users?id=1", code: http.StatusOK, expect: "/public/users?id=1"},
+		{uri: "/svc-a/users", code: http.StatusOK, expect: "/public/users"},
+		{uri: "/users/1", code: http.StatusOK, expect: "/profiles/1"},
+		{uri: "/api/v1/..%252fadmin", code: http.StatusBadRequest},
+		{uri: "/api/v1/..%252Fadmin", code: http.StatusBadRequest},
+		{uri: "/api/v1/%252e%252e/admin", code: http.StatusBadRequest},
+		{uri: "/api/v1/..;/admin", code: http.StatusBadRequest},
+		{uri: "/api/v1/admin%2500.json", code: http.StatusBadRequest},
+		{uri: "/svc-a/..%252fadmin", code: http.StatusBadRequest},
+		{uri: "/users/..%252fadmin", code: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		received.Store("")
+
+		ctx := doTestRequest(p, "GET", c.uri)
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.uri, c.code, ctx.Response.StatusCode())
+		}
+
+		if value := received.Load(); value != c.expect {
+			t.Errorf("%s expect:<%s>, acture:<%v>", c.uri, c.expect, value)
+		}
+	}
+}
+
+func TestNodeHostHeader(t *testing.T) {
+	var received string
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Host
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/vhost$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/vhost",
+			HostHeader:  "api.example.com",
+		},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/rewrite$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/rewrite",
+			Rewrite:     "/rewrite",
+		},
+	}))
+
+	doTestRequest(p, "GET", "/vhost")
+	if received != "api.example.com" {
+		t.Errorf("expect:<api.example.com>, acture:<%s>", received)
+	}
+
+	doTestRequest(p, "GET", "/api")
+	if received != "gateway" {
+		t.Errorf("expect:<gateway>, acture:<%s>", received)
+	}
+
+	doTestRequest(p, "GET", "/rewrite")
+	if received != backend.addr() {
+		t.Errorf("expect:<%s>, acture:<%s>", backend.addr(), received)
+	}
+}
+
+func TestNodeRewriteLocation(t *testing.T) {
+	var backend *testBackend
+	backend = newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/login":
+			w.Header().Set("Location", "http://"+backend.addr()+"/v2/home?from=login")
+		case "/v2/relative":
+			w.Header().Set("Location", "/v2/home")
+		case "/v2/external":
+			w.Header().Set("Location", "https://sso.example.com/login")
+		}
+		w.WriteHeader(http.StatusFound)
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/svc-a/", []*model.Node{
+		&model.Node{
+			ClusterName:     testClusterName,
+			URL:             "/node",
+			StripPrefix:     "/svc-a",
+			AddPrefix:       "/v2",
+			RewriteLocation: true,
+		},
+	}))
+
+	cases := []struct {
+		uri      string
+		location string
+	}{
+		{uri: "/svc-a/login", location: "http://gateway/svc-a/home?from=login"},
+		{uri: "/svc-a/relative", location: "/svc-a/home"},
+		// the other hosts are not changed
+		{uri: "/svc-a/external", location: "https://sso.example.com/login"},
+	}
+
+	for _, c := range cases {
+		ctx := doTestRequest(p, "GET", c.uri)
+		if ctx.Response.StatusCode() != http.StatusFound {
+			t.Fatalf("%s expect:<%d>, acture:<%d>", c.uri, http.StatusFound, ctx.Response.StatusCode())
+		}
+
+		if location := string(ctx.Response.Header.Peek("Location")); location != c.location {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.uri, c.location, location)
+		}
+	}
+}
+
+func TestNodeCookieRewrite(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1", Domain: "svc-a.internal", Path: "/v2"})
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "2", Domain: "svc-a.internal", Path: "/v2/admin"})
+		http.SetCookie(w, &http.Cookie{Name: "lang", Value: "en", Path: "/"})
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/svc-a/", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/node",
+			StripPrefix: "/svc-a",
+			AddPrefix:   "/v2",
+			CookieRewrite: &model.CookieRewrite{
+				Domains:  map[string]string{"svc-a.internal": "example.com"},
+				Paths:    map[string]string{"/": "/svc-a"},
+				Secure:   true,
+				SameSite: "Strict",
+			},
+		},
+	}))
+
+	ctx := doTestRequest(p, "GET", "/svc-a/users")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	var cookies []string
+	ctx.Response.Header.VisitAllCookie(func(key, value []byte) {
+		cookies = append(cookies, string(value))
+	})
+
+	expects := []string{
+		"sid=1; Path=/svc-a; Domain=example.com; Secure; SameSite=Strict",
+		"sid=2; Path=/svc-a/admin; Domain=example.com; Secure; SameSite=Strict",
+		"lang=en; Path=/svc-a; Secure; SameSite=Strict",
+	}
+	if len(cookies) != len(expects) {
+		t.Fatalf("expect:<%v>, acture:<%v>", expects, cookies)
+	}
+
+	for i, expect := range expects {
+		if cookies[i] != expect {
+			t.Errorf("expect:<%s>, acture:<%s>", expect, cookies[i])
+		}
+	}
+}
+
+func TestNodeMatchMethods(t *testing.T) {
+	query := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("query"))
+	})
+	defer query.Close()
+
+	command := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("command"))
+	})
+	defer command.Close()
+
+	p := newTestProxy(t, newTestConf(), "", query)
+
+	cluster, _ := model.NewCluster("command", "^/", "")
+	p.routeTable.AddNewCluster(cluster)
+	p.routeTable.AddNewServer(&model.Server{Schema: "http", Addr: command.addr()})
+	p.routeTable.Bind(command.addr(), "command")
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/users$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/users", MatchMethods: []string{"GET", "head"}},
+		&model.Node{ClusterName: "command", URL: "/users", MatchMethods: []string{"POST", "PUT", "DELETE"}},
+	}))
+
+	cases := []struct {
+		method string
+		expect string
+	}{
+		{method: "GET", expect: "query"},
+		{method: "POST", expect: "command"},
+		{method: "DELETE", expect: "command"},
+	}
+
+	for _, c := range cases {
+		ctx := doTestRequest(p, c.method, "/users")
+		if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != c.expect {
+			t.Errorf("%s expect:<%s>, acture:<%d, %s>", c.method, c.expect, ctx.Response.StatusCode(), ctx.Response.Body())
+		}
+	}
+
+	// the aggregation is not matched without the node of method
+	req := &fasthttp.Request{}
+	req.Header.SetMethod("PATCH")
+	req.SetRequestURI("/users")
+	results := p.routeTable.SelectByClient(req, "")
+	if len(results) != 1 || nil != results[0].Node {
+		t.Errorf("expect:<the cluster result>, acture:<%+v>", results)
+	}
+}
+
+func TestNodeHeaderRoutes(t *testing.T) {
+	stable := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stable"))
+	})
+	defer stable.Close()
+
+	beta := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("beta"))
+	})
+	defer beta.Close()
+
+	p := newTestProxy(t, newTestConf(), "", stable)
+
+	cluster, _ := model.NewCluster("beta", "^/", "")
+	p.routeTable.AddNewCluster(cluster)
+	p.routeTable.AddNewServer(&model.Server{Schema: "http", Addr: beta.addr()})
+	p.routeTable.Bind(beta.addr(), "beta")
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/api",
+			HeaderRoutes: []*model.HeaderRoute{
+				&model.HeaderRoute{ClusterName: "beta", Headers: []*model.HeaderMatch{&model.HeaderMatch{Name: "X-Variant", Exact: "beta"}}},
+			},
+		},
+	}))
+
+	for variant, expect := range map[string]string{"beta": "beta", "alpha": "stable", "": "stable"} {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/api")
+		req.Header.SetHost("gateway")
+		if "" != variant {
+			req.Header.Set("X-Variant", variant)
+		}
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, nil, nil)
+		p.ReverseProxyHandler(ctx)
+
+		if body := string(ctx.Response.Body()); body != expect {
+			t.Errorf("%s expect:<%s>, acture:<%s>", variant, expect, body)
+		}
+	}
+}
+
+func TestPathTemplateParams(t *testing.T) {
+	var received, user string
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.RequestURI()
+		user = r.Header.Get("X-User")
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeaderRules)
+	p.routeTable.AddNewAggregation(&model.Aggregation{
+		Path: "/users/{id}",
+		Nodes: []*model.Node{
+			&model.Node{
+				ClusterName: testClusterName,
+				Rewrite:     "/profiles/{id}",
+				RequestHeaders: &model.HeaderRules{
+					Add: map[string]string{"X-User": "${path.id}"},
+				},
+			},
+		},
+	})
+
+	doTestRequest(p, "GET", "/users/1")
+	if received != "/profiles/1" {
+		t.Errorf("expect:</profiles/1>, acture:<%s>", received)
+	}
+
+	if user != "1" {
+		t.Errorf("expect:<1>, acture:<%s>", user)
+	}
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	cnf := newTestConf()
+	cnf.ServerReadTimeout = 1
+	p := newTestProxy(t, cnf, "")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatalf("listen err: %s", err)
+	}
+	defer ln.Close()
+	go p.newServer().Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if nil != err {
+		t.Fatalf("dial err: %s", err)
+	}
+	defer conn.Close()
+
+	// the client stalled before the end of request headers
+	if _, err := conn.Write([]byte("GET /api HTTP/1.1\r\nHost: gateway\r\n")); nil != err {
+		t.Fatalf("write err: %s", err)
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(start.Add(5 * time.Second))
+	ioutil.ReadAll(conn)
+
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Errorf("expect the stalled connection closed by read timeout, elapsed %s", elapsed)
+	}
+}
+
+func TestDefaultCluster(t *testing.T) {
+	app := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("app"))
+	})
+	defer app.Close()
+
+	fallback := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("fallback"))
+	})
+	defer fallback.Close()
+
+	cnf := newTestConf()
+	cnf.DefaultCluster = "fallback"
+	rt := model.NewRouteTable(memStore{})
+	for _, c := range []struct {
+		name    string
+		pattern string
+		backend *testBackend
+	}{
+		{name: testClusterName, pattern: "^/api", backend: app},
+		{name: cnf.DefaultCluster, pattern: "^/fallback", backend: fallback},
+	} {
+		cluster, _ := model.NewCluster(c.name, c.pattern, "")
+		rt.AddNewCluster(cluster)
+		rt.AddNewServer(&model.Server{Schema: "http", Addr: c.backend.addr()})
+		rt.Bind(c.backend.addr(), c.name)
+	}
+	p := NewProxy(cnf, rt)
+
+	ctx := doTestRequest(p, "GET", "/api/users")
+	if ctx.Response.StatusCode() != http.StatusOK || string(ctx.Response.Body()) != "app" {
+		t.Errorf("matched expect:<app>, acture:<%d, %s>", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	ctx = doTestRequest(p, "GET", "/unknown")
+	if ctx.Response.StatusCode() != http.StatusNotFound || string(ctx.Response.Body()) != "fallback" {
+		t.Errorf("unmatched expect:<fallback>, acture:<%d, %s>", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	// the requests are not routed without the default cluster
+	rt.SetDefaultCluster("")
+	ctx = doTestRequest(p, "GET", "/unknown")
+	if ctx.Response.StatusCode() != http.StatusServiceUnavailable {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusServiceUnavailable, ctx.Response.StatusCode())
+	}
+}
+
+func TestAcceptRouting(t *testing.T) {
+	jsonBackend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, "application/json")
+		w.Write([]byte(`{"name":"zhangsan"}`))
+	})
+	defer jsonBackend.Close()
+
+	xmlBackend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderContentType, "application/xml")
+		w.Write([]byte(`<user><name>zhangsan</name></user>`))
+	})
+	defer xmlBackend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", jsonBackend)
+	p.RegistryFilter(FilterHeader)
+
+	cluster, _ := model.NewCluster("xml", "^/", "")
+	p.routeTable.AddNewCluster(cluster)
+	p.routeTable.AddNewServer(&model.Server{Schema: "http", Addr: xmlBackend.addr()})
+	p.routeTable.Bind(xmlBackend.addr(), "xml")
+
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/users", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/users", Produces: []string{"application/json"}},
+		&model.Node{ClusterName: "xml", URL: "/users", Produces: []string{"application/xml", "text/xml"}},
+	}))
+
+	cases := []struct {
+		name   string
+		accept string
+		code   int
+		body   string
+	}{
+		{name: "json preferred", accept: "application/json, application/xml;q=0.5", code: http.StatusOK, body: `{"name":"zhangsan"}`},
+		{name: "xml preferred", accept: "application/json;q=0.5, text/xml", code: http.StatusOK, body: `<user><name>zhangsan</name></user>`},
+		{name: "any", accept: "*/*", code: http.StatusOK, body: `{"name":"zhangsan"}`},
+		{name: "unacceptable", accept: "text/html, application/json;q=0", code: http.StatusNotAcceptable},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/users")
+		req.Header.SetHost("gateway")
+		req.Header.Set("Accept", c.accept)
+
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init(req, nil, nil)
+		p.ReverseProxyHandler(ctx)
+
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.name, c.code, ctx.Response.StatusCode())
+		}
+
+		if "" != c.body && string(ctx.Response.Body()) != c.body {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.name, c.body, ctx.Response.Body())
+		}
+	}
+}
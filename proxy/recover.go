@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrPanic the filters or the upstream call panic, the gateway is kept alive
+	ErrPanic = errors.New("proxy panic")
+)
+
+// recoverHandler recover the panic of the handler, the request is responded 500
+func (p *Proxy) recoverHandler(ctx *fasthttp.RequestCtx) {
+	if r := recover(); nil != r {
+		log.Errorf("[%s] Proxy panic: %v\n%s", getRequestID(ctx), r, debug.Stack())
+		p.metrics.incPanics(nil)
+
+		ctx.Response.Reset()
+		p.writeError(ctx, nil, http.StatusInternalServerError, ErrPanic)
+	}
+}
+
+// recoverProxy recover the panic of the filters and the upstream call of result, the result fail with 500
+func (p *Proxy) recoverProxy(result *model.RouteResult) {
+	if r := recover(); nil != r {
+		log.Errorf("[%s] Proxy panic: %v\n%s", result.RequestID, r, debug.Stack())
+		p.metrics.incPanics(result)
+
+		result.Err = ErrPanic
+		result.Code = http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+type testPanicFilter struct {
+	BaseFilter
+}
+
+func (f testPanicFilter) Name() string {
+	return "PANIC"
+}
+
+func (f testPanicFilter) Pre(c *FilterContext) (statusCode int, err error) {
+	if nil != c.result.Node && "/panic" == c.result.Node.URL {
+		panic("filter panic")
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+func TestRecoverPanic(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{}"))
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.filters.PushBack(testPanicFilter{})
+	p.updateChain()
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/panic$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/panic"},
+	}))
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/merge$", []*model.Node{
+		&model.Node{ClusterName: testClusterName, URL: "/panic", AttrName: "panic"},
+		&model.Node{ClusterName: testClusterName, URL: "/api", AttrName: "api"},
+	}))
+
+	ln := startTestProxy(t, p)
+	defer ln.Close()
+
+	get := func(uri string) int {
+		req := fasthttp.AcquireRequest()
+		res := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(res)
+
+		req.SetRequestURI("http://" + ln.Addr().String() + uri)
+		if err := fasthttp.Do(req, res); nil != err {
+			t.Fatalf("%s request err: %s", uri, err)
+		}
+
+		return res.StatusCode()
+	}
+
+	// the panic of the sub-request of merge is recovered in its goroutine
+	for _, uri := range []string{"/panic", "/merge"} {
+		if code := get(uri); code != http.StatusInternalServerError {
+			t.Errorf("%s expect:<%d>, acture:<%d>", uri, http.StatusInternalServerError, code)
+		}
+	}
+
+	// the server stays up
+	if code := get("/api"); code != http.StatusOK {
+		t.Errorf("expect:<%d>, acture:<%d>", http.StatusOK, code)
+	}
+
+	if value := p.metrics.panics.With(testClusterName, "/panic").Value(); value != 2 {
+		t.Errorf("expect:<2>, acture:<%v>", value)
+	}
+}
+
+func TestRecoverHandlerPanic(t *testing.T) {
+	p := newTestProxy(t, newTestConf(), "")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Response.SetBodyString("partial")
+	func() {
+		defer p.recoverHandler(ctx)
+		panic("handler panic")
+	}()
+
+	if ctx.Response.StatusCode() != http.StatusInternalServerError || len(ctx.Response.Body()) != 0 {
+		t.Errorf("expect:<%d>, acture:<%d %s>", http.StatusInternalServerError, ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+
+	if value := p.metrics.panics.With("", "").Value(); value != 1 {
+		t.Errorf("expect:<1>, acture:<%v>", value)
+	}
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"github.com/fagongzi/gateway/pkg/util"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerXRequestID    = "X-Request-Id"
+	requestIDRuntimeVar = "request.id"
+	maxRequestIDLength  = 128
+	requestIDUserValue  = "gateway.request.id"
+)
+
+// prepareRequestID preserve the request id supplied by client, or generate a new one
+// if absent or not match the configured pattern, the id is set to the request header
+// so it is forwarded to the backend servers.
+func (p *Proxy) prepareRequestID(ctx *fasthttp.RequestCtx) string {
+	requestID := string(ctx.Request.Header.Peek(headerXRequestID))
+	if !p.isValidRequestID([]byte(requestID)) {
+		requestID = util.UUID()
+		ctx.Request.Header.Set(headerXRequestID, requestID)
+	}
+
+	ctx.SetUserValue(requestIDUserValue, requestID)
+	return requestID
+}
+
+func (p *Proxy) isValidRequestID(id []byte) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	return nil == p.requestIDPattern || p.requestIDPattern.Match(id)
+}
+
+// getRequestID returns the request id prepared by prepareRequestID, it is read from the user value
+// instead of the request header, because the Peek of header is not safe in the sub-requests of merge
+func getRequestID(ctx *fasthttp.RequestCtx) string {
+	id, _ := ctx.UserValue(requestIDUserValue).(string)
+	return id
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+// dryRunRoute route the request by the same selection and rewrites of the proxy, but not forward to the server.
+// The load balance state is advanced as a real request, the request filters are not executed.
+func (p *Proxy) dryRunRoute(req model.RouteTestReq) *model.RouteTestRsp {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(newDryRunRequest(req), nil, nil)
+
+	rsp := &model.RouteTestRsp{
+		Maintenance: nil != p.getMaintenance(),
+	}
+
+	for _, filter := range p.chain {
+		rsp.Filters = append(rsp.Filters, filter.Name())
+	}
+
+	clientIP := req.ClientIP
+	if "" == clientIP {
+		clientIP = p.getClientIP(ctx)
+	}
+
+	for _, result := range p.routeTable.SelectByClient(p.prepareRouteRequest(ctx), clientIP) {
+		result.ClientIP = clientIP
+		p.selectAffinityServer(&ctx.Request, result)
+		rsp.Results = append(rsp.Results, p.newRouteTestResult(ctx, result))
+	}
+
+	return rsp
+}
+
+func newDryRunRequest(req model.RouteTestReq) *fasthttp.Request {
+	r := &fasthttp.Request{}
+
+	method := req.Method
+	if "" == method {
+		method = "GET"
+	}
+	r.Header.SetMethod(method)
+	r.SetRequestURI(req.URI)
+
+	for name, value := range req.Headers {
+		r.Header.Set(name, value)
+	}
+
+	if "" != req.Host {
+		r.Header.SetHost(req.Host)
+	}
+
+	return r
+}
+
+func (p *Proxy) newRouteTestResult(ctx *fasthttp.RequestCtx, result *model.RouteResult) *model.RouteTestResult {
+	value := &model.RouteTestResult{
+		Node:   -1,
+		Canary: result.Canary,
+		Params: result.Params,
+	}
+
+	if nil != result.Aggregation {
+		value.AggregationURL = result.Aggregation.URL
+		for index, node := range result.Aggregation.Nodes {
+			if node == result.Node {
+				value.Node = index
+			}
+		}
+	}
+
+	if nil != result.Node {
+		value.Mocked = result.Node.IsMocked()
+		value.Maintenance = nil != result.Node.Maintenance
+	}
+
+	if nil != result.Cluster {
+		value.ClusterName = result.Cluster.Name
+	}
+
+	if nil != result.Svr {
+		value.Server = result.Svr.Addr
+	}
+
+	for _, filter := range p.filterPlan(result.Node) {
+		value.Filters = append(value.Filters, filter.Name())
+	}
+
+	outreq, err := p.newOutRequest(ctx, result)
+	if nil != err {
+		value.Error = err.Error()
+		return value
+	}
+
+	value.URI = string(outreq.RequestURI())
+	value.Host = string(outreq.Host())
+	fasthttp.ReleaseRequest(outreq)
+
+	return value
+}
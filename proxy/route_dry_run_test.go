@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestManagerRouteTest(t *testing.T) {
+	var received atomic.Value
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.URL.RequestURI())
+		w.Write([]byte("OK"))
+	}
+
+	api := newTestBackend(handler)
+	defer api.Close()
+	users := newTestBackend(handler)
+	defer users.Close()
+
+	p := newTestProxy(t, newTestConf(), "", api)
+	p.RegistryFilter(FilterHeaderRules)
+
+	cluster, _ := model.NewCluster("users", "^/users", "")
+	p.routeTable.AddNewCluster(cluster)
+	p.routeTable.AddNewServer(&model.Server{Schema: "http", Addr: users.addr()})
+	p.routeTable.Bind(users.addr(), "users")
+
+	p.routeTable.AddNewAggregation(&model.Aggregation{
+		Path: "/users/{id}",
+		Nodes: []*model.Node{
+			&model.Node{ClusterName: "users", Rewrite: "/profiles/{id}"},
+		},
+	})
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/v1/orders", []*model.Node{
+		&model.Node{ClusterName: testClusterName, StripPrefix: "/v1"},
+	}))
+
+	cases := []struct {
+		uri     string
+		backend *testBackend
+		expect  model.RouteTestResult
+	}{
+		{
+			uri:     "/users/1",
+			backend: users,
+			expect:  model.RouteTestResult{AggregationURL: "/users/{id}", Node: 0, ClusterName: "users", Server: users.addr(), URI: "/profiles/1"},
+		},
+		{
+			uri:     "/v1/orders?page=2",
+			backend: api,
+			expect:  model.RouteTestResult{AggregationURL: "^/v1/orders", Node: 0, ClusterName: testClusterName, Server: api.addr(), URI: "/orders?page=2"},
+		},
+		{
+			uri:     "/other",
+			backend: api,
+			expect:  model.RouteTestResult{Node: -1, ClusterName: testClusterName, Server: api.addr(), URI: "/other"},
+		},
+	}
+
+	m := newManager(p)
+	for _, c := range cases {
+		rsp := &model.RouteTestRsp{}
+		if err := m.RouteTest(model.RouteTestReq{Method: "GET", URI: c.uri, Host: "gateway"}, rsp); nil != err {
+			t.Fatalf("%s route test err: %s", c.uri, err)
+		}
+
+		if len(rsp.Filters) != 1 || rsp.Filters[0] != FilterHeaderRules || rsp.Maintenance {
+			t.Errorf("%s expect:<[%s]>, acture:<%+v>", c.uri, FilterHeaderRules, rsp)
+		}
+
+		if len(rsp.Results) != 1 {
+			t.Fatalf("%s expect:<1>, acture:<%d>", c.uri, len(rsp.Results))
+		}
+
+		result := rsp.Results[0]
+		if result.AggregationURL != c.expect.AggregationURL || result.Node != c.expect.Node || result.ClusterName != c.expect.ClusterName ||
+			result.Server != c.expect.Server || result.URI != c.expect.URI {
+			t.Errorf("%s expect:<%+v>, acture:<%+v>", c.uri, c.expect, result)
+		}
+
+		// the dry run is not forwarded
+		requests := atomic.LoadInt32(&c.backend.requests)
+
+		ctx := doTestRequest(p, "GET", c.uri)
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.uri, http.StatusOK, ctx.Response.StatusCode())
+		}
+
+		if value := atomic.LoadInt32(&c.backend.requests); value != requests+1 {
+			t.Errorf("%s expect the request to <%s>", c.uri, c.expect.Server)
+		}
+
+		if value := received.Load(); value != c.expect.URI {
+			t.Errorf("%s expect:<%s>, acture:<%v>", c.uri, c.expect.URI, value)
+		}
+	}
+
+	rsp := &model.RouteTestRsp{}
+	m.RouteTest(model.RouteTestReq{URI: "/users/2"}, rsp)
+	if params := rsp.Results[0].Params; params["id"] != "2" {
+		t.Errorf("expect:<2>, acture:<%v>", params)
+	}
+}
@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+// rewriteCookies rewrite all the Set-Cookie headers of the response by the cookie rewrite of node,
+// the cookies of the same name with the different paths are kept
+func rewriteCookies(result *model.RouteResult) {
+	if nil == result.Node || nil == result.Node.CookieRewrite || nil == result.Res {
+		return
+	}
+
+	var cookies []string
+	result.Res.Header.VisitAllCookie(func(key, value []byte) {
+		cookies = append(cookies, result.Node.RewriteCookie(string(value)))
+	})
+
+	if len(cookies) == 0 {
+		return
+	}
+
+	// the Set-Cookie header is appended by Set
+	result.Res.Header.DelAllCookies()
+	for _, cookie := range cookies {
+		result.Res.Header.Set(headerSetCookie, cookie)
+	}
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	drainPollInterval = 10 * time.Millisecond
+)
+
+// Stop stop accepting new connections, and wait for the in-flight requests finished until the ctx is done,
+// then close the remaining connections, stop the rpc server, the gRPC server and the health checks of servers.
+// The ctx error is returned if the in-flight requests are not finished.
+func (p *Proxy) Stop(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&p.stopping, 0, 1) {
+		return nil
+	}
+
+	p.stopLock.Lock()
+	ln, rpcLn, grpcServer := p.ln, p.rpcListener, p.grpcServer
+	p.stopLock.Unlock()
+
+	if nil != ln {
+		ln.Close()
+	}
+
+	err := p.waitInFlight(ctx)
+
+	// the keep-alive and websocket connections
+	if nil != ln {
+		ln.closeConns()
+	}
+
+	if nil != grpcServer {
+		// wait for the in-flight gRPC calls until the ctx is done
+		if e := grpcServer.Shutdown(ctx); nil == err {
+			err = e
+		}
+	}
+
+	if nil != rpcLn {
+		rpcLn.Close()
+	}
+
+	p.routeTable.StopCheck()
+	return err
+}
+
+func (p *Proxy) isStopping() bool {
+	return atomic.LoadInt32(&p.stopping) == 1
+}
+
+func (p *Proxy) waitInFlight(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for atomic.LoadInt64(&p.inFlight) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// drainListener track the accepted connections to close them when the proxy stopped
+type drainListener struct {
+	net.Listener
+
+	sync.Mutex
+	conns map[*drainConn]struct{}
+}
+
+func newDrainListener(ln net.Listener) *drainListener {
+	return &drainListener{
+		Listener: ln,
+		conns:    make(map[*drainConn]struct{}),
+	}
+}
+
+func (l *drainListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if nil != err {
+		return nil, err
+	}
+
+	c := &drainConn{Conn: conn, ln: l}
+	l.Lock()
+	l.conns[c] = struct{}{}
+	l.Unlock()
+
+	return c, nil
+}
+
+func (l *drainListener) closeConns() {
+	l.Lock()
+	conns := make([]*drainConn, 0, len(l.conns))
+	for c := range l.conns {
+		conns = append(conns, c)
+	}
+	l.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+type drainConn struct {
+	net.Conn
+	ln   *drainListener
+	once sync.Once
+}
+
+func (c *drainConn) Close() error {
+	c.once.Do(func() {
+		c.ln.Lock()
+		delete(c.ln.conns, c)
+		c.ln.Unlock()
+	})
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStop(t *testing.T) {
+	received := make(chan struct{}, 1)
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.Addr = "127.0.0.1:0"
+	cnf.MgrAddr = "127.0.0.1:0"
+	p := newTestProxy(t, cnf, "", backend)
+
+	exited := make(chan struct{})
+	go func() {
+		p.Start()
+		close(exited)
+	}()
+
+	var addr string
+	for i := 0; i < 100 && "" == addr; i++ {
+		p.stopLock.Lock()
+		if nil != p.ln {
+			addr = p.ln.Addr().String()
+		}
+		p.stopLock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if "" == addr {
+		t.Fatalf("proxy not started")
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+	slow := make(chan result, 1)
+	go func() {
+		rsp, err := http.Get("http://" + addr + "/api")
+		if nil != err {
+			slow <- result{err: err}
+			return
+		}
+		defer rsp.Body.Close()
+
+		body, err := ioutil.ReadAll(rsp.Body)
+		slow <- result{body: string(body), err: err}
+	}()
+	<-received
+
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- p.Stop(ctx)
+	}()
+
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatalf("expect serve exited")
+	}
+
+	if conn, err := net.Dial("tcp", addr); nil == err {
+		conn.Close()
+		t.Errorf("expect new connection refused")
+	}
+
+	r := <-slow
+	if nil != r.err || "OK" != r.body {
+		t.Errorf("expect:<OK>, acture:<%s, %v>", r.body, r.err)
+	}
+
+	if err := <-stopped; nil != err {
+		t.Errorf("expect:<nil>, acture:<%s>", err)
+	}
+}
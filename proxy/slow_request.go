@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// logSlowRequest log the request slower than SlowRequestThreshold with the timing breakdown,
+// the total is from the beginAt to now, including the filters and the backend server.
+// The durations of each filter are logged if AccessLogFilterTimings is set.
+func (p *Proxy) logSlowRequest(c *FilterContext, beginAt time.Time) {
+	if p.config.SlowRequestThreshold <= 0 {
+		return
+	}
+
+	total := time.Since(beginAt)
+	if total < time.Duration(p.config.SlowRequestThreshold)*time.Millisecond {
+		return
+	}
+
+	var upstream time.Duration
+	if c.endAt > c.startAt {
+		upstream = time.Duration(c.endAt - c.startAt)
+	}
+
+	node, server := "", ""
+	if nil != c.result.Node {
+		node = c.result.Node.URL
+	}
+	if nil != c.result.Svr {
+		server = c.result.Svr.Addr
+	}
+
+	line := fmt.Sprintf("[%s] Slow request <%s %s>, node <%s>, server <%s>, total <%.3fms>, upstream <%.3fms>, filters <%.3fms>",
+		c.runtimeVar[requestIDRuntimeVar],
+		c.ctx.Method(),
+		c.ctx.URI().Path(),
+		node,
+		server,
+		durationMillis(total),
+		durationMillis(upstream),
+		durationMillis(total-upstream))
+
+	if len(c.timings) > 0 {
+		timings := make([]string, 0, len(c.timings))
+		for _, timing := range c.timings {
+			timings = append(timings, fmt.Sprintf("%s:%.3fms", timing.name, durationMillis(timing.duration)))
+		}
+		line = fmt.Sprintf("%s [%s]", line, strings.Join(timings, ","))
+	}
+
+	p.slowLogger.Warn(line)
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
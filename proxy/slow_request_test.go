@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+)
+
+// testLogBuffer the log writer shared by the goroutines of proxy
+type testLogBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *testLogBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *testLogBuffer) lines(substr string) []string {
+	b.Lock()
+	defer b.Unlock()
+
+	var lines []string
+	for _, line := range strings.Split(b.buf.String(), "\n") {
+		if strings.Contains(line, substr) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestSlowRequestLog(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(time.Millisecond * 100)
+		}
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.SlowRequestThreshold = 50
+	cnf.AccessLogFilterTimings = true
+	cnf.AccessLogSampleRate = 0.01
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterHeader)
+	p.RegistryFilter(FilterAccessLog)
+
+	buf := &testLogBuffer{}
+	p.slowLogger = log.New(buf, "")
+
+	ctx := doTestRequest(p, "GET", "/fast")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	if lines := buf.lines("Slow request"); len(lines) != 0 {
+		t.Errorf("expect:<0>, acture:<%v>", lines)
+	}
+
+	ctx = doTestRequest(p, "GET", "/slow")
+	if ctx.Response.StatusCode() != http.StatusOK {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusOK, ctx.Response.StatusCode())
+	}
+
+	lines := buf.lines("Slow request")
+	if len(lines) != 1 {
+		t.Fatalf("expect:<1>, acture:<%v>", lines)
+	}
+
+	for _, expect := range []string{"<GET /slow>", "server <" + backend.addr() + ">", "upstream <1", FilterHeader + ":"} {
+		if !strings.Contains(lines[0], expect) {
+			t.Errorf("expect:<%s>, acture:<%s>", expect, lines[0])
+		}
+	}
+
+	if !strings.Contains(lines[0], "[WARN]") {
+		t.Errorf("expect:<[WARN]>, acture:<%s>", lines[0])
+	}
+}
@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/fagongzi/gateway/conf"
+)
+
+const (
+	clientCNRuntimeVar  = "client.cn"
+	clientSANRuntimeVar = "client.san"
+)
+
+var (
+	tlsVersions = map[string]uint16{
+		"1.0": tls.VersionTLS10,
+		"1.1": tls.VersionTLS11,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	}
+)
+
+var (
+	// ErrInvalidClientCAFile the client CA file has no certificates
+	ErrInvalidClientCAFile = errors.New("invalid client CA file")
+)
+
+// newListener listen at the addr of proxy, the new connections are limited by ServerConnRateLimit before the tls,
+// the tls is terminated if the certificate is configured
+func (p *Proxy) newListener() (net.Listener, error) {
+	ln, err := net.Listen("tcp4", p.config.Addr)
+	if nil != err {
+		return nil, err
+	}
+
+	if p.config.ServerConnRateLimit > 0 {
+		ln = newConnRateLimitListener(ln, p.config.ServerConnRateLimit, p.config.ServerConnRateLimitBurst)
+	}
+
+	if "" == p.config.TLSCertFile {
+		return ln, nil
+	}
+
+	tlsConfig, err := newTLSConfig(p.config)
+	if nil != err {
+		ln.Close()
+		return nil, err
+	}
+
+	if "" == p.config.TLSClientCAFile {
+		return tls.NewListener(ln, tlsConfig), nil
+	}
+
+	p.clientConns = newClientConns()
+	return &clientCertListener{
+		Listener: tls.NewListener(ln, tlsConfig),
+		conns:    p.clientConns,
+	}, nil
+}
+
+// newTLSConfig create the tls config of inbound connections, the certificate is selected by the SNI of client
+func newTLSConfig(config *conf.Conf) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	certs := append([]conf.TLSCert{{CertFile: config.TLSCertFile, KeyFile: config.TLSKeyFile}}, config.TLSCerts...)
+	for _, c := range certs {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if nil != err {
+			return nil, err
+		}
+
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+
+	if "" != config.TLSMinVersion {
+		version, ok := tlsVersions[config.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls version: %s", config.TLSMinVersion)
+		}
+
+		tlsConfig.MinVersion = version
+	}
+
+	if len(config.TLSCipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+
+		for _, name := range config.TLSCipherSuites {
+			id, ok := suites[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown tls cipher suite: %s", name)
+			}
+
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+
+	if "" != config.TLSClientCAFile {
+		if err := setClientCAs(tlsConfig, config.TLSClientCAFile); nil != err {
+			return nil, err
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// setClientCAs require and verify the client certificates by the CA bundle
+func setClientCAs(tlsConfig *tls.Config, caFile string) error {
+	data, err := ioutil.ReadFile(caFile)
+	if nil != err {
+		return err
+	}
+
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(data) {
+		return ErrInvalidClientCAFile
+	}
+
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return nil
+}
+
+// setClientCertVars set the CN and SANs of the verified client certificate to the runtime vars
+func (p *Proxy) setClientCertVars(c *FilterContext) {
+	if nil == p.clientConns {
+		return
+	}
+
+	conn := p.clientConns.get(c.ctx.RemoteAddr().String())
+	if nil == conn {
+		return
+	}
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return
+	}
+
+	cert := certs[0]
+	sans := append([]string{}, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+
+	c.runtimeVar[clientCNRuntimeVar] = cert.Subject.CommonName
+	c.runtimeVar[clientSANRuntimeVar] = strings.Join(sans, ",")
+}
+
+// clientConns the accepted tls conns by the remote addr, the fasthttp handler only knows the remote addr
+type clientConns struct {
+	sync.RWMutex
+	conns map[string]*tls.Conn
+}
+
+func newClientConns() *clientConns {
+	return &clientConns{
+		conns: make(map[string]*tls.Conn),
+	}
+}
+
+func (cc *clientConns) add(conn *tls.Conn) {
+	cc.Lock()
+	cc.conns[conn.RemoteAddr().String()] = conn
+	cc.Unlock()
+}
+
+func (cc *clientConns) remove(conn *tls.Conn) {
+	cc.Lock()
+	if cc.conns[conn.RemoteAddr().String()] == conn {
+		delete(cc.conns, conn.RemoteAddr().String())
+	}
+	cc.Unlock()
+}
+
+func (cc *clientConns) get(addr string) *tls.Conn {
+	cc.RLock()
+	defer cc.RUnlock()
+	return cc.conns[addr]
+}
+
+type clientCertListener struct {
+	net.Listener
+	conns *clientConns
+}
+
+func (l *clientCertListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if nil != err {
+		return nil, err
+	}
+
+	tlsConn := conn.(*tls.Conn)
+	l.conns.add(tlsConn)
+	return &clientCertConn{Conn: tlsConn, conns: l.conns}, nil
+}
+
+type clientCertConn struct {
+	*tls.Conn
+	conns *clientConns
+	once  sync.Once
+}
+
+func (c *clientCertConn) Close() error {
+	c.once.Do(func() {
+		c.conns.remove(c.Conn)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,299 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+type testCert struct {
+	cert     *x509.Certificate
+	key      *rsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert create a certificate signed by the parent, self-signed if the parent is nil
+func newTestCert(t *testing.T, dir string, name string, parent *testCert, hosts ...string) *testCert {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if nil != err {
+		t.Fatalf("generate key err: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); nil != ip {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	signer, signerKey := template, key
+	if nil == parent {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if nil != err {
+		t.Fatalf("create cert err: %s", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+
+	ioutil.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	return c
+}
+
+func TestTLSTermination(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if nil != err {
+		t.Fatalf("create dir err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, dir, "ca", nil)
+	cert := newTestCert(t, dir, "gateway", ca, "127.0.0.1")
+	other := newTestCert(t, dir, "other", ca, "other.test")
+
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.Addr = "127.0.0.1:0"
+	cnf.TLSCertFile = cert.certFile
+	cnf.TLSKeyFile = cert.keyFile
+	cnf.TLSCerts = append(cnf.TLSCerts, conf.TLSCert{CertFile: other.certFile, KeyFile: other.keyFile})
+	cnf.TLSMinVersion = "1.2"
+	p := newTestProxy(t, cnf, "", backend)
+
+	ln, err := p.newListener()
+	if nil != err {
+		t.Fatalf("listen err: %s", err)
+	}
+	defer ln.Close()
+	go fasthttp.Serve(ln, p.ReverseProxyHandler)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	for _, serverName := range []string{"", "other.test"} {
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: serverName},
+			},
+		}
+
+		rsp, err := client.Get("https://" + ln.Addr().String() + "/api")
+		if nil != err {
+			t.Fatalf("%s request err: %s", serverName, err)
+		}
+
+		body, _ := ioutil.ReadAll(rsp.Body)
+		rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusOK || string(body) != "OK" {
+			t.Errorf("expect:<%d,OK>, acture:<%d,%s>", http.StatusOK, rsp.StatusCode, body)
+		}
+	}
+
+	// tls 1.1 is rejected
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS11})
+	if nil == err {
+		conn.Close()
+		t.Errorf("expect tls version error")
+	}
+}
+
+func TestTLSConfigError(t *testing.T) {
+	cnf := newTestConf()
+	cnf.TLSCertFile = "not-exists.crt"
+	if _, err := newTLSConfig(cnf); nil == err {
+		t.Errorf("expect load cert error")
+	}
+}
+
+func TestUpstreamTLS(t *testing.T) {
+	backend := newTestTLSBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.ServerName))
+	})
+	defer backend.Close()
+
+	file, err := ioutil.TempFile("", "ca")
+	if nil != err {
+		t.Fatalf("create file err: %s", err)
+	}
+	defer os.Remove(file.Name())
+	pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw})
+	file.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+
+	cases := []struct {
+		url  string
+		node *model.Node
+		code int
+		body string
+	}{
+		{url: "/ca", node: &model.Node{Scheme: model.SchemeHTTPS, CAFile: file.Name()}, code: http.StatusOK},
+		{url: "/sni", node: &model.Node{Scheme: model.SchemeHTTPS, CAFile: file.Name(), ServerName: "example.com"}, code: http.StatusOK, body: "example.com"},
+		{url: "/insecure", node: &model.Node{Scheme: model.SchemeHTTPS, InsecureSkipVerify: true}, code: http.StatusOK},
+		{url: "/unknown", node: &model.Node{Scheme: model.SchemeHTTPS}, code: http.StatusBadGateway},
+		{url: "/plain", node: &model.Node{}, code: http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		c.node.ClusterName = testClusterName
+		c.node.URL = c.url
+		p.routeTable.AddNewAggregation(model.NewAggregation("^"+c.url+"$", []*model.Node{c.node}))
+
+		ctx := doTestRequest(p, "GET", c.url)
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s expect:<%d>, acture:<%d>", c.url, c.code, ctx.Response.StatusCode())
+		}
+
+		if c.code == http.StatusOK && "" != c.body && string(ctx.Response.Body()) != c.body {
+			t.Errorf("%s expect:<%s>, acture:<%s>", c.url, c.body, ctx.Response.Body())
+		}
+	}
+
+	// the reloaded nodes of the same tls options reuse the conns
+	hosts := len(p.fastHTTPClient.hosts)
+	for _, c := range cases[:3] {
+		node := &model.Node{
+			ClusterName:        testClusterName,
+			URL:                c.url,
+			Scheme:             c.node.Scheme,
+			CAFile:             c.node.CAFile,
+			ServerName:         c.node.ServerName,
+			InsecureSkipVerify: c.node.InsecureSkipVerify,
+		}
+		p.routeTable.UpdateAggregation(model.NewAggregation("^"+c.url+"$", []*model.Node{node}))
+		doTestRequest(p, "GET", c.url)
+	}
+
+	if value := len(p.fastHTTPClient.hosts); value != hosts {
+		t.Errorf("expect:<%d>, acture:<%d>", hosts, value)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if nil != err {
+		t.Fatalf("create dir err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, dir, "ca", nil)
+	cert := newTestCert(t, dir, "gateway", ca, "127.0.0.1")
+	client := newTestCert(t, dir, "client", ca, "client.test")
+	otherCA := newTestCert(t, dir, "other-ca", nil)
+	other := newTestCert(t, dir, "other", otherCA, "other.test")
+
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Client-CN") + ";" + r.Header.Get("X-Client-SAN")))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.Addr = "127.0.0.1:0"
+	cnf.TLSCertFile = cert.certFile
+	cnf.TLSKeyFile = cert.keyFile
+	cnf.TLSClientCAFile = ca.certFile
+	p := newTestProxy(t, cnf, "", backend)
+	p.RegistryFilter(FilterHeaderRules)
+	p.routeTable.AddNewAggregation(model.NewAggregation("^/api$", []*model.Node{
+		&model.Node{
+			ClusterName: testClusterName,
+			URL:         "/api",
+			RequestHeaders: &model.HeaderRules{
+				Add: map[string]string{
+					"X-Client-CN":  "${client.cn}",
+					"X-Client-SAN": "${client.san}",
+				},
+			},
+		},
+	}))
+
+	ln, err := p.newListener()
+	if nil != err {
+		t.Fatalf("listen err: %s", err)
+	}
+	defer ln.Close()
+	go fasthttp.Serve(ln, p.ReverseProxyHandler)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	get := func(certs ...*testCert) (string, error) {
+		tlsConfig := &tls.Config{RootCAs: pool}
+		for _, c := range certs {
+			pair, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+			if nil != err {
+				t.Fatalf("load cert err: %s", err)
+			}
+			tlsConfig.Certificates = append(tlsConfig.Certificates, pair)
+		}
+
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		rsp, err := c.Get("https://" + ln.Addr().String() + "/api")
+		if nil != err {
+			return "", err
+		}
+		defer rsp.Body.Close()
+
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return string(body), nil
+	}
+
+	body, err := get(client)
+	if nil != err {
+		t.Fatalf("request err: %s", err)
+	}
+	if body != "client;client.test" {
+		t.Errorf("expect:<client;client.test>, acture:<%s>", body)
+	}
+
+	if _, err = get(other); nil == err {
+		t.Errorf("expect the cert of other CA is rejected")
+	}
+
+	if _, err = get(); nil == err {
+		t.Errorf("expect the request without cert is rejected")
+	}
+}
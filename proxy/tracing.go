@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerTraceParent = "traceparent"
+	headerTraceState  = "tracestate"
+
+	traceParentVersion = "00"
+	traceOperationName = "proxy"
+
+	// TagNode the span tag of node url
+	TagNode = "node"
+	// TagServer the span tag of backend server addr
+	TagServer = "server"
+	// TagStatusCode the span tag of backend server status code
+	TagStatusCode = "http.status_code"
+	// TagError the span tag of error
+	TagError = "error"
+)
+
+// SpanContext the W3C trace context
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	State   string
+}
+
+// TraceParent return the traceparent header value
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", traceParentVersion, hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), sc.Flags)
+}
+
+// Span the span of upstream call
+type Span interface {
+	Context() SpanContext
+	SetTag(key string, value interface{})
+	Finish()
+}
+
+// Tracer start the span of upstream call, implement it to report spans to the tracing system, e.g. jaeger
+type Tracer interface {
+	// StartSpan start a span, the parent is nil if the request has no trace context
+	StartSpan(operation string, parent *SpanContext) Span
+}
+
+// NewSpanContext create a span context with a new span id, the trace id is inherited from parent,
+// a new trace id is generated if parent is nil
+func NewSpanContext(parent *SpanContext) SpanContext {
+	sc := SpanContext{}
+
+	if nil != parent {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.State = parent.State
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+
+	rand.Read(sc.SpanID[:])
+	return sc
+}
+
+// propagationTracer only propagate the trace context, the spans are not reported
+type propagationTracer struct{}
+
+type propagationSpan struct {
+	sc SpanContext
+}
+
+func (t propagationTracer) StartSpan(operation string, parent *SpanContext) Span {
+	return &propagationSpan{sc: NewSpanContext(parent)}
+}
+
+func (s *propagationSpan) Context() SpanContext                 { return s.sc }
+func (s *propagationSpan) SetTag(key string, value interface{}) {}
+func (s *propagationSpan) Finish()                              {}
+
+// SetTracer set the tracer of upstream calls
+func (p *Proxy) SetTracer(tracer Tracer) {
+	p.tracer = tracer
+}
+
+// startSpan start the span of upstream call with the trace context of request,
+// and inject the context of span to the outreq
+func (p *Proxy) startSpan(c *FilterContext) Span {
+	if nil == p.tracer {
+		return nil
+	}
+
+	req := c.Request()
+	parent, ok := parseTraceParent(string(req.Header.Peek(headerTraceParent)))
+	if ok {
+		parent.State = string(req.Header.Peek(headerTraceState))
+	}
+
+	var span Span
+	if ok {
+		span = p.tracer.StartSpan(traceOperationName, &parent)
+	} else {
+		span = p.tracer.StartSpan(traceOperationName, nil)
+	}
+
+	sc := span.Context()
+	c.outreq.Header.Set(headerTraceParent, sc.TraceParent())
+	if "" != sc.State {
+		c.outreq.Header.Set(headerTraceState, sc.State)
+	} else {
+		c.outreq.Header.Del(headerTraceState)
+	}
+
+	return span
+}
+
+func (p *Proxy) finishSpan(span Span, c *FilterContext, res *fasthttp.Response, err error) {
+	if nil == span {
+		return
+	}
+
+	if nil != c.result.Node {
+		span.SetTag(TagNode, c.result.Node.URL)
+	}
+
+	span.SetTag(TagServer, c.result.Svr.Addr)
+
+	if nil != res {
+		span.SetTag(TagStatusCode, res.StatusCode())
+	}
+
+	if nil != err {
+		span.SetTag(TagError, err.Error())
+	}
+
+	span.Finish()
+}
+
+// parseTraceParent parse the traceparent header: version-traceid-spanid-flags
+func parseTraceParent(value string) (SpanContext, bool) {
+	sc := SpanContext{}
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == traceParentVersion && len(parts) != 4) {
+		return sc, false
+	}
+
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) {
+		return sc, false
+	}
+
+	var flags [1]byte
+	if !decodeHex(flags[:], parts[3]) {
+		return sc, false
+	}
+	sc.Flags = flags[0]
+
+	if sc.TraceID == [16]byte{} || sc.SpanID == [8]byte{} {
+		return sc, false
+	}
+
+	return sc, true
+}
+
+func decodeHex(dst []byte, value string) bool {
+	if len(value) != hex.EncodedLen(len(dst)) || strings.ToLower(value) != value {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(value))
+	return nil == err
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+type mockSpan struct {
+	sc       SpanContext
+	parent   *SpanContext
+	tags     map[string]interface{}
+	finished bool
+}
+
+func (s *mockSpan) Context() SpanContext                 { return s.sc }
+func (s *mockSpan) SetTag(key string, value interface{}) { s.tags[key] = value }
+func (s *mockSpan) Finish()                              { s.finished = true }
+
+type mockTracer struct {
+	sync.Mutex
+	spans []*mockSpan
+}
+
+func (t *mockTracer) StartSpan(operation string, parent *SpanContext) Span {
+	t.Lock()
+	defer t.Unlock()
+
+	span := &mockSpan{
+		sc:     NewSpanContext(parent),
+		parent: parent,
+		tags:   make(map[string]interface{}),
+	}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func TestTracingPropagation(t *testing.T) {
+	var traceParent, traceState string
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get(headerTraceParent)
+		traceState = r.Header.Get(headerTraceState)
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	tracer := &mockTracer{}
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.SetTracer(tracer)
+
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/api")
+	req.Header.SetHost("gateway")
+	req.Header.Set(headerTraceParent, incoming)
+	req.Header.Set(headerTraceState, "vendor=value")
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, nil, nil)
+	p.ReverseProxyHandler(ctx)
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("expect:<1>, acture:<%d>", len(tracer.spans))
+	}
+
+	span := tracer.spans[0]
+	if nil == span.parent || span.parent.TraceParent() != incoming {
+		t.Errorf("expect:<%s>, acture:<%+v>", incoming, span.parent)
+	}
+
+	if !span.finished {
+		t.Errorf("expect span finished")
+	}
+
+	if span.tags[TagServer] != backend.addr() || span.tags[TagStatusCode] != http.StatusOK {
+		t.Errorf("expect:<%s,%d>, acture:<%v,%v>", backend.addr(), http.StatusOK, span.tags[TagServer], span.tags[TagStatusCode])
+	}
+
+	if traceParent != span.sc.TraceParent() {
+		t.Errorf("expect:<%s>, acture:<%s>", span.sc.TraceParent(), traceParent)
+	}
+
+	if !strings.HasPrefix(traceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || strings.HasSuffix(traceParent, "-00f067aa0ba902b7-01") {
+		t.Errorf("expect same trace id with new span id, acture:<%s>", traceParent)
+	}
+
+	if traceState != "vendor=value" {
+		t.Errorf("expect:<vendor=value>, acture:<%s>", traceState)
+	}
+}
+
+func TestTracingNewTrace(t *testing.T) {
+	var traceParent string
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get(headerTraceParent)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer backend.Close()
+
+	tracer := &mockTracer{}
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.SetTracer(tracer)
+
+	doTestRequest(p, "GET", "/api")
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("expect:<1>, acture:<%d>", len(tracer.spans))
+	}
+
+	span := tracer.spans[0]
+	if nil != span.parent {
+		t.Errorf("expect nil parent, acture:<%+v>", span.parent)
+	}
+
+	if span.tags[TagStatusCode] != http.StatusInternalServerError {
+		t.Errorf("expect:<%d>, acture:<%v>", http.StatusInternalServerError, span.tags[TagStatusCode])
+	}
+
+	sc, ok := parseTraceParent(traceParent)
+	if !ok || sc.TraceID != span.sc.TraceID {
+		t.Errorf("expect:<%s>, acture:<%s>", hex.EncodeToString(span.sc.TraceID[:]), traceParent)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	cases := map[string]bool{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":    true,
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xx": true,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-xx": false,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":    false,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":    false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":    false,
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":    false,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7":       false,
+		"": false,
+	}
+
+	for value, expect := range cases {
+		if _, ok := parseTraceParent(value); ok != expect {
+			t.Errorf("%s expect:<%v>, acture:<%v>", value, expect, ok)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// originPathUserValue the path of client before the trailing slash normalization
+	originPathUserValue = "gateway.originPath"
+)
+
+// normalizeTrailingSlash normalize the trailing slash of the request path by TrailingSlash before matching,
+// returns true if the client is redirected to the normalized path
+func (p *Proxy) normalizeTrailingSlash(ctx *fasthttp.RequestCtx) bool {
+	mode := p.config.TrailingSlash
+	if "" == mode || model.TrailingSlashKeep == mode {
+		return false
+	}
+
+	path := string(ctx.URI().Path())
+	normalized := model.NormalizeTrailingSlash(path, mode)
+	if normalized == path {
+		return false
+	}
+
+	if !p.config.TrailingSlashRedirect {
+		ctx.SetUserValue(originPathUserValue, path)
+		ctx.URI().SetPath(normalized)
+		return false
+	}
+
+	location := normalized
+	if query := ctx.URI().QueryString(); len(query) > 0 {
+		location += "?" + string(query)
+	}
+
+	// the method and body of the others are kept by 308
+	code := http.StatusPermanentRedirect
+	if ctx.IsGet() || ctx.IsHead() {
+		code = http.StatusMovedPermanently
+	}
+
+	ctx.Response.Header.Set(headerLocation, location)
+	ctx.SetStatusCode(code)
+	return true
+}
+
+// normalizeNodeTrailingSlash normalize the trailing slash of the path forwarded to the node by the node,
+// the keep restores the trailing slash of client changed by the global normalization
+func normalizeNodeTrailingSlash(ctx *fasthttp.RequestCtx, outreq *fasthttp.Request, node *model.Node) {
+	if nil == node || "" == node.TrailingSlash {
+		return
+	}
+
+	mode := node.TrailingSlash
+	if model.TrailingSlashKeep == mode {
+		origin, ok := ctx.UserValue(originPathUserValue).(string)
+		if !ok {
+			return
+		}
+
+		mode = model.TrailingSlashStrip
+		if strings.HasSuffix(origin, "/") {
+			mode = model.TrailingSlashAdd
+		}
+	}
+
+	path := string(outreq.URI().Path())
+	if normalized := model.NormalizeTrailingSlash(path, mode); normalized != path {
+		outreq.URI().SetPath(normalized)
+	}
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestTrailingSlash(t *testing.T) {
+	var received atomic.Value
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.URL.RequestURI())
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cases := []struct {
+		mode   string
+		uri    string
+		expect string
+	}{
+		{mode: model.TrailingSlashStrip, uri: "/users/?page=1", expect: "/users?page=1"},
+		{mode: model.TrailingSlashStrip, uri: "/", expect: "/"},
+		{mode: model.TrailingSlashAdd, uri: "/users?page=1", expect: "/users/?page=1"},
+		{mode: model.TrailingSlashAdd, uri: "/static/app.js", expect: "/static/app.js"},
+		{mode: "", uri: "/users/", expect: "/users/"},
+		// the node keep the trailing slash of client
+		{mode: model.TrailingSlashStrip, uri: "/legacy/items/", expect: "/items/"},
+		{mode: model.TrailingSlashAdd, uri: "/legacy/items", expect: "/items"},
+	}
+
+	for _, c := range cases {
+		cnf := newTestConf()
+		cnf.TrailingSlash = c.mode
+		p := newTestProxy(t, cnf, "", backend)
+		p.routeTable.AddNewAggregation(model.NewAggregation("^/legacy/", []*model.Node{
+			&model.Node{ClusterName: testClusterName, StripPrefix: "/legacy", TrailingSlash: model.TrailingSlashKeep},
+		}))
+
+		ctx := doTestRequest(p, "GET", c.uri)
+		if ctx.Response.StatusCode() != http.StatusOK {
+			t.Errorf("%s %s expect:<%d>, acture:<%d>", c.mode, c.uri, http.StatusOK, ctx.Response.StatusCode())
+		}
+
+		if value := received.Load(); value != c.expect {
+			t.Errorf("%s %s expect:<%s>, acture:<%v>", c.mode, c.uri, c.expect, value)
+		}
+	}
+}
+
+func TestTrailingSlashRedirect(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	defer backend.Close()
+
+	cnf := newTestConf()
+	cnf.TrailingSlash = model.TrailingSlashStrip
+	cnf.TrailingSlashRedirect = true
+	p := newTestProxy(t, cnf, "", backend)
+
+	cases := []struct {
+		method   string
+		uri      string
+		code     int
+		location string
+	}{
+		{method: "GET", uri: "/users/?page=1", code: http.StatusMovedPermanently, location: "/users?page=1"},
+		{method: "POST", uri: "/users/", code: http.StatusPermanentRedirect, location: "/users"},
+		{method: "GET", uri: "/users", code: http.StatusOK},
+	}
+
+	for _, c := range cases {
+		requests := atomic.LoadInt32(&backend.requests)
+
+		ctx := doTestRequest(p, c.method, c.uri)
+		if ctx.Response.StatusCode() != c.code {
+			t.Errorf("%s %s expect:<%d>, acture:<%d>", c.method, c.uri, c.code, ctx.Response.StatusCode())
+		}
+
+		if location := string(ctx.Response.Header.Peek(headerLocation)); location != c.location {
+			t.Errorf("%s %s expect:<%s>, acture:<%s>", c.method, c.uri, c.location, location)
+		}
+
+		forwarded := atomic.LoadInt32(&backend.requests) - requests
+		if expect := "" == c.location; (forwarded == 1) != expect {
+			t.Errorf("%s %s expect forwarded:<%v>, acture:<%d>", c.method, c.uri, expect, forwarded)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/CodisLabs/codis/pkg/utils/log"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	upgradeWebSocket = []byte("websocket")
+)
+
+func isWebSocket(req *fasthttp.Request) bool {
+	return req.Header.ConnectionUpgrade() && bytes.EqualFold(req.Header.Peek("Upgrade"), upgradeWebSocket)
+}
+
+// doWebSocket send the handshake request to the result server, and tunnel
+// the bytes between client and server after upgraded.
+func (p *Proxy) doWebSocket(ctx *fasthttp.RequestCtx, result *model.RouteResult) {
+	defer result.Release()
+
+	svr := result.Svr
+	if nil == svr {
+		p.writeError(ctx, result.Node, p.getFailureStatusCode(ErrNoServer, nil), ErrNoServer)
+		return
+	}
+
+	outreq, err := p.newOutRequest(ctx, result)
+	if nil != err {
+		log.WarnErrorf(err, "[%s] Proxy rewrite <%s> fail", result.RequestID, string(ctx.URI().RequestURI()))
+		p.writeError(ctx, result.Node, http.StatusBadRequest, err)
+		return
+	}
+	defer fasthttp.ReleaseRequest(outreq)
+
+	c := &FilterContext{
+		ctx:        ctx,
+		outreq:     outreq,
+		result:     result,
+		rb:         p.routeTable,
+		runtimeVar: make(map[string]string),
+		webSocket:  true,
+	}
+	defer c.done()
+	p.setClientCertVars(c)
+	setCanaryVars(c)
+	setPathParamVars(c)
+
+	// pre filters
+	filterName, code, err := p.doPreFilters(c)
+	if nil != err {
+		log.WarnErrorf(err, "Proxy Filter-Pre<%s> fail", filterName)
+		p.writeError(ctx, result.Node, code, err)
+		return
+	}
+
+	tlsConfig, err := getTLSConfig(result)
+	if nil != err {
+		log.WarnErrorf(err, "Proxy websocket tls config fail")
+		p.writeError(ctx, result.Node, p.getFailureStatusCode(err, nil), err)
+		return
+	}
+
+	if !svr.CircuitAllow() {
+		err = getCircuitErr(svr)
+		log.InfoErrorf(err, "Proxy websocket fail <%s>", svr.Addr)
+		p.writeError(ctx, result.Node, p.getFailureStatusCode(err, nil), err)
+		return
+	}
+
+	c.startAt = time.Now().UnixNano()
+	conn, br, res, err := p.handshake(outreq, svr.Addr, tlsConfig, p.getDeadline(result))
+	c.endAt = time.Now().UnixNano()
+
+	result.Res = res
+	recordCircuit(svr, res, err)
+
+	if nil != err || res.StatusCode() != fasthttp.StatusSwitchingProtocols {
+		if nil != err {
+			log.InfoErrorf(err, "Proxy websocket fail <%s>", svr.Addr)
+		} else {
+			log.Infof("Proxy websocket fail <%s>, Code <%d>", svr.Addr, res.StatusCode())
+			conn.Close()
+		}
+
+		if nil != err || res.StatusCode() >= fasthttp.StatusInternalServerError {
+			p.doPostErrFilters(c)
+		}
+
+		p.writeError(ctx, result.Node, p.getFailureStatusCode(err, res), err)
+		return
+	}
+
+	// post filters
+	filterName, code, err = p.doPostFilters(c)
+	if nil != err {
+		log.InfoErrorf(err, "Proxy Filter-Post<%s> fail: %s ", filterName, err.Error())
+		conn.Close()
+		p.writeError(ctx, result.Node, code, err)
+		return
+	}
+
+	res.Header.CopyTo(&ctx.Response.Header)
+
+	svr.IncrActiveConns()
+	ctx.Hijack(func(client net.Conn) {
+		p.tunnel(client, conn, br, svr)
+	})
+}
+
+// handshake send the websocket handshake request to addr, and read the response header.
+// The returned conn and reader are used by the tunnel if the server upgraded.
+func (p *Proxy) handshake(req *fasthttp.Request, addr string, tlsConfig *tls.Config, deadline time.Time) (net.Conn, *bufio.Reader, *fasthttp.Response, error) {
+	res := fasthttp.AcquireResponse()
+
+	conn, err := dialAddr(addr, tlsConfig)
+	if nil != err {
+		return nil, nil, res, err
+	}
+
+	if !deadline.IsZero() {
+		conn.SetDeadline(deadline)
+	}
+
+	br := bufio.NewReaderSize(conn, p.config.ReadBufferSize)
+	bw := bufio.NewWriterSize(conn, p.config.WriteBufferSize)
+
+	err = req.Write(bw)
+	if nil == err {
+		err = bw.Flush()
+	}
+	if nil == err {
+		err = res.Header.Read(br)
+	}
+	if nil != err {
+		conn.Close()
+		if isTimeout(err) {
+			err = fasthttp.ErrTimeout
+		}
+		return nil, nil, res, err
+	}
+
+	// the tunnel has no deadline
+	conn.SetDeadline(time.Time{})
+	return conn, br, res, nil
+}
+
+// tunnel copy bytes between client and server, both directions are closed if either side closed.
+func (p *Proxy) tunnel(client net.Conn, backend net.Conn, br *bufio.Reader, svr *model.Server) {
+	startAt := time.Now()
+	errCh := make(chan error, 2)
+
+	go func() {
+		_, err := io.Copy(backend, client)
+		errCh <- err
+	}()
+
+	go func() {
+		_, err := io.Copy(client, br)
+		errCh <- err
+	}()
+
+	<-errCh
+
+	// the hijacked client conn is closed by fasthttp after tunnel returned,
+	// so use the deadline to stop reading from client.
+	backend.Close()
+	client.SetDeadline(time.Now())
+
+	<-errCh
+
+	svr.DecrActiveConns()
+	log.Infof("Proxy websocket <%s> closed, duration <%s>", svr.Addr, time.Since(startAt))
+}
@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testWebSocketKey = "dGhlIHNhbXBsZSBub25jZQ=="
+)
+
+func webSocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// newEchoWebSocketBackend upgrade the request, and echo the bytes until client closed
+func newEchoWebSocketBackend(done chan struct{}) *testBackend {
+	return newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if nil != err {
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		rw.WriteString("Upgrade: websocket\r\n")
+		rw.WriteString("Connection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + webSocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		rw.Flush()
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := rw.Read(buf)
+			if nil != err {
+				return
+			}
+
+			conn.Write(buf[:n])
+		}
+	})
+}
+
+func TestWebSocket(t *testing.T) {
+	done := make(chan struct{})
+	backend := newEchoWebSocketBackend(done)
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	p.RegistryFilter(FilterHeader)
+	ln := startTestProxy(t, p)
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if nil != err {
+		t.Fatalf("dial err: %s", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\n" +
+		"Host: gateway\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + testWebSocketKey + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"))
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if nil != err {
+		t.Fatalf("read handshake response err: %s", err)
+	}
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expect:<%d>, acture:<%d>", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+
+	if upgrade := res.Header.Get("Upgrade"); upgrade != "websocket" {
+		t.Errorf("expect:<websocket>, acture:<%s>", upgrade)
+	}
+
+	if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != webSocketAccept(testWebSocketKey) {
+		t.Errorf("expect:<%s>, acture:<%s>", webSocketAccept(testWebSocketKey), accept)
+	}
+
+	// a masked text frame with payload "hello"
+	frame := []byte{0x81, 0x85, 0x01, 0x02, 0x03, 0x04, 'h' ^ 0x01, 'e' ^ 0x02, 'l' ^ 0x03, 'l' ^ 0x04, 'o' ^ 0x01}
+	for i := 0; i < 2; i++ {
+		conn.Write(frame)
+
+		echo := make([]byte, len(frame))
+		if _, err = io.ReadFull(br, echo); nil != err || string(echo) != string(frame) {
+			t.Errorf("expect:<%v>, acture:<%v>, err:<%v>", frame, echo, err)
+		}
+	}
+
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 2):
+		t.Errorf("expect backend conn closed after client closed")
+	}
+}
+
+func TestWebSocketWithBackendClose(t *testing.T) {
+	backend := newTestBackend(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if nil != err {
+			return
+		}
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		rw.WriteString("Upgrade: websocket\r\n")
+		rw.WriteString("Connection: Upgrade\r\n\r\n")
+		rw.Flush()
+		conn.Close()
+	})
+	defer backend.Close()
+
+	p := newTestProxy(t, newTestConf(), "", backend)
+	ln := startTestProxy(t, p)
+	defer ln.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if nil != err {
+		t.Fatalf("dial err: %s", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("GET /ws HTTP/1.1\r\n" +
+		"Host: gateway\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n\r\n"))
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	if nil != err || res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expect:<%d>, acture:<%v>, err:<%v>", http.StatusSwitchingProtocols, res, err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second * 2))
+	if _, err = br.ReadByte(); err != io.EOF {
+		t.Errorf("expect:<%v>, acture:<%v>", io.EOF, err)
+	}
+}